@@ -0,0 +1,303 @@
+package main
+
+import (
+	"bufio"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+
+	"macurate/validation"
+)
+
+// Admin is an admin account. Passwords are only stored as bcrypt hashes.
+type Admin struct {
+	ID        int
+	Username  string
+	CreatedAt time.Time
+	Current   bool
+}
+
+const minAdminPasswordLength = 8
+
+var errUsernameTaken = errors.New("username already taken")
+
+func createAdminTables() error {
+	_, err := db.Exec(`
+    CREATE TABLE IF NOT EXISTS admins (
+        id SERIAL PRIMARY KEY,
+        username TEXT NOT NULL UNIQUE,
+        password_hash TEXT NOT NULL,
+        created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+    );
+    ALTER TABLE admin_sessions ADD COLUMN IF NOT EXISTS admin_id INTEGER REFERENCES admins(id) ON DELETE CASCADE;
+    DELETE FROM admin_sessions WHERE admin_id IS NULL;
+    `)
+	return err
+}
+
+func hashAdminPassword(password string) (string, error) {
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	return string(hash), err
+}
+
+func createAdmin(username, password string) (int, error) {
+	hash, err := hashAdminPassword(password)
+	if err != nil {
+		return 0, err
+	}
+	var id int
+	err = db.QueryRow(`
+        INSERT INTO admins (username, password_hash) VALUES ($1, $2)
+        ON CONFLICT (username) DO NOTHING
+        RETURNING id`, username, hash).Scan(&id)
+	if err == sql.ErrNoRows {
+		return 0, errUsernameTaken
+	}
+	return id, err
+}
+
+func setAdminPassword(id int, password string) error {
+	hash, err := hashAdminPassword(password)
+	if err != nil {
+		return err
+	}
+	_, err = db.Exec("UPDATE admins SET password_hash = $2 WHERE id = $1", id, hash)
+	return err
+}
+
+// Hash compared against when the username is unknown, so a miss costs the
+// same bcrypt work as a wrong password
+var dummyAdminHash, _ = bcrypt.GenerateFromPassword([]byte("macurate-dummy"), bcrypt.DefaultCost)
+
+// The admin id for a username and password, or false
+func verifyAdmin(username, password string) (int, bool, error) {
+	var id int
+	var hash string
+	err := db.QueryRow("SELECT id, password_hash FROM admins WHERE username = $1", username).Scan(&id, &hash)
+	if err == sql.ErrNoRows {
+		bcrypt.CompareHashAndPassword(dummyAdminHash, []byte(password))
+		return 0, false, nil
+	} else if err != nil {
+		return 0, false, err
+	}
+	if bcrypt.CompareHashAndPassword([]byte(hash), []byte(password)) != nil {
+		return 0, false, nil
+	}
+	return id, true, nil
+}
+
+func listAdmins(currentID int) ([]Admin, error) {
+	rows, err := db.Query("SELECT id, username, created_at FROM admins ORDER BY username")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var list []Admin
+	for rows.Next() {
+		var a Admin
+		if err := rows.Scan(&a.ID, &a.Username, &a.CreatedAt); err != nil {
+			return nil, err
+		}
+		a.Current = a.ID == currentID
+		list = append(list, a)
+	}
+	return list, rows.Err()
+}
+
+// The admin account behind this request's session
+func currentAdminID(r *http.Request) (int, bool) {
+	sessionID, ok := currentAdminSession(r)
+	if !ok {
+		return 0, false
+	}
+	var id int
+	if err := db.QueryRowContext(r.Context(), "SELECT admin_id FROM admin_sessions WHERE id = $1", sessionID).Scan(&id); err != nil {
+		return 0, false
+	}
+	return id, true
+}
+
+// Seed the first account from ADMIN_PASSWORD (as user "admin") when there
+// are no admins yet, so existing deployments keep working after upgrading.
+func bootstrapAdminFromEnv() error {
+	var n int
+	if err := db.QueryRow("SELECT COUNT(*) FROM admins").Scan(&n); err != nil {
+		return err
+	}
+	if n > 0 {
+		return nil
+	}
+	password := serverCfg.AdminPassword
+	if password == "" {
+		slog.Warn("no admin accounts yet; open /setup or run: macurate create-admin <username>")
+		return nil
+	}
+	if _, err := createAdmin("admin", password); err != nil {
+		return err
+	}
+	slog.Info(`created admin account "admin" from ADMIN_PASSWORD; the variable is no longer needed`)
+	return nil
+}
+
+// `macurate create-admin <username>`: read the password from stdin and
+// create the account
+func runCreateAdmin(args []string) error {
+	if len(args) != 1 || strings.TrimSpace(args[0]) == "" {
+		return errors.New("usage: macurate create-admin <username>")
+	}
+	password, err := readAdminPassword()
+	if err != nil {
+		return err
+	}
+	if _, err := createAdmin(strings.TrimSpace(args[0]), password); err != nil {
+		return err
+	}
+	fmt.Fprintf(os.Stderr, "created admin %q\n", args[0])
+	return nil
+}
+
+// `macurate reset-password <username>`: set a new password from stdin and
+// sign the account out everywhere, for when nobody can log in any more
+func runResetPassword(args []string) error {
+	if len(args) != 1 || strings.TrimSpace(args[0]) == "" {
+		return errors.New("usage: macurate reset-password <username>")
+	}
+	username := strings.TrimSpace(args[0])
+	var id int
+	err := db.QueryRow("SELECT id FROM admins WHERE username = $1", username).Scan(&id)
+	if err == sql.ErrNoRows {
+		return fmt.Errorf("no admin named %q", username)
+	} else if err != nil {
+		return err
+	}
+	password, err := readAdminPassword()
+	if err != nil {
+		return err
+	}
+	if err := setAdminPassword(id, password); err != nil {
+		return err
+	}
+	if _, err := db.Exec("DELETE FROM admin_sessions WHERE admin_id = $1", id); err != nil {
+		return err
+	}
+	fmt.Fprintf(os.Stderr, "password for %q reset; existing sessions were signed out\n", username)
+	return nil
+}
+
+// A password line from stdin, so it stays out of shell history
+func readAdminPassword() (string, error) {
+	fmt.Fprint(os.Stderr, "Password: ")
+	line, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	if err != nil && line == "" {
+		return "", err
+	}
+	password := strings.TrimRight(line, "\r\n")
+	if len(password) < minAdminPasswordLength {
+		return "", fmt.Errorf("password must be at least %d characters", minAdminPasswordLength)
+	}
+	return password, nil
+}
+
+// Admin accounts page (admin-only): add or remove admins and change one's
+// own password
+func adminAccountsHandler(w http.ResponseWriter, r *http.Request) {
+	currentID, ok := currentAdminID(r)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	var errs validation.Errors
+	notice := ""
+	if r.Method == http.MethodPost {
+		var req adminAccountRequest
+		if errs = bindAdminForm(r, &req); errs == nil {
+			errs, notice = applyAdminAccountAction(r, currentID, req)
+		}
+		if errs == nil && notice == "" {
+			http.Redirect(w, r, "/admin/accounts", http.StatusSeeOther)
+			return
+		}
+		if errs != nil {
+			w.WriteHeader(http.StatusBadRequest)
+		}
+	}
+
+	admins, err := listAdmins(currentID)
+	if err != nil {
+		serverError(w, r, err)
+		return
+	}
+	tmpl := parseTemplates("templates/accounts.html")
+	data := map[string]interface{}{
+		"Admins": admins,
+		"Errors": errs,
+		"Notice": notice,
+	}
+	if err := tmpl.Execute(w, data); err != nil {
+		serverError(w, r, err)
+	}
+}
+
+func applyAdminAccountAction(r *http.Request, currentID int, req adminAccountRequest) (validation.Errors, string) {
+	switch req.Action {
+	case "create":
+		if req.Username == "" {
+			return validation.Errors{"username": "is required"}, ""
+		}
+		password := r.PostFormValue("password")
+		if len(password) < minAdminPasswordLength {
+			return validation.Errors{"password": fmt.Sprintf("must be at least %d characters", minAdminPasswordLength)}, ""
+		}
+		if _, err := createAdmin(req.Username, password); err == errUsernameTaken {
+			return validation.Errors{"username": "is already taken"}, ""
+		} else if err != nil {
+			return validation.Errors{"form": err.Error()}, ""
+		}
+		return nil, "Admin " + req.Username + " created."
+	case "delete":
+		if req.ID == currentID {
+			return validation.Errors{"id": "cannot delete your own account"}, ""
+		}
+		if _, err := db.ExecContext(r.Context(), "DELETE FROM admins WHERE id = $1", req.ID); err != nil {
+			return validation.Errors{"form": err.Error()}, ""
+		}
+	case "password":
+		start := time.Now()
+		var username string
+		if err := db.QueryRowContext(r.Context(), "SELECT username FROM admins WHERE id = $1", currentID).Scan(&username); err != nil {
+			return validation.Errors{"form": err.Error()}, ""
+		}
+		if _, ok, err := verifyAdmin(username, r.PostFormValue("current_password")); err != nil {
+			return validation.Errors{"form": err.Error()}, ""
+		} else if !ok {
+			delayAuthFailure(start)
+			return validation.Errors{"current_password": "is wrong"}, ""
+		}
+		password := r.PostFormValue("password")
+		if len(password) < minAdminPasswordLength {
+			return validation.Errors{"password": fmt.Sprintf("must be at least %d characters", minAdminPasswordLength)}, ""
+		}
+		if password != r.PostFormValue("confirm") {
+			return validation.Errors{"confirm": "does not match"}, ""
+		}
+		if err := setAdminPassword(currentID, password); err != nil {
+			return validation.Errors{"form": err.Error()}, ""
+		}
+		// Other browsers logged in as this admin have to log in again
+		sessionID, _ := currentAdminSession(r)
+		if _, err := db.ExecContext(r.Context(), "DELETE FROM admin_sessions WHERE admin_id = $1 AND id <> $2", currentID, sessionID); err != nil {
+			return validation.Errors{"form": err.Error()}, ""
+		}
+		return nil, "Password changed."
+	}
+	return nil, ""
+}
@@ -0,0 +1,142 @@
+package main
+
+import (
+	"context"
+	"math"
+	"net/http"
+	"time"
+
+	"macurate/validation"
+)
+
+// Participation numbers for organizers, as aggregates only: no voter ids
+// or names leave the database. Voters are told apart by their voter id, so
+// votes cast where the cookie was declined each count as a voter of their
+// own. Days are UTC.
+
+type analyticsDay struct {
+	Date   string `json:"date"` // YYYY-MM-DD
+	Voters int    `json:"voters"`
+	Votes  int    `json:"votes"`
+}
+
+type analyticsBucket struct {
+	Votes  string `json:"votes"` // "1", "3-5", "21+"
+	Voters int    `json:"voters"`
+}
+
+type analyticsVoters struct {
+	Total        int               `json:"total"`
+	Votes        int               `json:"votes"`
+	MedianVotes  float64           `json:"median_votes"`
+	Distribution []analyticsBucket `json:"distribution"`
+}
+
+type analyticsPeople struct {
+	Total            int     `json:"total"`
+	WithZeroVotes    int     `json:"with_zero_votes"`
+	ZeroVotesPercent float64 `json:"zero_votes_percent"`
+	Comments         int     `json:"comments"`
+	MedianComments   float64 `json:"median_comments"`
+}
+
+type analyticsReport struct {
+	Days        int             `json:"days"`
+	GeneratedAt time.Time       `json:"generated_at"`
+	Daily       []analyticsDay  `json:"daily"`
+	Voters      analyticsVoters `json:"voters"`
+	People      analyticsPeople `json:"people"`
+}
+
+func loadAnalytics(ctx context.Context, days int) (analyticsReport, error) {
+	rep := analyticsReport{Days: days, GeneratedAt: time.Now().UTC(), Daily: []analyticsDay{}}
+
+	rows, err := db.QueryContext(ctx, `
+        WITH span AS (SELECT (NOW() AT TIME ZONE 'UTC')::date - ($1::int - 1) AS first)
+        SELECT to_char(d, 'YYYY-MM-DD'), COUNT(DISTINCT v.voter_id), COUNT(v.id)
+        FROM span, generate_series(span.first::timestamp, (NOW() AT TIME ZONE 'UTC')::date::timestamp, INTERVAL '1 day') d
+        LEFT JOIN votes v ON v.upvote IS NOT NULL
+             AND v.created_at >= span.first AT TIME ZONE 'UTC'
+             AND (v.created_at AT TIME ZONE 'UTC')::date = d::date
+        GROUP BY d
+        ORDER BY d`, days)
+	if err != nil {
+		return rep, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var d analyticsDay
+		if err := rows.Scan(&d.Date, &d.Voters, &d.Votes); err != nil {
+			return rep, err
+		}
+		rep.Daily = append(rep.Daily, d)
+	}
+	if err := rows.Err(); err != nil {
+		return rep, err
+	}
+
+	counts := make([]int, 6)
+	err = db.QueryRowContext(ctx, `
+        WITH per AS (
+            SELECT COUNT(*) AS n FROM votes
+            WHERE upvote IS NOT NULL AND voter_id IS NOT NULL
+            GROUP BY voter_id
+        )
+        SELECT COUNT(*), COALESCE(SUM(n), 0), COALESCE(percentile_cont(0.5) WITHIN GROUP (ORDER BY n), 0),
+               COUNT(*) FILTER (WHERE n = 1),
+               COUNT(*) FILTER (WHERE n = 2),
+               COUNT(*) FILTER (WHERE n BETWEEN 3 AND 5),
+               COUNT(*) FILTER (WHERE n BETWEEN 6 AND 10),
+               COUNT(*) FILTER (WHERE n BETWEEN 11 AND 20),
+               COUNT(*) FILTER (WHERE n > 20)
+        FROM per`).Scan(&rep.Voters.Total, &rep.Voters.Votes, &rep.Voters.MedianVotes,
+		&counts[0], &counts[1], &counts[2], &counts[3], &counts[4], &counts[5])
+	if err != nil {
+		return rep, err
+	}
+	for i, label := range []string{"1", "2", "3-5", "6-10", "11-20", "21+"} {
+		rep.Voters.Distribution = append(rep.Voters.Distribution, analyticsBucket{Votes: label, Voters: counts[i]})
+	}
+
+	err = db.QueryRowContext(ctx, `
+        WITH per AS (
+            SELECT COUNT(v.id) AS votes,
+                   COUNT(v.id) FILTER (WHERE COALESCE(TRIM(v.comment), '') <> '' AND v.status = 'approved') AS comments
+            FROM people p LEFT JOIN votes v ON v.person_id = p.id AND v.upvote IS NOT NULL
+            GROUP BY p.id
+        )
+        SELECT COUNT(*), COUNT(*) FILTER (WHERE votes = 0), COALESCE(SUM(comments), 0),
+               COALESCE(percentile_cont(0.5) WITHIN GROUP (ORDER BY comments), 0)
+        FROM per`).Scan(&rep.People.Total, &rep.People.WithZeroVotes, &rep.People.Comments, &rep.People.MedianComments)
+	if err != nil {
+		return rep, err
+	}
+	if rep.People.Total > 0 {
+		pct := 100 * float64(rep.People.WithZeroVotes) / float64(rep.People.Total)
+		rep.People.ZeroVotesPercent = math.Round(pct*10) / 10
+	}
+	return rep, nil
+}
+
+// GET /api/admin/analytics?days=30 (admin-only)
+func apiAdminAnalyticsHandler(w http.ResponseWriter, r *http.Request) {
+	if !adminAuthorized(r) {
+		writeError(w, http.StatusUnauthorized, "unauthorized", "Log in as an admin first")
+		return
+	}
+	var req analyticsRequest
+	if errs := validation.Bind(r.URL.Query(), &req); errs != nil {
+		writeValidationError(w, errs)
+		return
+	}
+	if req.Days == 0 {
+		req.Days = 30
+	}
+	rep, err := loadAnalytics(r.Context(), req.Days)
+	if err != nil {
+		serverError(w, r, err)
+		return
+	}
+	w.Header().Set("Cache-Control", "private, no-store")
+	writeJSON(w, http.StatusOK, rep)
+}
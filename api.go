@@ -0,0 +1,332 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"macurate/validation"
+)
+
+// The API's version. Routes live under /api/v1/; the unversioned /api/
+// paths they had before stay as aliases, so existing frontends keep
+// working. A breaking change (pagination envelopes, renamed fields) gets
+// /api/v2/ and leaves these alone. Every JSON body carries the version as
+// its first field, and the API-Version header says it too.
+const apiVersion = 1
+
+// Register an API route, given without the /api prefix ("GET /people"),
+// under /api/v1/ and at its old path
+func handleAPI(pattern string, h http.HandlerFunc) {
+	method, path, _ := strings.Cut(pattern, " ")
+	http.HandleFunc(method+" /api/v1"+path, h)
+	http.HandleFunc(method+" /api"+path, func(w http.ResponseWriter, r *http.Request) {
+		successor := "/api/v1" + strings.TrimPrefix(r.URL.Path, "/api")
+		w.Header().Set("Link", "<"+successor+`>; rel="successor-version"`)
+		h(w, r)
+	})
+}
+
+// v as JSON with "version" spliced in front; v is always an object here.
+// The encoder escapes <, > and & so user text stays inert even if a
+// client injects it.
+func encodeJSON(v interface{}) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := json.NewEncoder(&buf).Encode(v); err != nil {
+		return nil, err
+	}
+	body := buf.Bytes()
+	if len(body) < 2 || body[0] != '{' {
+		return body, nil
+	}
+	field := `{"version":` + strconv.Itoa(apiVersion)
+	if body[1] != '}' {
+		field += ","
+	}
+	return append([]byte(field), body[1:]...), nil
+}
+
+// Encode v as the JSON response body with the given status
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	body, err := encodeJSON(v)
+	if err != nil {
+		status = http.StatusInternalServerError
+		body = []byte(`{"version":` + strconv.Itoa(apiVersion) + `,"error":{"code":"internal_error","message":"Internal Server Error"}}` + "\n")
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.Header().Set("API-Version", strconv.Itoa(apiVersion))
+	w.WriteHeader(status)
+	w.Write(body)
+}
+
+// APIError is the body of every JSON error, as {"error": {...}}. Clients
+// branch on Code, which is one of: invalid_id, invalid_request,
+// validation_failed, unauthorized, invalid_credentials, forbidden,
+// consent_required, voting_closed, voting_frozen, not_found,
+// not_configured, conflict, rate_limited, timeout, upstream_error,
+// internal_error, comment_required, and the comment rule codes in
+// commentquality.go.
+// Message is for people and may change.
+type APIError struct {
+	Code    string            `json:"code"`
+	Message string            `json:"message"`
+	Fields  validation.Errors `json:"fields,omitempty"` // validation_failed only
+}
+
+func writeError(w http.ResponseWriter, status int, code, message string) {
+	writeAPIError(w, status, APIError{Code: code, Message: message})
+}
+
+func writeAPIError(w http.ResponseWriter, status int, e APIError) {
+	writeJSON(w, status, map[string]APIError{"error": e})
+}
+
+func isAPIPath(path string) bool {
+	return strings.HasPrefix(path, "/api/") || strings.HasPrefix(path, "/admin/api/")
+}
+
+// For code shared by pages and the API: the JSON envelope under /api/ and
+// /admin/api/, plain text everywhere else
+func httpError(w http.ResponseWriter, r *http.Request, status int, code, message string) {
+	if isAPIPath(r.URL.Path) {
+		writeError(w, status, code, message)
+		return
+	}
+	http.Error(w, message, status)
+}
+
+// Like writeJSON for 200 responses that clients poll, with a weak ETag over
+// the body. A matching If-None-Match gets 304 and no body. The response is
+// still built, since votes, edits, moderation and settings all change it
+// and there's no single "last modified" to check first; what polling saves
+// is the transfer.
+func writeJSONWithETag(w http.ResponseWriter, r *http.Request, v interface{}) {
+	body, err := encodeJSON(v)
+	if err != nil {
+		serverError(w, r, err)
+		return
+	}
+	sum := sha256.Sum256(body)
+	etag := `W/"` + hex.EncodeToString(sum[:12]) + `"`
+
+	w.Header().Set("ETag", etag)
+	// The body depends on the voter cookie (my_vote) and admin session
+	w.Header().Set("Cache-Control", "private, no-cache")
+	w.Header().Add("Vary", "Cookie")
+	if etagMatches(r.Header.Get("If-None-Match"), etag) {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.Header().Set("API-Version", strconv.Itoa(apiVersion))
+	w.WriteHeader(http.StatusOK)
+	w.Write(body)
+}
+
+// If-None-Match uses weak comparison: W/ prefixes are ignored
+func etagMatches(header, etag string) bool {
+	if header == "" {
+		return false
+	}
+	want := strings.TrimPrefix(etag, "W/")
+	for _, tag := range strings.Split(header, ",") {
+		tag = strings.TrimSpace(tag)
+		if tag == "*" || strings.TrimPrefix(tag, "W/") == want {
+			return true
+		}
+	}
+	return false
+}
+
+// apiPerson is the public JSON shape of a person. Score fields are null
+// while scores are hidden.
+type apiPerson struct {
+	PublicID  string     `json:"public_id"`
+	Name      string     `json:"name"`
+	Score     *int       `json:"score"`
+	Upvotes   *int       `json:"upvotes"`
+	Downvotes *int       `json:"downvotes"`
+	Hidden    bool       `json:"hidden"`
+	Tags      []TagCount `json:"tags"`
+	// Slugs of the categories the person is in
+	Categories []string `json:"categories"`
+	// Net score per rating dimension; score is still the total over all
+	// votes. Null while scores are hidden.
+	Dimensions map[string]int `json:"dimensions"`
+	// Star ratings; null while scores are hidden
+	Rating *RatingSummary `json:"rating"`
+	MyVote *string        `json:"my_vote"` // "up", "down" or null
+	Frozen bool           `json:"voting_frozen"`
+
+	CommentCount   int        `json:"comment_count"`
+	LastActivityAt *time.Time `json:"last_activity_at"`
+
+	// Only with ?include=preview_comment
+	PreviewComment *PreviewComment `json:"preview_comment,omitempty"`
+}
+
+// apiPersonDetail is a person profile with their newest comments.
+type apiPersonDetail struct {
+	apiPerson
+	RecentComments []PreviewComment `json:"recent_comments"`
+}
+
+func newAPIPerson(p Person, hidden bool) apiPerson {
+	ap := apiPerson{
+		PublicID: p.PublicID, Name: p.Name, Hidden: hidden, Tags: p.Tags, Frozen: p.Frozen,
+		CommentCount: p.Comments, LastActivityAt: p.LastActivityAt,
+	}
+	if ap.Tags == nil {
+		ap.Tags = []TagCount{}
+	}
+	if ap.Categories = p.Categories; ap.Categories == nil {
+		ap.Categories = []string{}
+	}
+	if !hidden {
+		ap.Score, ap.Upvotes, ap.Downvotes = &p.Score, &p.Upvotes, &p.Downvotes
+		ap.Dimensions = p.Dimensions
+		ap.Rating = &p.Rating
+		if ap.Dimensions == nil {
+			ap.Dimensions = map[string]int{}
+		}
+	}
+	return ap
+}
+
+// List people as JSON in the board's sort order. Admins always see scores.
+// ?include=preview_comment embeds each person's best comment. ?limit= and
+// ?offset= page through the list; total is always the full count, or the
+// category's with ?category=.
+func apiPeopleHandler(w http.ResponseWriter, r *http.Request) {
+	var page pageRequest
+	if errs := validation.Bind(r.URL.Query(), &page); errs != nil {
+		writeValidationError(w, errs)
+		return
+	}
+
+	hidden := scoresHiddenFor(r)
+
+	sortOrder := getSortOrder()
+	if hidden {
+		sortOrder = "name" // ranking would leak the hidden scores
+	}
+	limit, offset := page.Limit, page.Offset
+	if page.Category != "" {
+		limit, offset = 0, 0 // paged below, once narrowed to the category
+	}
+	people, total, err := queryPeoplePage(r.Context(), sortOrder, hostTeamID(r), limit, offset)
+	stale := false
+	if dbUnavailable(err) {
+		// The last list we loaded, without the per-voter extras
+		var at time.Time
+		if people, total, at, stale = stalePeoplePage(sortOrder, hostTeamID(r), limit, offset); stale {
+			markDBDown(err)
+			setStaleHeader(w, at)
+			err = nil
+		}
+	}
+	if err != nil {
+		serverError(w, r, err)
+		return
+	}
+	if page.Category != "" {
+		people = inCategory(people, page.Category)
+		total = len(people)
+		people = pagePeople(people, page.Limit, page.Offset)
+	}
+
+	myVotes := map[int]string{}
+	if voterID := currentVoterID(r); voterID != "" && !stale {
+		if myVotes, err = voterLatestVotes(r.Context(), voterID); err != nil {
+			serverError(w, r, err)
+			return
+		}
+	}
+
+	var previews map[int]PreviewComment
+	include := parseInclude(r.URL.Query().Get("include"))
+	if include["preview_comment"] && getDisplayOptions().CommentsEnabled && !stale {
+		if previews, err = previewComments(r.Context()); err != nil {
+			serverError(w, r, err)
+			return
+		}
+	}
+
+	list := make([]apiPerson, 0, len(people))
+	for _, p := range people {
+		ap := newAPIPerson(p, hidden)
+		if v, ok := myVotes[p.ID]; ok {
+			ap.MyVote = &v
+		}
+		if c, ok := previews[p.ID]; ok {
+			ap.PreviewComment = &c
+		}
+		list = append(list, ap)
+	}
+	writeJSONWithETag(w, r, map[string]interface{}{
+		"people": list,
+		"total":  total,
+		"limit":  page.Limit,
+		"offset": page.Offset,
+		"stale":  stale,
+	})
+}
+
+// Person profile: one person with their newest comments embedded
+// (?comments=, default 5). Hidden scores stay hidden unless admin.
+func apiPersonHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := resolvePersonRef(r.Context(), r.PathValue("id"))
+	if err == errUnknownPerson {
+		writeError(w, http.StatusNotFound, "not_found", "Person not found")
+		return
+	} else if err != nil {
+		serverError(w, r, err)
+		return
+	}
+	var req personDetailRequest
+	if errs := validation.Bind(r.URL.Query(), &req); errs != nil {
+		writeValidationError(w, errs)
+		return
+	}
+	if req.Comments == 0 {
+		req.Comments = 5
+	}
+
+	p, err := queryPerson(r.Context(), id)
+	if err == sql.ErrNoRows {
+		writeError(w, http.StatusNotFound, "not_found", "Person not found")
+		return
+	} else if err != nil {
+		serverError(w, r, err)
+		return
+	}
+
+	ap := apiPersonDetail{apiPerson: newAPIPerson(p, scoresHiddenFor(r))}
+	if voterID := currentVoterID(r); voterID != "" {
+		myVotes, err := voterLatestVotes(r.Context(), voterID)
+		if err != nil {
+			serverError(w, r, err)
+			return
+		}
+		if v, ok := myVotes[p.ID]; ok {
+			ap.MyVote = &v
+		}
+	}
+
+	ap.RecentComments = []PreviewComment{}
+	if getDisplayOptions().CommentsEnabled {
+		if ap.RecentComments, err = recentComments(r.Context(), p.ID, req.Comments); err != nil {
+			serverError(w, r, err)
+			return
+		}
+	}
+	writeJSONWithETag(w, r, ap)
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestETagMatches(t *testing.T) {
+	const etag = `W/"abc123"`
+	tests := []struct {
+		header string
+		want   bool
+	}{
+		{"", false},
+		{`W/"abc123"`, true},
+		{`"abc123"`, true},
+		{`"other", W/"abc123"`, true},
+		{`  W/"abc123"  `, true},
+		{"*", true},
+		{`"other"`, false},
+		{`W/"abc12"`, false},
+		{`abc123`, false},
+		{`W/"ABC123"`, false},
+	}
+	for _, tt := range tests {
+		if got := etagMatches(tt.header, etag); got != tt.want {
+			t.Errorf("etagMatches(%q, %q) = %v, want %v", tt.header, etag, got, tt.want)
+		}
+	}
+}
+
+func TestWriteJSONWithETag(t *testing.T) {
+	body := map[string]int{"score": 3}
+	first := httptest.NewRecorder()
+	writeJSONWithETag(first, httptest.NewRequest("GET", "/api/people", nil), body)
+	etag := first.Header().Get("ETag")
+	if first.Code != http.StatusOK || etag == "" || first.Body.Len() == 0 {
+		t.Fatalf("first response: %d, ETag %q, %d bytes", first.Code, etag, first.Body.Len())
+	}
+
+	tests := []struct {
+		name        string
+		ifNoneMatch string
+		body        interface{}
+		want        int
+	}{
+		{"same body", etag, body, http.StatusNotModified},
+		{"changed body", etag, map[string]int{"score": 4}, http.StatusOK},
+		{"no validator", "", body, http.StatusOK},
+	}
+	for _, tt := range tests {
+		r := httptest.NewRequest("GET", "/api/people", nil)
+		if tt.ifNoneMatch != "" {
+			r.Header.Set("If-None-Match", tt.ifNoneMatch)
+		}
+		w := httptest.NewRecorder()
+		writeJSONWithETag(w, r, tt.body)
+		if w.Code != tt.want {
+			t.Errorf("%s: status %d, want %d", tt.name, w.Code, tt.want)
+		}
+		if tt.want == http.StatusNotModified && w.Body.Len() != 0 {
+			t.Errorf("%s: 304 with a %d byte body", tt.name, w.Body.Len())
+		}
+	}
+}
@@ -0,0 +1,210 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// APIKey is an admin-issued read-only key for third-party API consumers.
+type APIKey struct {
+	ID         int
+	Name       string
+	Prefix     string
+	RateLimit  int // requests per minute
+	Usage      int64
+	LastUsedAt sql.NullTime
+	Revoked    bool
+	CreatedAt  time.Time
+}
+
+const defaultAPIKeyRateLimit = 600
+
+type apiKeyCtxKey struct{}
+
+// The API key id that authenticated this request, if any
+func apiKeyFromContext(ctx context.Context) (int, bool) {
+	id, ok := ctx.Value(apiKeyCtxKey{}).(int)
+	return id, ok
+}
+
+func createAPIKeyTables() error {
+	_, err := db.Exec(`
+    CREATE TABLE IF NOT EXISTS api_keys (
+        id SERIAL PRIMARY KEY,
+        name TEXT NOT NULL,
+        prefix TEXT NOT NULL,
+        key_hash TEXT NOT NULL UNIQUE,
+        rate_limit INTEGER NOT NULL,
+        usage_count BIGINT NOT NULL DEFAULT 0,
+        last_used_at TIMESTAMPTZ,
+        revoked BOOLEAN NOT NULL DEFAULT FALSE,
+        created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+    );
+    `)
+	return err
+}
+
+func hashAPIKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+// Generate and store a new key. The plaintext is returned once and never stored.
+func createAPIKey(name string, rateLimit int) (string, error) {
+	b := make([]byte, 24)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	key := "mr_" + hex.EncodeToString(b)
+	_, err := db.Exec(
+		"INSERT INTO api_keys (name, prefix, key_hash, rate_limit) VALUES ($1, $2, $3, $4)",
+		name, key[:10], hashAPIKey(key), rateLimit,
+	)
+	if err != nil {
+		return "", err
+	}
+	return key, nil
+}
+
+func listAPIKeys() ([]APIKey, error) {
+	rows, err := db.Query(`
+        SELECT id, name, prefix, rate_limit, usage_count, last_used_at, revoked, created_at
+        FROM api_keys ORDER BY id DESC`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var keys []APIKey
+	for rows.Next() {
+		var k APIKey
+		if err := rows.Scan(&k.ID, &k.Name, &k.Prefix, &k.RateLimit, &k.Usage, &k.LastUsedAt, &k.Revoked, &k.CreatedAt); err != nil {
+			return nil, err
+		}
+		keys = append(keys, k)
+	}
+	return keys, rows.Err()
+}
+
+// Count a request against the key's per-minute limit, a token bucket in
+// the Store shared by every instance. ok is false when the limit is
+// exceeded.
+func allowAPIKeyRequest(ctx context.Context, id, limit int) (bool, rateLimitStatus) {
+	return takeToken(ctx, apiKeyBucket(id), limit, true)
+}
+
+func apiKeyBucket(id int) string {
+	return "apikey:" + strconv.Itoa(id)
+}
+
+// Key sent as "Authorization: Bearer <key>" or "X-API-Key: <key>"
+func requestAPIKey(r *http.Request) string {
+	if k := r.Header.Get("X-API-Key"); k != "" {
+		return k
+	}
+	if auth := r.Header.Get("Authorization"); strings.HasPrefix(auth, "Bearer ") {
+		return strings.TrimPrefix(auth, "Bearer ")
+	}
+	return ""
+}
+
+// Authenticate optional read-only API keys. Requests without a key pass
+// through as anonymous; requests with a bad, revoked or over-quota key are
+// rejected. Keys only grant read access.
+func withAPIKey(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		key := requestAPIKey(r)
+		if key == "" {
+			next(w, r)
+			return
+		}
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			writeError(w, http.StatusForbidden, "forbidden", "API keys are read-only")
+			return
+		}
+
+		var id, limit int
+		var revoked bool
+		err := db.QueryRowContext(r.Context(), "SELECT id, rate_limit, revoked FROM api_keys WHERE key_hash = $1", hashAPIKey(key)).
+			Scan(&id, &limit, &revoked)
+		if err == sql.ErrNoRows || (err == nil && revoked) {
+			writeError(w, http.StatusUnauthorized, "unauthorized", "Invalid API key")
+			return
+		} else if err != nil {
+			serverError(w, r, err)
+			return
+		}
+
+		ok, st := allowAPIKeyRequest(r.Context(), id, limit)
+		if st.Limit > 0 {
+			st.setHeaders(w)
+		}
+		if !ok {
+			writeError(w, http.StatusTooManyRequests, "rate_limited", "API key rate limit exceeded")
+			return
+		}
+		if _, err := db.ExecContext(r.Context(), "UPDATE api_keys SET usage_count = usage_count + 1, last_used_at = NOW() WHERE id = $1", id); err != nil {
+			serverError(w, r, err)
+			return
+		}
+
+		next(w, r.WithContext(context.WithValue(r.Context(), apiKeyCtxKey{}, id)))
+	}
+}
+
+// Issue or revoke API keys (admin-only). A new key is shown exactly once.
+func adminAPIKeysHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if !adminAuthorized(r) {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	var req adminAPIKeyRequest
+	if errs := bindAdminForm(r, &req); errs != nil {
+		renderAdmin(w, r, errs)
+		return
+	}
+
+	switch req.Action {
+	case "create":
+		if req.Name == "" {
+			req.Name = "unnamed"
+		}
+		if req.RateLimit == 0 {
+			req.RateLimit = defaultAPIKeyRateLimit
+		}
+		key, err := createAPIKey(req.Name, req.RateLimit)
+		if err != nil {
+			serverError(w, r, err)
+			return
+		}
+		tmpl := parseTemplates("templates/apikey.html")
+		data := map[string]interface{}{
+			"Name": req.Name,
+			"Key":  key,
+		}
+		w.Header().Set("Cache-Control", "no-store")
+		if err := tmpl.Execute(w, data); err != nil {
+			serverError(w, r, err)
+		}
+		return
+	case "revoke":
+		if _, err := db.ExecContext(r.Context(), "UPDATE api_keys SET revoked = TRUE WHERE id = $1", req.ID); err != nil {
+			serverError(w, r, err)
+			return
+		}
+	}
+
+	http.Redirect(w, r, "/admin", http.StatusSeeOther)
+}
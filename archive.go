@@ -0,0 +1,260 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"flag"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// Cold storage for old votes. There are no seasons yet, so a closed period
+// is everything before a cutoff date. Archived votes move to a separate
+// database (ARCHIVE_DATABASE_URL), which keeps the live tables small; the
+// archive is only opened when someone looks at it or archives more.
+
+const archiveBatchSize = 1000
+
+// Name kept in the archive for someone whose data was anonymized
+const anonymizedName = "Removed person"
+
+// ArchivedTotals are one person's archived vote totals.
+type ArchivedTotals struct {
+	Name      string
+	Upvotes   int
+	Downvotes int
+	Comments  int
+	First     time.Time
+	Last      time.Time
+}
+
+func openArchiveDB() (*sql.DB, error) {
+	url := os.Getenv("ARCHIVE_DATABASE_URL")
+	if url == "" {
+		return nil, errors.New("ARCHIVE_DATABASE_URL is not set")
+	}
+	adb, err := sql.Open("postgres", url)
+	if err != nil {
+		return nil, err
+	}
+	if err := adb.Ping(); err != nil {
+		adb.Close()
+		return nil, err
+	}
+	return adb, nil
+}
+
+func createArchiveTables(adb *sql.DB) error {
+	_, err := adb.Exec(`
+    CREATE TABLE IF NOT EXISTS archived_votes (
+        id INTEGER PRIMARY KEY,
+        person_id INTEGER NOT NULL,
+        person_name TEXT NOT NULL,
+        upvote BOOLEAN,
+        comment TEXT,
+        voter_name TEXT,
+        status TEXT NOT NULL,
+        tags TEXT[] NOT NULL DEFAULT '{}',
+        replies TEXT[] NOT NULL DEFAULT '{}',
+        created_at TIMESTAMPTZ NOT NULL,
+        archived_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+    );
+    CREATE INDEX IF NOT EXISTS archived_votes_created_at_idx ON archived_votes (created_at);
+    `)
+	return err
+}
+
+// `macurate archive -before 2025-01-01`: copy older votes into the archive
+// in batches, then delete them here. A batch is only deleted once the
+// archive has it, and copies are idempotent, so an interrupted run can
+// simply be repeated.
+func runArchive(args []string) error {
+	fs := flag.NewFlagSet("archive", flag.ContinueOnError)
+	before := fs.String("before", "", "archive votes created before this date (YYYY-MM-DD)")
+	dryRun := fs.Bool("dry-run", false, "count the votes that would move without moving them")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	cutoff, err := time.Parse("2006-01-02", *before)
+	if err != nil {
+		return errors.New("usage: macurate archive -before YYYY-MM-DD [-dry-run]")
+	}
+	if *dryRun {
+		n, comments, err := countArchivable(archiveFilter{Before: cutoff})
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(os.Stderr, "dry run: would archive %d votes (%d with comments) created before %s\n", n, comments, cutoff.Format("2006-01-02"))
+		return nil
+	}
+
+	adb, err := openArchiveDB()
+	if err != nil {
+		return err
+	}
+	defer adb.Close()
+	if err := createArchiveTables(adb); err != nil {
+		return err
+	}
+
+	total := 0
+	for {
+		n, err := archiveBatch(adb, archiveFilter{Before: cutoff})
+		if err != nil {
+			return err
+		}
+		if n == 0 {
+			break
+		}
+		total += n
+		slog.Info("archive: moved votes", "total", total)
+	}
+	fmt.Fprintf(os.Stderr, "archived %d votes created before %s\n", total, cutoff.Format("2006-01-02"))
+	return nil
+}
+
+// Which votes an archive batch moves
+type archiveFilter struct {
+	Before    time.Time // zero for any age
+	PersonID  int       // 0 for everyone
+	Anonymize bool      // keep only the vote itself, not who or what was said
+}
+
+// How many votes, and of those with a comment, the filter would move. The
+// move spans two databases, so a dry run counts instead of rolling back.
+func countArchivable(f archiveFilter) (votes, comments int, err error) {
+	before := sql.NullTime{Time: f.Before, Valid: !f.Before.IsZero()}
+	err = db.QueryRow(`
+        SELECT COUNT(*), COUNT(*) FILTER (WHERE COALESCE(TRIM(comment), '') <> '')
+        FROM votes
+        WHERE ($1::timestamptz IS NULL OR created_at < $1) AND ($2 = 0 OR person_id = $2)`,
+		before, f.PersonID).Scan(&votes, &comments)
+	return votes, comments, err
+}
+
+func archiveBatch(adb *sql.DB, f archiveFilter) (int, error) {
+	before := sql.NullTime{Time: f.Before, Valid: !f.Before.IsZero()}
+	rows, err := db.Query(`
+        SELECT v.id, v.person_id, p.name, v.upvote, v.comment, v.voter_name, v.status, v.created_at,
+               ARRAY(SELECT t.label FROM vote_tags vt JOIN reason_tags t ON t.id = vt.tag_id
+                     WHERE vt.vote_id = v.id ORDER BY t.label),
+               ARRAY(SELECT body FROM comment_replies WHERE vote_id = v.id ORDER BY id)
+        FROM votes v JOIN people p ON p.id = v.person_id
+        WHERE ($1::timestamptz IS NULL OR v.created_at < $1) AND ($3 = 0 OR v.person_id = $3)
+        ORDER BY v.id
+        LIMIT $2`, before, archiveBatchSize, f.PersonID)
+	if err != nil {
+		return 0, err
+	}
+	defer rows.Close()
+
+	tx, err := adb.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	var ids []int
+	for rows.Next() {
+		var id, personID int
+		var name, status string
+		var upvote sql.NullBool
+		var comment, voterName sql.NullString
+		var createdAt time.Time
+		var tags, replies pq.StringArray
+		if err := rows.Scan(&id, &personID, &name, &upvote, &comment, &voterName, &status, &createdAt, &tags, &replies); err != nil {
+			return 0, err
+		}
+		if f.Anonymize {
+			name, comment, voterName, replies = anonymizedName, sql.NullString{}, sql.NullString{}, pq.StringArray{}
+		}
+		if _, err := tx.Exec(`
+            INSERT INTO archived_votes (id, person_id, person_name, upvote, comment, voter_name, status, tags, replies, created_at)
+            VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)
+            ON CONFLICT (id) DO NOTHING`,
+			id, personID, name, upvote, comment, voterName, status, tags, replies, createdAt); err != nil {
+			return 0, err
+		}
+		ids = append(ids, id)
+	}
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+	if len(ids) == 0 {
+		return 0, nil
+	}
+	if err := tx.Commit(); err != nil {
+		return 0, err
+	}
+
+	// Tags, replies, edits and translations cascade off the votes
+	if _, err := db.Exec("DELETE FROM votes WHERE id = ANY($1)", pq.Array(ids)); err != nil {
+		return 0, err
+	}
+	return len(ids), nil
+}
+
+// Per-person totals from the archive, read in a read-only transaction
+func archivedTotals(ctx context.Context) ([]ArchivedTotals, error) {
+	adb, err := openArchiveDB()
+	if err != nil {
+		return nil, err
+	}
+	defer adb.Close()
+
+	tx, err := adb.BeginTx(ctx, &sql.TxOptions{ReadOnly: true})
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	rows, err := tx.QueryContext(ctx, `
+        SELECT person_name,
+               COUNT(*) FILTER (WHERE upvote IS TRUE),
+               COUNT(*) FILTER (WHERE upvote IS FALSE),
+               COUNT(*) FILTER (WHERE COALESCE(TRIM(comment), '') <> '' AND status = 'approved'),
+               MIN(created_at), MAX(created_at)
+        FROM archived_votes
+        GROUP BY person_id, person_name
+        ORDER BY person_name`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var list []ArchivedTotals
+	for rows.Next() {
+		var t ArchivedTotals
+		if err := rows.Scan(&t.Name, &t.Upvotes, &t.Downvotes, &t.Comments, &t.First, &t.Last); err != nil {
+			return nil, err
+		}
+		list = append(list, t)
+	}
+	return list, rows.Err()
+}
+
+// Archived totals (admin-only); the archive database is attached only for
+// the duration of the request
+func adminArchiveHandler(w http.ResponseWriter, r *http.Request) {
+	if !adminAuthorized(r) {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+	data := map[string]interface{}{}
+	totals, err := archivedTotals(r.Context())
+	if err != nil {
+		data["Error"] = err.Error()
+	}
+	data["Totals"] = totals
+
+	tmpl := parseTemplates("templates/archive.html")
+	if err := tmpl.Execute(w, data); err != nil {
+		serverError(w, r, err)
+	}
+}
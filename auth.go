@@ -0,0 +1,56 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+)
+
+// Failed credential checks never answer faster than this, so response timing
+// says nothing about how close a guess was and brute forcing gets slower.
+const authFailureDelay = 500 * time.Millisecond
+
+// Pad a failed attempt that started at start up to authFailureDelay
+func delayAuthFailure(start time.Time) {
+	if d := authFailureDelay - time.Since(start); d > 0 {
+		time.Sleep(d)
+	}
+}
+
+// The one login path shared by the HTML form and the JSON API: verify the
+// credentials and start a session. Returns false (after the failure delay)
+// when they are wrong.
+func loginAdmin(w http.ResponseWriter, r *http.Request, username, password string) (bool, error) {
+	start := time.Now()
+	id, ok, err := verifyAdmin(username, password)
+	if err != nil {
+		return false, err
+	}
+	if !ok {
+		delayAuthFailure(start)
+		return false, nil
+	}
+	return true, createAdminSession(w, r, id)
+}
+
+// JSON login: {"username": "...", "password": "..."} starts an admin session cookie
+func apiAdminLoginHandler(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Username string `json:"username"`
+		Password string `json:"password"`
+	}
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 4096)).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid_request", "Invalid JSON body")
+		return
+	}
+	ok, err := loginAdmin(w, r, req.Username, req.Password)
+	if err != nil {
+		serverError(w, r, err)
+		return
+	}
+	if !ok {
+		writeError(w, http.StatusUnauthorized, "invalid_credentials", "Wrong username or password")
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{"ok": true})
+}
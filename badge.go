@@ -0,0 +1,127 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"html"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/rivo/uniseg"
+)
+
+// Shields.io-style score badges for READMEs, wikis and email signatures.
+// Rendered badges are kept for badgeTTL so a popular embed doesn't re-rank
+// the whole board on every view.
+
+const badgeTTL = time.Minute
+
+type cachedBadge struct {
+	svg []byte
+	at  time.Time
+}
+
+var (
+	badgeMu    sync.Mutex
+	badgeCache = map[int]cachedBadge{}
+)
+
+// Rank is 1 + the number of people with a strictly higher score.
+func personScoreRank(ctx context.Context, id int) (name string, score, rank int, err error) {
+	err = db.QueryRowContext(ctx, `
+        WITH scores AS (
+            SELECT p.id, p.name,
+                   COALESCE(SUM(CASE WHEN v.upvote IS TRUE THEN 1 WHEN v.upvote IS FALSE THEN -1 ELSE 0 END), 0) AS score
+            FROM people p
+            LEFT JOIN votes v ON v.person_id = p.id
+            GROUP BY p.id
+        )
+        SELECT s.name, s.score, 1 + (SELECT COUNT(*) FROM scores o WHERE o.score > s.score)
+        FROM scores s WHERE s.id = $1`, id).Scan(&name, &score, &rank)
+	return
+}
+
+func badgeColor(score int) string {
+	switch {
+	case score >= 10:
+		return "#4c1"
+	case score > 0:
+		return "#97ca00"
+	case score == 0:
+		return "#9f9f9f"
+	case score > -10:
+		return "#fe7d37"
+	default:
+		return "#e05d44"
+	}
+}
+
+// Rough Verdana 11px advance, good enough for badge sizing
+func badgeTextWidth(s string) int {
+	return uniseg.StringWidth(s)*7 + 10
+}
+
+func renderBadge(label, value, color string) []byte {
+	lw, vw := badgeTextWidth(label), badgeTextWidth(value)
+	label, value = html.EscapeString(label), html.EscapeString(value)
+	return []byte(fmt.Sprintf(`<svg xmlns="http://www.w3.org/2000/svg" width="%[1]d" height="20" role="img" aria-label="%[4]s: %[5]s">
+<title>%[4]s: %[5]s</title>
+<linearGradient id="s" x2="0" y2="100%%"><stop offset="0" stop-color="#bbb" stop-opacity=".1"/><stop offset="1" stop-opacity=".1"/></linearGradient>
+<clipPath id="r"><rect width="%[1]d" height="20" rx="3" fill="#fff"/></clipPath>
+<g clip-path="url(#r)"><rect width="%[2]d" height="20" fill="#555"/><rect x="%[2]d" width="%[3]d" height="20" fill="%[6]s"/><rect width="%[1]d" height="20" fill="url(#s)"/></g>
+<g fill="#fff" text-anchor="middle" font-family="Verdana,Geneva,DejaVu Sans,sans-serif" font-size="11">
+<text x="%[7]d" y="14">%[4]s</text><text x="%[8]d" y="14">%[5]s</text>
+</g>
+</svg>
+`, lw+vw, lw, vw, label, value, color, lw/2, lw+vw/2))
+}
+
+// GET /badge/{id}/score.svg: the person's score and rank as an SVG badge.
+// While scores are hidden or switched off the badge says so instead.
+func badgeScoreHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := resolvePersonRef(r.Context(), r.PathValue("id"))
+	if err == errUnknownPerson {
+		http.Error(w, "Invalid id", http.StatusBadRequest)
+		return
+	} else if err != nil {
+		serverError(w, r, err)
+		return
+	}
+
+	badgeMu.Lock()
+	cached, ok := badgeCache[id]
+	badgeMu.Unlock()
+	if !ok || time.Since(cached.at) > badgeTTL {
+		name, score, rank, err := personScoreRank(r.Context(), id)
+		if err == sql.ErrNoRows {
+			http.Error(w, "Person not found", http.StatusNotFound)
+			return
+		} else if err != nil {
+			serverError(w, r, err)
+			return
+		}
+		var svg []byte
+		if !publicDisplayOptions().ShowScores {
+			svg = renderBadge(name, "hidden", "#9f9f9f")
+		} else {
+			svg = renderBadge(name, fmt.Sprintf("%+d · #%d", score, rank), badgeColor(score))
+		}
+		cached = cachedBadge{svg: svg, at: time.Now()}
+
+		badgeMu.Lock()
+		for k, b := range badgeCache {
+			if time.Since(b.at) > badgeTTL {
+				delete(badgeCache, k)
+			}
+		}
+		badgeCache[id] = cached
+		badgeMu.Unlock()
+	}
+
+	w.Header().Set("Content-Type", "image/svg+xml")
+	w.Header().Set("Cache-Control", fmt.Sprintf("public, max-age=%d", int(badgeTTL.Seconds())))
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.Write(cached.svg)
+}
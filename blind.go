@@ -0,0 +1,97 @@
+package main
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"macurate/validation"
+)
+
+// Layout of the admin datetime-local input
+const datetimeLocalLayout = "2006-01-02T15:04"
+
+// When voting closes, if a deadline has been set
+func getVotingClosesAt() (time.Time, bool) {
+	t, err := parseTimestamp(getSetting("voting_closes_at", ""))
+	if err != nil {
+		return time.Time{}, false
+	}
+	return t, true
+}
+
+// Voting deadline formatted for the admin datetime-local input
+func closesAtInput() string {
+	if t, ok := getVotingClosesAt(); ok {
+		return t.Local().Format(datetimeLocalLayout)
+	}
+	return ""
+}
+
+// Voting is closed once the configured deadline has passed
+func votingClosed() bool {
+	t, ok := getVotingClosesAt()
+	return ok && !time.Now().Before(t)
+}
+
+// In blind mode public scores and rankings stay hidden until voting closes
+func scoresHidden() bool {
+	return getBoolSetting("blind_voting", false) && !votingClosed()
+}
+
+// Display options as the public sees them: blind voting suppresses scores,
+// counts and ranking regardless of the display settings
+func publicDisplayOptions() DisplayOptions {
+	display := getDisplayOptions()
+	if scoresHidden() {
+		display.ShowScores = false
+		display.ShowVoteCounts = false
+		display.SortOrder = "name"
+	}
+	return display
+}
+
+// Whether scores are left out of the response to r: blind voting or the
+// show_scores display setting hide them from everyone but admins
+func scoresHiddenFor(r *http.Request) bool {
+	return !publicDisplayOptions().ShowScores && !adminAuthorized(r)
+}
+
+// Toggle blind voting and set the voting deadline (admin-only)
+func adminBlindHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if !adminAuthorized(r) {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	var req adminBlindRequest
+	if errs := bindAdminForm(r, &req); errs != nil {
+		renderAdmin(w, r, errs)
+		return
+	}
+
+	closesAt := ""
+	if req.ClosesAt != "" {
+		t, err := time.ParseInLocation(datetimeLocalLayout, req.ClosesAt, time.Local)
+		if err != nil {
+			renderAdmin(w, r, validation.Errors{"closes_at": "must be a date and time"})
+			return
+		}
+		closesAt = t.UTC().Format(time.RFC3339)
+	}
+
+	if err := setSetting("blind_voting", strconv.FormatBool(req.BlindVoting)); err != nil {
+		serverError(w, r, err)
+		return
+	}
+	if err := setSetting("voting_closes_at", closesAt); err != nil {
+		serverError(w, r, err)
+		return
+	}
+
+	http.Redirect(w, r, "/admin", http.StatusSeeOther)
+}
@@ -0,0 +1,168 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"slices"
+	"strings"
+
+	"macurate/validation"
+)
+
+// Categories group people on one board (departments, squads, guests).
+// Unlike teams, which give each person one home and can have a domain of
+// their own, a person can be in any number of categories, and they only
+// filter listings: ?category=slug on the homepage and /api/people. The
+// filter applies to the full, cached board and pages afterwards, so ranks
+// and totals are those within the category.
+
+// Category is an admin-defined group of people.
+type Category struct {
+	ID      int    `json:"id"`
+	Slug    string `json:"slug"`
+	Name    string `json:"name"`
+	Members int    `json:"members"`
+}
+
+func createCategoryTables() error {
+	_, err := db.Exec(`
+    CREATE TABLE IF NOT EXISTS categories (
+        id SERIAL PRIMARY KEY,
+        slug TEXT NOT NULL UNIQUE,
+        name TEXT NOT NULL
+    );
+    CREATE TABLE IF NOT EXISTS person_categories (
+        person_id INTEGER REFERENCES people(id) ON DELETE CASCADE,
+        category_id INTEGER REFERENCES categories(id) ON DELETE CASCADE,
+        PRIMARY KEY (person_id, category_id)
+    );
+    `)
+	return err
+}
+
+// List all categories in name order, with their member counts
+func listCategories(ctx context.Context) ([]Category, error) {
+	rows, err := db.QueryContext(ctx, `
+        SELECT c.id, c.slug, c.name, COUNT(pc.person_id)
+        FROM categories c LEFT JOIN person_categories pc ON pc.category_id = c.id
+        GROUP BY c.id
+        ORDER BY c.name`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var cats []Category
+	for rows.Next() {
+		var c Category
+		if err := rows.Scan(&c.ID, &c.Slug, &c.Name, &c.Members); err != nil {
+			return nil, err
+		}
+		cats = append(cats, c)
+	}
+	return cats, rows.Err()
+}
+
+// Category slugs for every person in at least one, keyed by person id
+func categoriesByPerson(ctx context.Context) (map[int][]string, error) {
+	rows, err := db.QueryContext(ctx, `
+        SELECT pc.person_id, c.slug
+        FROM person_categories pc JOIN categories c ON c.id = pc.category_id
+        ORDER BY pc.person_id, c.name`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	slugs := make(map[int][]string)
+	for rows.Next() {
+		var personID int
+		var slug string
+		if err := rows.Scan(&personID, &slug); err != nil {
+			return nil, err
+		}
+		slugs[personID] = append(slugs[personID], slug)
+	}
+	return slugs, rows.Err()
+}
+
+// The people in category slug, keeping their order
+func inCategory(people []Person, slug string) []Person {
+	var in []Person
+	for _, p := range people {
+		if slices.Contains(p.Categories, slug) {
+			in = append(in, p)
+		}
+	}
+	return in
+}
+
+// One page of people (limit 0 means all)
+func pagePeople(people []Person, limit, offset int) []Person {
+	offset = min(offset, len(people))
+	end := len(people)
+	if limit > 0 {
+		end = min(offset+limit, end)
+	}
+	return people[offset:end]
+}
+
+// Create/delete categories and put people in or out of them (admin-only)
+func adminCategoriesHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if !adminAuthorized(r) {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	var req adminCategoryRequest
+	if errs := bindAdminForm(r, &req); errs != nil {
+		renderAdmin(w, r, errs)
+		return
+	}
+
+	switch req.Action {
+	case "add":
+		name := strings.TrimSpace(req.Name)
+		if name == "" {
+			renderAdmin(w, r, validation.Errors{"category_name": "is required"})
+			return
+		}
+		if !pageSlugRe.MatchString(req.Slug) {
+			renderAdmin(w, r, validation.Errors{"category_slug": "may only contain a-z, 0-9 and single dashes"})
+			return
+		}
+		if _, err := db.ExecContext(r.Context(), "INSERT INTO categories (slug, name) VALUES ($1, $2) ON CONFLICT (slug) DO UPDATE SET name = EXCLUDED.name", req.Slug, name); err != nil {
+			serverError(w, r, err)
+			return
+		}
+	case "delete":
+		if req.CategoryID == 0 {
+			renderAdmin(w, r, validation.Errors{"category_id": "is required"})
+			return
+		}
+		if _, err := db.ExecContext(r.Context(), "DELETE FROM categories WHERE id=$1", req.CategoryID); err != nil {
+			serverError(w, r, err)
+			return
+		}
+	case "assign", "unassign":
+		if req.PersonID == 0 || req.CategoryID == 0 {
+			renderAdmin(w, r, validation.Errors{"category_id": "and person are required"})
+			return
+		}
+		query := "INSERT INTO person_categories (person_id, category_id) VALUES ($1, $2) ON CONFLICT DO NOTHING"
+		if req.Action == "unassign" {
+			query = "DELETE FROM person_categories WHERE person_id = $1 AND category_id = $2"
+		}
+		if _, err := db.ExecContext(r.Context(), query, req.PersonID, req.CategoryID); err != nil {
+			serverError(w, r, err)
+			return
+		}
+	}
+	invalidatePeopleCache()
+
+	http.Redirect(w, r, "/admin", http.StatusSeeOther)
+}
@@ -0,0 +1,154 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"database/sql"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+)
+
+// `macurate [command] [flags]`. With no command the server starts. Every
+// command reads the same environment as the server; all but vapid-keys
+// open the database and bring the schema up to date first (migrate does
+// that itself so -status can report what is pending).
+
+type cliCommand struct {
+	usage   string
+	summary string
+	noDB    bool
+	run     func(args []string) error // nil for serve
+}
+
+var cliCommands = map[string]cliCommand{
+	"serve":          {usage: "serve", summary: "run the web server (default)"},
+	"migrate":        {usage: "migrate [-status]", summary: "apply pending schema migrations", run: runMigrate},
+	"create-admin":   {usage: "create-admin <username>", summary: "add an admin account; the password is read from stdin", run: runCreateAdmin},
+	"reset-password": {usage: "reset-password <username>", summary: "set a new admin password from stdin and end its sessions", run: runResetPassword},
+	"add-person":     {usage: "add-person [-team NAME] [-image FILE] <name>", summary: "add a person to the board", run: runAddPerson},
+	"export":         {usage: "export [-format ndjson|json] [-person ID] [-o FILE]", summary: "write every vote and comment to stdout or a file", run: runExport},
+	"import":         {usage: "import (-from DATABASE_URL | -file EXPORT) [-on-conflict skip|merge|duplicate] [-dry-run]", summary: "bring people, votes and comments over from another board", run: runImport},
+	"archive":        {usage: "archive -before YYYY-MM-DD [-dry-run]", summary: "move old votes to ARCHIVE_DATABASE_URL", run: runArchive},
+	"migrate-db":     {usage: "migrate-db -to DATABASE_URL", summary: "copy the whole board to a new, empty database", run: runMigrateDB},
+	"vapid-keys":     {usage: "vapid-keys", summary: "print a new Web Push key pair", noDB: true, run: func([]string) error { return runVAPIDKeys() }},
+}
+
+// The command named on the command line, "serve" when there is none.
+// Unknown commands and help requests print the usage and exit.
+func parseCommand(argv []string) (string, cliCommand, []string) {
+	name, args := "serve", []string(nil)
+	if len(argv) > 0 {
+		name, args = argv[0], argv[1:]
+	}
+	switch name {
+	case "help", "-h", "-help", "--help":
+		printUsage()
+		os.Exit(0)
+	}
+	cmd, ok := cliCommands[name]
+	if !ok {
+		fmt.Fprintf(os.Stderr, "unknown command %q\n\n", name)
+		printUsage()
+		os.Exit(2)
+	}
+	return name, cmd, args
+}
+
+func printUsage() {
+	names := make([]string, 0, len(cliCommands))
+	for name := range cliCommands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	fmt.Fprintln(os.Stderr, "usage: macurate [command]")
+	fmt.Fprintln(os.Stderr)
+	for _, name := range names {
+		c := cliCommands[name]
+		fmt.Fprintf(os.Stderr, "  %-52s %s\n", c.usage, c.summary)
+	}
+}
+
+// `macurate add-person`: for seeding a board from a script. The photo goes
+// through the same normalization as an admin upload.
+func runAddPerson(args []string) error {
+	fs := flag.NewFlagSet("add-person", flag.ContinueOnError)
+	team := fs.String("team", "", "team name (must exist)")
+	imagePath := fs.String("image", "", "photo to use")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	name := strings.TrimSpace(strings.Join(fs.Args(), " "))
+	if name == "" || len(name) > 100 {
+		return errors.New("usage: macurate add-person [-team NAME] [-image FILE] <name>")
+	}
+
+	var teamID sql.NullInt64
+	if *team != "" {
+		err := db.QueryRow("SELECT id FROM teams WHERE LOWER(name) = LOWER($1)", *team).Scan(&teamID)
+		if err == sql.ErrNoRows {
+			return fmt.Errorf("no team named %q", *team)
+		} else if err != nil {
+			return err
+		}
+	}
+	var img []byte
+	if *imagePath != "" {
+		raw, err := os.ReadFile(*imagePath)
+		if err != nil {
+			return err
+		}
+		if img, err = normalizeImage(raw); err != nil {
+			return fmt.Errorf("%s: %w", *imagePath, err)
+		}
+	}
+
+	var id int
+	if err := db.QueryRow("INSERT INTO people (name, image, team_id, public_id) VALUES ($1, $2, $3, $4) RETURNING id", name, img, teamID, newPublicID()).Scan(&id); err != nil {
+		return err
+	}
+	fmt.Fprintf(os.Stderr, "added %q (id %d)\n", name, id)
+	return nil
+}
+
+// `macurate export`: the admin comments export, without a browser
+func runExport(args []string) error {
+	fs := flag.NewFlagSet("export", flag.ContinueOnError)
+	format := fs.String("format", "ndjson", "ndjson or json")
+	personID := fs.Int("person", 0, "only this person's votes")
+	out := fs.String("o", "", "write here instead of stdout")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *format != "ndjson" && *format != "json" {
+		return errors.New("-format must be ndjson or json")
+	}
+
+	rows, err := queryCommentsExport(context.Background(), *personID)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	f := os.Stdout
+	if *out != "" {
+		if f, err = os.Create(*out); err != nil {
+			return err
+		}
+		defer f.Close()
+	}
+	w := bufio.NewWriter(f)
+	if err := writeCommentsExport(rows, w, *format == "json", func() { w.Flush() }); err != nil {
+		return err
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+	if f != os.Stdout {
+		return f.Close()
+	}
+	return nil
+}
@@ -0,0 +1,144 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"unicode"
+
+	"macurate/validation"
+)
+
+// Rules against low-effort comments, set on the admin page. A comment that
+// breaks one is refused with a code naming the rule (comment_too_short,
+// comment_all_caps, comment_repeated_character, comment_emoji_only), so the
+// vote form can tell the voter what to change instead of a bare 400. All
+// rules are off until an admin turns them on.
+
+// CommentRules are the checks applied to new and edited comments.
+type CommentRules struct {
+	MinLength   int  `json:"min_length"` // in characters as people count them; 0 is off
+	NoShouting  bool `json:"no_shouting"`
+	NoRepeats   bool `json:"no_repeats"`
+	NoEmojiOnly bool `json:"no_emoji_only"`
+}
+
+// Shorter comments can't meaningfully shout ("OK", "WOW")
+const shoutingMinLetters = 6
+
+// Helper to read current comment rules from settings
+func getCommentRules() CommentRules {
+	n, err := strconv.Atoi(getSetting("comment_min_length", "0"))
+	if err != nil || n < 0 {
+		n = 0
+	}
+	return CommentRules{
+		MinLength:   n,
+		NoShouting:  getBoolSetting("comment_no_shouting", false),
+		NoRepeats:   getBoolSetting("comment_no_repeats", false),
+		NoEmojiOnly: getBoolSetting("comment_no_emoji_only", false),
+	}
+}
+
+// The first rule a non-empty comment breaks, as an API error whose
+// message speaks to the voter; nil if it passes
+func checkCommentQuality(rules CommentRules, text string) *APIError {
+	problem := func(code, msg string) *APIError {
+		return &APIError{Code: code, Message: msg, Fields: validation.Errors{"comment": msg}}
+	}
+	switch {
+	case text == "":
+		return nil
+	case rules.NoEmojiOnly && emojiOnly(text):
+		return problem("comment_emoji_only", "Add a few words to go with the emoji.")
+	case rules.NoRepeats && repeatedCharacter(text):
+		return problem("comment_repeated_character", "Write a comment rather than one character over and over.")
+	case rules.MinLength > 0 && validation.Length(text) < rules.MinLength:
+		return problem("comment_too_short", fmt.Sprintf("Say a bit more: comments need at least %d characters.", rules.MinLength))
+	case rules.NoShouting && allCaps(text):
+		return problem("comment_all_caps", "Please don't write the whole comment in capitals.")
+	}
+	return nil
+}
+
+// Every cased letter is upper case, and there are enough of them to count
+func allCaps(text string) bool {
+	letters := 0
+	for _, r := range text {
+		switch {
+		case unicode.IsLower(r):
+			return false
+		case unicode.IsUpper(r):
+			letters++
+		}
+	}
+	return letters >= shoutingMinLetters
+}
+
+// The same character three or more times and nothing else but spaces
+func repeatedCharacter(text string) bool {
+	var first rune
+	n := 0
+	for _, r := range text {
+		if unicode.IsSpace(r) {
+			continue
+		}
+		if n == 0 {
+			first = r
+		} else if r != first {
+			return false
+		}
+		n++
+	}
+	return n >= 3
+}
+
+// Only pictographs and the joiners, selectors and modifiers that build
+// them up, with at least one actual symbol
+func emojiOnly(text string) bool {
+	symbols := 0
+	for _, r := range text {
+		switch {
+		case unicode.IsSpace(r):
+		case unicode.Is(unicode.So, r):
+			symbols++
+		case unicode.In(r, unicode.Sk, unicode.Me), r == '\u200d', r == '\ufe0e', r == '\ufe0f',
+			r >= 0xE0020 && r <= 0xE007F: // ZWJ, variation selectors, tag sequences
+		default:
+			return false
+		}
+	}
+	return symbols > 0
+}
+
+// Save the comment rules (admin-only)
+func adminCommentRulesHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if !adminAuthorized(r) {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	var req adminCommentRulesRequest
+	if errs := bindAdminForm(r, &req); errs != nil {
+		renderAdmin(w, r, errs)
+		return
+	}
+
+	for key, value := range map[string]string{
+		"comment_min_length":    strconv.Itoa(req.MinLength),
+		"comment_no_shouting":   strconv.FormatBool(req.NoShouting),
+		"comment_no_repeats":    strconv.FormatBool(req.NoRepeats),
+		"comment_no_emoji_only": strconv.FormatBool(req.NoEmojiOnly),
+	} {
+		if err := setSetting(key, value); err != nil {
+			serverError(w, r, err)
+			return
+		}
+	}
+
+	http.Redirect(w, r, "/admin", http.StatusSeeOther)
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"os"
+	"time"
+)
+
+// Display name of the board: BOARD_NAME, else the name chosen at setup
+var boardName = "MacuRate"
+
+func loadBoardName() {
+	name := os.Getenv("BOARD_NAME")
+	if name == "" {
+		name = getSetting("board_name", "MacuRate")
+	}
+	configMu.Lock()
+	boardName = name
+	configMu.Unlock()
+}
+
+func currentBoardName() string {
+	configMu.RLock()
+	defer configMu.RUnlock()
+	return boardName
+}
+
+// Public runtime settings the frontend needs. Nothing secret goes in here.
+func publicConfig(ctx context.Context) (map[string]interface{}, error) {
+	tags, err := listReasonTags(ctx)
+	if err != nil {
+		return nil, err
+	}
+	reasons := []map[string]interface{}{}
+	for _, t := range tags {
+		reasons = append(reasons, map[string]interface{}{"id": t.ID, "label": t.Label})
+	}
+
+	dimensions, err := listDimensions(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if dimensions == nil {
+		dimensions = []Dimension{}
+	}
+
+	categories, err := listCategories(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if categories == nil {
+		categories = []Category{}
+	}
+
+	var closesAt interface{}
+	if t, ok := getVotingClosesAt(); ok {
+		closesAt = t.UTC().Format(time.RFC3339)
+	}
+
+	announcement, err := latestAnnouncement(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return map[string]interface{}{
+		"board_name":       currentBoardName(),
+		"announcement":     announcement,
+		"voting_mode":      getVotingMode(),
+		"vote_type":        getVoteType(),
+		"qv_budget":        getQuadraticBudget(),
+		"vote_dedup":       getVoteDedup(),
+		"display":          publicDisplayOptions(),
+		"scores_hidden":    scoresHidden(),
+		"voting_closed":    votingClosed(),
+		"voting_closes_at": closesAt,
+		"name_policy":      getNamePolicy(),
+		"comment_policy":   getCommentPolicy(),
+		"comment_required": map[string]bool{
+			"up":   commentRequired(getCommentPolicy(), true),
+			"down": commentRequired(getCommentPolicy(), false),
+		},
+		"comment_rules": getCommentRules(),
+		"reason_tags":   reasons,
+		"dimensions":    dimensions,
+		"categories":    categories,
+		"features": map[string]bool{
+			"translation": translator != nil,
+			"web_push":    vapid != nil,
+		},
+	}, nil
+}
+
+// Expose public runtime configuration as JSON
+func apiConfigHandler(w http.ResponseWriter, r *http.Request) {
+	cfg, err := publicConfig(r.Context())
+	if err != nil {
+		serverError(w, r, err)
+		return
+	}
+	w.Header().Set("Cache-Control", "no-cache")
+	writeJSON(w, http.StatusOK, cfg)
+}
@@ -0,0 +1,137 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Privacy policy and imprint pages, written by admins in Markdown and kept
+// in settings, plus an optional consent gate. With consent_required on, the
+// voter cookie (which remembers your votes, powers one-vote-per-person
+// limits, undo and follows) is only set after the visitor accepts it in the
+// banner. Declining still allows anonymous votes on boards without
+// per-voter limits.
+
+const consentCookieName = "macurate_consent"
+
+var errConsentRequired = errors.New("consent required")
+
+// The pages that exist, by path
+var legalPages = map[string]struct{ setting, title string }{
+	"privacy": {"page_privacy", "Privacy policy"},
+	"imprint": {"page_imprint", "Imprint"},
+}
+
+func consentRequired() bool {
+	return getSetting("consent_required", "false") == "true"
+}
+
+// "yes", "no", or "" when the visitor hasn't answered
+func consentAnswer(r *http.Request) string {
+	v, _ := readCookie(r, consentCookieName)
+	if v == "yes" || v == "no" {
+		return v
+	}
+	return ""
+}
+
+// Whether tracking cookies may be set for this visitor
+func trackingAllowed(r *http.Request) bool {
+	return !consentRequired() || consentAnswer(r) == "yes"
+}
+
+// Voting needs a stable voter id when the board limits votes per voter
+func voterTrackingNeeded() bool {
+	return getVotingMode() == votingModeQuadratic || getVoteDedup() != dedupOff
+}
+
+func writeConsentRequired(w http.ResponseWriter) {
+	writeError(w, http.StatusForbidden, "consent_required", "Please accept the voter cookie first; this board needs it to count votes fairly")
+}
+
+// Record the banner answer for a year and go back where the visitor was
+func consentHandler(w http.ResponseWriter, r *http.Request) {
+	var req consentRequest
+	if !bindForm(w, r, &req) {
+		return
+	}
+	answer := "no"
+	if req.Accept {
+		answer = "yes"
+	}
+	http.SetCookie(w, newCookie(r, consentCookieName, answer, time.Now().AddDate(1, 0, 0)))
+	if !req.Accept {
+		// Forget any voter id given out before the gate was switched on
+		http.SetCookie(w, newCookie(r, voterCookieName, "", time.Unix(0, 0)))
+	}
+	next := string(SafeURL(r.FormValue("next")))
+	if next == "#" || next == "" || next[0] != '/' {
+		next = "/"
+	}
+	http.Redirect(w, r, next, http.StatusSeeOther)
+}
+
+// GET /privacy and /imprint; 404 until an admin has written them
+func legalPageHandler(w http.ResponseWriter, r *http.Request) {
+	page, ok := legalPages[strings.TrimPrefix(r.URL.Path, "/")]
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+	body := getSetting(page.setting, "")
+	if body == "" {
+		http.NotFound(w, r)
+		return
+	}
+	tmpl := parseTemplates("templates/page.html")
+	data := map[string]interface{}{
+		"BoardName": currentBoardName(),
+		"Title":     page.title,
+		"Body":      renderMarkdown(body),
+	}
+	if err := tmpl.Execute(w, data); err != nil {
+		serverError(w, r, err)
+	}
+}
+
+// Which legal pages have content, for footer links
+func legalPageLinks() map[string]bool {
+	links := map[string]bool{}
+	for path, page := range legalPages {
+		links[path] = getSetting(page.setting, "") != ""
+	}
+	return links
+}
+
+// Edit the legal pages and the consent switch (admin-only)
+func adminLegalHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if !adminAuthorized(r) {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	var req adminLegalRequest
+	if errs := bindAdminForm(r, &req); errs != nil {
+		renderAdmin(w, r, errs)
+		return
+	}
+	for key, value := range map[string]string{
+		"page_privacy":     req.Privacy,
+		"page_imprint":     req.Imprint,
+		"consent_required": strconv.FormatBool(req.ConsentRequired),
+	} {
+		if err := setSetting(key, value); err != nil {
+			serverError(w, r, err)
+			return
+		}
+	}
+
+	http.Redirect(w, r, "/admin", http.StatusSeeOther)
+}
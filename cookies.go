@@ -0,0 +1,118 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+// Cookie attributes, from COOKIE_SECURE (auto|true|false), COOKIE_SAMESITE
+// (lax|strict|none), COOKIE_DOMAIN, COOKIE_PATH and COOKIE_HOST_PREFIX.
+// TRUST_PROXY=true lets X-Forwarded-Proto decide whether a request is HTTPS
+// and X-Forwarded-For name the client.
+type cookieConfig struct {
+	Secure     string // "auto", "true" or "false"
+	SameSite   http.SameSite
+	Domain     string
+	Path       string
+	HostPrefix bool // __Host- names: Secure, Path=/, no Domain
+	TrustProxy bool
+}
+
+var cookieCfg = cookieConfig{Secure: "auto", SameSite: http.SameSiteLaxMode, Path: "/"}
+
+func loadCookieConfig() error {
+	cfg := cookieConfig{
+		Secure:     strings.ToLower(os.Getenv("COOKIE_SECURE")),
+		Domain:     os.Getenv("COOKIE_DOMAIN"),
+		Path:       os.Getenv("COOKIE_PATH"),
+		HostPrefix: os.Getenv("COOKIE_HOST_PREFIX") == "true",
+		TrustProxy: os.Getenv("TRUST_PROXY") == "true",
+	}
+	switch cfg.Secure {
+	case "":
+		cfg.Secure = "auto"
+	case "auto", "true", "false":
+	default:
+		return fmt.Errorf("COOKIE_SECURE must be auto, true or false, got %q", cfg.Secure)
+	}
+	switch strings.ToLower(os.Getenv("COOKIE_SAMESITE")) {
+	case "", "lax":
+		cfg.SameSite = http.SameSiteLaxMode
+	case "strict":
+		cfg.SameSite = http.SameSiteStrictMode
+	case "none":
+		cfg.SameSite = http.SameSiteNoneMode
+	default:
+		return fmt.Errorf("COOKIE_SAMESITE must be lax, strict or none")
+	}
+	if cfg.Path == "" {
+		cfg.Path = "/"
+	}
+	if cfg.HostPrefix {
+		if cfg.Domain != "" || cfg.Path != "/" {
+			return fmt.Errorf("COOKIE_HOST_PREFIX requires COOKIE_PATH=/ and no COOKIE_DOMAIN")
+		}
+		if cfg.Secure == "false" {
+			return fmt.Errorf("COOKIE_HOST_PREFIX requires secure cookies")
+		}
+		cfg.Secure = "true"
+	}
+	if cfg.SameSite == http.SameSiteNoneMode && cfg.Secure == "false" {
+		return fmt.Errorf("COOKIE_SAMESITE=none requires secure cookies")
+	}
+	cookieCfg = cfg
+	return nil
+}
+
+// Whether the client reached us over HTTPS, directly or via a trusted proxy
+func isHTTPS(r *http.Request) bool {
+	if r.TLS != nil {
+		return true
+	}
+	return cookieCfg.TrustProxy && strings.EqualFold(r.Header.Get("X-Forwarded-Proto"), "https")
+}
+
+// Full cookie name, with the __Host- prefix when enabled
+func cookieName(base string) string {
+	if cookieCfg.HostPrefix {
+		return "__Host-" + base
+	}
+	return base
+}
+
+// Read a cookie by its base name
+func readCookie(r *http.Request, base string) (string, bool) {
+	c, err := r.Cookie(cookieName(base))
+	if err != nil || c.Value == "" {
+		return "", false
+	}
+	return c.Value, true
+}
+
+// Build an HttpOnly cookie with the configured attributes. A zero expires
+// makes a deleting cookie.
+func newCookie(r *http.Request, base, value string, expires time.Time) *http.Cookie {
+	c := &http.Cookie{
+		Name:     cookieName(base),
+		Value:    value,
+		Path:     cookieCfg.Path,
+		Domain:   cookieCfg.Domain,
+		HttpOnly: true,
+		SameSite: cookieCfg.SameSite,
+	}
+	switch cookieCfg.Secure {
+	case "true":
+		c.Secure = true
+	case "auto":
+		c.Secure = isHTTPS(r)
+	}
+	if expires.IsZero() {
+		c.MaxAge = -1
+	} else {
+		c.Expires = expires
+	}
+	return c
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// Riding out a database outage (a Postgres restart, a failover). A
+// background ping tracks whether the database answers; /readyz reports it
+// so a load balancer can route around this instance. Meanwhile failures
+// that mean "no database" answer 503 database_unavailable with a
+// Retry-After instead of a 500, settings fall back to their last known
+// values, and the board and /api/people serve the last people list they
+// loaded, marked with X-Stale-Since. database/sql reconnects by itself, so
+// everything recovers once the database is back.
+
+const dbPingInterval = 5 * time.Second
+
+var dbHealth struct {
+	mu      sync.Mutex
+	down    bool
+	since   time.Time // of the current state
+	lastErr string
+}
+
+// Whether err means the database can't be reached, rather than a bad query
+func dbUnavailable(err error) bool {
+	var pqErr *pq.Error
+	var netErr net.Error
+	switch {
+	case err == nil:
+		return false
+	case errors.Is(err, driver.ErrBadConn), errors.Is(err, io.EOF), errors.Is(err, io.ErrUnexpectedEOF),
+		errors.Is(err, syscall.ECONNREFUSED), errors.Is(err, syscall.ECONNRESET):
+		return true
+	case errors.As(err, &pqErr):
+		// Class 08 is connection exceptions; 57P01-57P03 a server
+		// shutting down or still starting
+		return pqErr.Code.Class() == "08" || pqErr.Code == "57P01" || pqErr.Code == "57P02" || pqErr.Code == "57P03"
+	case errors.As(err, &netErr):
+		return true
+	}
+	return false
+}
+
+func markDBDown(err error) {
+	dbHealth.mu.Lock()
+	defer dbHealth.mu.Unlock()
+	dbHealth.lastErr = err.Error()
+	if !dbHealth.down {
+		dbHealth.down, dbHealth.since = true, time.Now()
+		slog.Error("database unavailable", "err", err)
+	}
+}
+
+func markDBUp() {
+	dbHealth.mu.Lock()
+	defer dbHealth.mu.Unlock()
+	if dbHealth.down {
+		slog.Info("database is back", "after", time.Since(dbHealth.since).Round(time.Second))
+		dbHealth.down, dbHealth.since, dbHealth.lastErr = false, time.Now(), ""
+		// Anything cached during the outage may be older than it looks
+		invalidatePeopleCache()
+	}
+}
+
+func dbIsDown() bool {
+	dbHealth.mu.Lock()
+	defer dbHealth.mu.Unlock()
+	return dbHealth.down
+}
+
+func startDBHealthCheck() {
+	go func() {
+		for range time.Tick(dbPingInterval) {
+			ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+			err := db.PingContext(ctx)
+			cancel()
+			if err != nil {
+				markDBDown(err)
+			} else {
+				markDBUp()
+			}
+		}
+	}()
+}
+
+// Answer a request that needed the database while it is away
+func writeDBUnavailable(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Retry-After", strconv.Itoa(int(dbPingInterval.Seconds())))
+	httpError(w, r, http.StatusServiceUnavailable, "database_unavailable", "The board's database is unavailable right now. Please try again shortly.")
+}
+
+// Mark a response as built from data loaded at t
+func setStaleHeader(w http.ResponseWriter, t time.Time) {
+	w.Header().Set("X-Stale-Since", t.UTC().Format(time.RFC3339))
+}
+
+// GET /readyz: 200 while the database answers, 503 while it doesn't
+func readyzHandler(w http.ResponseWriter, r *http.Request) {
+	dbHealth.mu.Lock()
+	down, since, lastErr := dbHealth.down, dbHealth.since, dbHealth.lastErr
+	dbHealth.mu.Unlock()
+	w.Header().Set("Cache-Control", "no-store")
+	if down {
+		writeJSON(w, http.StatusServiceUnavailable, map[string]interface{}{
+			"status": "unavailable",
+			"since":  since.UTC(),
+			"error":  lastErr,
+		})
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{"status": "ok"})
+}
@@ -0,0 +1,287 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	debugRingSize    = 200
+	debugBodyMaxSize = 4096
+)
+
+// RecordedExchange is a sanitized failing request with the response sent.
+type RecordedExchange struct {
+	Time           time.Time
+	Method         string
+	Path           string
+	Query          string
+	RequestHeader  http.Header
+	RequestBody    string
+	Status         int
+	ResponseHeader http.Header
+	ResponseBody   string
+	Duration       time.Duration
+}
+
+// Ring buffer of the most recent failing API exchanges
+type exchangeRing struct {
+	mu    sync.Mutex
+	items []RecordedExchange
+	next  int
+	full  bool
+}
+
+func (r *exchangeRing) add(e RecordedExchange) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.items == nil {
+		r.items = make([]RecordedExchange, debugRingSize)
+	}
+	r.items[r.next] = e
+	r.next = (r.next + 1) % debugRingSize
+	if r.next == 0 {
+		r.full = true
+	}
+}
+
+// Newest first
+func (r *exchangeRing) list() []RecordedExchange {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	n := r.next
+	if r.full {
+		n = debugRingSize
+	}
+	out := make([]RecordedExchange, 0, n)
+	for i := 0; i < n; i++ {
+		idx := (r.next - 1 - i + debugRingSize) % debugRingSize
+		out = append(out, r.items[idx])
+	}
+	return out
+}
+
+func (r *exchangeRing) clear() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.items, r.next, r.full = nil, 0, false
+}
+
+var (
+	debugRecording atomic.Bool // mirrors the debug_recording setting
+	debugRing      exchangeRing
+)
+
+// Headers and parameters that must never end up in the ring buffer
+var sensitiveHeaders = []string{"Authorization", "Cookie", "Set-Cookie", "X-Api-Key"}
+var sensitiveParams = []string{"pass", "password", "token", "api_key"}
+
+// Requests that count as API calls for recording purposes
+func isRecordedPath(path string) bool {
+	return strings.HasPrefix(path, "/api/") || path == "/vote" || path == "/comments"
+}
+
+// Record failing API requests (4xx/5xx) while debug recording is enabled.
+// It sits inside withCompression so the body it keeps is the one the
+// handler wrote, not gzip.
+func withDebugRecorder(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !debugRecording.Load() || !isRecordedPath(r.URL.Path) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		var reqBody []byte
+		if r.Body != nil {
+			reqBody, _ = io.ReadAll(io.LimitReader(r.Body, debugBodyMaxSize))
+			r.Body = struct {
+				io.Reader
+				io.Closer
+			}{io.MultiReader(bytes.NewReader(reqBody), r.Body), r.Body}
+		}
+
+		rec := &recordingWriter{ResponseWriter: w, status: http.StatusOK}
+		start := time.Now()
+		next.ServeHTTP(rec, r)
+		if rec.status < 400 {
+			return
+		}
+
+		debugRing.add(RecordedExchange{
+			Time:           start,
+			Method:         r.Method,
+			Path:           r.URL.Path,
+			Query:          sanitizeQuery(r.URL.RawQuery),
+			RequestHeader:  sanitizeHeader(r.Header),
+			RequestBody:    sanitizeBody(r.Header.Get("Content-Type"), reqBody),
+			Status:         rec.status,
+			ResponseHeader: sanitizeHeader(rec.Header()),
+			ResponseBody:   sanitizeBody(rec.Header().Get("Content-Type"), rec.body.Bytes()),
+			Duration:       time.Since(start),
+		})
+	})
+}
+
+// ResponseWriter that remembers the status and the start of the body
+type recordingWriter struct {
+	http.ResponseWriter
+	status      int
+	wroteHeader bool
+	body        bytes.Buffer
+}
+
+func (w *recordingWriter) WriteHeader(status int) {
+	if !w.wroteHeader {
+		w.status = status
+		w.wroteHeader = true
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *recordingWriter) Write(b []byte) (int, error) {
+	w.wroteHeader = true
+	if room := debugBodyMaxSize - w.body.Len(); room > 0 {
+		if len(b) < room {
+			room = len(b)
+		}
+		w.body.Write(b[:room])
+	}
+	return w.ResponseWriter.Write(b)
+}
+
+func (w *recordingWriter) Flush() {
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+func (w *recordingWriter) Unwrap() http.ResponseWriter { return w.ResponseWriter }
+
+func sanitizeHeader(h http.Header) http.Header {
+	out := h.Clone()
+	for _, k := range sensitiveHeaders {
+		if out.Get(k) != "" {
+			out.Set(k, "[redacted]")
+		}
+	}
+	return out
+}
+
+func sanitizeValues(v url.Values) string {
+	for _, k := range sensitiveParams {
+		if _, ok := v[k]; ok {
+			v.Set(k, "[redacted]")
+		}
+	}
+	return v.Encode()
+}
+
+func sanitizeQuery(raw string) string {
+	v, err := url.ParseQuery(raw)
+	if err != nil {
+		return "[unparseable]"
+	}
+	return sanitizeValues(v)
+}
+
+// Form and JSON bodies get sensitive fields redacted; multipart uploads
+// are dropped, and so is JSON that can't be parsed (cut off at
+// debugBodyMaxSize, say), since it can't be checked
+func sanitizeBody(contentType string, body []byte) string {
+	switch {
+	case len(body) == 0:
+		return ""
+	case strings.HasPrefix(contentType, "application/x-www-form-urlencoded"):
+		return sanitizeQuery(string(body))
+	case strings.HasPrefix(contentType, "multipart/"):
+		return "[multipart body omitted]"
+	case strings.HasPrefix(contentType, "application/json"), strings.HasSuffix(strings.SplitN(contentType, ";", 2)[0], "+json"):
+		var v interface{}
+		if err := json.Unmarshal(body, &v); err != nil {
+			return "[unparseable JSON body omitted]"
+		}
+		out, err := json.Marshal(redactJSON(v))
+		if err != nil {
+			return "[unparseable JSON body omitted]"
+		}
+		return string(out)
+	}
+	return string(body)
+}
+
+// Replace the values of sensitive keys at any depth
+func redactJSON(v interface{}) interface{} {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		for k, val := range v {
+			if isSensitiveParam(k) {
+				v[k] = "[redacted]"
+			} else {
+				v[k] = redactJSON(val)
+			}
+		}
+	case []interface{}:
+		for i, val := range v {
+			v[i] = redactJSON(val)
+		}
+	}
+	return v
+}
+
+func isSensitiveParam(key string) bool {
+	for _, k := range sensitiveParams {
+		if strings.EqualFold(k, key) {
+			return true
+		}
+	}
+	return false
+}
+
+// Load the recording flag from settings at startup
+func loadDebugRecording() {
+	debugRecording.Store(getBoolSetting("debug_recording", false))
+}
+
+// View recorded failing requests; POST toggles recording or clears the buffer (admin-only)
+func adminDebugRequestsHandler(w http.ResponseWriter, r *http.Request) {
+	if !adminAuthorized(r) {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	if r.Method == http.MethodPost {
+		switch action := r.FormValue("action"); action {
+		case "enable", "disable":
+			on := action == "enable"
+			if err := setSetting("debug_recording", strconv.FormatBool(on)); err != nil {
+				serverError(w, r, err)
+				return
+			}
+			debugRecording.Store(on)
+		case "clear":
+			debugRing.clear()
+		default:
+			http.Error(w, "Invalid action", http.StatusBadRequest)
+			return
+		}
+		http.Redirect(w, r, "/admin/debug/requests", http.StatusSeeOther)
+		return
+	}
+
+	tmpl := parseTemplates("templates/debug_requests.html")
+	data := map[string]interface{}{
+		"Enabled":   debugRecording.Load(),
+		"Exchanges": debugRing.list(),
+	}
+	if err := tmpl.Execute(w, data); err != nil {
+		serverError(w, r, err)
+	}
+}
@@ -0,0 +1,23 @@
+package main
+
+import "testing"
+
+func TestSanitizeBody(t *testing.T) {
+	tests := []struct {
+		name, contentType, body, want string
+	}{
+		{"empty", "application/json", "", ""},
+		{"form", "application/x-www-form-urlencoded", "pass=hunter2&person_id=3", "pass=%5Bredacted%5D&person_id=3"},
+		{"multipart", "multipart/form-data; boundary=x", "--x\r\n", "[multipart body omitted]"},
+		{"json", "application/json", `{"person_id":3,"password":"hunter2"}`, `{"password":"[redacted]","person_id":3}`},
+		{"json nested", "application/json; charset=utf-8", `{"auth":{"Token":"abc"},"list":[{"api_key":"k"}]}`, `{"auth":{"Token":"[redacted]"},"list":[{"api_key":"[redacted]"}]}`},
+		{"problem json", "application/problem+json", `{"pass":"x"}`, `{"pass":"[redacted]"}`},
+		{"json cut off", "application/json", `{"password":"hunt`, "[unparseable JSON body omitted]"},
+		{"plain text", "text/plain", "not found", "not found"},
+	}
+	for _, tt := range tests {
+		if got := sanitizeBody(tt.contentType, []byte(tt.body)); got != tt.want {
+			t.Errorf("%s: sanitizeBody(%q) = %q, want %q", tt.name, tt.body, got, tt.want)
+		}
+	}
+}
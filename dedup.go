@@ -0,0 +1,40 @@
+package main
+
+import "database/sql"
+
+// Duplicate vote policies for up/down voting, keyed on the voter cookie:
+// any number of votes, one per person ever, or one per person per day.
+const (
+	dedupOff   = "off"
+	dedupOnce  = "once"
+	dedupDaily = "daily"
+)
+
+func getVoteDedup() string {
+	switch v := getSetting("vote_dedup", dedupOff); v {
+	case dedupOnce, dedupDaily:
+		return v
+	}
+	return dedupOff
+}
+
+// Whether voterID already used their vote on personID in dimensionID (0
+// for none) under the policy. Takes the voter's lock so two concurrent
+// votes can't both pass.
+func duplicateVote(tx *sql.Tx, policy, voterID string, personID, dimensionID int) (bool, error) {
+	if policy == dedupOff {
+		return false, nil
+	}
+	if _, err := tx.Exec("SELECT pg_advisory_xact_lock(hashtext($1))", voterID); err != nil {
+		return false, err
+	}
+	var exists bool
+	err := tx.QueryRow(`
+        SELECT EXISTS (
+            SELECT 1 FROM votes
+            WHERE voter_id = $1 AND person_id = $2 AND upvote IS NOT NULL
+              AND COALESCE(dimension_id, 0) = $4
+              AND ($3 = 'once' OR created_at >= date_trunc('day', NOW()))
+        )`, voterID, personID, policy, dimensionID).Scan(&exists)
+	return exists, err
+}
@@ -0,0 +1,154 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Announcement is a board-wide message shown above the leaderboard.
+type Announcement struct {
+	ID        int       `json:"id"`
+	Body      string    `json:"body"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+const digestInterval = 7 * 24 * time.Hour
+
+func createDigestTables() error {
+	_, err := db.Exec(`
+    CREATE TABLE IF NOT EXISTS announcements (
+        id SERIAL PRIMARY KEY,
+        kind TEXT NOT NULL DEFAULT 'digest',
+        body TEXT NOT NULL,
+        created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+    );
+    `)
+	return err
+}
+
+func weeklyDigestEnabled() bool {
+	return getBoolSetting("weekly_digest", false)
+}
+
+// Newest announcement, or nil when there is none
+func latestAnnouncement(ctx context.Context) (*Announcement, error) {
+	var a Announcement
+	err := db.QueryRowContext(ctx, "SELECT id, body, created_at FROM announcements ORDER BY id DESC LIMIT 1").
+		Scan(&a.ID, &a.Body, &a.CreatedAt)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	return &a, nil
+}
+
+// Background loop posting the weekly digest once a week while enabled
+func startDigestScheduler() {
+	go func() {
+		for range time.Tick(time.Hour) {
+			if !weeklyDigestEnabled() {
+				continue
+			}
+			if err := runExclusive("digest", postDigestIfDue); err != nil {
+				slog.Error("digest failed", "err", err)
+			}
+		}
+	}()
+}
+
+func postDigestIfDue() error {
+	var last sql.NullTime
+	if err := db.QueryRow("SELECT MAX(created_at) FROM announcements WHERE kind = 'digest'").Scan(&last); err != nil {
+		return err
+	}
+	if last.Valid && time.Since(last.Time) < digestInterval {
+		return nil
+	}
+	return postWeeklyDigest()
+}
+
+// Summarize the last week's activity as an announcement. The top gainer is
+// left out while scores are hidden.
+func postWeeklyDigest() error {
+	var parts []string
+
+	if publicDisplayOptions().ShowScores {
+		var name string
+		var gain int
+		err := db.QueryRow(`
+            SELECT p.name, SUM(CASE WHEN v.upvote THEN 1 ELSE -1 END) AS gain
+            FROM votes v JOIN people p ON p.id = v.person_id
+            WHERE v.created_at > NOW() - INTERVAL '7 days' AND v.upvote IS NOT NULL
+            GROUP BY p.id, p.name
+            ORDER BY gain DESC, p.name
+            LIMIT 1`).Scan(&name, &gain)
+		if err != nil && err != sql.ErrNoRows {
+			return err
+		}
+		if err == nil && gain > 0 {
+			parts = append(parts, fmt.Sprintf("Top gainer: %s +%d", name, gain))
+		}
+	}
+
+	var name string
+	var comments int
+	err := db.QueryRow(`
+        SELECT p.name, COUNT(*) AS n
+        FROM votes v JOIN people p ON p.id = v.person_id
+        WHERE v.created_at > NOW() - INTERVAL '7 days'
+          AND COALESCE(TRIM(v.comment), '') <> '' AND v.status = 'approved'
+        GROUP BY p.id, p.name
+        ORDER BY n DESC, p.name
+        LIMIT 1`).Scan(&name, &comments)
+	if err != nil && err != sql.ErrNoRows {
+		return err
+	}
+	if err == nil {
+		parts = append(parts, fmt.Sprintf("most debated: %s with %d comments", name, comments))
+	}
+
+	body := "A quiet week: no new votes."
+	if len(parts) > 0 {
+		body = "This week – " + strings.Join(parts, "; ") + "."
+	}
+	_, err = db.Exec("INSERT INTO announcements (kind, body) VALUES ('digest', $1)", body)
+	return err
+}
+
+// Toggle the weekly digest or post one right away (admin-only)
+func adminDigestHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if !adminAuthorized(r) {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	var err error
+	switch r.FormValue("action") {
+	case "settings":
+		err = setSetting("weekly_digest", strconv.FormatBool(r.FormValue("enabled") != ""))
+	case "post":
+		err = postWeeklyDigest()
+	case "clear":
+		_, err = db.ExecContext(r.Context(), "DELETE FROM announcements")
+	default:
+		http.Error(w, "Invalid action", http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		serverError(w, r, err)
+		return
+	}
+
+	http.Redirect(w, r, "/admin", http.StatusSeeOther)
+}
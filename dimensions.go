@@ -0,0 +1,129 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"strings"
+
+	"macurate/validation"
+)
+
+// Rating dimensions let voters say what a vote is about ("helpfulness",
+// "humor"). A vote names at most one; votes without one still count
+// towards the overall score, which stays the sum of every vote. With a
+// dedup policy on, a voter gets one vote per person in each dimension.
+
+// Dimension is an admin-defined axis votes can be cast on.
+type Dimension struct {
+	ID   int    `json:"id"`
+	Name string `json:"name"`
+}
+
+func createDimensionTables() error {
+	_, err := db.Exec(`
+    CREATE TABLE IF NOT EXISTS dimensions (
+        id SERIAL PRIMARY KEY,
+        name TEXT NOT NULL UNIQUE
+    );
+    ALTER TABLE votes ADD COLUMN IF NOT EXISTS dimension_id INTEGER REFERENCES dimensions(id) ON DELETE SET NULL;
+    `)
+	return err
+}
+
+// List all dimensions in name order
+func listDimensions(ctx context.Context) ([]Dimension, error) {
+	rows, err := db.QueryContext(ctx, "SELECT id, name FROM dimensions ORDER BY name")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var dims []Dimension
+	for rows.Next() {
+		var d Dimension
+		if err := rows.Scan(&d.ID, &d.Name); err != nil {
+			return nil, err
+		}
+		dims = append(dims, d)
+	}
+	return dims, rows.Err()
+}
+
+func dimensionExists(ctx context.Context, id int) (bool, error) {
+	var ok bool
+	err := db.QueryRowContext(ctx, "SELECT EXISTS (SELECT 1 FROM dimensions WHERE id = $1)", id).Scan(&ok)
+	return ok, err
+}
+
+// Net score per dimension for every person, keyed by person id, then
+// dimension name. Dimensions without votes for someone are left out.
+func dimensionScoresByPerson(ctx context.Context) (map[int]map[string]int, error) {
+	rows, err := db.QueryContext(ctx, `
+        SELECT v.person_id, d.name, SUM(CASE WHEN v.upvote THEN 1 ELSE -1 END)
+        FROM votes v
+        JOIN dimensions d ON d.id = v.dimension_id
+        WHERE v.upvote IS NOT NULL
+        GROUP BY v.person_id, d.name`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	scores := make(map[int]map[string]int)
+	for rows.Next() {
+		var personID, score int
+		var name string
+		if err := rows.Scan(&personID, &name, &score); err != nil {
+			return nil, err
+		}
+		if scores[personID] == nil {
+			scores[personID] = map[string]int{}
+		}
+		scores[personID][name] = score
+	}
+	return scores, rows.Err()
+}
+
+// Create or delete a dimension (admin-only). Deleting one keeps its votes
+// in the overall score.
+func adminDimensionsHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if !adminAuthorized(r) {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	var req adminDimensionRequest
+	if errs := bindAdminForm(r, &req); errs != nil {
+		renderAdmin(w, r, errs)
+		return
+	}
+
+	switch req.Action {
+	case "add":
+		name := strings.TrimSpace(req.Name)
+		if name == "" {
+			renderAdmin(w, r, validation.Errors{"dimension_name": "is required"})
+			return
+		}
+		if _, err := db.ExecContext(r.Context(), "INSERT INTO dimensions (name) VALUES ($1) ON CONFLICT (name) DO NOTHING", name); err != nil {
+			serverError(w, r, err)
+			return
+		}
+	case "delete":
+		if req.ID == 0 {
+			renderAdmin(w, r, validation.Errors{"id": "is required"})
+			return
+		}
+		if _, err := db.ExecContext(r.Context(), "DELETE FROM dimensions WHERE id=$1", req.ID); err != nil {
+			serverError(w, r, err)
+			return
+		}
+	}
+	invalidatePeopleCache()
+
+	http.Redirect(w, r, "/admin", http.StatusSeeOther)
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// DisplayOptions controls what the public pages and API show by default.
+type DisplayOptions struct {
+	SortOrder       string `json:"sort_order"`
+	ShowScores      bool   `json:"show_scores"`
+	ShowVoteCounts  bool   `json:"show_vote_counts"`
+	CommentsEnabled bool   `json:"comments_enabled"`
+}
+
+// Settings keys for the boolean display options and their built-in defaults
+var displayDefaults = map[string]bool{
+	"show_scores":      true,
+	"show_vote_counts": false,
+	"comments_enabled": true,
+}
+
+// Seed display settings from DEFAULT_SHOW_SCORES, DEFAULT_SHOW_VOTE_COUNTS
+// and DEFAULT_COMMENTS_ENABLED. Values already chosen by an admin are kept.
+func seedDisplaySettings() error {
+	for key, def := range displayDefaults {
+		value := strconv.FormatBool(def)
+		if v := os.Getenv("DEFAULT_" + strings.ToUpper(key)); v != "" {
+			b, err := strconv.ParseBool(v)
+			if err != nil {
+				return fmt.Errorf("DEFAULT_%s: %v", strings.ToUpper(key), err)
+			}
+			value = strconv.FormatBool(b)
+		}
+		if _, err := db.Exec(
+			"INSERT INTO settings (key, value) VALUES ($1, $2) ON CONFLICT (key) DO NOTHING",
+			key, value,
+		); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Initial sort order for a fresh deployment, from DEFAULT_SORT_ORDER
+func defaultSortOrder() string {
+	switch v := os.Getenv("DEFAULT_SORT_ORDER"); v {
+	case "name", "score_desc", "upvotes_desc":
+		return v
+	}
+	return "name"
+}
+
+// Read a boolean setting, falling back to def when missing or malformed
+func getBoolSetting(key string, def bool) bool {
+	b, err := strconv.ParseBool(getSetting(key, strconv.FormatBool(def)))
+	if err != nil {
+		return def
+	}
+	return b
+}
+
+// Helper to read current display options from settings
+func getDisplayOptions() DisplayOptions {
+	return DisplayOptions{
+		SortOrder:       getSortOrder(),
+		ShowScores:      getBoolSetting("show_scores", displayDefaults["show_scores"]),
+		ShowVoteCounts:  getBoolSetting("show_vote_counts", displayDefaults["show_vote_counts"]),
+		CommentsEnabled: getBoolSetting("comments_enabled", displayDefaults["comments_enabled"]),
+	}
+}
+
+// Update display options (admin-only)
+func adminDisplayHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if !adminAuthorized(r) {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	var req adminDisplayRequest
+	if errs := bindAdminForm(r, &req); errs != nil {
+		renderAdmin(w, r, errs)
+		return
+	}
+
+	for key, value := range map[string]bool{
+		"show_scores":      req.ShowScores,
+		"show_vote_counts": req.ShowVoteCounts,
+		"comments_enabled": req.CommentsEnabled,
+	} {
+		if err := setSetting(key, strconv.FormatBool(value)); err != nil {
+			serverError(w, r, err)
+			return
+		}
+	}
+
+	http.Redirect(w, r, "/admin", http.StatusSeeOther)
+}
@@ -0,0 +1,148 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"log/slog"
+	"net"
+	"net/http"
+	"os"
+	"regexp"
+	"strings"
+	"sync"
+
+	"golang.org/x/crypto/acme/autocert"
+)
+
+// Custom domains: a team can get its own hostname (votes.teamname.example.com)
+// pointing at this instance. Requests arriving on that host see a board with
+// just the team's members. With AUTOCERT_DIR set, certificates for the main
+// hosts (AUTOCERT_HOSTS) and every team domain are fetched from Let's Encrypt.
+
+var (
+	domainsMu   sync.RWMutex
+	teamDomains = map[string]int{} // hostname -> team id
+)
+
+var (
+	errInvalidHostname = errors.New("is not a valid hostname")
+	errDomainTaken     = errors.New("is already used by another team")
+)
+
+var hostnamePattern = regexp.MustCompile(`^([a-z0-9]([a-z0-9-]*[a-z0-9])?\.)+[a-z]{2,}$`)
+
+func createDomainTables() error {
+	_, err := db.Exec(`ALTER TABLE teams ADD COLUMN IF NOT EXISTS domain TEXT UNIQUE`)
+	return err
+}
+
+// Refresh the hostname cache; called on startup and after admin changes.
+func loadTeamDomains() error {
+	rows, err := db.Query("SELECT domain, id FROM teams WHERE domain IS NOT NULL")
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	domains := map[string]int{}
+	for rows.Next() {
+		var host string
+		var id int
+		if err := rows.Scan(&host, &id); err != nil {
+			return err
+		}
+		domains[host] = id
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	domainsMu.Lock()
+	teamDomains = domains
+	domainsMu.Unlock()
+	return nil
+}
+
+func normalizeHost(host string) string {
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	return strings.TrimSuffix(strings.ToLower(host), ".")
+}
+
+// Team whose board the request's Host maps to, or 0 for the main board.
+func hostTeamID(r *http.Request) int {
+	domainsMu.RLock()
+	defer domainsMu.RUnlock()
+	return teamDomains[normalizeHost(r.Host)]
+}
+
+// Point a hostname at a team; an empty domain removes the mapping.
+func setTeamDomain(teamID int, domain string) error {
+	domain = normalizeHost(domain)
+	if domain != "" && !hostnamePattern.MatchString(domain) {
+		return errInvalidHostname
+	}
+	var taken bool
+	if err := db.QueryRow("SELECT EXISTS (SELECT 1 FROM teams WHERE domain = $1 AND id <> $2)", domain, teamID).Scan(&taken); err != nil {
+		return err
+	} else if taken {
+		return errDomainTaken
+	}
+	if _, err := db.Exec("UPDATE teams SET domain = NULLIF($1, '') WHERE id = $2", domain, teamID); err != nil {
+		return err
+	}
+	notifyInstances("teams")
+	return loadTeamDomains()
+}
+
+// Only issue certificates for hosts we actually serve.
+func autocertHostPolicy(baseHosts []string) autocert.HostPolicy {
+	return func(_ context.Context, host string) error {
+		host = normalizeHost(host)
+		for _, h := range baseHosts {
+			if host == h {
+				return nil
+			}
+		}
+		domainsMu.RLock()
+		_, ok := teamDomains[host]
+		domainsMu.RUnlock()
+		if !ok {
+			return fmt.Errorf("autocert: host %q is not configured", host)
+		}
+		return nil
+	}
+}
+
+// Switch srv to HTTPS on :443 with per-host certificates and start the ACME
+// challenge / HTTPS redirect listener on :80. Returns false when AUTOCERT_DIR
+// is unset.
+func useAutocert(srv *http.Server) bool {
+	dir := os.Getenv("AUTOCERT_DIR")
+	if dir == "" {
+		return false
+	}
+	var baseHosts []string
+	for _, h := range strings.Split(os.Getenv("AUTOCERT_HOSTS"), ",") {
+		if h = normalizeHost(strings.TrimSpace(h)); h != "" {
+			baseHosts = append(baseHosts, h)
+		}
+	}
+	m := &autocert.Manager{
+		Prompt:     autocert.AcceptTOS,
+		Cache:      autocert.DirCache(dir),
+		HostPolicy: autocertHostPolicy(baseHosts),
+		Email:      os.Getenv("AUTOCERT_EMAIL"),
+	}
+
+	go func() {
+		log.Fatal(http.ListenAndServe(":http", m.HTTPHandler(nil)))
+	}()
+	srv.Addr = ":https"
+	srv.TLSConfig = m.TLSConfig()
+	slog.Info("using autocert", "hosts", baseHosts)
+	return true
+}
@@ -0,0 +1,27 @@
+package main
+
+import (
+	"database/sql"
+	"net/http"
+	"strconv"
+)
+
+// Destructive admin operations (DELETE /admin/api/people/{id}, imports) take
+// dry_run=true, and the import and archive commands -dry-run. The storage
+// functions do the real work inside their transaction either way and only
+// skip the commit on a dry run, so the preview they report is exactly what
+// a real run would have done. Archiving spans two databases and counts
+// instead.
+
+func dryRunRequested(r *http.Request) bool {
+	v, _ := strconv.ParseBool(r.FormValue("dry_run"))
+	return v
+}
+
+// Commit, or roll back when this was only a preview
+func finishTx(tx *sql.Tx, dryRun bool) error {
+	if dryRun {
+		return tx.Rollback()
+	}
+	return tx.Commit()
+}
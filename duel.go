@@ -0,0 +1,190 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"macurate/ranking"
+	"macurate/validation"
+)
+
+// Head-to-head voting: voters are shown two people and pick the better
+// one, and both ratings move by Elo (ranking.EloDuel). Unlike the +1/-1
+// score this doesn't reward having been on the board longest, since a
+// win over someone rated low is worth little. Ratings live in
+// people.elo_rating, every duel in duels; a voter gets to judge each pair
+// once.
+
+// Duelist is one side of a duel.
+type Duelist struct {
+	PublicID string   `json:"public_id"`
+	Name     string   `json:"name"`
+	Team     string   `json:"team,omitempty"`
+	Rating   *float64 `json:"rating"` // null while scores are hidden
+}
+
+func createDuelTables() error {
+	_, err := db.Exec(`
+    ALTER TABLE people ADD COLUMN IF NOT EXISTS elo_rating DOUBLE PRECISION NOT NULL DEFAULT 1500;
+    CREATE TABLE IF NOT EXISTS duels (
+        id SERIAL PRIMARY KEY,
+        winner_id INTEGER NOT NULL REFERENCES people(id) ON DELETE CASCADE,
+        loser_id INTEGER NOT NULL REFERENCES people(id) ON DELETE CASCADE,
+        voter_id TEXT NOT NULL,
+        created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+    );
+    CREATE UNIQUE INDEX IF NOT EXISTS duels_voter_pair_idx
+        ON duels (voter_id, LEAST(winner_id, loser_id), GREATEST(winner_id, loser_id));
+    `)
+	return err
+}
+
+var errDuelTaken = errors.New("duel already recorded")
+
+// Record that winner beat loser and update both ratings, in id order so
+// two duels over the same people can't deadlock
+func recordDuel(ctx context.Context, voterID string, winner, loser int) (float64, float64, error) {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, 0, err
+	}
+	defer tx.Rollback()
+
+	res, err := tx.ExecContext(ctx, `
+        INSERT INTO duels (winner_id, loser_id, voter_id) VALUES ($1, $2, $3)
+        ON CONFLICT DO NOTHING`, winner, loser, voterID)
+	if err != nil {
+		return 0, 0, err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return 0, 0, errDuelTaken
+	}
+
+	rows, err := tx.QueryContext(ctx, "SELECT id, elo_rating FROM people WHERE id IN ($1, $2) ORDER BY id FOR UPDATE", winner, loser)
+	if err != nil {
+		return 0, 0, err
+	}
+	ratings := map[int]float64{}
+	for rows.Next() {
+		var id int
+		var rating float64
+		if err := rows.Scan(&id, &rating); err != nil {
+			rows.Close()
+			return 0, 0, err
+		}
+		ratings[id] = rating
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, 0, err
+	}
+
+	won, lost := ranking.EloDuel(ratings[winner], ratings[loser])
+	if _, err := tx.ExecContext(ctx, `
+        UPDATE people SET elo_rating = CASE id WHEN $1 THEN $3::float8 ELSE $4::float8 END
+        WHERE id IN ($1, $2)`, winner, loser, won, lost); err != nil {
+		return 0, 0, err
+	}
+	return won, lost, tx.Commit()
+}
+
+// GET /api/duel: two people picked at random to compare. Frozen people
+// sit out.
+func apiDuelHandler(w http.ResponseWriter, r *http.Request) {
+	rows, err := db.QueryContext(r.Context(), `
+        SELECT COALESCE(p.public_id, ''), p.name, COALESCE(t.name, ''), p.elo_rating
+        FROM people p LEFT JOIN teams t ON t.id = p.team_id
+        WHERE NOT p.voting_frozen AND ($1 = 0 OR p.team_id = $1)
+        ORDER BY random()
+        LIMIT 2`, hostTeamID(r))
+	if err != nil {
+		serverError(w, r, err)
+		return
+	}
+	defer rows.Close()
+
+	hidden := scoresHiddenFor(r)
+	people := []Duelist{}
+	for rows.Next() {
+		var d Duelist
+		var rating float64
+		if err := rows.Scan(&d.PublicID, &d.Name, &d.Team, &rating); err != nil {
+			serverError(w, r, err)
+			return
+		}
+		if !hidden {
+			d.Rating = &rating
+		}
+		people = append(people, d)
+	}
+	if err := rows.Err(); err != nil {
+		serverError(w, r, err)
+		return
+	}
+	if len(people) < 2 {
+		writeError(w, http.StatusNotFound, "not_found", "Not enough people for a duel")
+		return
+	}
+	w.Header().Set("Cache-Control", "no-store")
+	writeJSON(w, http.StatusOK, map[string]interface{}{"people": people, "hidden": hidden})
+}
+
+// POST /api/duel {"winner_id": ..., "loser_id": ...} with public ids
+func apiDuelVoteHandler(w http.ResponseWriter, r *http.Request) {
+	if votingClosed() {
+		writeError(w, http.StatusForbidden, "voting_closed", "Voting is closed")
+		return
+	}
+	var req duelRequest
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 1<<12)).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid_request", "Invalid JSON body")
+		return
+	}
+	if errs := validation.Struct(&req); errs != nil {
+		writeValidationError(w, errs)
+		return
+	}
+	if !resolveRequestPerson(w, r, req.Winner, &req.WinnerID) || !resolveRequestPerson(w, r, req.Loser, &req.LoserID) {
+		return
+	}
+	if req.WinnerID == req.LoserID {
+		writeValidationError(w, validation.Errors{"loser_id": "must be someone other than the winner"})
+		return
+	}
+	for _, id := range []int{req.WinnerID, req.LoserID} {
+		if frozen, err := votingFrozen(r.Context(), id); err != nil {
+			serverError(w, r, err)
+			return
+		} else if frozen {
+			writeVotingFrozen(w)
+			return
+		}
+	}
+
+	voterID, err := ensureVoterID(w, r)
+	if err == errConsentRequired {
+		writeConsentRequired(w)
+		return
+	} else if err != nil {
+		serverError(w, r, err)
+		return
+	}
+
+	won, lost, err := recordDuel(r.Context(), voterID, req.WinnerID, req.LoserID)
+	if err == errDuelTaken {
+		writeError(w, http.StatusConflict, "conflict", "You already compared these two")
+		return
+	} else if err != nil {
+		serverError(w, r, err)
+		return
+	}
+
+	resp := map[string]interface{}{"ok": true}
+	if !scoresHiddenFor(r) {
+		resp["winner_rating"] = won
+		resp["loser_rating"] = lost
+	}
+	writeJSON(w, http.StatusCreated, resp)
+}
@@ -0,0 +1,167 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// How long after posting the author may still edit a comment
+// (COMMENT_EDIT_MINUTES, 0 disables editing)
+var commentEditWindow = 15 * time.Minute
+
+func loadCommentEditWindow() {
+	window := 15 * time.Minute
+	if v := os.Getenv("COMMENT_EDIT_MINUTES"); v != "" {
+		if n, err := strconv.Atoi(v); err == nil && n >= 0 {
+			window = time.Duration(n) * time.Minute
+		}
+	}
+	configMu.Lock()
+	commentEditWindow = window
+	configMu.Unlock()
+}
+
+func editWindowSeconds() int {
+	configMu.RLock()
+	defer configMu.RUnlock()
+	return int(commentEditWindow.Seconds())
+}
+
+// CommentEdit is a previous version of an edited comment.
+type CommentEdit struct {
+	Text     string    `json:"text"`
+	EditedAt time.Time `json:"edited_at"`
+}
+
+func createEditTables() error {
+	_, err := db.Exec(`
+    ALTER TABLE votes ADD COLUMN IF NOT EXISTS edited_at TIMESTAMPTZ;
+    CREATE TABLE IF NOT EXISTS comment_edits (
+        id SERIAL PRIMARY KEY,
+        vote_id INTEGER NOT NULL REFERENCES votes(id) ON DELETE CASCADE,
+        old_comment TEXT NOT NULL,
+        edited_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+    );
+    CREATE INDEX IF NOT EXISTS comment_edits_vote_id_idx ON comment_edits (vote_id);
+    `)
+	return err
+}
+
+// Edit history for the given comments keyed by vote id, oldest first
+func commentEditsByVote(ctx context.Context, voteIDs []int) (map[int][]CommentEdit, error) {
+	edits := map[int][]CommentEdit{}
+	if len(voteIDs) == 0 {
+		return edits, nil
+	}
+	rows, err := db.QueryContext(ctx, `
+        SELECT vote_id, old_comment, edited_at FROM comment_edits
+        WHERE vote_id = ANY($1) ORDER BY id`, pq.Array(voteIDs))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var voteID int
+		var e CommentEdit
+		if err := rows.Scan(&voteID, &e.Text, &e.EditedAt); err != nil {
+			return nil, err
+		}
+		edits[voteID] = append(edits[voteID], e)
+	}
+	return edits, rows.Err()
+}
+
+// Let the comment's author (same voter cookie) change it within the edit
+// window. The previous text is kept in comment_edits; cached translations
+// of it are dropped, and a published edit goes out like a new comment.
+func commentEditHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if votingClosed() {
+		http.Error(w, "Voting is closed", http.StatusForbidden)
+		return
+	}
+	var req commentEditRequest
+	if !bindForm(w, r, &req) {
+		return
+	}
+	if !getDisplayOptions().CommentsEnabled {
+		http.Error(w, "Comments are disabled", http.StatusForbidden)
+		return
+	}
+	if problem := checkCommentQuality(getCommentRules(), req.Comment); problem != nil {
+		writeAPIError(w, http.StatusBadRequest, *problem)
+		return
+	}
+	voterID := currentVoterID(r)
+	window := editWindowSeconds()
+	if voterID == "" || window == 0 {
+		http.Error(w, "Comment can no longer be edited", http.StatusForbidden)
+		return
+	}
+
+	tx, err := db.BeginTx(r.Context(), nil)
+	if err != nil {
+		serverError(w, r, err)
+		return
+	}
+	defer tx.Rollback()
+
+	var old string
+	err = tx.QueryRow(`
+        SELECT COALESCE(comment, '') FROM votes
+        WHERE id = $1 AND voter_id = $2 AND created_at > NOW() - $3 * INTERVAL '1 second'
+          AND status NOT IN ('rejected', 'retracted')
+        FOR UPDATE`, req.VoteID, voterID, window).Scan(&old)
+	if err == sql.ErrNoRows {
+		http.Error(w, "Comment can no longer be edited", http.StatusForbidden)
+		return
+	} else if err != nil {
+		serverError(w, r, err)
+		return
+	}
+	if old == req.Comment {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+
+	if _, err := tx.Exec("INSERT INTO comment_edits (vote_id, old_comment) VALUES ($1, $2)", req.VoteID, old); err != nil {
+		serverError(w, r, err)
+		return
+	}
+	// An edited comment goes back through review while moderation is on
+	status := newCommentStatus(req.Comment)
+	c := webhookComment{VoteID: req.VoteID, Text: req.Comment, Edited: true}
+	if err := tx.QueryRow(`
+        UPDATE votes SET comment = $2, edited_at = NOW(), status = $3 WHERE id = $1
+        RETURNING COALESCE((SELECT public_id FROM people WHERE id = person_id), ''), COALESCE(upvote, FALSE), COALESCE(voter_name, '')`,
+		req.VoteID, req.Comment, status,
+	).Scan(&c.PublicID, &c.Upvote, &c.Author); err != nil {
+		serverError(w, r, err)
+		return
+	}
+	if _, err := tx.Exec("DELETE FROM comment_translations WHERE vote_id = $1", req.VoteID); err != nil {
+		serverError(w, r, err)
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		serverError(w, r, err)
+		return
+	}
+	invalidatePeopleCache()
+	if status == commentApproved {
+		events.publish("comment", map[string]interface{}{"vote_id": req.VoteID, "public_id": c.PublicID})
+		queueWebhooks(webhookCommentPublished, c)
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
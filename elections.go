@@ -0,0 +1,418 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/lib/pq"
+
+	"macurate/validation"
+)
+
+// Election is a ranked-choice question over a set of people.
+type Election struct {
+	ID         int         `json:"id"`
+	Question   string      `json:"question"`
+	Closed     bool        `json:"closed"`
+	CreatedAt  time.Time   `json:"created_at"`
+	Candidates []Candidate `json:"candidates"`
+}
+
+// Candidate is a person standing in an election.
+type Candidate struct {
+	ID       int    `json:"-"`
+	PublicID string `json:"public_id"`
+	Name     string `json:"name"`
+}
+
+// IRVRound is one counting round of an instant-runoff tally, by internal
+// person id.
+type IRVRound struct {
+	Counts     map[int]int
+	Exhausted  int
+	Eliminated []int
+}
+
+// apiIRVRound is an IRVRound as the API shows it, by public id.
+type apiIRVRound struct {
+	Counts     map[string]int `json:"counts"`
+	Exhausted  int            `json:"exhausted"`
+	Eliminated []string       `json:"eliminated,omitempty"`
+}
+
+func newAPIIRVRounds(rounds []IRVRound, candidates []Candidate) []apiIRVRound {
+	publicIDs := make(map[int]string, len(candidates))
+	for _, c := range candidates {
+		publicIDs[c.ID] = c.PublicID
+	}
+	out := make([]apiIRVRound, len(rounds))
+	for i, round := range rounds {
+		out[i] = apiIRVRound{Counts: make(map[string]int, len(round.Counts)), Exhausted: round.Exhausted}
+		for id, n := range round.Counts {
+			out[i].Counts[publicIDs[id]] = n
+		}
+		for _, id := range round.Eliminated {
+			out[i].Eliminated = append(out[i].Eliminated, publicIDs[id])
+		}
+	}
+	return out
+}
+
+func createElectionTables() error {
+	_, err := db.Exec(`
+    CREATE TABLE IF NOT EXISTS elections (
+        id SERIAL PRIMARY KEY,
+        question TEXT NOT NULL,
+        closed BOOLEAN NOT NULL DEFAULT FALSE,
+        created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+    );
+    CREATE TABLE IF NOT EXISTS election_candidates (
+        election_id INTEGER REFERENCES elections(id) ON DELETE CASCADE,
+        person_id INTEGER REFERENCES people(id) ON DELETE CASCADE,
+        PRIMARY KEY (election_id, person_id)
+    );
+    CREATE TABLE IF NOT EXISTS election_ballots (
+        id SERIAL PRIMARY KEY,
+        election_id INTEGER REFERENCES elections(id) ON DELETE CASCADE,
+        voter_id TEXT NOT NULL,
+        ranking INTEGER[] NOT NULL,
+        created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+        UNIQUE (election_id, voter_id)
+    );
+    `)
+	return err
+}
+
+// Load elections with their candidates; id 0 loads all, newest first
+func loadElections(ctx context.Context, id int) ([]Election, error) {
+	rows, err := db.QueryContext(ctx, `
+        SELECT e.id, e.question, e.closed, e.created_at, p.id, COALESCE(p.public_id, ''), p.name
+        FROM elections e
+        LEFT JOIN election_candidates c ON c.election_id = e.id
+        LEFT JOIN people p ON p.id = c.person_id
+        WHERE $1 = 0 OR e.id = $1
+        ORDER BY e.id DESC, p.name`, id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var list []Election
+	for rows.Next() {
+		var e Election
+		var pid sql.NullInt64
+		var ppublic, pname sql.NullString
+		if err := rows.Scan(&e.ID, &e.Question, &e.Closed, &e.CreatedAt, &pid, &ppublic, &pname); err != nil {
+			return nil, err
+		}
+		if len(list) == 0 || list[len(list)-1].ID != e.ID {
+			e.Candidates = []Candidate{}
+			list = append(list, e)
+		}
+		if pid.Valid {
+			last := &list[len(list)-1]
+			last.Candidates = append(last.Candidates, Candidate{ID: int(pid.Int64), PublicID: ppublic.String, Name: pname.String})
+		}
+	}
+	return list, rows.Err()
+}
+
+// Tally ranked ballots with instant runoff. Each round the candidate with the
+// fewest votes is eliminated (ties: fewer first-round votes, then higher id)
+// until someone holds a majority of the non-exhausted ballots. Returns 0 as
+// the winner when there are no valid ballots.
+func instantRunoff(candidates []int, ballots [][]int) (int, []IRVRound) {
+	active := make(map[int]bool, len(candidates))
+	for _, c := range candidates {
+		active[c] = true
+	}
+
+	var rounds []IRVRound
+	var firstRound map[int]int
+	for len(active) > 0 {
+		round := IRVRound{Counts: make(map[int]int, len(active))}
+		for c := range active {
+			round.Counts[c] = 0
+		}
+		for _, b := range ballots {
+			counted := false
+			for _, pref := range b {
+				if active[pref] {
+					round.Counts[pref]++
+					counted = true
+					break
+				}
+			}
+			if !counted {
+				round.Exhausted++
+			}
+		}
+		if firstRound == nil {
+			firstRound = round.Counts
+		}
+
+		total := len(ballots) - round.Exhausted
+		if total == 0 {
+			rounds = append(rounds, round)
+			return 0, rounds
+		}
+		for c, n := range round.Counts {
+			if n*2 > total || len(active) == 1 {
+				rounds = append(rounds, round)
+				return c, rounds
+			}
+		}
+
+		ids := make([]int, 0, len(active))
+		for c := range active {
+			ids = append(ids, c)
+		}
+		sort.Slice(ids, func(i, j int) bool {
+			a, b := ids[i], ids[j]
+			if round.Counts[a] != round.Counts[b] {
+				return round.Counts[a] < round.Counts[b]
+			}
+			if firstRound[a] != firstRound[b] {
+				return firstRound[a] < firstRound[b]
+			}
+			return a > b
+		})
+		loser := ids[0]
+		delete(active, loser)
+		round.Eliminated = []int{loser}
+		rounds = append(rounds, round)
+	}
+	return 0, rounds
+}
+
+// List elections
+func apiElectionsHandler(w http.ResponseWriter, r *http.Request) {
+	list, err := loadElections(r.Context(), 0)
+	if err != nil {
+		serverError(w, r, err)
+		return
+	}
+	if list == nil {
+		list = []Election{}
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{"elections": list})
+}
+
+// Single election by id
+func apiElectionHandler(w http.ResponseWriter, r *http.Request) {
+	e, ok := electionFromPath(w, r)
+	if !ok {
+		return
+	}
+	writeJSON(w, http.StatusOK, e)
+}
+
+func electionFromPath(w http.ResponseWriter, r *http.Request) (Election, bool) {
+	id, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil || id <= 0 {
+		writeError(w, http.StatusBadRequest, "invalid_id", "Invalid id")
+		return Election{}, false
+	}
+	list, err := loadElections(r.Context(), id)
+	if err != nil {
+		serverError(w, r, err)
+		return Election{}, false
+	}
+	if len(list) == 0 {
+		writeError(w, http.StatusNotFound, "not_found", "Election not found")
+		return Election{}, false
+	}
+	return list[0], true
+}
+
+// Submit a ranked ballot: {"ranking": [publicID, ...]} most preferred first;
+// the integer ids older clients send are taken too
+func apiElectionBallotHandler(w http.ResponseWriter, r *http.Request) {
+	e, ok := electionFromPath(w, r)
+	if !ok {
+		return
+	}
+	if e.Closed {
+		writeError(w, http.StatusForbidden, "voting_closed", "Election is closed")
+		return
+	}
+
+	var req ballotRequest
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 1<<16)).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid_request", "Invalid JSON body")
+		return
+	}
+	if errs := validation.Struct(&req); errs != nil {
+		writeValidationError(w, errs)
+		return
+	}
+
+	allowed := make(map[int]bool, len(e.Candidates))
+	for _, c := range e.Candidates {
+		allowed[c.ID] = true
+	}
+	ranking := make([]int, len(req.Ranking))
+	seen := make(map[int]bool, len(req.Ranking))
+	for i, ref := range req.Ranking {
+		id, err := resolvePersonRef(r.Context(), string(ref))
+		if err != nil && err != errUnknownPerson {
+			serverError(w, r, err)
+			return
+		}
+		ranking[i] = id
+		if !allowed[id] {
+			writeValidationError(w, validation.Errors{"ranking": "contains a person who is not a candidate"})
+			return
+		}
+		if seen[id] {
+			writeValidationError(w, validation.Errors{"ranking": "lists a candidate more than once"})
+			return
+		}
+		seen[id] = true
+	}
+
+	voterID, err := ensureVoterID(w, r)
+	if err == errConsentRequired {
+		writeConsentRequired(w)
+		return
+	} else if err != nil {
+		serverError(w, r, err)
+		return
+	}
+
+	res, err := db.ExecContext(r.Context(),
+		`INSERT INTO election_ballots (election_id, voter_id, ranking) VALUES ($1, $2, $3)
+         ON CONFLICT (election_id, voter_id) DO NOTHING`,
+		e.ID, voterID, pq.Array(ranking),
+	)
+	if err != nil {
+		serverError(w, r, err)
+		return
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		writeError(w, http.StatusConflict, "conflict", "You already voted in this election")
+		return
+	}
+	writeJSON(w, http.StatusCreated, map[string]interface{}{"ok": true})
+}
+
+// Instant-runoff results, public once the election is closed (to admins anytime)
+func apiElectionResultsHandler(w http.ResponseWriter, r *http.Request) {
+	e, ok := electionFromPath(w, r)
+	if !ok {
+		return
+	}
+	if !e.Closed && !adminAuthorized(r) {
+		writeError(w, http.StatusForbidden, "forbidden", "Results are available once the election closes")
+		return
+	}
+
+	rows, err := db.QueryContext(r.Context(), "SELECT ranking FROM election_ballots WHERE election_id = $1", e.ID)
+	if err != nil {
+		serverError(w, r, err)
+		return
+	}
+	defer rows.Close()
+
+	var ballots [][]int
+	for rows.Next() {
+		var ranking pq.Int64Array
+		if err := rows.Scan(&ranking); err != nil {
+			serverError(w, r, err)
+			return
+		}
+		b := make([]int, len(ranking))
+		for i, v := range ranking {
+			b[i] = int(v)
+		}
+		ballots = append(ballots, b)
+	}
+	if err := rows.Err(); err != nil {
+		serverError(w, r, err)
+		return
+	}
+
+	ids := make([]int, len(e.Candidates))
+	for i, c := range e.Candidates {
+		ids[i] = c.ID
+	}
+	winner, rounds := instantRunoff(ids, ballots)
+
+	resp := map[string]interface{}{
+		"election": e,
+		"ballots":  len(ballots),
+		"rounds":   newAPIIRVRounds(rounds, e.Candidates),
+		"winner":   nil,
+	}
+	for _, c := range e.Candidates {
+		if c.ID == winner {
+			resp["winner"] = c
+		}
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
+
+// Create or close an election (admin-only)
+func adminElectionsHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if !adminAuthorized(r) {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	var req adminElectionRequest
+	if errs := bindAdminForm(r, &req); errs != nil {
+		renderAdmin(w, r, errs)
+		return
+	}
+
+	switch req.Action {
+	case "create":
+		if req.Question == "" {
+			renderAdmin(w, r, validation.Errors{"question": "is required"})
+			return
+		}
+		if len(req.Candidates) < 2 {
+			renderAdmin(w, r, validation.Errors{"candidate": "pick at least two people"})
+			return
+		}
+		tx, err := db.BeginTx(r.Context(), nil)
+		if err != nil {
+			serverError(w, r, err)
+			return
+		}
+		defer tx.Rollback()
+		var id int
+		if err := tx.QueryRow("INSERT INTO elections (question) VALUES ($1) RETURNING id", req.Question).Scan(&id); err != nil {
+			serverError(w, r, err)
+			return
+		}
+		if _, err := tx.Exec(
+			`INSERT INTO election_candidates (election_id, person_id)
+             SELECT $1, id FROM people WHERE id = ANY($2)`,
+			id, pq.Array(req.Candidates),
+		); err != nil {
+			serverError(w, r, err)
+			return
+		}
+		if err := tx.Commit(); err != nil {
+			serverError(w, r, err)
+			return
+		}
+	case "close":
+		if _, err := db.ExecContext(r.Context(), "UPDATE elections SET closed = TRUE WHERE id = $1", req.ID); err != nil {
+			serverError(w, r, err)
+			return
+		}
+	}
+
+	http.Redirect(w, r, "/admin", http.StatusSeeOther)
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"slices"
+	"testing"
+)
+
+// n copies of ballot
+func ballots(n int, ballot ...int) [][]int {
+	list := make([][]int, n)
+	for i := range list {
+		list[i] = ballot
+	}
+	return list
+}
+
+func TestInstantRunoff(t *testing.T) {
+	tests := []struct {
+		name       string
+		candidates []int
+		ballots    [][]int
+		winner     int
+		eliminated []int // in order, one per round
+		exhausted  int   // in the last round
+	}{
+		{"no ballots", []int{1, 2}, nil, 0, nil, 0},
+		{"only blank ballots", []int{1, 2}, [][]int{{}, {}}, 0, nil, 2},
+		{"first-round majority", []int{1, 2, 3}, slices.Concat(ballots(2, 1), ballots(1, 2)), 1, nil, 0},
+		{
+			"transfer decides",
+			[]int{1, 2, 3},
+			slices.Concat(ballots(4, 1), ballots(3, 2), ballots(2, 3, 2)),
+			2, []int{3}, 0,
+		},
+		{
+			"exhausted ballots leave the majority to the rest",
+			[]int{1, 2, 3},
+			slices.Concat(ballots(4, 1), ballots(3, 2), ballots(2, 3)),
+			1, []int{3}, 2,
+		},
+		{
+			"tie goes out on first-round votes",
+			[]int{1, 2, 3, 4},
+			slices.Concat(ballots(5, 1), ballots(3, 2), ballots(2, 3, 2), ballots(1, 4, 3, 2)),
+			2, []int{4, 3}, 0,
+		},
+		{"full tie drops the higher id", []int{1, 2}, [][]int{{1}, {2}}, 1, []int{2}, 1},
+		{"unknown candidates are skipped", []int{1, 2}, [][]int{{9, 1}, {1}, {2}}, 1, nil, 0},
+	}
+	for _, tt := range tests {
+		winner, rounds := instantRunoff(tt.candidates, tt.ballots)
+		if winner != tt.winner {
+			t.Errorf("%s: winner %d, want %d", tt.name, winner, tt.winner)
+		}
+		var eliminated []int
+		for _, r := range rounds {
+			eliminated = append(eliminated, r.Eliminated...)
+		}
+		if !slices.Equal(eliminated, tt.eliminated) {
+			t.Errorf("%s: eliminated %v, want %v", tt.name, eliminated, tt.eliminated)
+		}
+		if len(rounds) != len(tt.eliminated)+1 {
+			t.Errorf("%s: %d rounds, want %d", tt.name, len(rounds), len(tt.eliminated)+1)
+		} else if got := rounds[len(rounds)-1].Exhausted; got != tt.exhausted {
+			t.Errorf("%s: %d exhausted ballots in the last round, want %d", tt.name, got, tt.exhausted)
+		}
+	}
+}
@@ -0,0 +1,237 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"os"
+	"runtime"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// ErrorReporter ships server errors and panics to an error tracker.
+type ErrorReporter interface {
+	Report(ev ErrorEvent)
+}
+
+// ErrorEvent is a single 500 or recovered panic.
+type ErrorEvent struct {
+	Err     error
+	Panic   bool
+	Request *http.Request
+	Stack   []uintptr
+}
+
+// Configured error reporter; nil when error tracking is disabled
+var errorReporter ErrorReporter
+
+// Log a server-side failure, report it and answer 500. A query that ran
+// out of time gets the 503 timeout answer instead: it says nothing about a
+// bug, just a slow database, and the client may retry. So does a database
+// that can't be reached at all; see dbhealth.go.
+func serverError(w http.ResponseWriter, r *http.Request, err error) {
+	if isQueryTimeout(err) {
+		slog.WarnContext(r.Context(), "query timed out", "method", r.Method, "path", r.URL.Path, "err", err)
+		if !errors.Is(r.Context().Err(), context.Canceled) { // nobody is listening
+			writeTimeoutError(w, r)
+		}
+		return
+	}
+	if dbUnavailable(err) {
+		markDBDown(err)
+		slog.WarnContext(r.Context(), "database unavailable", "method", r.Method, "path", r.URL.Path, "err", err)
+		writeDBUnavailable(w, r)
+		return
+	}
+	slog.ErrorContext(r.Context(), "server error", "method", r.Method, "path", r.URL.Path, "err", err)
+	reportError(ErrorEvent{Err: err, Request: r, Stack: callers(3)})
+	httpError(w, r, http.StatusInternalServerError, "internal_error", err.Error())
+}
+
+// A deadline from the request context, or Postgres cancelling the
+// statement at DB_QUERY_TIMEOUT (SQLSTATE 57014, query_canceled)
+func isQueryTimeout(err error) bool {
+	var pqErr *pq.Error
+	return errors.Is(err, context.DeadlineExceeded) ||
+		(errors.As(err, &pqErr) && pqErr.Code == "57014")
+}
+
+func reportError(ev ErrorEvent) {
+	if errorReporter != nil {
+		errorReporter.Report(ev)
+	}
+}
+
+func callers(skip int) []uintptr {
+	pcs := make([]uintptr, 32)
+	return pcs[:runtime.Callers(skip, pcs)]
+}
+
+// Recover from handler panics: log the stack, report it and answer 500
+func withRecovery(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		defer func() {
+			v := recover()
+			if v == nil {
+				return
+			}
+			if v == http.ErrAbortHandler {
+				panic(v) // deliberate abort, let net/http handle it
+			}
+			err, ok := v.(error)
+			if !ok {
+				err = fmt.Errorf("%v", v)
+			}
+			buf := make([]byte, 16<<10)
+			slog.ErrorContext(r.Context(), "panic", "method", r.Method, "path", r.URL.Path, "err", err, "stack", string(buf[:runtime.Stack(buf, false)]))
+			reportError(ErrorEvent{Err: err, Panic: true, Request: r, Stack: callers(3)})
+			httpError(w, r, http.StatusInternalServerError, "internal_error", "Internal Server Error")
+		}()
+		next.ServeHTTP(w, r)
+	})
+}
+
+// Build the error reporter from SENTRY_DSN (and SENTRY_ENVIRONMENT).
+// Returns nil when unset.
+func newErrorReporterFromEnv() (ErrorReporter, error) {
+	dsn := os.Getenv("SENTRY_DSN")
+	if dsn == "" {
+		return nil, nil
+	}
+	return newSentryReporter(dsn, os.Getenv("SENTRY_ENVIRONMENT"))
+}
+
+// sentryReporter posts events to a Sentry-compatible store endpoint
+// (Sentry, GlitchTip, ...) from a background goroutine.
+type sentryReporter struct {
+	storeURL    string
+	auth        string
+	environment string
+	serverName  string
+	events      chan map[string]interface{}
+	client      *http.Client
+}
+
+func newSentryReporter(dsn, environment string) (*sentryReporter, error) {
+	u, err := url.Parse(dsn)
+	if err != nil || u.User == nil || u.Host == "" {
+		return nil, fmt.Errorf("invalid SENTRY_DSN")
+	}
+	path := strings.Trim(u.Path, "/")
+	i := strings.LastIndex(path, "/")
+	projectID := path[i+1:]
+	prefix := ""
+	if i >= 0 {
+		prefix = "/" + path[:i]
+	}
+	if projectID == "" {
+		return nil, fmt.Errorf("invalid SENTRY_DSN: missing project id")
+	}
+	host, _ := os.Hostname()
+	s := &sentryReporter{
+		storeURL: fmt.Sprintf("%s://%s%s/api/%s/store/", u.Scheme, u.Host, prefix, projectID),
+		auth: fmt.Sprintf("Sentry sentry_version=7, sentry_client=macurate/1.0, sentry_key=%s",
+			u.User.Username()),
+		environment: environment,
+		serverName:  host,
+		events:      make(chan map[string]interface{}, 64),
+		client:      &http.Client{Timeout: 5 * time.Second},
+	}
+	go s.run()
+	return s, nil
+}
+
+func (s *sentryReporter) Report(ev ErrorEvent) {
+	id := make([]byte, 16)
+	rand.Read(id)
+	level := "error"
+	if ev.Panic {
+		level = "fatal"
+	}
+	event := map[string]interface{}{
+		"event_id":    hex.EncodeToString(id),
+		"timestamp":   time.Now().UTC().Format(time.RFC3339),
+		"level":       level,
+		"platform":    "go",
+		"server_name": s.serverName,
+		"exception": map[string]interface{}{
+			"values": []map[string]interface{}{{
+				"type":       fmt.Sprintf("%T", ev.Err),
+				"value":      ev.Err.Error(),
+				"stacktrace": map[string]interface{}{"frames": sentryFrames(ev.Stack)},
+			}},
+		},
+	}
+	if s.environment != "" {
+		event["environment"] = s.environment
+	}
+	if r := ev.Request; r != nil {
+		// Query strings may carry the admin password; only the path is sent
+		event["request"] = map[string]interface{}{
+			"url":    r.URL.Path,
+			"method": r.Method,
+		}
+	}
+
+	select {
+	case s.events <- event:
+	default:
+		slog.Warn("error reporter queue full, dropping event")
+	}
+}
+
+func (s *sentryReporter) run() {
+	for event := range s.events {
+		body, err := json.Marshal(event)
+		if err != nil {
+			continue
+		}
+		req, err := http.NewRequest(http.MethodPost, s.storeURL, bytes.NewReader(body))
+		if err != nil {
+			continue
+		}
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("X-Sentry-Auth", s.auth)
+		resp, err := s.client.Do(req)
+		if err != nil {
+			slog.Warn("error reporter", "err", err)
+			continue
+		}
+		resp.Body.Close()
+		if resp.StatusCode >= 300 {
+			slog.Warn("error reporter: store rejected event", "status", resp.Status)
+		}
+	}
+}
+
+// Sentry expects frames oldest call first
+func sentryFrames(pcs []uintptr) []map[string]interface{} {
+	var frames []map[string]interface{}
+	it := runtime.CallersFrames(pcs)
+	for {
+		f, more := it.Next()
+		frames = append(frames, map[string]interface{}{
+			"function": f.Function,
+			"filename": f.File,
+			"lineno":   f.Line,
+			"in_app":   strings.HasPrefix(f.Function, "main."),
+		})
+		if !more {
+			break
+		}
+	}
+	for i, j := 0, len(frames)-1; i < j; i, j = i+1, j-1 {
+		frames[i], frames[j] = frames[j], frames[i]
+	}
+	return frames
+}
@@ -0,0 +1,191 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/lib/pq"
+
+	"macurate/validation"
+)
+
+// Every published event is also written to event_log, whose BIGSERIAL seq
+// is the event's id on the stream; events are logged in batches off the
+// request path (see eventHub.publish). A client that reconnects asks for what
+// it missed, by Last-Event-ID on /events or GET /api/events/replay, instead
+// of refetching everything. The log keeps EVENT_LOG_DAYS (default 7) days.
+
+const eventReplayMax = 500
+
+func createEventLogTables() error {
+	_, err := db.Exec(`
+    CREATE TABLE IF NOT EXISTS event_log (
+        seq BIGSERIAL PRIMARY KEY,
+        kind TEXT NOT NULL,
+        data JSONB,
+        created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+    );
+    CREATE INDEX IF NOT EXISTS event_log_created_at_idx ON event_log (created_at);
+    `)
+	return err
+}
+
+// Store batch in one statement and set each event's Seq. Rows are inserted
+// in batch order, so the seqs handed out, sorted, follow it too. On error
+// the events keep Seq 0.
+func logEvents(batch []Event) error {
+	kinds := make([]string, len(batch))
+	data := make([]sql.NullString, len(batch))
+	at := make([]string, len(batch))
+	for i, ev := range batch {
+		kinds[i], at[i] = ev.Kind, ev.At.Format(time.RFC3339Nano)
+		if ev.Data != nil {
+			b, err := json.Marshal(ev.Data)
+			if err != nil {
+				return err
+			}
+			data[i] = sql.NullString{String: string(b), Valid: true}
+		}
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	rows, err := db.QueryContext(ctx, `
+        INSERT INTO event_log (kind, data, created_at)
+        SELECT kind, data::jsonb, at
+        FROM unnest($1::text[], $2::text[], $3::timestamptz[]) WITH ORDINALITY AS e(kind, data, at, n)
+        ORDER BY n
+        RETURNING seq`,
+		pq.Array(kinds), pq.Array(data), pq.Array(at))
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	seqs := make([]int64, 0, len(batch))
+	for rows.Next() {
+		var seq int64
+		if err := rows.Scan(&seq); err != nil {
+			return err
+		}
+		seqs = append(seqs, seq)
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	if len(seqs) != len(batch) {
+		return fmt.Errorf("event log: %d rows for %d events", len(seqs), len(batch))
+	}
+	slices.Sort(seqs)
+	for i := range batch {
+		batch[i].Seq = seqs[i]
+	}
+	return nil
+}
+
+// Events after seq, oldest first, at most limit of them; more reports
+// whether the log goes on. Score milestones are left out while scores are
+// hidden from this viewer, as in /api/milestones.
+func eventsSince(ctx context.Context, after int64, limit int, hidden bool) (list []Event, more bool, err error) {
+	rows, err := db.QueryContext(ctx, `
+        SELECT seq, kind, data, created_at
+        FROM event_log
+        WHERE seq > $1 AND (NOT $3 OR kind <> 'milestone' OR data->>'kind' = 'votes')
+        ORDER BY seq
+        LIMIT $2`, after, limit+1, hidden)
+	if err != nil {
+		return nil, false, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var ev Event
+		var data []byte
+		if err := rows.Scan(&ev.Seq, &ev.Kind, &data, &ev.At); err != nil {
+			return nil, false, err
+		}
+		if data != nil {
+			ev.Data = json.RawMessage(data)
+		}
+		list = append(list, ev)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, false, err
+	}
+	if len(list) > limit {
+		return list[:limit], true, nil
+	}
+	return list, false, nil
+}
+
+// Whether the log still reaches back to the event after seq; when it
+// doesn't, some were pruned and the client has to start over.
+func eventLogCovers(ctx context.Context, after int64) (bool, error) {
+	var oldest *int64
+	if err := db.QueryRowContext(ctx, "SELECT MIN(seq) FROM event_log").Scan(&oldest); err != nil {
+		return false, err
+	}
+	return oldest == nil || *oldest <= after+1, nil
+}
+
+// Drop events older than EVENT_LOG_DAYS
+func pruneEventLog() error {
+	days := 7
+	if v := os.Getenv("EVENT_LOG_DAYS"); v != "" {
+		if n, err := strconv.Atoi(v); err == nil && n > 0 {
+			days = n
+		}
+	}
+	res, err := db.Exec("DELETE FROM event_log WHERE created_at < NOW() - make_interval(days => $1)", days)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n > 0 {
+		slog.Info("maintenance: pruned event log", "events", n)
+	}
+	return nil
+}
+
+// Events after ?from_seq= (the last seq the caller saw; 0 for the oldest
+// kept). When "resync" is true events were pruned in between and the caller
+// should reload its state before following next_seq.
+func apiEventsReplayHandler(w http.ResponseWriter, r *http.Request) {
+	var req eventReplayRequest
+	if errs := validation.Bind(r.URL.Query(), &req); errs != nil {
+		writeValidationError(w, errs)
+		return
+	}
+	if req.Limit == 0 {
+		req.Limit = 100
+	}
+
+	covered, err := eventLogCovers(r.Context(), req.FromSeq)
+	if err != nil {
+		serverError(w, r, err)
+		return
+	}
+	hidden := scoresHiddenFor(r)
+	list, more, err := eventsSince(r.Context(), req.FromSeq, req.Limit, hidden)
+	if err != nil {
+		serverError(w, r, err)
+		return
+	}
+	next := req.FromSeq
+	if len(list) > 0 {
+		next = list[len(list)-1].Seq
+	}
+	if list == nil {
+		list = []Event{}
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"events":   list,
+		"next_seq": next,
+		"more":     more,
+		"resync":   req.FromSeq > 0 && !covered,
+	})
+}
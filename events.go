@@ -0,0 +1,318 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// In-process event bus with a Server-Sent Events stream at GET /events.
+// Events carry ids, never scores or voter details, so listeners refetch
+// whatever they show through the normal (hidden-score aware) endpoints.
+// Events published on other instances arrive through instancesync.go; the
+// log in eventlog.go is shared.
+
+// Event is one message on the bus. Seq is 0 when it could not be logged.
+type Event struct {
+	Seq  int64       `json:"seq,omitempty"`
+	Kind string      `json:"kind"`
+	Data interface{} `json:"data,omitempty"`
+	At   time.Time   `json:"at"`
+}
+
+// One stream's queue. A client that falls behind loses events and gets a
+// single "resync" once it catches up, telling it to refetch everything;
+// one that stays full for maxLag events in a row is disconnected.
+type eventClient struct {
+	ch      chan Event
+	lagging bool
+	dropped int // consecutive
+}
+
+type eventHub struct {
+	// Published events waiting to be logged, oldest first. One goroutine
+	// drains it, so publishing never waits on the database and streams
+	// still see seqs in order.
+	pending   chan Event
+	startOnce sync.Once
+
+	mu     sync.Mutex
+	subs   map[*eventClient]struct{}
+	closed bool
+
+	// Totals for /metrics
+	droppedTotal   uint64
+	slowDisconnect uint64
+	rejected       uint64
+}
+
+// How many published events may wait for the log, and how many go in one
+// INSERT
+const (
+	eventQueueSize = 1024
+	eventLogBatch  = 100
+)
+
+var events = &eventHub{subs: map[*eventClient]struct{}{}, pending: make(chan Event, eventQueueSize)}
+
+var errTooManyClients = errors.New("too many realtime clients")
+
+// REALTIME_MAX_CLIENTS caps concurrent streams (default 200, 0 = no cap);
+// REALTIME_QUEUE is each client's buffer (default 16 events) and
+// REALTIME_MAX_LAG how many events in a row a client may miss before it is
+// cut off (default 64).
+var realtimeMaxClients, realtimeQueue, realtimeMaxLag = 200, 16, 64
+
+func loadRealtimeConfig() error {
+	maxClients, queue, maxLag := 200, 16, 64
+	for _, opt := range []struct {
+		key    string
+		dst    *int
+		allow0 bool
+	}{
+		{"REALTIME_MAX_CLIENTS", &maxClients, true},
+		{"REALTIME_QUEUE", &queue, false},
+		{"REALTIME_MAX_LAG", &maxLag, false},
+	} {
+		v := os.Getenv(opt.key)
+		if v == "" {
+			continue
+		}
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 || (n == 0 && !opt.allow0) {
+			return fmt.Errorf("%s: must be a positive number", opt.key)
+		}
+		*opt.dst = n
+	}
+	configMu.Lock()
+	realtimeMaxClients, realtimeQueue, realtimeMaxLag = maxClients, queue, maxLag
+	configMu.Unlock()
+	return nil
+}
+
+// Subscribe returns a channel of events; it is closed on shutdown or when
+// the client is cut off for lagging.
+func (h *eventHub) subscribe() (chan Event, func(), error) {
+	configMu.RLock()
+	maxClients, queue := realtimeMaxClients, realtimeQueue
+	configMu.RUnlock()
+
+	c := &eventClient{ch: make(chan Event, queue)}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.closed {
+		close(c.ch)
+		return c.ch, func() {}, nil
+	}
+	if maxClients > 0 && len(h.subs) >= maxClients {
+		h.rejected++
+		return nil, nil, errTooManyClients
+	}
+	h.subs[c] = struct{}{}
+	return c.ch, func() {
+		h.mu.Lock()
+		defer h.mu.Unlock()
+		h.drop(c)
+	}, nil
+}
+
+// Callers hold mu.
+func (h *eventHub) drop(c *eventClient) {
+	if _, ok := h.subs[c]; ok {
+		delete(h.subs, c)
+		close(c.ch)
+	}
+}
+
+// Publish to every subscriber, on this instance and the others, once the
+// event is logged. Never blocks: when the log has fallen a whole queue
+// behind, the event goes out at once without a seq.
+func (h *eventHub) publish(kind string, data interface{}) {
+	ev := Event{Kind: kind, Data: data, At: time.Now().UTC()}
+	h.startOnce.Do(func() { go h.logAndDeliver() })
+	select {
+	case h.pending <- ev:
+	default:
+		slog.Warn("event log queue full, streaming unlogged", "kind", kind)
+		h.deliver(ev)
+		notifyInstancesEvent(ev)
+	}
+}
+
+// Log pending events a batch at a time, then deliver them in order
+func (h *eventHub) logAndDeliver() {
+	for ev := range h.pending {
+		batch := []Event{ev}
+	fill:
+		for len(batch) < eventLogBatch {
+			select {
+			case ev := <-h.pending:
+				batch = append(batch, ev)
+			default:
+				break fill
+			}
+		}
+		if err := logEvents(batch); err != nil {
+			slog.Error("event log write failed", "events", len(batch), "err", err)
+		}
+		for _, ev := range batch {
+			h.deliver(ev)
+			notifyInstancesEvent(ev)
+		}
+	}
+}
+
+// Queue ev for this instance's subscribers without ever blocking on a slow one.
+func (h *eventHub) deliver(ev Event) {
+	configMu.RLock()
+	maxLag := realtimeMaxLag
+	configMu.RUnlock()
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for c := range h.subs {
+		next := ev
+		if c.lagging {
+			next = Event{Kind: "resync", At: ev.At}
+		}
+		select {
+		case c.ch <- next:
+			c.lagging, c.dropped = false, 0
+		default:
+			h.droppedTotal++
+			c.lagging = true
+			if c.dropped++; c.dropped >= maxLag {
+				h.slowDisconnect++
+				h.drop(c)
+			}
+		}
+	}
+}
+
+// End every stream so a graceful shutdown doesn't wait on them.
+func (h *eventHub) close() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.closed = true
+	for c := range h.subs {
+		h.drop(c)
+	}
+}
+
+// RealtimeStats are the hub's numbers for the dashboards.
+type RealtimeStats struct {
+	Clients        int
+	Queued         int // events waiting across all clients
+	Dropped        uint64
+	SlowDisconnect uint64
+	Rejected       uint64
+	MaxClients     int
+}
+
+func (h *eventHub) stats() RealtimeStats {
+	configMu.RLock()
+	maxClients := realtimeMaxClients
+	configMu.RUnlock()
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	st := RealtimeStats{Clients: len(h.subs), Dropped: h.droppedTotal, SlowDisconnect: h.slowDisconnect, Rejected: h.rejected, MaxClients: maxClients}
+	for c := range h.subs {
+		st.Queued += len(c.ch)
+	}
+	return st
+}
+
+const (
+	eventsHeartbeat    = 25 * time.Second
+	eventsWriteTimeout = 10 * time.Second
+)
+
+// Stream bus events as SSE, with a comment line every so often so proxies
+// keep the connection open. A reconnecting EventSource sends Last-Event-ID
+// and first gets what it missed from the log, or a "resync" when that is
+// too much or already pruned.
+func eventsHandler(w http.ResponseWriter, r *http.Request) {
+	ch, unsubscribe, err := events.subscribe()
+	if err == errTooManyClients {
+		w.Header().Set("Retry-After", "30")
+		http.Error(w, "Too many live connections, try again later", http.StatusServiceUnavailable)
+		return
+	}
+	defer unsubscribe()
+
+	rc := http.NewResponseController(w)
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+	if err := rc.Flush(); err != nil {
+		return
+	}
+	heartbeat := time.NewTicker(eventsHeartbeat)
+	defer heartbeat.Stop()
+
+	write := func(ev Event) error {
+		data, err := json.Marshal(ev)
+		if err != nil {
+			return nil
+		}
+		rc.SetWriteDeadline(time.Now().Add(eventsWriteTimeout))
+		if ev.Seq > 0 {
+			fmt.Fprintf(w, "id: %d\n", ev.Seq)
+		}
+		fmt.Fprintf(w, "event: %s\ndata: %s\n\n", ev.Kind, data)
+		return rc.Flush()
+	}
+
+	// Live events already queued may overlap the replay; skip those
+	var replayed int64
+	if last, err := strconv.ParseInt(r.Header.Get("Last-Event-ID"), 10, 64); err == nil && last > 0 {
+		hidden := scoresHiddenFor(r)
+		missed, more, err := eventsSince(r.Context(), last, eventReplayMax, hidden)
+		covered, coverErr := eventLogCovers(r.Context(), last)
+		if err != nil || coverErr != nil || more || !covered {
+			if write(Event{Kind: "resync", At: time.Now().UTC()}) != nil {
+				return
+			}
+		} else {
+			for _, ev := range missed {
+				if write(ev) != nil {
+					return
+				}
+				replayed = ev.Seq
+			}
+		}
+	}
+
+	// Each write gets a deadline so a stuck client is dropped instead of
+	// pinning this goroutine; the deadline is cleared while idle.
+	for {
+		rc.SetWriteDeadline(time.Time{})
+		select {
+		case <-r.Context().Done():
+			return
+		case <-heartbeat.C:
+			rc.SetWriteDeadline(time.Now().Add(eventsWriteTimeout))
+			fmt.Fprint(w, ": ping\n\n")
+			if rc.Flush() != nil {
+				return
+			}
+		case ev, ok := <-ch:
+			if !ok {
+				return
+			}
+			if ev.Seq > 0 && ev.Seq <= replayed {
+				continue
+			}
+			if write(ev) != nil {
+				return
+			}
+		}
+	}
+}
@@ -0,0 +1,289 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"log/slog"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"macurate/validation"
+)
+
+// "Remove me from this board": anyone can ask at /remove-me, and the request
+// waits for an admin. Approving it takes the person off the board. With an
+// archive database their votes are archived first, optionally anonymized
+// (no name, comments or voter names kept, and the request itself scrubbed
+// of who asked and why); without one they are deleted. Requests are never
+// deleted, so the table doubles as the audit trail.
+
+const (
+	exclusionPending  = "pending"
+	exclusionApproved = "approved"
+	exclusionRejected = "rejected"
+)
+
+// ExclusionRequest is one removal request and what became of it.
+type ExclusionRequest struct {
+	ID            int
+	PersonID      sql.NullInt64 // NULL once the person is gone
+	PersonName    string
+	RequesterName string
+	Contact       string
+	Reason        string
+	Status        string
+	Outcome       string // what approval did, e.g. "archived, anonymized"
+	DecidedBy     string
+	CreatedAt     time.Time
+	DecidedAt     sql.NullTime
+}
+
+func createExclusionTables() error {
+	_, err := db.Exec(`
+    CREATE TABLE IF NOT EXISTS exclusion_requests (
+        id SERIAL PRIMARY KEY,
+        person_id INTEGER REFERENCES people(id) ON DELETE SET NULL,
+        person_name TEXT NOT NULL,
+        requester_name TEXT NOT NULL,
+        contact TEXT NOT NULL DEFAULT '',
+        reason TEXT NOT NULL DEFAULT '',
+        status TEXT NOT NULL DEFAULT 'pending',
+        outcome TEXT NOT NULL DEFAULT '',
+        decided_by TEXT NOT NULL DEFAULT '',
+        created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+        decided_at TIMESTAMPTZ
+    );
+    CREATE INDEX IF NOT EXISTS exclusion_requests_status_idx ON exclusion_requests (status, id);
+    `)
+	return err
+}
+
+func listExclusionRequests(ctx context.Context) ([]ExclusionRequest, error) {
+	rows, err := db.QueryContext(ctx, `
+        SELECT id, person_id, person_name, requester_name, contact, reason, status,
+               outcome, decided_by, created_at, decided_at
+        FROM exclusion_requests
+        ORDER BY status <> 'pending', id DESC
+        LIMIT 200`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var list []ExclusionRequest
+	for rows.Next() {
+		var e ExclusionRequest
+		if err := rows.Scan(&e.ID, &e.PersonID, &e.PersonName, &e.RequesterName, &e.Contact, &e.Reason, &e.Status,
+			&e.Outcome, &e.DecidedBy, &e.CreatedAt, &e.DecidedAt); err != nil {
+			return nil, err
+		}
+		list = append(list, e)
+	}
+	return list, rows.Err()
+}
+
+// Public request form
+func removeMeHandler(w http.ResponseWriter, r *http.Request) {
+	people, err := queryPeople(r.Context(), "name")
+	if err != nil {
+		serverError(w, r, err)
+		return
+	}
+	data := map[string]interface{}{
+		"BoardName": currentBoardName(),
+		"People":    people,
+		"PersonID":  r.FormValue("person_id"),
+	}
+
+	if r.Method == http.MethodPost {
+		var req exclusionRequest
+		errs := bindAdminForm(r, &req)
+		var name string
+		if errs == nil {
+			req.PersonID, err = resolvePersonRef(r.Context(), req.Person)
+			if err == nil {
+				err = db.QueryRowContext(r.Context(), "SELECT name FROM people WHERE id = $1", req.PersonID).Scan(&name)
+			}
+			if err == sql.ErrNoRows || err == errUnknownPerson {
+				errs = validation.Errors{"person_id": "is not on this board"}
+			} else if err != nil {
+				serverError(w, r, err)
+				return
+			}
+		}
+		if errs == nil {
+			if _, err := db.ExecContext(r.Context(), `
+                INSERT INTO exclusion_requests (person_id, person_name, requester_name, contact, reason)
+                VALUES ($1, $2, $3, $4, $5)`,
+				req.PersonID, name, req.Name, req.Contact, req.Reason); err != nil {
+				serverError(w, r, err)
+				return
+			}
+			slog.InfoContext(r.Context(), "exclusion requested", "person_id", req.PersonID)
+			data["Sent"] = true
+		} else {
+			data["Errors"] = errs
+			w.WriteHeader(http.StatusBadRequest)
+		}
+	}
+
+	tmpl := parseTemplates("templates/remove_me.html")
+	if err := tmpl.Execute(w, data); err != nil {
+		serverError(w, r, err)
+	}
+}
+
+// Anonymizing is about what the archive keeps, so it needs one
+var errAnonymizeNeedsArchive = errors.New("anonymize needs an archive database (ARCHIVE_DATABASE_URL)")
+
+// Take the person off the board as request id asks; returns the outcome
+// recorded on the request. Voting is frozen first so nothing arrives
+// behind the archive. Once the archive is done its outcome is saved on the
+// request, so when the final delete fails, approving again only retries
+// the delete.
+func carryOutExclusion(ctx context.Context, id, personID int, anonymize bool) (string, error) {
+	var outcome string
+	if err := db.QueryRowContext(ctx, "SELECT outcome FROM exclusion_requests WHERE id = $1", id).Scan(&outcome); err != nil {
+		return "", err
+	}
+	if outcome != "" {
+		return outcome, removeExcludedPerson(ctx, personID)
+	}
+	hasArchive := os.Getenv("ARCHIVE_DATABASE_URL") != ""
+	if anonymize && !hasArchive {
+		return "", errAnonymizeNeedsArchive
+	}
+	if _, err := setVotingFrozen(ctx, personID, true); err != nil {
+		return "", err
+	}
+	outcome = "deleted"
+	if hasArchive {
+		adb, err := openArchiveDB()
+		if err != nil {
+			return "", err
+		}
+		defer adb.Close()
+		if err := createArchiveTables(adb); err != nil {
+			return "", err
+		}
+		for {
+			n, err := archiveBatch(adb, archiveFilter{PersonID: personID, Anonymize: anonymize})
+			if err != nil {
+				return "", err
+			}
+			if n == 0 {
+				break
+			}
+		}
+		outcome = "archived"
+		if anonymize {
+			outcome += ", anonymized"
+		}
+		if _, err := db.ExecContext(ctx, "UPDATE exclusion_requests SET outcome = $2 WHERE id = $1", id, outcome); err != nil {
+			return "", err
+		}
+	}
+	return outcome, removeExcludedPerson(ctx, personID)
+}
+
+// Delete the person; one who is already gone counts as done
+func removeExcludedPerson(ctx context.Context, personID int) error {
+	if _, err := deletePerson(ctx, personID, false); err != nil && err != sql.ErrNoRows {
+		return err
+	}
+	return nil
+}
+
+// Review removal requests (admin-only): GET lists them, POST approves or
+// rejects a pending one
+func adminExclusionsHandler(w http.ResponseWriter, r *http.Request) {
+	if !adminAuthorized(r) {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	if r.Method == http.MethodPost {
+		var req adminExclusionRequest
+		if errs := bindAdminForm(r, &req); errs != nil {
+			http.Error(w, "Invalid request", http.StatusBadRequest)
+			return
+		}
+		var personID sql.NullInt64
+		var started string
+		err := db.QueryRowContext(r.Context(), "SELECT person_id, outcome FROM exclusion_requests WHERE id = $1 AND status = 'pending'", req.ID).
+			Scan(&personID, &started)
+		if err == sql.ErrNoRows {
+			http.Error(w, "No such pending request", http.StatusNotFound)
+			return
+		} else if err != nil {
+			serverError(w, r, err)
+			return
+		}
+
+		admin := "admin"
+		if id, ok := currentAdminID(r); ok {
+			db.QueryRowContext(r.Context(), "SELECT username FROM admins WHERE id = $1", id).Scan(&admin)
+		}
+		status, outcome := exclusionRejected, ""
+		if req.Action == "approve" {
+			status, outcome = exclusionApproved, "already gone"
+			if started != "" {
+				// An earlier approval got as far as the archive; finish it the
+				// same way
+				outcome, req.Anonymize = started, strings.HasSuffix(started, "anonymized")
+			}
+			if personID.Valid {
+				outcome, err = carryOutExclusion(r.Context(), req.ID, int(personID.Int64), req.Anonymize)
+				if err == errAnonymizeNeedsArchive {
+					http.Error(w, "Anonymizing needs an archive database", http.StatusBadRequest)
+					return
+				} else if err != nil {
+					serverError(w, r, err)
+					return
+				}
+			}
+		} else if started != "" {
+			http.Error(w, "This request is partly carried out; approve it to finish", http.StatusConflict)
+			return
+		}
+		// An anonymized removal keeps only the fact that it happened
+		if _, err := db.ExecContext(r.Context(), `
+            UPDATE exclusion_requests SET
+                status = $2, outcome = $3, decided_by = $4, decided_at = NOW(),
+                person_name = CASE WHEN $5 THEN $6 ELSE person_name END,
+                requester_name = CASE WHEN $5 THEN '' ELSE requester_name END,
+                contact = CASE WHEN $5 THEN '' ELSE contact END,
+                reason = CASE WHEN $5 THEN '' ELSE reason END
+            WHERE id = $1`,
+			req.ID, status, outcome, admin, status == exclusionApproved && req.Anonymize, anonymizedName); err != nil {
+			serverError(w, r, err)
+			return
+		}
+		slog.InfoContext(r.Context(), "exclusion request decided", "request", req.ID, "status", status, "outcome", outcome, "admin", admin)
+		http.Redirect(w, r, "/admin/exclusions", http.StatusSeeOther)
+		return
+	}
+
+	list, err := listExclusionRequests(r.Context())
+	if err != nil {
+		serverError(w, r, err)
+		return
+	}
+	pending := 0
+	for _, e := range list {
+		if e.Status == exclusionPending {
+			pending++
+		}
+	}
+	tmpl := parseTemplates("templates/exclusions.html")
+	data := map[string]interface{}{
+		"Requests":   list,
+		"Pending":    pending,
+		"HasArchive": os.Getenv("ARCHIVE_DATABASE_URL") != "",
+	}
+	if err := tmpl.Execute(w, data); err != nil {
+		serverError(w, r, err)
+	}
+}
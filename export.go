@@ -0,0 +1,114 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"io"
+	"net/http"
+	"time"
+)
+
+// exportComment is one line of the comments export.
+type exportComment struct {
+	ID        int       `json:"id"`
+	PersonID  int       `json:"person_id"`
+	Person    string    `json:"person"`
+	Upvote    *bool     `json:"upvote"` // null once retracted
+	Text      string    `json:"text"`
+	Author    string    `json:"author,omitempty"`
+	Status    string    `json:"status"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// Flush the response every this many rows while streaming
+const exportFlushEvery = 500
+
+// Export every vote with its comment (admin-only), streamed straight from
+// the rows iterator so memory stays flat on large boards. format=ndjson
+// (default) writes one object per line; format=json writes one array.
+// ?person_id= narrows the export to one person.
+func adminExportCommentsHandler(w http.ResponseWriter, r *http.Request) {
+	if !adminAuthorized(r) {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+	var req exportRequest
+	if !bindForm(w, r, &req) {
+		return
+	}
+
+	rows, err := queryCommentsExport(r.Context(), req.PersonID)
+	if err != nil {
+		serverError(w, r, err)
+		return
+	}
+	defer rows.Close()
+
+	array := req.Format == "json"
+	ext := "ndjson"
+	w.Header().Set("Content-Type", "application/x-ndjson")
+	if array {
+		ext = "json"
+		w.Header().Set("Content-Type", "application/json")
+	}
+	w.Header().Set("Content-Disposition", `attachment; filename="macurate-comments.`+ext+`"`)
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+
+	rc := http.NewResponseController(w)
+	if err := writeCommentsExport(rows, w, array, func() { rc.Flush() }); err != nil {
+		// Headers are gone (or the client is); all we can do is cut the stream short
+		panic(http.ErrAbortHandler)
+	}
+}
+
+// personID 0 means everyone
+func queryCommentsExport(ctx context.Context, personID int) (*sql.Rows, error) {
+	return db.QueryContext(ctx, `
+        SELECT v.id, v.person_id, p.name, v.upvote, COALESCE(v.comment, ''),
+               COALESCE(v.voter_name, ''), v.status, v.created_at
+        FROM votes v JOIN people p ON p.id = v.person_id
+        WHERE $1 = 0 OR v.person_id = $1
+        ORDER BY v.id`, personID)
+}
+
+// Encode export rows as NDJSON, or one JSON array, calling flush every
+// exportFlushEvery rows. Shared by the admin download and `macurate export`.
+func writeCommentsExport(rows *sql.Rows, w io.Writer, array bool, flush func()) error {
+	enc := json.NewEncoder(w)
+	anonymous := getNamePolicy() == namePolicyAnonymous
+	n := 0
+	if array {
+		if _, err := io.WriteString(w, "["); err != nil {
+			return err
+		}
+	}
+	for rows.Next() {
+		var c exportComment
+		if err := rows.Scan(&c.ID, &c.PersonID, &c.Person, &c.Upvote, &c.Text, &c.Author, &c.Status, &c.CreatedAt); err != nil {
+			return err
+		}
+		if anonymous {
+			c.Author = ""
+		}
+		if array && n > 0 {
+			if _, err := io.WriteString(w, ","); err != nil {
+				return err
+			}
+		}
+		if err := enc.Encode(c); err != nil {
+			return err
+		}
+		if n++; n%exportFlushEvery == 0 {
+			flush()
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	if array {
+		_, err := io.WriteString(w, "]\n")
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,172 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/xml"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+
+	"macurate/validation"
+)
+
+// Atom feed of the newest published comments, for following the board
+// from a feed reader: /feed.xml for everyone, /feed.xml?person_id= for one
+// person. Only approved comments appear, authors are left out when names
+// are anonymous, and on a team's own domain the feed covers that team.
+
+const feedEntries = 50
+
+type atomFeed struct {
+	XMLName xml.Name    `xml:"http://www.w3.org/2005/Atom feed"`
+	ID      string      `xml:"id"`
+	Title   string      `xml:"title"`
+	Updated time.Time   `xml:"updated"`
+	Author  atomAuthor  `xml:"author"` // for entries without a voter name
+	Link    []atomLink  `xml:"link"`
+	Entries []atomEntry `xml:"entry"`
+}
+
+type atomLink struct {
+	Href string `xml:"href,attr"`
+	Rel  string `xml:"rel,attr,omitempty"`
+	Type string `xml:"type,attr,omitempty"`
+}
+
+type atomEntry struct {
+	ID        string      `xml:"id"`
+	Title     string      `xml:"title"`
+	Published time.Time   `xml:"published"`
+	Updated   time.Time   `xml:"updated"`
+	Link      atomLink    `xml:"link"`
+	Author    *atomAuthor `xml:"author,omitempty"`
+	Content   atomContent `xml:"content"`
+}
+
+type atomAuthor struct {
+	Name string `xml:"name"`
+}
+
+type atomContent struct {
+	Type string `xml:"type,attr"`
+	Body string `xml:",chardata"`
+}
+
+// Comments are stored as plain text, so they are escaped here, keeping
+// their line breaks; type="html" only says the reader should render the
+// (escaped) markup.
+func commentContent(text string) atomContent {
+	return atomContent{Type: "html", Body: string(SafeHTML(text))}
+}
+
+// GET /feed.xml
+func feedHandler(w http.ResponseWriter, r *http.Request) {
+	var req feedRequest
+	if errs := validation.Bind(r.URL.Query(), &req); errs != nil {
+		http.Error(w, "Invalid person_id", http.StatusBadRequest)
+		return
+	}
+	if !getDisplayOptions().CommentsEnabled {
+		http.Error(w, "Comments are disabled", http.StatusNotFound)
+		return
+	}
+
+	scheme := "http"
+	if isHTTPS(r) {
+		scheme = "https"
+	}
+	base := scheme + "://" + r.Host
+	title := currentBoardName()
+	selfURL := base + "/feed.xml"
+
+	var personID int
+	if req.Person != "" {
+		id, err := resolvePersonRef(r.Context(), req.Person)
+		if err == nil {
+			var name string
+			err = db.QueryRowContext(r.Context(), "SELECT name FROM people WHERE id = $1", id).Scan(&name)
+			title = name + " · " + title
+		}
+		if err == errUnknownPerson || err == sql.ErrNoRows {
+			http.Error(w, "Person not found", http.StatusNotFound)
+			return
+		} else if err != nil {
+			serverError(w, r, err)
+			return
+		}
+		personID = id
+		selfURL += "?person_id=" + url.QueryEscape(req.Person)
+	}
+
+	rows, err := db.QueryContext(r.Context(), `
+        SELECT v.id, v.upvote, v.comment, COALESCE(v.voter_name, ''), v.created_at,
+               COALESCE(v.edited_at, v.created_at), p.name, COALESCE(p.public_id, '')
+        FROM votes v JOIN people p ON p.id = v.person_id
+        WHERE v.upvote IS NOT NULL AND COALESCE(TRIM(v.comment), '') <> '' AND v.status = 'approved'
+          AND ($1 = 0 OR v.person_id = $1)
+          AND ($2 = 0 OR p.team_id = $2)
+        ORDER BY v.id DESC
+        LIMIT $3`, personID, hostTeamID(r), feedEntries)
+	if err != nil {
+		serverError(w, r, err)
+		return
+	}
+	defer rows.Close()
+
+	anonymous := getNamePolicy() == namePolicyAnonymous
+	feed := atomFeed{
+		ID:     selfURL,
+		Title:  title,
+		Author: atomAuthor{Name: currentBoardName()},
+		Link: []atomLink{
+			{Href: selfURL, Rel: "self", Type: "application/atom+xml"},
+			{Href: base + "/", Rel: "alternate", Type: "text/html"},
+		},
+	}
+	for rows.Next() {
+		var (
+			id                 int
+			up                 bool
+			text, author, name string
+			publicID           string
+			created, updated   time.Time
+		)
+		if err := rows.Scan(&id, &up, &text, &author, &created, &updated, &name, &publicID); err != nil {
+			serverError(w, r, err)
+			return
+		}
+		direction := "Downvote"
+		if up {
+			direction = "Upvote"
+		}
+		link := fmt.Sprintf("%s/comments?person_id=%s#comment-%d", base, publicID, id)
+		e := atomEntry{
+			ID:        link,
+			Title:     direction + " for " + name,
+			Published: created.UTC(),
+			Updated:   updated.UTC(),
+			Link:      atomLink{Href: link, Rel: "alternate"},
+			Content:   commentContent(text),
+		}
+		if author != "" && !anonymous {
+			e.Author = &atomAuthor{Name: author}
+		}
+		if e.Updated.After(feed.Updated) {
+			feed.Updated = e.Updated
+		}
+		feed.Entries = append(feed.Entries, e)
+	}
+	if err := rows.Err(); err != nil {
+		serverError(w, r, err)
+		return
+	}
+	if feed.Updated.IsZero() {
+		feed.Updated = time.Now().UTC()
+	}
+
+	w.Header().Set("Content-Type", "application/atom+xml; charset=utf-8")
+	w.Header().Set("Cache-Control", "public, max-age=60")
+	w.Write([]byte(xml.Header))
+	xml.NewEncoder(w).Encode(feed)
+}
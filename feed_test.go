@@ -0,0 +1,40 @@
+package main
+
+import (
+	"encoding/xml"
+	"strings"
+	"testing"
+)
+
+func TestCommentContent(t *testing.T) {
+	tests := []struct {
+		in, want string
+	}{
+		{"Great work", "Great work"},
+		{"<script>alert(1)</script>", "&lt;script&gt;alert(1)&lt;/script&gt;"},
+		{"<img src=x onerror=alert(1)>", "&lt;img src=x onerror=alert(1)&gt;"},
+		{"first\nsecond", "first<br>second"},
+	}
+	for _, tt := range tests {
+		c := commentContent(tt.in)
+		if c.Type != "html" || c.Body != tt.want {
+			t.Errorf("commentContent(%q) = %q %q, want html %q", tt.in, c.Type, c.Body, tt.want)
+		}
+	}
+}
+
+// A feed reader unescapes the XML once; what it then renders as HTML must
+// not contain the tag.
+func TestCommentContentInFeed(t *testing.T) {
+	out, err := xml.Marshal(atomEntry{Content: commentContent("<script>alert(1)</script>")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var e atomEntry
+	if err := xml.Unmarshal(out, &e); err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(e.Content.Body, "<script") {
+		t.Errorf("feed content renders as markup: %q", e.Content.Body)
+	}
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"net/http"
+)
+
+// Frozen people stay on the board with their current score, but nobody can
+// vote for them or take a vote back until an admin unfreezes them (someone
+// on leave, or who asked to be left alone for a while).
+
+func createFreezeTables() error {
+	_, err := db.Exec(`ALTER TABLE people ADD COLUMN IF NOT EXISTS voting_frozen BOOLEAN NOT NULL DEFAULT FALSE`)
+	return err
+}
+
+// Unknown people count as not frozen; the vote itself fails on them later.
+func votingFrozen(ctx context.Context, personID int) (bool, error) {
+	var frozen bool
+	err := db.QueryRowContext(ctx, "SELECT voting_frozen FROM people WHERE id = $1", personID).Scan(&frozen)
+	if err == sql.ErrNoRows {
+		return false, nil
+	}
+	return frozen, err
+}
+
+func writeVotingFrozen(w http.ResponseWriter) {
+	writeError(w, http.StatusForbidden, "voting_frozen", "Voting for this person is paused")
+}
+
+func setVotingFrozen(ctx context.Context, personID int, frozen bool) (bool, error) {
+	res, err := db.ExecContext(ctx, "UPDATE people SET voting_frozen = $2 WHERE id = $1", personID, frozen)
+	if err != nil {
+		return false, err
+	}
+	n, _ := res.RowsAffected()
+	return n > 0, nil
+}
+
+// Freeze or unfreeze one person (admin-only)
+func adminFreezeHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if !adminAuthorized(r) {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	var req adminFreezeRequest
+	if errs := bindAdminForm(r, &req); errs != nil {
+		renderAdmin(w, r, errs)
+		return
+	}
+	if _, err := setVotingFrozen(r.Context(), req.PersonID, req.Frozen); err != nil {
+		serverError(w, r, err)
+		return
+	}
+	invalidatePeopleCache()
+	events.publish("person_updated", map[string]interface{}{"public_id": publicIDOf(r.Context(), req.PersonID)})
+
+	http.Redirect(w, r, "/admin", http.StatusSeeOther)
+}
@@ -4,7 +4,10 @@ go 1.24.4
 
 require (
 	github.com/lib/pq v1.10.9
+	github.com/rivo/uniseg v0.4.7
 	github.com/rwcarlsen/goexif v0.0.0-20190401172101-9e8deecbddbd
+	golang.org/x/crypto v0.41.0
 	golang.org/x/image v0.30.0
-
+	golang.org/x/net v0.42.0
+	golang.org/x/text v0.28.0
 )
@@ -0,0 +1,208 @@
+package main
+
+import (
+	"compress/gzip"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Gzip for HTML, JSON and the other text responses once they pass
+// GZIP_MIN_BYTES (default 1024; "off" disables it). The first bytes are held
+// back until the size is known, so small responses go out as they are.
+// Brotli would need a dependency for little gain over gzip on pages this
+// size, so it is left out.
+
+var (
+	gzipMinBytes = 1024 // 0 disables compression
+	gzipPool     = sync.Pool{New: func() interface{} { return gzip.NewWriter(io.Discard) }}
+)
+
+func loadCompressionConfig() error {
+	min := 1024
+	switch v := os.Getenv("GZIP_MIN_BYTES"); v {
+	case "":
+	case "off":
+		min = 0
+	default:
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 {
+			return fmt.Errorf("GZIP_MIN_BYTES: must be a positive number or \"off\"")
+		}
+		min = n
+	}
+	configMu.Lock()
+	gzipMinBytes = min
+	configMu.Unlock()
+	return nil
+}
+
+// Whether the client takes gzip, i.e. lists it, or failing that "*",
+// without q=0. Codings and q are case-insensitive.
+func acceptsGzip(r *http.Request) bool {
+	gzip, star := -1.0, -1.0 // q of each, -1 when not listed
+	for _, part := range strings.Split(r.Header.Get("Accept-Encoding"), ",") {
+		coding, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		q := 1.0
+		if v, ok := strings.CutPrefix(strings.ToLower(strings.TrimSpace(params)), "q="); ok {
+			if f, err := strconv.ParseFloat(v, 64); err == nil {
+				q = f
+			} else {
+				q = 0
+			}
+		}
+		switch strings.ToLower(strings.TrimSpace(coding)) {
+		case "gzip":
+			gzip = q
+		case "*":
+			star = q
+		}
+	}
+	if gzip >= 0 {
+		return gzip > 0
+	}
+	return star > 0
+}
+
+func compressibleType(contentType string) bool {
+	mediaType, _, _ := strings.Cut(contentType, ";")
+	mediaType = strings.TrimSpace(mediaType)
+	switch {
+	case mediaType == "text/event-stream":
+		return false // flushed per event, gzip would only add latency
+	case strings.HasPrefix(mediaType, "text/"):
+		return true
+	case strings.HasSuffix(mediaType, "json"), strings.HasSuffix(mediaType, "xml"),
+		mediaType == "application/javascript", mediaType == "image/svg+xml":
+		return true
+	}
+	return false
+}
+
+func withCompression(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		configMu.RLock()
+		min := gzipMinBytes
+		configMu.RUnlock()
+		// WebSocket upgrades hijack the connection and need the raw writer
+		if min == 0 || r.Method == http.MethodHead || r.Header.Get("Upgrade") != "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+		w.Header().Add("Vary", "Accept-Encoding")
+		if !acceptsGzip(r) {
+			next.ServeHTTP(w, r)
+			return
+		}
+		gw := &gzipWriter{ResponseWriter: w, min: min}
+		// Not deferred: after a panic the held-back bytes are dropped and
+		// withRecovery answers instead
+		next.ServeHTTP(gw, r)
+		gw.close()
+	})
+}
+
+// Holds the start of the response until it's clear whether to compress
+type gzipWriter struct {
+	http.ResponseWriter
+	min     int
+	status  int
+	buf     []byte
+	decided bool
+	gz      *gzip.Writer
+}
+
+func (w *gzipWriter) WriteHeader(status int) {
+	if w.status != 0 || w.decided {
+		return
+	}
+	w.status = status
+	// Informational and bodiless responses go straight out
+	if status < 200 || status == http.StatusNoContent || status == http.StatusNotModified {
+		w.decide(false)
+	}
+}
+
+func (w *gzipWriter) Write(b []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	if !w.decided {
+		w.buf = append(w.buf, b...)
+		if len(w.buf) >= w.min {
+			if err := w.decide(true); err != nil {
+				return 0, err
+			}
+		}
+		return len(b), nil
+	}
+	if w.gz != nil {
+		return w.gz.Write(b)
+	}
+	return w.ResponseWriter.Write(b)
+}
+
+// Send the header and whatever was held back, compressed if big enough
+// and of a type that's worth it
+func (w *gzipWriter) decide(big bool) error {
+	w.decided = true
+	h := w.Header()
+	if h.Get("Content-Type") == "" && len(w.buf) > 0 {
+		h.Set("Content-Type", http.DetectContentType(w.buf))
+	}
+	if big && h.Get("Content-Encoding") == "" && compressibleType(h.Get("Content-Type")) {
+		h.Set("Content-Encoding", "gzip")
+		h.Del("Content-Length")
+		w.gz = gzipPool.Get().(*gzip.Writer)
+		w.gz.Reset(w.ResponseWriter)
+	}
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	w.ResponseWriter.WriteHeader(w.status)
+	buf := w.buf
+	w.buf = nil
+	if len(buf) == 0 {
+		return nil
+	}
+	var err error
+	if w.gz != nil {
+		_, err = w.gz.Write(buf)
+	} else {
+		_, err = w.ResponseWriter.Write(buf)
+	}
+	return err
+}
+
+// A flush means the handler is streaming, so stop waiting for more bytes
+func (w *gzipWriter) Flush() {
+	if !w.decided {
+		w.decide(len(w.buf) >= w.min)
+	}
+	if w.gz != nil {
+		w.gz.Flush()
+	}
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+func (w *gzipWriter) close() {
+	if !w.decided {
+		if w.status == 0 && len(w.buf) == 0 {
+			return // nothing written; leave the default response to net/http
+		}
+		w.decide(false)
+	}
+	if w.gz != nil {
+		w.gz.Close()
+		gzipPool.Put(w.gz)
+		w.gz = nil
+	}
+}
+
+func (w *gzipWriter) Unwrap() http.ResponseWriter { return w.ResponseWriter }
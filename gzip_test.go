@@ -0,0 +1,65 @@
+package main
+
+import (
+	"net/http/httptest"
+	"testing"
+)
+
+func TestAcceptsGzip(t *testing.T) {
+	tests := []struct {
+		header string
+		want   bool
+	}{
+		{"", false},
+		{"gzip", true},
+		{"gzip, deflate, br", true},
+		{"br, gzip", true},
+		{"deflate, br", false},
+		{"GZIP", true},
+		{"gzip;q=0.5", true},
+		{"gzip; q=0.001", true},
+		{"gzip;q=0", false},
+		{"gzip;Q=0", false},
+		{"gzip;q=0.000", false},
+		{"gzip;q=bad", false},
+		{"*", true},
+		{"*;q=0", false},
+		{"gzip;q=0, *", false},
+		{"*;q=0, gzip", true},
+		{"identity", false},
+		{"x-gzip", false},
+	}
+	for _, tt := range tests {
+		r := httptest.NewRequest("GET", "/", nil)
+		if tt.header != "" {
+			r.Header.Set("Accept-Encoding", tt.header)
+		}
+		if got := acceptsGzip(r); got != tt.want {
+			t.Errorf("acceptsGzip(%q) = %v, want %v", tt.header, got, tt.want)
+		}
+	}
+}
+
+func TestCompressibleType(t *testing.T) {
+	tests := []struct {
+		contentType string
+		want        bool
+	}{
+		{"text/html; charset=utf-8", true},
+		{"text/css", true},
+		{"application/json", true},
+		{"application/problem+json", true},
+		{"application/atom+xml", true},
+		{"application/javascript", true},
+		{"image/svg+xml", true},
+		{"text/event-stream", false},
+		{"image/png", false},
+		{"application/pdf", false},
+		{"", false},
+	}
+	for _, tt := range tests {
+		if got := compressibleType(tt.contentType); got != tt.want {
+			t.Errorf("compressibleType(%q) = %v, want %v", tt.contentType, got, tt.want)
+		}
+	}
+}
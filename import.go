@@ -0,0 +1,788 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"macurate/validation"
+)
+
+// Bring people, their votes and comments over from another macurate board,
+// either straight from its database (`macurate import -from URL`) or from a
+// comments export (`-file`, or the upload on /admin/import). Scores follow
+// from the votes. A person whose name is already on this board is skipped,
+// merged into the existing one, or added again, as -on-conflict says.
+//
+// An upload goes in two steps: the file is parsed and checked, then stored
+// as a staged batch and previewed person by person (what would be added,
+// merged or skipped, and which records were bad); committing the batch
+// applies it in one transaction. Staged batches expire after
+// importBatchTTL.
+
+const (
+	importSkip      = "skip"
+	importMerge     = "merge"
+	importDuplicate = "duplicate"
+	importAdded     = "add" // an outcome: new here, whatever the setting
+
+	importMaxRowErrors = 100
+	importBatchTTL     = 24 * time.Hour
+)
+
+type importVote struct {
+	Upvote    bool
+	Comment   string
+	VoterName string
+	VoterID   string
+	Status    string
+	CreatedAt time.Time
+}
+
+type importPerson struct {
+	Name  string
+	Team  string
+	Image []byte // nil from an export file
+	Votes []importVote
+}
+
+// A record of the file that was left out, and why
+type importRowError struct {
+	Record  int    `json:"record"` // 1-based, not counting a CSV header
+	Message string `json:"message"`
+}
+
+// What happens to one person of the import
+type importOutcome struct {
+	Name             string
+	Team             string
+	Action           string // importAdded, importMerge or importSkip
+	ExistingID       int    // the person here with that name, if any
+	ExistingPublicID string
+	Upvotes          int
+	Downvotes        int
+	Comments         int
+}
+
+type importStats struct {
+	PeopleAdded   int
+	PeopleMerged  int
+	PeopleSkipped int
+	Votes         int
+	DryRun        bool
+	People        []importOutcome
+}
+
+func (s importStats) String() string {
+	msg := fmt.Sprintf("%d people added, %d merged, %d skipped; %d votes imported",
+		s.PeopleAdded, s.PeopleMerged, s.PeopleSkipped, s.Votes)
+	if s.DryRun {
+		msg += " (dry run, nothing was saved)"
+	}
+	return msg
+}
+
+// Older boards lack some columns; this says which ones the source has
+func sourceColumns(ctx context.Context, src *sql.DB, table string) (map[string]bool, error) {
+	rows, err := src.QueryContext(ctx, "SELECT column_name FROM information_schema.columns WHERE table_name = $1 AND table_schema = current_schema()", table)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	cols := map[string]bool{}
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return nil, err
+		}
+		cols[name] = true
+	}
+	return cols, rows.Err()
+}
+
+// Everything worth importing from another board's database
+func readImportDatabase(ctx context.Context, url string) ([]importPerson, error) {
+	src, err := sql.Open("postgres", url)
+	if err != nil {
+		return nil, err
+	}
+	defer src.Close()
+	if err := src.PingContext(ctx); err != nil {
+		return nil, err
+	}
+
+	peopleCols, err := sourceColumns(ctx, src, "people")
+	if err != nil {
+		return nil, err
+	}
+	voteCols, err := sourceColumns(ctx, src, "votes")
+	if err != nil {
+		return nil, err
+	}
+	if !peopleCols["name"] || !voteCols["person_id"] {
+		return nil, errors.New("that database doesn't look like a macurate board")
+	}
+	col := func(cols map[string]bool, expr, name, fallback string) string {
+		if cols[name] {
+			return expr
+		}
+		return fallback
+	}
+
+	teamExpr := "''"
+	if peopleCols["team_id"] {
+		teamExpr = "COALESCE((SELECT t.name FROM teams t WHERE t.id = p.team_id), '')"
+	}
+	rows, err := src.QueryContext(ctx, `SELECT p.id, p.name, `+teamExpr+`, p.image FROM people p ORDER BY p.id`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var people []importPerson
+	index := map[int]int{} // source id -> position in people
+	for rows.Next() {
+		var id int
+		var p importPerson
+		if err := rows.Scan(&id, &p.Name, &p.Team, &p.Image); err != nil {
+			return nil, err
+		}
+		index[id] = len(people)
+		people = append(people, p)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	rows, err = src.QueryContext(ctx, `
+        SELECT person_id, upvote, COALESCE(comment, ''),
+               `+col(voteCols, "COALESCE(voter_name, '')", "voter_name", "''")+`,
+               `+col(voteCols, "COALESCE(voter_id, '')", "voter_id", "''")+`,
+               `+col(voteCols, "status", "status", "'approved'")+`,
+               `+col(voteCols, "created_at", "created_at", "NOW()")+`
+        FROM votes
+        WHERE upvote IS NOT NULL
+        ORDER BY id`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var personID int
+		var v importVote
+		if err := rows.Scan(&personID, &v.Upvote, &v.Comment, &v.VoterName, &v.VoterID, &v.Status, &v.CreatedAt); err != nil {
+			return nil, err
+		}
+		if i, ok := index[personID]; ok {
+			people[i].Votes = append(people[i].Votes, v)
+		}
+	}
+	return people, rows.Err()
+}
+
+// A comments export: NDJSON, one JSON array, or CSV with a header row
+// naming the same fields (person, upvote, text, author, status,
+// created_at; person_id is optional). It has no teams or photos. Bad
+// records are collected rather than failing the whole file; only an
+// unreadable file, or one with more than importMaxRowErrors bad records,
+// is an error.
+func readImportFile(r io.Reader) ([]importPerson, []importRowError, error) {
+	br := bufio.NewReader(r)
+	first, err := firstNonSpace(br)
+	if err == io.EOF {
+		return nil, nil, errors.New("the file is empty")
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+
+	b := &importBuilder{index: map[importKey]int{}}
+	switch first {
+	case '[':
+		err = b.readJSONArray(br)
+	case '{':
+		err = b.readNDJSON(br)
+	default:
+		err = b.readCSV(br)
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(b.people) == 0 && len(b.errs) == 0 {
+		return nil, nil, errors.New("the file has no votes in it")
+	}
+	return b.people, b.errs, nil
+}
+
+// People in an export are told apart by their id there, or by name when a
+// hand-made file has no ids
+type importKey struct {
+	id   int
+	name string
+}
+
+type importBuilder struct {
+	people []importPerson
+	index  map[importKey]int
+	errs   []importRowError
+	record int
+}
+
+// Take the next record, or note why it can't be used
+func (b *importBuilder) add(c exportComment, err error) error {
+	b.record++
+	if err == nil {
+		err = validateImportRecord(c)
+	}
+	if err != nil {
+		b.errs = append(b.errs, importRowError{Record: b.record, Message: err.Error()})
+		if len(b.errs) > importMaxRowErrors {
+			return fmt.Errorf("more than %d records have errors; is this a macurate export?", importMaxRowErrors)
+		}
+		return nil
+	}
+
+	key := importKey{id: c.PersonID}
+	if c.PersonID == 0 {
+		key.name = strings.ToLower(c.Person)
+	}
+	i, ok := b.index[key]
+	if !ok {
+		i = len(b.people)
+		b.index[key] = i
+		b.people = append(b.people, importPerson{Name: c.Person})
+	}
+	if c.Upvote == nil {
+		return nil // retracted; counts for nothing
+	}
+	status := c.Status
+	if status == "" {
+		status = commentApproved
+	}
+	b.people[i].Votes = append(b.people[i].Votes, importVote{
+		Upvote: *c.Upvote, Comment: c.Text, VoterName: c.Author, Status: status, CreatedAt: c.CreatedAt,
+	})
+	return nil
+}
+
+// The limits a vote cast here would have to meet
+func validateImportRecord(c exportComment) error {
+	switch {
+	case strings.TrimSpace(c.Person) == "":
+		return errors.New("no person")
+	case len([]rune(c.Person)) > 100:
+		return errors.New("person name is longer than 100 characters")
+	case len([]rune(c.Text)) > 2000:
+		return errors.New("comment is longer than 2000 characters")
+	case len([]rune(c.Author)) > 64:
+		return errors.New("author is longer than 64 characters")
+	case c.CreatedAt.IsZero():
+		return errors.New("no created_at")
+	}
+	switch c.Status {
+	case "", commentApproved, commentPending, commentRejected:
+	default:
+		return fmt.Errorf("unknown status %q", c.Status)
+	}
+	return nil
+}
+
+func (b *importBuilder) readJSONArray(r io.Reader) error {
+	dec := json.NewDecoder(r)
+	if _, err := dec.Token(); err != nil {
+		return err
+	}
+	for dec.More() {
+		// A syntax error loses our place in the array, so only a record of
+		// the wrong shape is skipped
+		var raw json.RawMessage
+		if err := dec.Decode(&raw); err != nil {
+			return fmt.Errorf("record %d: %w", b.record+1, err)
+		}
+		var c exportComment
+		err := json.Unmarshal(raw, &c)
+		if err := b.add(c, err); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (b *importBuilder) readNDJSON(r io.Reader) error {
+	sc := bufio.NewScanner(r)
+	sc.Buffer(make([]byte, 64*1024), 1<<20)
+	for sc.Scan() {
+		line := bytes.TrimSpace(sc.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+		var c exportComment
+		err := json.Unmarshal(line, &c)
+		if err := b.add(c, err); err != nil {
+			return err
+		}
+	}
+	return sc.Err()
+}
+
+func (b *importBuilder) readCSV(r io.Reader) error {
+	cr := csv.NewReader(r)
+	header, err := cr.Read()
+	if err != nil {
+		return err
+	}
+	cols := map[string]int{}
+	for i, name := range header {
+		cols[strings.ToLower(strings.TrimSpace(name))] = i
+	}
+	if _, ok := cols["person"]; !ok {
+		return errors.New("the CSV header has no person column")
+	}
+	if _, ok := cols["upvote"]; !ok {
+		return errors.New("the CSV header has no upvote column")
+	}
+
+	for {
+		row, err := cr.Read()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil && !errors.Is(err, csv.ErrFieldCount) {
+			return err
+		}
+		var c exportComment
+		if err == nil {
+			c, err = parseImportCSVRow(cols, row)
+		}
+		if err := b.add(c, err); err != nil {
+			return err
+		}
+	}
+}
+
+func parseImportCSVRow(cols map[string]int, row []string) (exportComment, error) {
+	field := func(name string) string {
+		if i, ok := cols[name]; ok && i < len(row) {
+			return strings.TrimSpace(row[i])
+		}
+		return ""
+	}
+	c := exportComment{Person: field("person"), Text: field("text"), Author: field("author"), Status: field("status")}
+	if v := field("person_id"); v != "" {
+		id, err := strconv.Atoi(v)
+		if err != nil {
+			return c, fmt.Errorf("person_id %q is not a number", v)
+		}
+		c.PersonID = id
+	}
+	switch v := strings.ToLower(field("upvote")); v {
+	case "true", "up", "1":
+		up := true
+		c.Upvote = &up
+	case "false", "down", "0":
+		up := false
+		c.Upvote = &up
+	case "":
+		// retracted
+	default:
+		return c, fmt.Errorf("upvote %q is not up or down", v)
+	}
+	if v := field("created_at"); v != "" {
+		t, err := parseTimestamp(v)
+		if err != nil {
+			return c, fmt.Errorf("created_at: %w", err)
+		}
+		c.CreatedAt = t
+	}
+	return c, nil
+}
+
+func firstNonSpace(br *bufio.Reader) (byte, error) {
+	for {
+		b, err := br.ReadByte()
+		if err != nil {
+			return 0, err
+		}
+		if !strings.ContainsRune(" \t\r\n", rune(b)) {
+			return b, br.UnreadByte()
+		}
+	}
+}
+
+// Write the people and votes in one transaction; a dry run rolls it back
+// and only reports what would have happened
+func applyImport(ctx context.Context, people []importPerson, onConflict string, dryRun bool) (importStats, error) {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return importStats{DryRun: dryRun}, err
+	}
+	defer tx.Rollback()
+	stats, err := applyImportTx(ctx, tx, people, onConflict)
+	stats.DryRun = dryRun
+	if err != nil {
+		return stats, err
+	}
+	if err := finishTx(tx, dryRun); err != nil {
+		return stats, err
+	}
+	if !dryRun {
+		importApplied()
+	}
+	return stats, nil
+}
+
+// After a committed import
+func importApplied() {
+	invalidatePeopleCache()
+	// Too much changed for incremental updates; have clients refetch
+	events.publish("resync", nil)
+}
+
+func applyImportTx(ctx context.Context, tx *sql.Tx, people []importPerson, onConflict string) (importStats, error) {
+	var stats importStats
+	teams := map[string]sql.NullInt64{}
+	teamID := func(name string) (sql.NullInt64, error) {
+		if name == "" {
+			return sql.NullInt64{}, nil
+		}
+		if id, ok := teams[name]; ok {
+			return id, nil
+		}
+		var id sql.NullInt64
+		err := tx.QueryRowContext(ctx, `
+            WITH ins AS (INSERT INTO teams (name) VALUES ($1) ON CONFLICT (name) DO NOTHING RETURNING id)
+            SELECT id FROM ins UNION ALL SELECT id FROM teams WHERE name = $1 LIMIT 1`, name).Scan(&id)
+		teams[name] = id
+		return id, err
+	}
+
+	for _, p := range people {
+		var existing int
+		var existingPublicID string
+		err := tx.QueryRowContext(ctx, "SELECT id, COALESCE(public_id, '') FROM people WHERE LOWER(name) = LOWER($1) ORDER BY id LIMIT 1", p.Name).Scan(&existing, &existingPublicID)
+		if err != nil && err != sql.ErrNoRows {
+			return stats, err
+		}
+
+		outcome := importOutcome{Name: p.Name, Team: p.Team, ExistingID: existing, ExistingPublicID: existingPublicID}
+		for _, v := range p.Votes {
+			if v.Upvote {
+				outcome.Upvotes++
+			} else {
+				outcome.Downvotes++
+			}
+			if v.Comment != "" {
+				outcome.Comments++
+			}
+		}
+
+		personID := existing
+		switch {
+		case existing != 0 && onConflict == importSkip:
+			outcome.Action = importSkip
+			stats.People = append(stats.People, outcome)
+			stats.PeopleSkipped++
+			continue
+		case existing != 0 && onConflict == importMerge:
+			outcome.Action = importMerge
+			stats.PeopleMerged++
+		default:
+			team, err := teamID(p.Team)
+			if err != nil {
+				return stats, err
+			}
+			if err := tx.QueryRowContext(ctx, "INSERT INTO people (name, image, team_id, public_id) VALUES ($1, $2, $3, $4) RETURNING id",
+				p.Name, p.Image, team, newPublicID()).Scan(&personID); err != nil {
+				return stats, err
+			}
+			outcome.Action = importAdded
+			stats.PeopleAdded++
+		}
+		stats.People = append(stats.People, outcome)
+
+		for _, v := range p.Votes {
+			if _, err := tx.ExecContext(ctx, `
+                INSERT INTO votes (person_id, upvote, comment, voter_name, voter_id, status, created_at)
+                VALUES ($1, $2, $3, NULLIF($4, ''), NULLIF($5, ''), $6, $7)`,
+				personID, v.Upvote, v.Comment, v.VoterName, v.VoterID, v.Status, v.CreatedAt); err != nil {
+				return stats, err
+			}
+			stats.Votes++
+		}
+	}
+	return stats, nil
+}
+
+func createImportTables() error {
+	_, err := db.Exec(`
+    CREATE TABLE IF NOT EXISTS import_batches (
+        id SERIAL PRIMARY KEY,
+        filename TEXT NOT NULL DEFAULT '',
+        on_conflict TEXT NOT NULL,
+        people JSONB NOT NULL,
+        row_errors JSONB NOT NULL DEFAULT '[]',
+        created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+        committed_at TIMESTAMPTZ
+    );
+    `)
+	return err
+}
+
+// An uploaded file waiting to be committed
+type importBatch struct {
+	ID          int
+	Filename    string
+	OnConflict  string
+	People      []importPerson
+	RowErrors   []importRowError
+	CreatedAt   time.Time
+	CommittedAt sql.NullTime
+}
+
+func (b importBatch) ExpiresAt() time.Time { return b.CreatedAt.Add(importBatchTTL) }
+
+func stageImport(ctx context.Context, filename, onConflict string, people []importPerson, rowErrors []importRowError) (int, error) {
+	if _, err := db.ExecContext(ctx, "DELETE FROM import_batches WHERE created_at < $1", time.Now().Add(-importBatchTTL)); err != nil {
+		return 0, err
+	}
+	if rowErrors == nil {
+		rowErrors = []importRowError{}
+	}
+	peopleJSON, err := json.Marshal(people)
+	if err != nil {
+		return 0, err
+	}
+	errorsJSON, err := json.Marshal(rowErrors)
+	if err != nil {
+		return 0, err
+	}
+	var id int
+	err = db.QueryRowContext(ctx, `
+        INSERT INTO import_batches (filename, on_conflict, people, row_errors)
+        VALUES ($1, $2, $3, $4) RETURNING id`, filename, onConflict, peopleJSON, errorsJSON).Scan(&id)
+	return id, err
+}
+
+// A batch that hasn't expired; sql.ErrNoRows otherwise
+func loadImportBatch(ctx context.Context, id int) (importBatch, error) {
+	b := importBatch{ID: id}
+	var peopleJSON, errorsJSON []byte
+	err := db.QueryRowContext(ctx, `
+        SELECT filename, on_conflict, people, row_errors, created_at, committed_at
+        FROM import_batches WHERE id = $1 AND created_at >= $2`, id, time.Now().Add(-importBatchTTL)).
+		Scan(&b.Filename, &b.OnConflict, &peopleJSON, &errorsJSON, &b.CreatedAt, &b.CommittedAt)
+	if err != nil {
+		return b, err
+	}
+	if err := json.Unmarshal(peopleJSON, &b.People); err != nil {
+		return b, err
+	}
+	return b, json.Unmarshal(errorsJSON, &b.RowErrors)
+}
+
+var errImportCommitted = errors.New("this import was already committed")
+
+// Apply a staged batch. Marking it committed happens in the same
+// transaction, so a double submit can't import it twice.
+func commitImportBatch(ctx context.Context, b importBatch) (importStats, error) {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return importStats{}, err
+	}
+	defer tx.Rollback()
+	res, err := tx.ExecContext(ctx, "UPDATE import_batches SET committed_at = NOW() WHERE id = $1 AND committed_at IS NULL", b.ID)
+	if err != nil {
+		return importStats{}, err
+	}
+	if n, err := res.RowsAffected(); err != nil {
+		return importStats{}, err
+	} else if n == 0 {
+		return importStats{}, errImportCommitted
+	}
+	stats, err := applyImportTx(ctx, tx, b.People, b.OnConflict)
+	if err != nil {
+		return stats, err
+	}
+	if err := tx.Commit(); err != nil {
+		return stats, err
+	}
+	importApplied()
+	return stats, nil
+}
+
+// `macurate import`
+func runImport(args []string) error {
+	fs := flag.NewFlagSet("import", flag.ContinueOnError)
+	from := fs.String("from", "", "database URL of the other board")
+	file := fs.String("file", "", "comments export (NDJSON, JSON or CSV) to read instead")
+	onConflict := fs.String("on-conflict", importSkip, "when a name is already here: skip, merge or duplicate")
+	dryRun := fs.Bool("dry-run", false, "report what would be imported without saving it")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if (*from == "") == (*file == "") {
+		return errors.New("usage: macurate import (-from DATABASE_URL | -file EXPORT) [-on-conflict skip|merge|duplicate] [-dry-run]")
+	}
+	switch *onConflict {
+	case importSkip, importMerge, importDuplicate:
+	default:
+		return errors.New("-on-conflict must be skip, merge or duplicate")
+	}
+
+	ctx := context.Background()
+	var people []importPerson
+	var err error
+	if *from != "" {
+		people, err = readImportDatabase(ctx, *from)
+	} else {
+		var f *os.File
+		if f, err = os.Open(*file); err != nil {
+			return err
+		}
+		defer f.Close()
+		var rowErrors []importRowError
+		people, rowErrors, err = readImportFile(f)
+		if err == nil && len(rowErrors) > 0 {
+			for _, e := range rowErrors {
+				fmt.Fprintf(os.Stderr, "import: record %d: %s\n", e.Record, e.Message)
+			}
+			err = fmt.Errorf("%d records have errors; nothing was imported", len(rowErrors))
+		}
+	}
+	if err != nil {
+		return err
+	}
+
+	stats, err := applyImport(ctx, people, *onConflict, *dryRun)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(os.Stderr, "import: %s\n", stats)
+	return nil
+}
+
+// Upload a comments export from another board (admin-only). A POST stages
+// the file and redirects to its preview at ?batch=ID, where it can be
+// committed or discarded.
+func adminImportHandler(w http.ResponseWriter, r *http.Request) {
+	if !adminAuthorized(r) {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+	data := map[string]interface{}{
+		"OnConflict": importSkip,
+	}
+	render := func(status int) {
+		if status != http.StatusOK {
+			w.WriteHeader(status)
+		}
+		tmpl := parseTemplates("templates/import.html")
+		if err := tmpl.Execute(w, data); err != nil {
+			serverError(w, r, err)
+		}
+	}
+
+	if r.Method == http.MethodPost && r.FormValue("action") == "" {
+		var req adminImportRequest
+		errs := bindAdminForm(r, &req)
+		var people []importPerson
+		var rowErrors []importRowError
+		var filename string
+		if errs == nil {
+			data["OnConflict"] = req.OnConflict
+			file, header, err := r.FormFile("file")
+			if err != nil {
+				errs = validation.Errors{"file": "is required"}
+			} else {
+				defer file.Close()
+				filename = header.Filename
+				if people, rowErrors, err = readImportFile(file); err != nil {
+					errs = validation.Errors{"file": "could not be read: " + err.Error()}
+				}
+			}
+		}
+		if errs != nil {
+			data["Errors"] = errs
+			render(http.StatusBadRequest)
+			return
+		}
+		id, err := stageImport(r.Context(), filename, req.OnConflict, people, rowErrors)
+		if err != nil {
+			serverError(w, r, err)
+			return
+		}
+		http.Redirect(w, r, fmt.Sprintf("/admin/import?batch=%d", id), http.StatusSeeOther)
+		return
+	}
+
+	if r.FormValue("batch") == "" {
+		render(http.StatusOK)
+		return
+	}
+	var req adminImportBatchRequest
+	if errs := bindAdminForm(r, &req); errs != nil {
+		data["Errors"] = errs
+		render(http.StatusBadRequest)
+		return
+	}
+	batch, err := loadImportBatch(r.Context(), req.BatchID)
+	if err == sql.ErrNoRows {
+		data["Gone"] = true
+		render(http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		serverError(w, r, err)
+		return
+	}
+	data["Batch"] = batch
+
+	switch {
+	case r.Method == http.MethodPost && req.Action == "discard":
+		if _, err := db.ExecContext(r.Context(), "DELETE FROM import_batches WHERE id = $1 AND committed_at IS NULL", batch.ID); err != nil {
+			serverError(w, r, err)
+			return
+		}
+		http.Redirect(w, r, "/admin/import", http.StatusSeeOther)
+		return
+	case r.Method == http.MethodPost && req.Action == "commit":
+		stats, err := commitImportBatch(r.Context(), batch)
+		if err == errImportCommitted {
+			data["Committed"] = true
+			render(http.StatusConflict)
+			return
+		}
+		if err != nil {
+			serverError(w, r, err)
+			return
+		}
+		slog.InfoContext(r.Context(), "import", "batch", batch.ID, "people_added", stats.PeopleAdded, "people_merged", stats.PeopleMerged,
+			"people_skipped", stats.PeopleSkipped, "votes", stats.Votes, "skipped_records", len(batch.RowErrors))
+		data["Stats"] = stats
+		data["Committed"] = true
+	case batch.CommittedAt.Valid:
+		data["Committed"] = true
+	default:
+		// Worked out again on every view; the board may have changed since
+		// the upload
+		stats, err := applyImport(r.Context(), batch.People, batch.OnConflict, true)
+		if err != nil {
+			serverError(w, r, err)
+			return
+		}
+		data["Stats"] = stats
+	}
+	render(http.StatusOK)
+}
@@ -0,0 +1,297 @@
+package main
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/mail"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"macurate/validation"
+)
+
+// Vote by email: point a Mailgun route (or an SES receipt rule forwarding
+// through a small relay) at POST /inbound/email and reply with lines like
+//
+//	+1 anna great demo
+//	-1 bob
+//
+// Each line is one vote with the rest as the comment. Senders become
+// voters keyed by their address, and the vote is written by recordVote, so
+// duplicate rules, quadratic credits and moderation apply as on the
+// website. With SMTP configured the sender gets a reply saying which lines
+// counted.
+//
+// INBOUND_EMAIL_SECRET enables the endpoint. Mailgun requests are checked
+// against their signature (timestamp+token HMAC with the secret) and each
+// token is only accepted once; other relays send the secret in an
+// X-Inbound-Secret header.
+// INBOUND_EMAIL_DOMAINS optionally limits which sender domains may vote.
+
+var voteLinePattern = regexp.MustCompile(`^(\+1|-1|\+|-|up|down)\s+(.+)$`)
+
+func voteLineUp(sign string) bool {
+	return sign == "+1" || sign == "+" || sign == "up"
+}
+
+// InboundVoteResult reports what happened to one line of the message.
+type InboundVoteResult struct {
+	Line   string `json:"line"`
+	Person string `json:"person,omitempty"`
+	Error  string `json:"error,omitempty"`
+}
+
+func inboundAuthorized(r *http.Request, secret string) bool {
+	if sig := r.FormValue("signature"); sig != "" {
+		ts, err := strconv.ParseInt(r.FormValue("timestamp"), 10, 64)
+		if err != nil || time.Since(time.Unix(ts, 0)).Abs() > 15*time.Minute {
+			return false
+		}
+		mac := hmac.New(sha256.New, []byte(secret))
+		mac.Write([]byte(r.FormValue("timestamp") + r.FormValue("token")))
+		want := hex.EncodeToString(mac.Sum(nil))
+		return hmac.Equal([]byte(sig), []byte(want))
+	}
+	got := r.Header.Get("X-Inbound-Secret")
+	return got != "" && hmac.Equal([]byte(got), []byte(secret))
+}
+
+func senderAllowed(addr string) bool {
+	list := os.Getenv("INBOUND_EMAIL_DOMAINS")
+	if list == "" {
+		return true
+	}
+	_, domain, _ := strings.Cut(addr, "@")
+	for _, d := range strings.Split(list, ",") {
+		if strings.EqualFold(strings.TrimSpace(d), domain) {
+			return true
+		}
+	}
+	return false
+}
+
+// Voter id for a mail address: stable across messages, distinct from cookies.
+func emailVoterID(addr string) string {
+	sum := sha256.Sum256([]byte(strings.ToLower(addr)))
+	return "mail:" + hex.EncodeToString(sum[:16])
+}
+
+// Lines above the quoted original ("On ... wrote:" or "> ...").
+func replyLines(body string) []string {
+	var lines []string
+	for _, l := range strings.Split(body, "\n") {
+		l = strings.TrimSpace(l)
+		if strings.HasPrefix(l, ">") || (strings.HasPrefix(l, "On ") && strings.HasSuffix(l, "wrote:")) || l == "--" {
+			break
+		}
+		if l != "" {
+			lines = append(lines, l)
+		}
+	}
+	return lines
+}
+
+// Match the start of rest against a person: the longest full name wins, then
+// a unique first name. Returns the person and the remaining comment.
+func matchPerson(people []Person, rest string) (Person, string, bool) {
+	best, bestLen := Person{}, 0
+	for _, p := range people {
+		n := len(p.Name)
+		if n > bestLen && len(rest) >= n && strings.EqualFold(rest[:n], p.Name) && (len(rest) == n || rest[n] == ' ') {
+			best, bestLen = p, n
+		}
+	}
+	if bestLen > 0 {
+		return best, strings.TrimSpace(rest[bestLen:]), true
+	}
+
+	word, comment, _ := strings.Cut(rest, " ")
+	var found []Person
+	for _, p := range people {
+		first, _, _ := strings.Cut(p.Name, " ")
+		if strings.EqualFold(first, word) {
+			found = append(found, p)
+		}
+	}
+	if len(found) != 1 {
+		return Person{}, "", false
+	}
+	return found[0], strings.TrimSpace(comment), true
+}
+
+// Mailgun signs each delivery with a fresh token. Tokens are remembered
+// as long as a signature is accepted (15 minutes), so a captured request
+// can't be replayed.
+const inboundTokenTTL = 15 * time.Minute
+
+func createInboundTables() error {
+	_, err := db.Exec(`
+    CREATE TABLE IF NOT EXISTS inbound_email_tokens (
+        token TEXT PRIMARY KEY,
+        seen_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+    );
+    `)
+	return err
+}
+
+// Claim a Mailgun token; false when it has been seen before
+func claimInboundToken(ctx context.Context, token string) (bool, error) {
+	if _, err := db.ExecContext(ctx, "DELETE FROM inbound_email_tokens WHERE seen_at < NOW() - $1 * INTERVAL '1 second'",
+		int(inboundTokenTTL.Seconds())); err != nil {
+		return false, err
+	}
+	res, err := db.ExecContext(ctx, "INSERT INTO inbound_email_tokens (token) VALUES ($1) ON CONFLICT DO NOTHING", token)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n > 0, err
+}
+
+// Mail the sender what became of each line, when SMTP is set up
+func sendInboundReceipt(to, subject string, results []InboundVoteResult) {
+	if !smtpConfigured() || len(results) == 0 {
+		return
+	}
+	var b strings.Builder
+	for _, res := range results {
+		outcome := "counted for " + res.Person
+		if res.Error != "" {
+			outcome = "not counted: " + res.Error
+		}
+		fmt.Fprintf(&b, "%s\r\n  %s\r\n", res.Line, outcome)
+	}
+	if subject == "" {
+		subject = currentBoardName()
+	}
+	if err := sendMail(to, "Re: "+strings.TrimPrefix(subject, "Re: "), b.String()); err != nil {
+		slog.Error("inbound email receipt", "err", err)
+	}
+}
+
+// Inbound mail webhook; see the top of the file
+func inboundEmailHandler(w http.ResponseWriter, r *http.Request) {
+	secret := os.Getenv("INBOUND_EMAIL_SECRET")
+	if secret == "" {
+		http.NotFound(w, r)
+		return
+	}
+	if _, err := formValues(r); err != nil {
+		http.Error(w, "Invalid form", http.StatusBadRequest)
+		return
+	}
+	if !inboundAuthorized(r, secret) {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+	if r.FormValue("signature") != "" {
+		if fresh, err := claimInboundToken(r.Context(), r.FormValue("token")); err != nil {
+			serverError(w, r, err)
+			return
+		} else if !fresh {
+			// 406 is the status Mailgun takes as "don't retry"
+			http.Error(w, "Token already used", http.StatusNotAcceptable)
+			return
+		}
+	}
+
+	from := r.FormValue("from")
+	if from == "" {
+		from = r.FormValue("sender")
+	}
+	addr, err := mail.ParseAddress(from)
+	if err != nil {
+		writeValidationError(w, validation.Errors{"from": "is not a valid address"})
+		return
+	}
+	if !senderAllowed(addr.Address) {
+		http.Error(w, "Sender not allowed", http.StatusForbidden)
+		return
+	}
+	if votingClosed() {
+		http.Error(w, "Voting is closed", http.StatusForbidden)
+		return
+	}
+
+	// Mailgun strips the quoted reply for us; fall back to the full text
+	body := r.FormValue("stripped-text")
+	if body == "" {
+		body = r.FormValue("body-plain")
+	}
+	if body == "" {
+		body = r.FormValue("text")
+	}
+
+	name := addr.Name
+	if name == "" {
+		name, _, _ = strings.Cut(addr.Address, "@")
+	}
+	voterName, _ := resolveVoterName(getNamePolicy(), name)
+	voterID := emailVoterID(addr.Address)
+	voteType := getVoteType()
+	commentsEnabled := getDisplayOptions().CommentsEnabled
+	commentPolicy := getCommentPolicy()
+	commentRules := getCommentRules()
+
+	people, err := queryPeople(r.Context(), "name")
+	if err != nil {
+		serverError(w, r, err)
+		return
+	}
+
+	results := []InboundVoteResult{}
+	for _, line := range replyLines(body) {
+		m := voteLinePattern.FindStringSubmatch(line)
+		if m == nil {
+			continue // greetings, signatures and the like
+		}
+		res := InboundVoteResult{Line: line}
+		up := voteLineUp(m[1])
+		vote := "down"
+		if up {
+			vote = "up"
+		}
+		p, comment, ok := matchPerson(people, m[2])
+		comment = validation.CleanText(comment)
+		problem := checkCommentQuality(commentRules, comment)
+		typeErrs := checkVoteType(voteType, voteRequest{Vote: vote})
+		switch {
+		case typeErrs != nil:
+			res.Error = "this board takes star ratings, not up/down votes"
+		case !ok:
+			res.Error = "no single person matches"
+		case p.Frozen:
+			res.Error = "voting for this person is paused"
+		case comment != "" && !commentsEnabled:
+			res.Error = "comments are disabled"
+		case validation.Length(comment) > 2000:
+			res.Error = "comment is too long"
+		case comment == "" && commentRequired(commentPolicy, up):
+			res.Error = commentRequiredError(commentPolicy).Message
+		case problem != nil:
+			res.Error = problem.Message
+		default:
+			res.Person = p.Name
+			err := recordVote(r.Context(), newVote{
+				PersonID: p.ID, VoterID: voterID, VoterName: voterName, Vote: vote, Comment: comment, Source: "email",
+			})
+			if err == errNoVoteCredits || err == errAlreadyVoted {
+				res.Error = err.Error()
+			} else if err != nil {
+				serverError(w, r, err)
+				return
+			}
+		}
+		results = append(results, res)
+	}
+	go sendInboundReceipt(addr.Address, r.FormValue("subject"), results)
+	writeJSON(w, http.StatusOK, map[string]interface{}{"votes": results})
+}
@@ -0,0 +1,176 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/json"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// Several app instances can run against one Postgres database. Votes,
+// settings and everything else durable are shared through it; what each
+// instance keeps in memory is kept in step over a LISTEN/NOTIFY channel:
+//
+//   - "people": a change to scores or the roster drops every people cache
+//   - "teams", "board_name": admin changes reload the team domains and the
+//     board name everywhere
+//   - "event": a live event published on one instance is streamed by all
+//
+// A notification is best effort; after the listener reconnects, caches are
+// dropped and streams told to resync. Rate limits and API key quotas are
+// token buckets in the Store, so they hold across instances. Still per
+// instance: the badge cache (up to badgeTTL stale), the traffic dashboard
+// and debug recordings, and SIGHUP reloads, which each instance needs its
+// own of.
+
+const instanceSyncChannel = "macurate_sync"
+
+// Queued events beyond this are replaced by one "resync"
+const instanceSyncMaxEvents = 1000
+
+type syncMessage struct {
+	From  string `json:"from"`
+	Kind  string `json:"kind"` // "people", "teams", "board_name" or "event"
+	Event *Event `json:"event,omitempty"`
+}
+
+// Notifications waiting to be sent. Cache kinds coalesce, so a burst of
+// votes sends one "people"; events go out one by one, in order.
+var instanceSync struct {
+	mu       sync.Mutex
+	started  bool
+	id       string // this instance, to skip its own notifications
+	kinds    map[string]bool
+	events   []Event
+	overflow bool
+	wake     chan struct{}
+}
+
+// Tell the other instances that kind changed; a no-op until
+// startInstanceSync, so CLI commands don't send anything
+func notifyInstances(kind string) {
+	instanceSync.mu.Lock()
+	defer instanceSync.mu.Unlock()
+	if !instanceSync.started {
+		return
+	}
+	instanceSync.kinds[kind] = true
+	wakeInstanceSync()
+}
+
+// Have the other instances stream ev too
+func notifyInstancesEvent(ev Event) {
+	instanceSync.mu.Lock()
+	defer instanceSync.mu.Unlock()
+	if !instanceSync.started {
+		return
+	}
+	if len(instanceSync.events) >= instanceSyncMaxEvents {
+		instanceSync.overflow = true
+	} else {
+		instanceSync.events = append(instanceSync.events, ev)
+	}
+	wakeInstanceSync()
+}
+
+// Callers hold instanceSync.mu.
+func wakeInstanceSync() {
+	select {
+	case instanceSync.wake <- struct{}{}:
+	default:
+	}
+}
+
+// Listen for the other instances and send this one's notifications
+func startInstanceSync() {
+	instanceSync.mu.Lock()
+	instanceSync.id = rand.Text()
+	instanceSync.kinds = map[string]bool{}
+	instanceSync.wake = make(chan struct{}, 1)
+	instanceSync.started = true
+	instanceSync.mu.Unlock()
+
+	listener := pq.NewListener(serverCfg.DatabaseURL, time.Second, time.Minute, func(ev pq.ListenerEventType, err error) {
+		if err != nil {
+			slog.Warn("instance sync listener", "err", err)
+		}
+	})
+	if err := listener.Listen(instanceSyncChannel); err != nil {
+		slog.Error("instance sync listen failed", "err", err)
+	}
+	go func() {
+		for n := range listener.Notify {
+			if n == nil {
+				// Reconnected; whatever was sent meanwhile is lost
+				resyncInstance()
+				continue
+			}
+			var m syncMessage
+			if err := json.Unmarshal([]byte(n.Extra), &m); err != nil {
+				slog.Warn("instance sync: bad notification", "err", err)
+				continue
+			}
+			if m.From != instanceSync.id {
+				applySyncMessage(m)
+			}
+		}
+	}()
+	go sendInstanceSync()
+}
+
+func applySyncMessage(m syncMessage) {
+	switch m.Kind {
+	case "people":
+		dropPeopleCache()
+	case "teams":
+		if err := loadTeamDomains(); err != nil {
+			slog.Error("instance sync: team domains", "err", err)
+		}
+	case "board_name":
+		loadBoardName()
+	case "event":
+		if m.Event != nil {
+			events.deliver(*m.Event)
+		}
+	}
+}
+
+func resyncInstance() {
+	for _, kind := range []string{"people", "teams", "board_name"} {
+		applySyncMessage(syncMessage{Kind: kind})
+	}
+	events.deliver(Event{Kind: "resync", At: time.Now().UTC()})
+}
+
+func sendInstanceSync() {
+	for range instanceSync.wake {
+		instanceSync.mu.Lock()
+		var batch []syncMessage
+		for kind := range instanceSync.kinds {
+			batch = append(batch, syncMessage{Kind: kind})
+		}
+		for i := range instanceSync.events {
+			batch = append(batch, syncMessage{Kind: "event", Event: &instanceSync.events[i]})
+		}
+		if instanceSync.overflow {
+			batch = append(batch, syncMessage{Kind: "event", Event: &Event{Kind: "resync", At: time.Now().UTC()}})
+		}
+		id := instanceSync.id
+		instanceSync.kinds, instanceSync.events, instanceSync.overflow = map[string]bool{}, nil, false
+		instanceSync.mu.Unlock()
+
+		for _, m := range batch {
+			m.From = id
+			payload, err := json.Marshal(m)
+			if err == nil {
+				_, err = db.Exec("SELECT pg_notify($1, $2)", instanceSyncChannel, string(payload))
+			}
+			if err != nil {
+				slog.Error("instance sync notify failed", "kind", m.Kind, "err", err)
+			}
+		}
+	}
+}
@@ -0,0 +1,36 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+)
+
+// Several app instances can share one Postgres database (that's what it is
+// for; there is no local-disk store to outgrow). Background jobs take a
+// Postgres advisory lock so only one instance runs each tick; in-memory
+// state is kept in step by instancesync.go.
+
+// Run fn unless another instance holds the job's lock right now. Session
+// locks belong to a connection, so one is pinned for lock, work and unlock.
+func runExclusive(job string, fn func() error) error {
+	ctx := context.Background()
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	var got bool
+	if err := conn.QueryRowContext(ctx, "SELECT pg_try_advisory_lock(hashtext($1))", job).Scan(&got); err != nil {
+		return err
+	}
+	if !got {
+		return nil
+	}
+	defer func() {
+		if _, err := conn.ExecContext(ctx, "SELECT pg_advisory_unlock(hashtext($1))", job); err != nil {
+			slog.Error("job unlock failed", "job", job, "err", err)
+		}
+	}()
+	return fn()
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"strings"
+
+	"macurate/validation"
+)
+
+// Kiosk: a full-screen board for an office TV. It rotates through the
+// leaderboard, the latest comments and the team table, and refetches
+// /kiosk/data whenever the event stream reports a vote.
+//
+//	/kiosk?rotate=20&sections=leaderboard,comments
+
+var kioskSections = []string{"leaderboard", "comments", "teams"}
+
+// KioskComment is a recent comment with who it was about.
+type KioskComment struct {
+	PreviewComment
+	Person string `json:"person"`
+}
+
+// Newest approved comments across the board
+func latestComments(ctx context.Context, n int) ([]KioskComment, error) {
+	rows, err := db.QueryContext(ctx, `
+        SELECT v.id, v.upvote, v.comment, COALESCE(v.voter_name, ''), v.created_at, v.edited_at IS NOT NULL, p.name
+        FROM votes v JOIN people p ON p.id = v.person_id
+        WHERE COALESCE(TRIM(v.comment), '') <> '' AND v.status = 'approved' AND v.upvote IS NOT NULL
+        ORDER BY v.id DESC
+        LIMIT $1`, n)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	anonymous := getNamePolicy() == namePolicyAnonymous
+	list := []KioskComment{}
+	for rows.Next() {
+		var c KioskComment
+		if err := rows.Scan(&c.ID, &c.Upvote, &c.Text, &c.Author, &c.CreatedAt, &c.Edited, &c.Person); err != nil {
+			return nil, err
+		}
+		if anonymous {
+			c.Author = ""
+		}
+		list = append(list, c)
+	}
+	return list, rows.Err()
+}
+
+func kioskHandler(w http.ResponseWriter, r *http.Request) {
+	var req kioskRequest
+	if errs := validation.Bind(r.URL.Query(), &req); errs != nil {
+		writeValidationError(w, errs)
+		return
+	}
+	if req.Rotate == 0 {
+		req.Rotate = 15
+	}
+	sections := []string{}
+	for _, s := range strings.Split(req.Sections, ",") {
+		for _, known := range kioskSections {
+			if strings.TrimSpace(s) == known {
+				sections = append(sections, known)
+			}
+		}
+	}
+	if len(sections) == 0 {
+		sections = kioskSections
+	}
+
+	tmpl := parseTemplates("templates/kiosk.html")
+	data := map[string]interface{}{
+		"BoardName": currentBoardName(),
+		"Rotate":    req.Rotate,
+		"Sections":  sections,
+	}
+	if err := tmpl.Execute(w, data); err != nil {
+		serverError(w, r, err)
+	}
+}
+
+// Everything the kiosk shows, with the public view of scores
+func kioskDataHandler(w http.ResponseWriter, r *http.Request) {
+	display := publicDisplayOptions()
+	hidden := !display.ShowScores
+	teamID := hostTeamID(r)
+
+	people, _, err := queryPeoplePage(r.Context(), display.SortOrder, teamID, 10, 0)
+	if err != nil {
+		serverError(w, r, err)
+		return
+	}
+	list := make([]apiPerson, 0, len(people))
+	for _, p := range people {
+		list = append(list, newAPIPerson(p, hidden))
+	}
+
+	comments := []KioskComment{}
+	if display.CommentsEnabled {
+		if comments, err = latestComments(r.Context(), 8); err != nil {
+			serverError(w, r, err)
+			return
+		}
+	}
+
+	teams := []Team{}
+	if !hidden && teamID == 0 {
+		if teams, err = queryTeams(r.Context()); err != nil {
+			serverError(w, r, err)
+			return
+		}
+	}
+
+	w.Header().Set("Cache-Control", "no-cache")
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"board_name":    currentBoardName(),
+		"scores_hidden": hidden,
+		"people":        list,
+		"comments":      comments,
+		"teams":         teams,
+	})
+}
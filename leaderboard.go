@@ -0,0 +1,104 @@
+package main
+
+import (
+	"net/http"
+	"time"
+
+	"macurate/validation"
+)
+
+// Rankings over a recent period ("top this week"), from the votes cast in
+// it rather than the all-time totals. Weeks start on Monday and months on
+// the 1st, in UTC; "all" ranks the same totals as the board. Undone votes
+// don't count, and people without votes in the period aren't listed.
+
+// LeaderboardEntry is one person's standing over a period.
+type LeaderboardEntry struct {
+	Rank      int    `json:"rank"` // 1 for the top; ties share a rank
+	PublicID  string `json:"public_id"`
+	Name      string `json:"name"`
+	Team      string `json:"team,omitempty"`
+	Score     int    `json:"score"`
+	Upvotes   int    `json:"upvotes"`
+	Downvotes int    `json:"downvotes"`
+}
+
+// Start of the period containing now; zero for "all"
+func leaderboardStart(period string, now time.Time) time.Time {
+	now = now.UTC()
+	day := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+	switch period {
+	case "week":
+		return day.AddDate(0, 0, -((int(day.Weekday()) + 6) % 7))
+	case "month":
+		return day.AddDate(0, 0, 1-day.Day())
+	}
+	return time.Time{}
+}
+
+// GET /api/leaderboard?period=week|month|all (default week, ?limit= up to
+// 200, default 10). While scores are hidden only admins get entries.
+func apiLeaderboardHandler(w http.ResponseWriter, r *http.Request) {
+	var req leaderboardRequest
+	if errs := validation.Bind(r.URL.Query(), &req); errs != nil {
+		writeValidationError(w, errs)
+		return
+	}
+	if req.Period == "" {
+		req.Period = "week"
+	}
+	if req.Limit == 0 {
+		req.Limit = 10
+	}
+	start := leaderboardStart(req.Period, time.Now())
+
+	hidden := scoresHiddenFor(r)
+	entries := []LeaderboardEntry{}
+	if !hidden {
+		rows, err := db.QueryContext(r.Context(), `
+            SELECT RANK() OVER (ORDER BY s.score DESC), COALESCE(p.public_id, ''), p.name,
+                   COALESCE(t.name, ''), s.score, s.upvotes, s.downvotes
+            FROM (
+                SELECT person_id,
+                       SUM(CASE WHEN upvote THEN 1 ELSE -1 END) AS score,
+                       COUNT(*) FILTER (WHERE upvote) AS upvotes,
+                       COUNT(*) FILTER (WHERE NOT upvote) AS downvotes
+                FROM votes
+                WHERE upvote IS NOT NULL AND ($1 OR created_at >= $2)
+                GROUP BY person_id
+            ) s
+            JOIN people p ON p.id = s.person_id
+            LEFT JOIN teams t ON t.id = p.team_id
+            WHERE $3 = 0 OR p.team_id = $3
+            ORDER BY s.score DESC, s.upvotes DESC, p.name
+            LIMIT $4`, start.IsZero(), start, hostTeamID(r), req.Limit)
+		if err != nil {
+			serverError(w, r, err)
+			return
+		}
+		defer rows.Close()
+		for rows.Next() {
+			var e LeaderboardEntry
+			if err := rows.Scan(&e.Rank, &e.PublicID, &e.Name, &e.Team, &e.Score, &e.Upvotes, &e.Downvotes); err != nil {
+				serverError(w, r, err)
+				return
+			}
+			entries = append(entries, e)
+		}
+		if err := rows.Err(); err != nil {
+			serverError(w, r, err)
+			return
+		}
+	}
+
+	resp := map[string]interface{}{
+		"period":  req.Period,
+		"since":   nil,
+		"hidden":  hidden,
+		"entries": entries,
+	}
+	if !start.IsZero() {
+		resp["since"] = start
+	}
+	writeJSONWithETag(w, r, resp)
+}
@@ -2,31 +2,50 @@ package main
 
 import (
 	"bytes"
-	"database/sql"
+	"context"
+	"errors"
 	"html/template"
 	"image"
 	"image/jpeg"
 	"io"
 	"log"
+	"log/slog"
 	"net/http"
 	"os"
-	"strconv"
+	"sync"
+	"time"
+
+	"macurate/ranking"
+	"macurate/validation"
 
 	_ "github.com/lib/pq"
 	"github.com/rwcarlsen/goexif/exif"
 	"golang.org/x/image/draw"
 )
 
-var db *sql.DB
-var adminPassword string
+var db Store
 
 func main() {
-	dbURL := os.Getenv("DATABASE_URL")
-	if dbURL == "" {
-		log.Fatal("DATABASE_URL environment variable not set")
+	snapshotBaseEnv()
+	if err := loadConfigFile(); err != nil {
+		log.Fatal(err)
+	}
+	if err := setupLogging(); err != nil {
+		log.Fatal(err)
+	}
+	name, cmd, args := parseCommand(os.Args[1:])
+	if cmd.noDB {
+		if err := cmd.run(args); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
+	if err := loadServerConfig(); err != nil {
+		log.Fatal(err)
 	}
 	var err error
-	db, err = sql.Open("postgres", dbURL)
+	db, err = openStore(serverCfg)
 	if err != nil {
 		log.Fatal(err)
 	}
@@ -34,29 +53,189 @@ func main() {
 		log.Fatal(err)
 	}
 
-	adminPassword = os.Getenv("ADMIN_PASSWORD")
-	if adminPassword == "" {
-		log.Fatal("ADMIN_PASSWORD environment variable not set")
+	translator, err = newTranslatorFromEnv()
+	if err != nil {
+		log.Fatal(err)
+	}
+	toxicityScorer, err = newToxicityScorerFromEnv()
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	if err := loadCookieConfig(); err != nil {
+		log.Fatal(err)
+	}
+
+	errorReporter, err = newErrorReporterFromEnv()
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	pdfRenderer = newPDFRendererFromEnv()
+	if err := loadRouteTimeouts(); err != nil {
+		log.Fatal(err)
+	}
+	if err := loadMaintenanceConfig(); err != nil {
+		log.Fatal(err)
+	}
+	loadCommentEditWindow()
+	loadPeopleCacheTTL()
+	loadRateLimits()
+	if err := loadVAPIDKeys(); err != nil {
+		log.Fatal(err)
+	}
+	if err := loadRealtimeConfig(); err != nil {
+		log.Fatal(err)
+	}
+	if err := loadCompressionConfig(); err != nil {
+		log.Fatal(err)
 	}
 
 	createTables()
+	// migrate -status must see the schema before anything is applied
+	if name != "migrate" {
+		if err := runMigrations(); err != nil {
+			log.Fatal(err)
+		}
+		if err := assignPublicIDs(); err != nil {
+			log.Fatal(err)
+		}
+	}
+	if cmd.run != nil {
+		if err := cmd.run(args); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+	if err := bootstrapAdminFromEnv(); err != nil {
+		log.Fatal(err)
+	}
+	if err := loadTeamDomains(); err != nil {
+		log.Fatal(err)
+	}
+	loadBoardName()
+	loadDebugRecording()
+	startInstanceSync()
+	startNotifier()
+	startWebhookWorker()
+	startToxicityWorker()
+	startDigestScheduler()
+	startMaintenance()
+	startDBHealthCheck()
+	watchReloadSignal()
 
 	http.HandleFunc("/", homeHandler)
 	http.HandleFunc("/admin", adminHandler)
+	http.HandleFunc("/setup", setupHandler)
+	http.HandleFunc("/admin/login", adminLoginHandler)
+	http.HandleFunc("/admin/logout", adminLogoutHandler)
+	http.HandleFunc("/admin/sessions", adminSessionsHandler)
+	http.HandleFunc("/admin/accounts", adminAccountsHandler)
 	http.HandleFunc("/admin/add", adminAddHandler)
 	http.HandleFunc("/admin/sort", adminSortHandler)
-	http.HandleFunc("/vote", voteHandler)
+	http.HandleFunc("/admin/ranking", adminRankingHandler)
+	http.HandleFunc("GET /admin/simulate", adminSimulateHandler)
+	http.HandleFunc("/admin/tags", adminTagsHandler)
+	http.HandleFunc("/admin/dimensions", adminDimensionsHandler)
+	http.HandleFunc("/admin/categories", adminCategoriesHandler)
+	http.HandleFunc("/admin/name-policy", adminNamePolicyHandler)
+	http.HandleFunc("/admin/comment-policy", adminCommentPolicyHandler)
+	http.HandleFunc("/admin/comment-rules", adminCommentRulesHandler)
+	http.HandleFunc("/admin/display", adminDisplayHandler)
+	http.HandleFunc("/admin/blind", adminBlindHandler)
+	http.HandleFunc("/admin/freeze", adminFreezeHandler)
+	http.HandleFunc("/admin/exclusions", adminExclusionsHandler)
+	http.HandleFunc("GET /admin/search", adminSearchHandler)
+	http.HandleFunc("/admin/legal", adminLegalHandler)
+	http.HandleFunc("/admin/pages", adminPagesHandler)
+	http.HandleFunc("/admin/voting-mode", adminVotingModeHandler)
+	http.HandleFunc("/admin/elections", adminElectionsHandler)
+	http.HandleFunc("/admin/teams", adminTeamsHandler)
+	http.HandleFunc("/admin/seasons", adminSeasonsHandler)
+	http.HandleFunc("/admin/api-keys", adminAPIKeysHandler)
+	http.HandleFunc("/admin/subscriptions", adminSubscriptionsHandler)
+	http.HandleFunc("/admin/webhooks", adminWebhooksHandler)
+	http.HandleFunc("/admin/replies", adminRepliesHandler)
+	http.HandleFunc("/admin/moderation", adminModerationHandler)
+	http.HandleFunc("/admin/digest", adminDigestHandler)
+	http.HandleFunc("/admin/metrics", adminMetricsHandler)
+	http.HandleFunc("/admin/archive", adminArchiveHandler)
+	http.HandleFunc("/admin/import", adminImportHandler)
+	http.HandleFunc("/admin/reload", adminReloadHandler)
+	http.HandleFunc("GET /admin/export/comments", adminExportCommentsHandler)
+	http.HandleFunc("PUT /admin/api/people/{id}", adminAPIUpdatePersonHandler)
+	http.HandleFunc("PATCH /admin/api/people/{id}", adminAPIUpdatePersonHandler)
+	http.HandleFunc("DELETE /admin/api/people/{id}", adminAPIDeletePersonHandler)
+	http.HandleFunc("/notify/confirm", notifyConfirmHandler)
+	http.HandleFunc("/admin/roast", adminRoastHandler)
+	http.HandleFunc("/admin/debug/requests", adminDebugRequestsHandler)
+	http.HandleFunc("/admin/report", adminReportHandler)
+	http.HandleFunc("/vote", withVoteRateLimit(voteHandler))
 	http.HandleFunc("/comments", commentsHandler)
+	http.HandleFunc("GET /feed.xml", feedHandler)
+	http.HandleFunc("POST /consent", consentHandler)
+	http.HandleFunc("GET /privacy", legalPageHandler)
+	http.HandleFunc("GET /imprint", legalPageHandler)
+	http.HandleFunc("GET /pages/{slug}", pageHandler)
+	http.HandleFunc("GET /remove-me", removeMeHandler)
+	http.HandleFunc("POST /remove-me", withVoteRateLimit(removeMeHandler))
+	http.HandleFunc("/comments/edit", commentEditHandler)
+	http.HandleFunc("POST /inbound/email", inboundEmailHandler)
 	http.HandleFunc("/images/", imageHandler)
+	http.HandleFunc("GET /badge/{id}/score.svg", badgeScoreHandler)
+	http.HandleFunc("GET /events", eventsHandler)
+	http.HandleFunc("GET /ws", wsHandler)
+	http.HandleFunc("GET /metrics", prometheusHandler)
+	http.HandleFunc("GET /readyz", readyzHandler)
+	http.HandleFunc("GET /kiosk", kioskHandler)
+	http.HandleFunc("GET /kiosk/data", kioskDataHandler)
+	handleAPI("GET /openapi.json", apiOpenAPIHandler)
+	http.HandleFunc("GET /api/docs", apiDocsHandler)
+	handleAPI("POST /admin/login", apiAdminLoginHandler)
+	handleAPI("GET /admin/analytics", apiAdminAnalyticsHandler)
+	handleAPI("GET /admin/rankings", apiAdminRankingsHandler)
+	handleAPI("GET /config", withAPIKey(apiConfigHandler))
+	handleAPI("GET /people", withAPIKey(apiPeopleHandler))
+	handleAPI("GET /people/{id}", withAPIKey(apiPersonHandler))
+	handleAPI("GET /people/{id}/history", withAPIKey(apiPersonHistoryHandler))
+	handleAPI("GET /leaderboard", withAPIKey(apiLeaderboardHandler))
+	handleAPI("GET /trending", withAPIKey(apiTrendingHandler))
+	handleAPI("GET /duel", withAPIKey(apiDuelHandler))
+	handleAPI("POST /duel", withVoteRateLimit(withAPIKey(apiDuelVoteHandler)))
+	handleAPI("GET /seasons", withAPIKey(apiSeasonsHandler))
+	handleAPI("GET /seasons/{id}/results", withAPIKey(apiSeasonResultsHandler))
+	handleAPI("GET /onthisday", withAPIKey(apiOnThisDayHandler))
+	handleAPI("GET /suggest", withAPIKey(apiSuggestHandler))
+	handleAPI("GET /credits", withAPIKey(apiCreditsHandler))
+	handleAPI("GET /me/stats", withAPIKey(apiMyStatsHandler))
+	handleAPI("GET /teams", withAPIKey(apiTeamsHandler))
+	handleAPI("GET /milestones", withAPIKey(apiMilestonesHandler))
+	handleAPI("GET /events/replay", withAPIKey(apiEventsReplayHandler))
+	handleAPI("GET /push/key", apiPushKeyHandler)
+	handleAPI("POST /push/subscribe", withVoteRateLimit(apiPushSubscribeHandler))
+	handleAPI("POST /push/unsubscribe", apiPushUnsubscribeHandler)
+	handleAPI("GET /follows", apiFollowsHandler)
+	handleAPI("POST /people/{id}/follow", withVoteRateLimit(apiFollowHandler))
+	handleAPI("DELETE /people/{id}/follow", apiFollowHandler)
+	handleAPI("GET /elections", withAPIKey(apiElectionsHandler))
+	handleAPI("GET /elections/{id}", withAPIKey(apiElectionHandler))
+	handleAPI("POST /vote/undo", withVoteRateLimit(withAPIKey(apiVoteUndoHandler)))
+	handleAPI("POST /elections/{id}/ballots", withVoteRateLimit(withAPIKey(apiElectionBallotHandler)))
+	handleAPI("GET /elections/{id}/results", withAPIKey(apiElectionResultsHandler))
+	handleAPI("GET /comments/{id}/translation", withAPIKey(apiCommentTranslationHandler))
 
 	http.Handle("/static/", http.StripPrefix("/static/", http.FileServer(http.Dir("static"))))
 
-	port := os.Getenv("PORT")
-	if port == "" {
-		port = "8080"
+	srv := &http.Server{
+		Addr:    ":" + serverCfg.Port,
+		Handler: withRequestID(withCORS(withCompression(withDebugRecorder(withRecovery(withTimeouts(withAdminSessions(withMetrics(http.DefaultServeMux)))))))),
+	}
+	srv.RegisterOnShutdown(events.close)
+	tls := useAutocert(srv)
+	slog.Info("listening", "addr", srv.Addr)
+	if err := serveUntilSignal(srv, tls); err != nil {
+		log.Fatal(err)
 	}
-	log.Println("Listening on port", port)
-	log.Fatal(http.ListenAndServe(":"+port, nil))
 }
 
 // Set the global sort order (admin-only)
@@ -65,28 +244,24 @@ func adminSortHandler(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 		return
 	}
-	pass := r.FormValue("pass")
-	if pass != adminPassword {
+	if !adminAuthorized(r) {
 		http.Error(w, "Unauthorized", http.StatusUnauthorized)
 		return
 	}
 
-	order := r.FormValue("order")
 	// Whitelist supported orders
-	switch order {
-	case "name", "score_desc", "upvotes_desc":
-		// ok
-	default:
-		http.Error(w, "Invalid sort order", http.StatusBadRequest)
+	var req adminSortRequest
+	if errs := bindAdminForm(r, &req); errs != nil {
+		renderAdmin(w, r, errs)
 		return
 	}
 
-	if _, err := db.Exec("UPDATE settings SET value=$1 WHERE key='sort_order'", order); err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+	if _, err := db.ExecContext(r.Context(), "UPDATE settings SET value=$1 WHERE key='sort_order'", req.Order); err != nil {
+		serverError(w, r, err)
 		return
 	}
 
-	http.Redirect(w, r, "/admin?pass="+pass, http.StatusSeeOther)
+	http.Redirect(w, r, "/admin", http.StatusSeeOther)
 }
 
 // Record a vote with optional comment
@@ -96,93 +271,402 @@ func voteHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	personIDStr := r.FormValue("person_id")
-	personID, err := strconv.Atoi(personIDStr)
-	if err != nil || personID <= 0 {
-		http.Error(w, "Invalid person_id", http.StatusBadRequest)
+	if votingClosed() {
+		http.Error(w, "Voting is closed", http.StatusForbidden)
 		return
 	}
 
-	upvote := r.FormValue("vote") == "up"
-	comment := r.FormValue("comment")
+	var req voteRequest
+	if !bindForm(w, r, &req) || !resolveRequestPerson(w, r, req.Person, &req.PersonID) {
+		return
+	}
+	if errs := checkVoteType(getVoteType(), req); errs != nil {
+		writeValidationError(w, errs)
+		return
+	}
+	if req.Comment != "" && !getDisplayOptions().CommentsEnabled {
+		writeValidationError(w, validation.Errors{"comment": "comments are disabled"})
+		return
+	}
+	if req.Comment != "" && req.Vote == "" {
+		writeValidationError(w, validation.Errors{"comment": "needs an up or down vote"})
+		return
+	}
+	if policy := getCommentPolicy(); req.Vote != "" && req.Comment == "" && commentRequired(policy, req.Vote == "up") {
+		writeAPIError(w, http.StatusBadRequest, commentRequiredError(policy))
+		return
+	}
+	if problem := checkCommentQuality(getCommentRules(), req.Comment); problem != nil {
+		writeAPIError(w, http.StatusBadRequest, *problem)
+		return
+	}
+	voterName, msg := resolveVoterName(getNamePolicy(), req.Name)
+	if msg != "" {
+		writeValidationError(w, validation.Errors{"name": msg})
+		return
+	}
+	if req.Dimension != 0 {
+		if ok, err := dimensionExists(r.Context(), req.Dimension); err != nil {
+			serverError(w, r, err)
+			return
+		} else if !ok {
+			writeValidationError(w, validation.Errors{"dimension_id": "is not a known dimension"})
+			return
+		}
+	}
+	if frozen, err := votingFrozen(r.Context(), req.PersonID); err != nil {
+		serverError(w, r, err)
+		return
+	} else if frozen {
+		writeVotingFrozen(w)
+		return
+	}
 
-	if _, err := db.Exec(
-		"INSERT INTO votes (person_id, upvote, comment) VALUES ($1, $2, $3)",
-		personID, upvote, comment,
-	); err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+	voterID, err := ensureVoterID(w, r)
+	if err == errConsentRequired && !voterTrackingNeeded() && req.Rating == 0 {
+		// Counted, but not tied to this browser. Not for ratings: one
+		// voter, one rating only holds with a stable id.
+		voterID, err = newVoterID()
+	}
+	if err == errConsentRequired {
+		writeConsentRequired(w)
+		return
+	} else if err != nil {
+		serverError(w, r, err)
 		return
 	}
 
+	err = recordVote(r.Context(), newVote{
+		PersonID: req.PersonID, VoterID: voterID, VoterName: voterName, Vote: req.Vote, Comment: req.Comment,
+		Dimension: req.Dimension, Tags: req.Tags, Rating: req.Rating, Source: "web",
+	})
+	if err == errNoVoteCredits {
+		http.Error(w, "Not enough voting credits", http.StatusConflict)
+		return
+	} else if err == errAlreadyVoted {
+		http.Error(w, "You already voted for this person", http.StatusConflict)
+		return
+	} else if err != nil {
+		serverError(w, r, err)
+		return
+	}
 	w.WriteHeader(http.StatusOK)
 }
 
+// A vote that has passed the board's rules, ready to be written
+type newVote struct {
+	PersonID  int
+	VoterID   string
+	VoterName string
+	Vote      string // "up", "down", or "" for a star rating alone
+	Comment   string
+	Dimension int
+	Tags      []int
+	Rating    int
+	Source    string // where it came from, for webhooks: "web" or "email"
+}
+
+var (
+	errNoVoteCredits = errors.New("not enough voting credits")
+	errAlreadyVoted  = errors.New("already voted for this person")
+)
+
+// Write v and its rating, credits, score change and tags in one
+// transaction, then tell everyone who follows along: the live stream,
+// webhooks, milestones and push. Every way of voting goes through here so
+// they can't drift apart.
+func recordVote(ctx context.Context, v newVote) error {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if v.Rating != 0 {
+		if err := saveRating(tx, v.PersonID, v.VoterID, v.Rating); err != nil {
+			return err
+		}
+	}
+	if v.Vote == "" {
+		// Just a star rating
+		if err := tx.Commit(); err != nil {
+			return err
+		}
+		invalidatePeopleCache()
+		events.publish("vote", map[string]interface{}{"public_id": publicIDOf(ctx, v.PersonID)})
+		return nil
+	}
+
+	if getVotingMode() == votingModeQuadratic {
+		ok, err := chargeQuadraticVote(tx, v.VoterID, v.PersonID)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			return errNoVoteCredits
+		}
+	} else {
+		dup, err := duplicateVote(tx, getVoteDedup(), v.VoterID, v.PersonID, v.Dimension)
+		if err != nil {
+			return err
+		}
+		if dup {
+			return errAlreadyVoted
+		}
+	}
+
+	up, status := v.Vote == "up", newCommentStatus(v.Comment)
+	var voteID int
+	if err := tx.QueryRow(
+		"INSERT INTO votes (person_id, upvote, comment, voter_name, voter_id, status, dimension_id) VALUES ($1, $2, $3, NULLIF($4, ''), $5, $6, NULLIF($7, 0)) RETURNING id",
+		v.PersonID, up, v.Comment, v.VoterName, v.VoterID, status, v.Dimension,
+	).Scan(&voteID); err != nil {
+		return err
+	}
+	if err := recordScoreChange(tx, v.PersonID, voteID, voteDelta(up)); err != nil {
+		return err
+	}
+	if err := insertVoteTags(tx, voteID, v.Tags); err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	invalidatePeopleCache()
+	publicID := publicIDOf(ctx, v.PersonID)
+	events.publish("vote", map[string]interface{}{"public_id": publicID})
+	queueWebhooks(webhookVoteCreated, webhookVote{
+		VoteID: voteID, PublicID: publicID, Upvote: up, HasComment: v.Comment != "", VoterName: v.VoterName, Source: v.Source,
+	})
+	if v.Comment != "" && status == commentApproved {
+		events.publish("comment", map[string]interface{}{"vote_id": voteID, "public_id": publicID})
+		queueWebhooks(webhookCommentPublished, webhookComment{
+			VoteID: voteID, PublicID: publicID, Upvote: up, Text: v.Comment, Author: v.VoterName,
+		})
+	}
+	go checkMilestones(v.PersonID)
+	go pushVote(v.PersonID, up, v.Comment, status)
+	return nil
+}
+
 // Return simple HTML with comments for a person
 func commentsHandler(w http.ResponseWriter, r *http.Request) {
-	personID, err := strconv.Atoi(r.URL.Query().Get("person_id"))
-	if err != nil || personID <= 0 {
+	var req commentsRequest
+	if errs := validation.Bind(r.URL.Query(), &req); errs != nil {
 		http.Error(w, "Invalid person_id", http.StatusBadRequest)
 		return
 	}
+	personID, err := resolvePersonRef(r.Context(), req.Person)
+	if err == errUnknownPerson {
+		http.Error(w, "Invalid person_id", http.StatusBadRequest)
+		return
+	} else if err != nil {
+		serverError(w, r, err)
+		return
+	}
+	if !getDisplayOptions().CommentsEnabled {
+		http.Error(w, "Comments are disabled", http.StatusNotFound)
+		return
+	}
 
-	rows, err := db.Query("SELECT upvote, comment FROM votes WHERE person_id = $1 ORDER BY id DESC", personID)
+	rows, err := db.QueryContext(r.Context(), `
+        SELECT id, upvote, comment, COALESCE(voter_name, ''), edited_at IS NOT NULL,
+               voter_id IS NOT NULL AND voter_id = $2 AND created_at > NOW() - $3 * INTERVAL '1 second',
+               status
+        FROM votes
+        WHERE person_id = $1 AND upvote IS NOT NULL AND COALESCE(TRIM(comment), '') <> ''
+          AND (status = 'approved' OR (voter_id IS NOT NULL AND voter_id = $2))
+        ORDER BY id DESC`,
+		personID, currentVoterID(r), editWindowSeconds())
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		serverError(w, r, err)
 		return
 	}
 	defer rows.Close()
 
 	type Comment struct {
+		ID       int
 		IsUpvote bool
 		Text     string
+		Author   string
+		Edited   bool
+		Editable bool
+		Pending  bool
+		Replies  []Reply
+		History  []CommentEdit
 	}
+	anonymous := getNamePolicy() == namePolicyAnonymous
+	admin := adminAuthorized(r)
 	var list []Comment
+	var ids []int
 	for rows.Next() {
 		var c Comment
-		if err := rows.Scan(&c.IsUpvote, &c.Text); err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
+		var status string
+		if err := rows.Scan(&c.ID, &c.IsUpvote, &c.Text, &c.Author, &c.Edited, &c.Editable, &status); err != nil {
+			serverError(w, r, err)
 			return
 		}
+		// The author still sees their own held comment, marked as such
+		if status == commentRejected {
+			c.Text, c.Editable = "", false
+		}
+		c.Pending = status == commentPending
+		if anonymous {
+			c.Author = ""
+		}
 		list = append(list, c)
+		ids = append(ids, c.ID)
+	}
+
+	replies, err := repliesByVote(r.Context(), ids)
+	if err != nil {
+		serverError(w, r, err)
+		return
+	}
+	var history map[int][]CommentEdit
+	if admin {
+		if history, err = commentEditsByVote(r.Context(), ids); err != nil {
+			serverError(w, r, err)
+			return
+		}
+	}
+	for i := range list {
+		list[i].Replies = replies[list[i].ID]
+		list[i].History = history[list[i].ID]
 	}
 
 	// Minimal inline template to match the modal usage
 	const tmpl = `
 		<div>
-			{{if .}}
-				{{range .}}
-					<p>{{if .IsUpvote}}<span style="color:green">👍</span>{{else}}<span style="color:red">👎</span>{{end}} {{.Text}}</p>
+			{{if .List}}
+				{{range .List}}
+					<p id="comment-{{.ID}}">{{if .IsUpvote}}<span style="color:green">👍</span>{{else}}<span style="color:red">👎</span>{{end}} <span class="comment-text">{{safeHTML .Text}}</span>{{if .Author}} <em>— {{.Author}}</em>{{end}}{{if .Edited}} <small>(edited)</small>{{end}}{{if .Pending}} <small>(awaiting moderation)</small>{{end}}
+					{{if and $.Translate .Text}}<a href="#" onclick="translateComment({{.ID}}); return false;" style="font-size:0.8em;">Translate</a>{{end}}</p>
+					{{if and .Editable .Text}}
+						<form class="comment-edit" action="/comments/edit" method="POST" style="margin-left:20px;" onsubmit="return editComment(this);">
+							<input type="hidden" name="vote_id" value="{{.ID}}">
+							<input type="text" name="comment" maxlength="2000" value="{{.Text}}">
+							<button type="submit" style="font-size:0.8em;">Save edit</button>
+						</form>
+					{{end}}
+					{{if .History}}
+						<details style="margin-left:20px;font-size:0.8em;"><summary>Edit history</summary>
+						{{range .History}}<p>{{.EditedAt.Format "2006-01-02 15:04"}}: {{.Text}}</p>{{end}}
+						</details>
+					{{end}}
+					{{range .Replies}}
+						<p class="reply" style="margin-left:20px;"><span class="admin-badge" style="background:#333;color:#fff;border-radius:3px;padding:0 4px;font-size:0.8em;">{{.Role}}</span> {{.Text}}
+						{{if $.Admin}}<form action="/admin/replies" method="POST" style="display:inline;"><input type="hidden" name="action" value="delete"><input type="hidden" name="id" value="{{.ID}}"><button type="submit" style="font-size:0.8em;">Delete</button></form>{{end}}</p>
+					{{end}}
+					{{if and $.Admin .Text}}
+						<form action="/admin/replies" method="POST" style="margin-left:20px;">
+							<input type="hidden" name="action" value="create">
+							<input type="hidden" name="vote_id" value="{{.ID}}">
+							<input type="text" name="text" maxlength="1000" placeholder="Reply as admin">
+							<button type="submit">Reply</button>
+						</form>
+					{{end}}
 				{{end}}
 			{{else}}
 				<p>No comments yet.</p>
 			{{end}}
 		</div>`
-	if err := template.Must(template.New("comments").Parse(tmpl)).Execute(w, list); err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+	data := map[string]interface{}{
+		"List":      list,
+		"Translate": translator != nil,
+		"Admin":     admin,
+	}
+	if err := template.Must(template.New("comments").Funcs(templateFuncs).Parse(tmpl)).Execute(w, data); err != nil {
+		serverError(w, r, err)
 		return
 	}
 }
 
 // Helper to read current sort order from settings (defaults to "name")
 func getSortOrder() string {
-	var order string
-	_ = db.QueryRow("SELECT value FROM settings WHERE key='sort_order'").Scan(&order)
-	if order == "" {
-		order = "name"
-	}
-	return order
+	return getSetting("sort_order", "name")
 }
 
-func homeHandler(w http.ResponseWriter, r *http.Request) {
-	type Person struct {
-		ID      int
-		Name    string
-		Score   int // upvotes - downvotes
-		Upvotes int // number of positive votes
+// Read a setting value, falling back to def when missing or empty
+func getSetting(key, def string) string {
+	var value string
+	err := db.QueryRow("SELECT value FROM settings WHERE key=$1", key).Scan(&value)
+	if dbUnavailable(err) {
+		// Keep behaving as configured (hidden scores stay hidden) while
+		// the database is away
+		if v, ok := lastSettings.Load(key); ok {
+			value = v.(string)
+		}
+	} else {
+		lastSettings.Store(key, value)
+	}
+	if value == "" {
+		return def
 	}
+	return value
+}
+
+// Each setting as last read, for getSetting during a database outage
+var lastSettings sync.Map
 
-	sortOrder := getSortOrder()
+// Insert or overwrite a setting value
+func setSetting(key, value string) error {
+	_, err := db.Exec(`
+    INSERT INTO settings (key, value) VALUES ($1, $2)
+    ON CONFLICT (key) DO UPDATE SET value = EXCLUDED.value`, key, value)
+	return err
+}
+
+// Person is a leaderboard row: a person with their vote aggregates.
+type Person struct {
+	ID        int    `json:"-"` // internal; payloads carry PublicID
+	PublicID  string `json:"public_id"`
+	Name      string `json:"name"`
+	TeamID    int    `json:"team_id,omitempty"`
+	Team      string `json:"team,omitempty"`
+	Score     int    `json:"score"`     // upvotes - downvotes
+	Upvotes   int    `json:"upvotes"`   // number of positive votes
+	Downvotes int    `json:"downvotes"` // number of negative votes
+	Comments  int    `json:"comment_count"`
+	Frozen    bool   `json:"voting_frozen"`
+	// Time of the most recent vote or comment; nil when nobody voted yet
+	LastActivityAt *time.Time `json:"last_activity_at"`
+	Tags           []TagCount `json:"tags,omitempty"`
+	Categories     []string   `json:"categories,omitempty"` // slugs
+	// Net score per rating dimension, by name
+	Dimensions map[string]int `json:"dimensions,omitempty"`
+	// Star ratings; zero when nobody rated
+	Rating RatingSummary `json:"rating"`
+}
+
+// Load every person with score, upvotes and tag aggregates in the given sort order
+func queryPeople(ctx context.Context, sortOrder string) ([]Person, error) {
+	people, _, err := queryPeoplePage(ctx, sortOrder, 0, 0, 0)
+	return people, err
+}
+
+// Load one page of people (limit 0 means all) plus the total number of people.
+// teamID limits both to one team's members; 0 means everyone.
+func queryPeoplePage(ctx context.Context, sortOrder string, teamID, limit, offset int) ([]Person, int, error) {
+	all, ok, err := cachedPeople(ctx, sortOrder, teamID)
+	if !ok {
+		return loadPeoplePage(ctx, sortOrder, teamID, limit, offset)
+	}
+	if err != nil {
+		return nil, 0, err
+	}
+	total := len(all)
+	offset = min(offset, total)
+	end := total
+	if limit > 0 {
+		end = min(offset+limit, total)
+	}
+	// A copy, so callers can't change the cached entry
+	return append([]Person(nil), all[offset:end]...), total, nil
+}
 
+// queryPeoplePage straight from the database
+func loadPeoplePage(ctx context.Context, sortOrder string, teamID, limit, offset int) ([]Person, int, error) {
 	// Whitelist ORDER BY to avoid injection
 	orderByClause := "p.name"
 	switch sortOrder {
@@ -194,10 +678,123 @@ func homeHandler(w http.ResponseWriter, r *http.Request) {
 		orderByClause = "p.name"
 	}
 
-	// Correctly treat NULL vote rows as 0 (not -1)
-	query := `
+	// Other rankings need the whole list and page it afterwards
+	algo := defaultRanking
+	if sortOrder == "score_desc" {
+		algo = getRankingAlgorithm()
+	}
+	pageLimit, pageOffset := limit, offset
+	if algo != defaultRanking {
+		pageLimit, pageOffset = 0, 0
+	}
+
+	query := peopleSelect + `
+        WHERE $3 = 0 OR p.team_id = $3
+        GROUP BY p.id, p.name, t.name
+        ORDER BY ` + orderByClause + `, p.id
+        LIMIT NULLIF($1, 0) OFFSET $2`
+
+	rows, err := db.QueryContext(ctx, query, pageLimit, pageOffset, teamID)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	var people []Person
+	for rows.Next() {
+		p, err := scanPerson(rows)
+		if err != nil {
+			return nil, 0, err
+		}
+		people = append(people, p)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, 0, err
+	}
+
+	var total int
+	if algo != defaultRanking {
+		if err := rankPeople(ctx, people, algo); err != nil {
+			return nil, 0, err
+		}
+		total = len(people)
+		start, end := min(offset, total), total
+		if limit > 0 {
+			end = min(start+limit, total)
+		}
+		people = people[start:end]
+	} else if limit == 0 && offset == 0 {
+		total = len(people)
+	} else if err := db.QueryRowContext(ctx, "SELECT COUNT(*) FROM people WHERE $1 = 0 OR team_id = $1", teamID).Scan(&total); err != nil {
+		return nil, 0, err
+	}
+
+	tagCounts, err := tagCountsByPerson(ctx)
+	if err != nil {
+		return nil, 0, err
+	}
+	dimScores, err := dimensionScoresByPerson(ctx)
+	if err != nil {
+		return nil, 0, err
+	}
+	ratings, err := ratingsByPerson(ctx)
+	if err != nil {
+		return nil, 0, err
+	}
+	categories, err := categoriesByPerson(ctx)
+	if err != nil {
+		return nil, 0, err
+	}
+	for i := range people {
+		people[i].Tags = tagCounts[people[i].ID]
+		people[i].Categories = categories[people[i].ID]
+		people[i].Dimensions = dimScores[people[i].ID]
+		people[i].Rating = ratings[people[i].ID]
+	}
+	if limit == 0 && offset == 0 {
+		rememberPeople(sortOrder, teamID, people)
+	}
+	return people, total, nil
+}
+
+// Single person with vote aggregates; sql.ErrNoRows when the id is unknown
+func queryPerson(ctx context.Context, id int) (Person, error) {
+	p, err := scanPerson(db.QueryRowContext(ctx, peopleSelect+`
+        WHERE p.id = $1
+        GROUP BY p.id, p.name, t.name`, id))
+	if err != nil {
+		return p, err
+	}
+	tagCounts, err := tagCountsByPerson(ctx)
+	if err != nil {
+		return p, err
+	}
+	p.Tags = tagCounts[p.ID]
+	dimScores, err := dimensionScoresByPerson(ctx)
+	if err != nil {
+		return p, err
+	}
+	p.Dimensions = dimScores[p.ID]
+	ratings, err := ratingsByPerson(ctx)
+	if err != nil {
+		return p, err
+	}
+	p.Rating = ratings[p.ID]
+	categories, err := categoriesByPerson(ctx)
+	if err != nil {
+		return p, err
+	}
+	p.Categories = categories[p.ID]
+	return p, nil
+}
+
+// Correctly treat NULL vote rows as 0 (not -1)
+const peopleSelect = `
         SELECT p.id,
+               COALESCE(p.public_id, ''),
                p.name,
+               COALESCE(p.team_id, 0),
+               COALESCE(t.name, ''),
                COALESCE(SUM(
                    CASE
                      WHEN v.upvote IS TRUE  THEN 1
@@ -210,32 +807,115 @@ func homeHandler(w http.ResponseWriter, r *http.Request) {
                      WHEN v.upvote IS TRUE THEN 1
                      ELSE 0
                    END
-               ), 0) AS upvotes
+               ), 0) AS upvotes,
+               COALESCE(SUM(
+                   CASE
+                     WHEN v.upvote IS FALSE THEN 1
+                     ELSE 0
+                   END
+               ), 0) AS downvotes,
+               COUNT(v.id) FILTER (WHERE COALESCE(TRIM(v.comment), '') <> '' AND v.status = 'approved') AS comments,
+               MAX(v.created_at) AS last_activity_at,
+               p.voting_frozen
         FROM people p
-        LEFT JOIN votes v ON p.id = v.person_id
-        GROUP BY p.id, p.name
-        ORDER BY ` + orderByClause
+        LEFT JOIN teams t ON t.id = p.team_id
+        LEFT JOIN votes v ON p.id = v.person_id`
+
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanPerson(row rowScanner) (Person, error) {
+	var p Person
+	err := row.Scan(&p.ID, &p.PublicID, &p.Name, &p.TeamID, &p.Team, &p.Score, &p.Upvotes, &p.Downvotes, &p.Comments, &p.LastActivityAt, &p.Frozen)
+	return p, err
+}
 
-	rows, err := db.Query(query)
+func homeHandler(w http.ResponseWriter, r *http.Request) {
+	display := publicDisplayOptions()
+	teamID := hostTeamID(r)
+	people, _, err := queryPeoplePage(r.Context(), display.SortOrder, teamID, 0, 0)
+	var staleSince time.Time
+	if dbUnavailable(err) {
+		// The last board we loaded, with a banner, and nothing else
+		var ok bool
+		if people, _, staleSince, ok = stalePeoplePage(display.SortOrder, teamID, 0, 0); ok {
+			markDBDown(err)
+			setStaleHeader(w, staleSince)
+			err = nil
+		}
+	}
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		serverError(w, r, err)
 		return
 	}
-	defer rows.Close()
+	category := r.URL.Query().Get("category")
+	if category != "" {
+		people = inCategory(people, category)
+	}
 
-	var people []Person
-	for rows.Next() {
-		var p Person
-		if err := rows.Scan(&p.ID, &p.Name, &p.Score, &p.Upvotes); err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
+	var (
+		tags         []ReasonTag
+		dimensions   []Dimension
+		categories   []Category
+		teams        []Team
+		announcement *Announcement
+		pages        []Page
+	)
+	if staleSince.IsZero() {
+		if tags, err = listReasonTags(r.Context()); err != nil {
+			serverError(w, r, err)
+			return
+		}
+		if dimensions, err = listDimensions(r.Context()); err != nil {
+			serverError(w, r, err)
+			return
+		}
+		if categories, err = listCategories(r.Context()); err != nil {
+			serverError(w, r, err)
+			return
+		}
+
+		// A team's own domain shows just that team, so skip the team leaderboard
+		if display.ShowScores && teamID == 0 {
+			if teams, err = queryTeams(r.Context()); err != nil {
+				serverError(w, r, err)
+				return
+			}
+		}
+
+		if announcement, err = latestAnnouncement(r.Context()); err != nil {
+			serverError(w, r, err)
+			return
+		}
+
+		if pages, err = listPages(r.Context()); err != nil {
+			serverError(w, r, err)
 			return
 		}
-		people = append(people, p)
 	}
 
-	tmpl := template.Must(template.ParseFiles("templates/index.html"))
-	if err := tmpl.Execute(w, people); err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+	tmpl := parseTemplates("templates/index.html")
+	data := map[string]interface{}{
+		"People":        people,
+		"Teams":         teams,
+		"Tags":          tags,
+		"Dimensions":    dimensions,
+		"Categories":    categories,
+		"Category":      category,
+		"NamePolicy":    getNamePolicy(),
+		"CommentPolicy": getCommentPolicy(),
+		"Display":       display,
+		"VoteType":      getVoteType(),
+		"Announcement":  announcement,
+		"PushEnabled":   vapid != nil,
+		"AskConsent":    consentRequired() && consentAnswer(r) == "",
+		"LegalPages":    legalPageLinks(),
+		"Pages":         pages,
+		"StaleSince":    staleSince,
+	}
+	if err := tmpl.Execute(w, data); err != nil {
+		serverError(w, r, err)
 	}
 }
 
@@ -269,29 +949,255 @@ func createTables() {
 
 	_, err = db.Exec(`
     INSERT INTO settings (key, value)
-    VALUES ('sort_order', 'name')
+    VALUES ('sort_order', $1)
     ON CONFLICT (key) DO NOTHING;
+    `, defaultSortOrder())
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	if err := seedDisplaySettings(); err != nil {
+		log.Fatal(err)
+	}
+
+	_, err = db.Exec(`
+    ALTER TABLE votes ADD COLUMN IF NOT EXISTS voter_name TEXT;
+    ALTER TABLE votes ADD COLUMN IF NOT EXISTS voter_id TEXT;
+    ALTER TABLE votes ADD COLUMN IF NOT EXISTS created_at TIMESTAMPTZ NOT NULL DEFAULT NOW();
+    CREATE INDEX IF NOT EXISTS votes_voter_id_idx ON votes (voter_id, person_id);
     `)
 	if err != nil {
 		log.Fatal(err)
 	}
+
+	if err := createTagTables(); err != nil {
+		log.Fatal(err)
+	}
+	if err := createDimensionTables(); err != nil {
+		log.Fatal(err)
+	}
+	if err := createRatingTables(); err != nil {
+		log.Fatal(err)
+	}
+	if err := createCategoryTables(); err != nil {
+		log.Fatal(err)
+	}
+	if err := createToxicityTables(); err != nil {
+		log.Fatal(err)
+	}
+
+	if err := createTranslationTables(); err != nil {
+		log.Fatal(err)
+	}
+
+	if err := createElectionTables(); err != nil {
+		log.Fatal(err)
+	}
+
+	if err := createTeamTables(); err != nil {
+		log.Fatal(err)
+	}
+	if err := createDomainTables(); err != nil {
+		log.Fatal(err)
+	}
+	if err := createMilestoneTables(); err != nil {
+		log.Fatal(err)
+	}
+	if err := createEventLogTables(); err != nil {
+		log.Fatal(err)
+	}
+	if err := createFreezeTables(); err != nil {
+		log.Fatal(err)
+	}
+	if err := createExclusionTables(); err != nil {
+		log.Fatal(err)
+	}
+	if err := createPageTables(); err != nil {
+		log.Fatal(err)
+	}
+	if err := createImportTables(); err != nil {
+		log.Fatal(err)
+	}
+	if err := createWebhookTables(); err != nil {
+		log.Fatal(err)
+	}
+	if err := createScoreHistoryTables(); err != nil {
+		log.Fatal(err)
+	}
+	if err := createSeasonTables(); err != nil {
+		log.Fatal(err)
+	}
+	if err := createDuelTables(); err != nil {
+		log.Fatal(err)
+	}
+	if err := createPushTables(); err != nil {
+		log.Fatal(err)
+	}
+
+	if err := createAPIKeyTables(); err != nil {
+		log.Fatal(err)
+	}
+
+	if err := createStoreTables(); err != nil {
+		log.Fatal(err)
+	}
+
+	if err := createSessionTables(); err != nil {
+		log.Fatal(err)
+	}
+
+	if err := createAdminTables(); err != nil {
+		log.Fatal(err)
+	}
+
+	if err := createSuggestIndex(); err != nil {
+		log.Fatal(err)
+	}
+
+	if err := createNotifyTables(); err != nil {
+		log.Fatal(err)
+	}
+
+	if err := createReplyTables(); err != nil {
+		log.Fatal(err)
+	}
+
+	if err := createEditTables(); err != nil {
+		log.Fatal(err)
+	}
+
+	if err := createModerationTables(); err != nil {
+		log.Fatal(err)
+	}
+
+	if err := createDigestTables(); err != nil {
+		log.Fatal(err)
+	}
+
+	if err := createUndoTables(); err != nil {
+		log.Fatal(err)
+	}
+
+	if err := createInboundTables(); err != nil {
+		log.Fatal(err)
+	}
 }
 
 func adminHandler(w http.ResponseWriter, r *http.Request) {
-	pass := r.URL.Query().Get("pass")
-	if pass != adminPassword {
-		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+	if !adminAuthorized(r) {
+		http.Redirect(w, r, "/admin/login", http.StatusSeeOther)
+		return
+	}
+	renderAdmin(w, r, nil)
+}
+
+// Render the admin page; errs (if any) are shown next to the offending inputs
+func renderAdmin(w http.ResponseWriter, r *http.Request, errs validation.Errors) {
+	tags, err := listReasonTags(r.Context())
+	if err != nil {
+		serverError(w, r, err)
+		return
+	}
+	dimensions, err := listDimensions(r.Context())
+	if err != nil {
+		serverError(w, r, err)
+		return
+	}
+	categories, err := listCategories(r.Context())
+	if err != nil {
+		serverError(w, r, err)
+		return
+	}
+	people, err := queryPeople(r.Context(), "name")
+	if err != nil {
+		serverError(w, r, err)
+		return
+	}
+	elections, err := loadElections(r.Context(), 0)
+	if err != nil {
+		serverError(w, r, err)
+		return
+	}
+	teams, err := queryTeams(r.Context())
+	if err != nil {
+		serverError(w, r, err)
 		return
 	}
-	tmpl := template.Must(template.ParseFiles("templates/admin.html"))
-	data := map[string]string{
-		"AdminPass": pass,
+	seasons, err := querySeasons(r.Context())
+	if err != nil {
+		serverError(w, r, err)
+		return
+	}
+	apiKeys, err := listAPIKeys()
+	if err != nil {
+		serverError(w, r, err)
+		return
+	}
+	webhooks, err := listWebhooks(r.Context())
+	if err != nil {
+		serverError(w, r, err)
+		return
+	}
+	subscriptions, err := listSubscriptions()
+	if err != nil {
+		serverError(w, r, err)
+		return
+	}
+	pages, err := listPages(r.Context())
+	if err != nil {
+		serverError(w, r, err)
+		return
+	}
+	tmpl := parseTemplates("templates/admin.html")
+	data := map[string]interface{}{
+		"Tags":          tags,
+		"Dimensions":    dimensions,
+		"Categories":    categories,
+		"People":        people,
+		"Elections":     elections,
+		"Teams":         teams,
+		"Seasons":       seasons,
+		"APIKeys":       apiKeys,
+		"Subs":          subscriptions,
+		"Webhooks":      webhooks,
+		"WebhookEvents": webhookEvents,
+		"NamePolicy":    getNamePolicy(),
+		"CommentPolicy": getCommentPolicy(),
+		"CommentRules":  getCommentRules(),
+		"Display":       getDisplayOptions(),
+		"Blind":         getBoolSetting("blind_voting", false),
+		"VotingMode":    getVotingMode(),
+		"VoteType":      getVoteType(),
+		"QVBudget":      getQuadraticBudget(),
+		"Ranking":       getRankingAlgorithm(),
+		"Rankings":      ranking.Names(),
+		"VoteDedup":     getVoteDedup(),
+		"Digest":        weeklyDigestEnabled(),
+		"ClosesAt":      closesAtInput(),
+		"Reload":        lastReloadStatus(),
+		"Privacy":       getSetting("page_privacy", ""),
+		"Imprint":       getSetting("page_imprint", ""),
+		"Consent":       consentRequired(),
+		"Pages":         pages,
+		"Errors":        errs,
+	}
+	if errs != nil {
+		w.WriteHeader(http.StatusBadRequest)
 	}
 	if err := tmpl.Execute(w, data); err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		serverError(w, r, err)
 	}
 }
 
+// Bind an admin form, returning field errors for inline display
+func bindAdminForm(r *http.Request, dst interface{}) validation.Errors {
+	values, err := formValues(r)
+	if err != nil {
+		return validation.Errors{"form": "could not be read"}
+	}
+	return validation.Bind(values, dst)
+}
+
 // Admin upload: normalize JPEGs to 512x512 (respect EXIF orientation).
 // Non-JPEGs: store bytes exactly as uploaded.
 func adminAddHandler(w http.ResponseWriter, r *http.Request) {
@@ -299,16 +1205,20 @@ func adminAddHandler(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 		return
 	}
-	pass := r.FormValue("pass")
-	if pass != adminPassword {
+	if !adminAuthorized(r) {
 		http.Error(w, "Unauthorized", http.StatusUnauthorized)
 		return
 	}
 
-	name := r.FormValue("name")
+	var req adminAddRequest
+	if errs := bindAdminForm(r, &req); errs != nil {
+		renderAdmin(w, r, errs)
+		return
+	}
+	name := req.Name
 	file, _, err := r.FormFile("image")
 	if err != nil {
-		http.Error(w, "Image upload failed: "+err.Error(), http.StatusBadRequest)
+		renderAdmin(w, r, validation.Errors{"image": "upload failed: " + err.Error()})
 		return
 	}
 	defer file.Close()
@@ -321,48 +1231,42 @@ func adminAddHandler(w http.ResponseWriter, r *http.Request) {
 	}
 	imgBytes := buf.Bytes()
 
-	// Detect format quickly
-	_, format, cfgErr := image.DecodeConfig(bytes.NewReader(imgBytes))
-	if cfgErr != nil {
-		// If unknown, just store as-is (safer fallback)
-		if _, err := db.Exec("INSERT INTO people (name, image) VALUES ($1, $2)", name, imgBytes); err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
-			return
-		}
-		http.Redirect(w, r, "/", http.StatusSeeOther)
+	stored, err := normalizeImage(imgBytes)
+	if err != nil {
+		http.Error(w, "Failed to process image: "+err.Error(), http.StatusInternalServerError)
 		return
 	}
-
-	if format == "jpeg" || format == "jpg" {
-		processed, err := processJPEGForDB(imgBytes, 512, 512)
-		if err != nil {
-			http.Error(w, "Failed to process image: "+err.Error(), http.StatusInternalServerError)
-			return
-		}
-		_, err = db.Exec("INSERT INTO people (name, image) VALUES ($1, $2)", name, processed)
-		if err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
-			return
-		}
-	} else {
-		// For non-JPEG images, store exactly as uploaded
-		_, err = db.Exec("INSERT INTO people (name, image) VALUES ($1, $2)", name, imgBytes)
-		if err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
-			return
-		}
+	publicID := newPublicID()
+	if _, err := db.ExecContext(r.Context(), "INSERT INTO people (name, image, team_id, public_id) VALUES ($1, $2, NULLIF($3, 0), $4)", name, stored, req.TeamID, publicID); err != nil {
+		serverError(w, r, err)
+		return
 	}
+	invalidatePeopleCache()
+	events.publish("person_added", map[string]interface{}{"public_id": publicID})
 
 	http.Redirect(w, r, "/", http.StatusSeeOther)
 }
 
+// Bytes to store for an uploaded photo: JPEGs are normalized to 512x512,
+// anything else (including unknown formats) is kept exactly as uploaded.
+func normalizeImage(imgBytes []byte) ([]byte, error) {
+	_, format, err := image.DecodeConfig(bytes.NewReader(imgBytes))
+	if err != nil {
+		return imgBytes, nil
+	}
+	if format == "jpeg" || format == "jpg" {
+		return processJPEGForDB(imgBytes, 512, 512)
+	}
+	return imgBytes, nil
+}
+
 // Reverted: serve images exactly as stored, no processing
 func imageHandler(w http.ResponseWriter, r *http.Request) {
-	idStr := r.URL.Path[len("/images/"):]
-	id, _ := strconv.Atoi(idStr)
-
+	id, err := resolvePersonRef(r.Context(), r.URL.Path[len("/images/"):])
 	var img []byte
-	err := db.QueryRow("SELECT image FROM people WHERE id=$1", id).Scan(&img)
+	if err == nil {
+		err = db.QueryRowContext(r.Context(), "SELECT image FROM people WHERE id=$1", id).Scan(&img)
+	}
 	if err != nil {
 		http.Error(w, "Image not found", http.StatusNotFound)
 		return
@@ -373,7 +1277,8 @@ func imageHandler(w http.ResponseWriter, r *http.Request) {
 	if len(img) >= 512 {
 		ct = http.DetectContentType(img[:512])
 	}
-	w.Header().Set("Content-Type", ct)
+	w.Header().Set("Content-Type", safeImageContentType(ct))
+	w.Header().Set("X-Content-Type-Options", "nosniff")
 	w.Header().Set("Cache-Control", "public, max-age=86400")
 	w.Write(img)
 }
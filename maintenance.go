@@ -0,0 +1,223 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Database housekeeping: periodic VACUUM (ANALYZE) of the busy tables and
+// size/bloat monitoring with alerts. Postgres autovacuum does most of the
+// work; this keeps statistics fresh on small boards with bursty traffic and
+// tells operators when the database grows past what they expected.
+
+// TableStat is one table's size and dead-row share.
+type TableStat struct {
+	Name       string
+	Bytes      int64
+	LiveRows   int64
+	DeadRows   int64
+	DeadPct    float64
+	LastVacuum *time.Time
+}
+
+// DBStats is the latest size sample shown on the traffic dashboard.
+type DBStats struct {
+	SampledAt time.Time
+	Bytes     int64
+	Tables    []TableStat
+}
+
+// SizeMB is the database size for display.
+func (s DBStats) SizeMB() float64 { return float64(s.Bytes) / (1 << 20) }
+
+var vacuumTables = []string{"votes", "vote_tags", "comment_translations", "admin_sessions", "comment_edits", "comment_replies", "event_log"}
+
+var (
+	maintenanceInterval = 24 * time.Hour
+	maintenanceTicker   *time.Ticker
+	dbSizeAlertBytes    int64 // DB_SIZE_ALERT_MB; 0 disables
+	dbDeadAlertPct      = 20.0
+
+	dbStatsMu   sync.Mutex
+	lastDBStats DBStats
+	alerting    = map[string]bool{}
+)
+
+// DB_MAINTENANCE_INTERVAL (Go duration), DB_SIZE_ALERT_MB and
+// DB_DEAD_ROWS_ALERT_PCT configure the job.
+func loadMaintenanceConfig() error {
+	interval, sizeAlert, deadAlert := 24*time.Hour, int64(0), 20.0
+	if v := os.Getenv("DB_MAINTENANCE_INTERVAL"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil || d < time.Minute {
+			return fmt.Errorf("DB_MAINTENANCE_INTERVAL: must be a duration of at least 1m")
+		}
+		interval = d
+	}
+	if v := os.Getenv("DB_SIZE_ALERT_MB"); v != "" {
+		n, err := strconv.ParseInt(v, 10, 64)
+		if err != nil || n < 0 {
+			return fmt.Errorf("DB_SIZE_ALERT_MB: must be a non-negative number")
+		}
+		sizeAlert = n << 20
+	}
+	if v := os.Getenv("DB_DEAD_ROWS_ALERT_PCT"); v != "" {
+		f, err := strconv.ParseFloat(v, 64)
+		if err != nil || f <= 0 {
+			return fmt.Errorf("DB_DEAD_ROWS_ALERT_PCT: must be a positive number")
+		}
+		deadAlert = f
+	}
+
+	configMu.Lock()
+	defer configMu.Unlock()
+	// The vacuum ticker is already running; a new interval needs a restart
+	if maintenanceTicker == nil {
+		maintenanceInterval = interval
+	}
+	dbSizeAlertBytes, dbDeadAlertPct = sizeAlert, deadAlert
+	return nil
+}
+
+// Sample sizes every few minutes; vacuum on the maintenance interval
+func startMaintenance() {
+	go func() {
+		sample := time.NewTicker(5 * time.Minute)
+		configMu.Lock()
+		maintenanceTicker = time.NewTicker(maintenanceInterval)
+		vacuum := maintenanceTicker
+		configMu.Unlock()
+		sampleDBStats()
+		for {
+			select {
+			case <-sample.C:
+				sampleDBStats()
+			case <-vacuum.C:
+				if err := runExclusive("maintenance", func() error {
+					if err := pruneEventLog(); err != nil {
+						slog.Error("maintenance: event log prune failed", "err", err)
+					}
+					if err := pruneRateLimitBuckets(); err != nil {
+						slog.Error("maintenance: rate limit prune failed", "err", err)
+					}
+					return vacuumHotTables()
+				}); err != nil {
+					slog.Error("maintenance failed", "err", err)
+				}
+				sampleDBStats()
+			}
+		}
+	}()
+}
+
+func vacuumHotTables() error {
+	for _, t := range vacuumTables {
+		start := time.Now()
+		// Table names come from the fixed list above
+		if _, err := db.Exec("VACUUM (ANALYZE) " + t); err != nil {
+			slog.Error("maintenance: vacuum failed", "table", t, "err", err)
+			continue
+		}
+		slog.Info("maintenance: vacuumed", "table", t, "took", time.Since(start).Round(time.Millisecond))
+	}
+	return nil
+}
+
+func sampleDBStats() {
+	stats, err := readDBStats()
+	if err != nil {
+		slog.Error("maintenance failed", "err", err)
+		return
+	}
+	dbStatsMu.Lock()
+	lastDBStats = stats
+	dbStatsMu.Unlock()
+
+	configMu.RLock()
+	sizeAlert, deadAlert := dbSizeAlertBytes, dbDeadAlertPct
+	configMu.RUnlock()
+
+	checkAlert("db_size", sizeAlert > 0 && stats.Bytes > sizeAlert,
+		fmt.Sprintf("database size %.0f MB is above %d MB", stats.SizeMB(), sizeAlert>>20))
+	for _, t := range stats.Tables {
+		checkAlert("dead_rows:"+t.Name, t.DeadPct > deadAlert && t.DeadRows > 1000,
+			fmt.Sprintf("table %s is %.0f%% dead rows (%d of %d)", t.Name, t.DeadPct, t.DeadRows, t.LiveRows+t.DeadRows))
+	}
+}
+
+func readDBStats() (DBStats, error) {
+	stats := DBStats{SampledAt: time.Now()}
+	if err := db.QueryRow("SELECT pg_database_size(current_database())").Scan(&stats.Bytes); err != nil {
+		return stats, err
+	}
+	rows, err := db.Query(`
+        SELECT relname, pg_total_relation_size(relid), n_live_tup, n_dead_tup,
+               GREATEST(last_vacuum, last_autovacuum)
+        FROM pg_stat_user_tables
+        ORDER BY pg_total_relation_size(relid) DESC`)
+	if err != nil {
+		return stats, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var t TableStat
+		if err := rows.Scan(&t.Name, &t.Bytes, &t.LiveRows, &t.DeadRows, &t.LastVacuum); err != nil {
+			return stats, err
+		}
+		if total := t.LiveRows + t.DeadRows; total > 0 {
+			t.DeadPct = float64(t.DeadRows) * 100 / float64(total)
+		}
+		stats.Tables = append(stats.Tables, t)
+	}
+	return stats, rows.Err()
+}
+
+func currentDBStats() DBStats {
+	dbStatsMu.Lock()
+	defer dbStatsMu.Unlock()
+	return lastDBStats
+}
+
+// Alert once when a condition starts holding and again only after it cleared
+func checkAlert(key string, firing bool, message string) {
+	dbStatsMu.Lock()
+	was := alerting[key]
+	alerting[key] = firing
+	dbStatsMu.Unlock()
+	if firing && !was {
+		sendOpsAlert(message)
+	}
+}
+
+// Operator alerts go to the error tracker and, when set, ALERT_WEBHOOK_URL
+func sendOpsAlert(message string) {
+	slog.Warn("alert", "message", message)
+	reportError(ErrorEvent{Err: fmt.Errorf("alert: %s", message)})
+	url := os.Getenv("ALERT_WEBHOOK_URL")
+	if url == "" {
+		return
+	}
+	body, _ := json.Marshal(map[string]interface{}{
+		"event":   "ops.alert",
+		"board":   currentBoardName(),
+		"message": message,
+		"time":    time.Now().UTC().Format(time.RFC3339),
+	})
+	resp, err := notifyClient.Post(url, "application/json", bytes.NewReader(body))
+	if err == nil {
+		resp.Body.Close()
+		if resp.StatusCode >= 300 {
+			err = fmt.Errorf("alert webhook returned %s", resp.Status)
+		}
+	}
+	metrics.observeDelivery("alert", err)
+	if err != nil {
+		slog.Error("alert delivery failed", "err", err)
+	}
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"html"
+	"html/template"
+	"regexp"
+	"strings"
+)
+
+// A small Markdown subset for admin-written pages: # headings, paragraphs,
+// - and 1. lists, **bold**, *italic*, `code` and [links](url). Text is
+// escaped before any markup is added, and link targets go through SafeURL,
+// so nothing an admin types can turn into script.
+
+var (
+	mdHeading = regexp.MustCompile(`^(#{1,3})\s+(.*)$`)
+	mdBullet  = regexp.MustCompile(`^[-*]\s+(.*)$`)
+	mdOrdered = regexp.MustCompile(`^\d+[.)]\s+(.*)$`)
+	mdLink    = regexp.MustCompile(`\[([^\]]+)\]\(([^)\s]+)\)`)
+	mdBold    = regexp.MustCompile(`\*\*([^*]+)\*\*`)
+	mdItalic  = regexp.MustCompile(`\*([^*]+)\*`)
+)
+
+func renderMarkdown(src string) template.HTML {
+	var out, para strings.Builder
+	list := "" // "ul" or "ol" while inside a list
+
+	flushPara := func() {
+		if para.Len() > 0 {
+			out.WriteString("<p>" + para.String() + "</p>\n")
+			para.Reset()
+		}
+	}
+	closeList := func() {
+		if list != "" {
+			out.WriteString("</" + list + ">\n")
+			list = ""
+		}
+	}
+	item := func(kind, text string) {
+		flushPara()
+		if list != kind {
+			closeList()
+			out.WriteString("<" + kind + ">\n")
+			list = kind
+		}
+		out.WriteString("<li>" + markdownInline(text) + "</li>\n")
+	}
+
+	for _, line := range strings.Split(strings.ReplaceAll(src, "\r\n", "\n"), "\n") {
+		line = strings.TrimSpace(line)
+		if m := mdHeading.FindStringSubmatch(line); m != nil {
+			flushPara()
+			closeList()
+			tag := []string{"h2", "h3", "h4"}[len(m[1])-1]
+			out.WriteString("<" + tag + ">" + markdownInline(m[2]) + "</" + tag + ">\n")
+		} else if m := mdBullet.FindStringSubmatch(line); m != nil {
+			item("ul", m[1])
+		} else if m := mdOrdered.FindStringSubmatch(line); m != nil {
+			item("ol", m[1])
+		} else if line == "" {
+			flushPara()
+			closeList()
+		} else {
+			closeList()
+			if para.Len() > 0 {
+				para.WriteString("\n")
+			}
+			para.WriteString(markdownInline(line))
+		}
+	}
+	flushPara()
+	closeList()
+	return template.HTML(out.String())
+}
+
+// Inline markup on one line; code spans are left as written
+func markdownInline(text string) string {
+	parts := strings.Split(text, "`")
+	for i, part := range parts {
+		escaped := template.HTMLEscapeString(part)
+		if i%2 == 1 && i < len(parts)-1 {
+			parts[i] = "<code>" + escaped + "</code>"
+			continue
+		}
+		escaped = mdLink.ReplaceAllStringFunc(escaped, func(s string) string {
+			m := mdLink.FindStringSubmatch(s)
+			href := SafeURL(html.UnescapeString(m[2]))
+			return `<a href="` + template.HTMLEscapeString(string(href)) + `">` + m[1] + "</a>"
+		})
+		escaped = mdBold.ReplaceAllString(escaped, "<strong>$1</strong>")
+		escaped = mdItalic.ReplaceAllString(escaped, "<em>$1</em>")
+		if i%2 == 1 {
+			escaped = "`" + escaped // unmatched backtick
+		}
+		parts[i] = escaped
+	}
+	return strings.Join(parts, "")
+}
@@ -0,0 +1,283 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+)
+
+// In-process metrics registry: per-route response counts in one-minute
+// buckets over the last hour, plus outbound delivery results. Counters
+// reset on restart; this is for spotting abuse or breakage, not billing.
+
+const metricsBuckets = 60
+
+// RouteCounts are response counts for one route.
+type RouteCounts struct {
+	Route     string
+	Total     int
+	Status4x  int
+	Status5x  int
+	Status429 int
+}
+
+// Rate is a share of Total, for the dashboard.
+func (c RouteCounts) Rate(n int) float64 {
+	if c.Total == 0 {
+		return 0
+	}
+	return float64(n) * 100 / float64(c.Total)
+}
+
+// DeliveryCounts are outbound notification results for one channel.
+type DeliveryCounts struct {
+	Channel string
+	Sent    int
+	Failed  int
+}
+
+type metricsBucket struct {
+	minute     int64
+	routes     map[string]*RouteCounts
+	deliveries map[string]*DeliveryCounts
+}
+
+type metricsRegistry struct {
+	mu      sync.Mutex
+	buckets [metricsBuckets]metricsBucket
+
+	// Since-start totals for /metrics; Prometheus wants counters that only grow
+	requests map[requestKey]uint64
+	latency  map[string]*latencyHistogram
+}
+
+var metrics = &metricsRegistry{
+	requests: map[requestKey]uint64{},
+	latency:  map[string]*latencyHistogram{},
+}
+
+// The bucket for now, cleared when it last held an older minute. Callers hold mu.
+func (m *metricsRegistry) current(now time.Time) *metricsBucket {
+	minute := now.Unix() / 60
+	b := &m.buckets[minute%metricsBuckets]
+	if b.minute != minute {
+		*b = metricsBucket{
+			minute:     minute,
+			routes:     map[string]*RouteCounts{},
+			deliveries: map[string]*DeliveryCounts{},
+		}
+	}
+	return b
+}
+
+func (m *metricsRegistry) observeResponse(route string, status int, elapsed time.Duration) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.requests[requestKey{route, status}]++
+	h := m.latency[route]
+	if h == nil {
+		h = &latencyHistogram{}
+		m.latency[route] = h
+	}
+	h.observe(elapsed)
+
+	b := m.current(time.Now())
+	c := b.routes[route]
+	if c == nil {
+		c = &RouteCounts{Route: route}
+		b.routes[route] = c
+	}
+	c.Total++
+	switch {
+	case status == http.StatusTooManyRequests:
+		c.Status429++
+		c.Status4x++
+	case status >= 500:
+		c.Status5x++
+	case status >= 400:
+		c.Status4x++
+	}
+}
+
+func (m *metricsRegistry) observeDelivery(channel string, err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	b := m.current(time.Now())
+	c := b.deliveries[channel]
+	if c == nil {
+		c = &DeliveryCounts{Channel: channel}
+		b.deliveries[channel] = c
+	}
+	if err != nil {
+		c.Failed++
+	} else {
+		c.Sent++
+	}
+}
+
+// Totals over the last window (at most an hour), busiest routes first
+func (m *metricsRegistry) snapshot(window time.Duration) ([]RouteCounts, []DeliveryCounts) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	oldest := time.Now().Add(-window).Unix() / 60
+	routes := map[string]*RouteCounts{}
+	deliveries := map[string]*DeliveryCounts{}
+	for _, b := range m.buckets {
+		if b.minute <= oldest {
+			continue
+		}
+		for k, c := range b.routes {
+			t := routes[k]
+			if t == nil {
+				t = &RouteCounts{Route: k}
+				routes[k] = t
+			}
+			t.Total += c.Total
+			t.Status4x += c.Status4x
+			t.Status5x += c.Status5x
+			t.Status429 += c.Status429
+		}
+		for k, c := range b.deliveries {
+			t := deliveries[k]
+			if t == nil {
+				t = &DeliveryCounts{Channel: k}
+				deliveries[k] = t
+			}
+			t.Sent += c.Sent
+			t.Failed += c.Failed
+		}
+	}
+
+	routeList := make([]RouteCounts, 0, len(routes))
+	for _, c := range routes {
+		routeList = append(routeList, *c)
+	}
+	sort.Slice(routeList, func(i, j int) bool {
+		if routeList[i].Total != routeList[j].Total {
+			return routeList[i].Total > routeList[j].Total
+		}
+		return routeList[i].Route < routeList[j].Route
+	})
+	deliveryList := make([]DeliveryCounts, 0, len(deliveries))
+	for _, c := range deliveries {
+		deliveryList = append(deliveryList, *c)
+	}
+	sort.Slice(deliveryList, func(i, j int) bool { return deliveryList[i].Channel < deliveryList[j].Channel })
+	return routeList, deliveryList
+}
+
+type statusWriter struct {
+	http.ResponseWriter
+	status int
+}
+
+func (w *statusWriter) WriteHeader(status int) {
+	if w.status == 0 {
+		w.status = status
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *statusWriter) Write(b []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	return w.ResponseWriter.Write(b)
+}
+
+// Lets http.ResponseController reach Flush on the real writer
+func (w *statusWriter) Unwrap() http.ResponseWriter { return w.ResponseWriter }
+
+// Count every response by the mux pattern that served it. Must wrap the mux
+// directly so the matched pattern is visible on the request afterwards.
+func withMetrics(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		sw := &statusWriter{ResponseWriter: w}
+		start := time.Now()
+		defer func() {
+			status := sw.status
+			if status == 0 {
+				status = http.StatusOK
+			}
+			if p := recover(); p != nil {
+				metrics.observeResponse(routeLabel(r), http.StatusInternalServerError, time.Since(start))
+				panic(p)
+			}
+			metrics.observeResponse(routeLabel(r), status, time.Since(start))
+		}()
+		next.ServeHTTP(sw, r)
+	})
+}
+
+// Pattern strings keep the label set small; unmatched paths share one label
+func routeLabel(r *http.Request) string {
+	if r.Pattern == "" {
+		return "(unmatched)"
+	}
+	return r.Pattern
+}
+
+// KeyUsage is how much of its rate-limit bucket an API key has used.
+type KeyUsage struct {
+	APIKey
+	Used    int
+	Percent float64
+}
+
+func apiKeyUsage(ctx context.Context) ([]KeyUsage, error) {
+	keys, err := listAPIKeys()
+	if err != nil {
+		return nil, err
+	}
+	var list []KeyUsage
+	for _, k := range keys {
+		if k.Revoked {
+			continue
+		}
+		u := KeyUsage{APIKey: k}
+		if k.RateLimit > 0 {
+			_, st := takeToken(ctx, apiKeyBucket(k.ID), k.RateLimit, false)
+			if st.Limit > 0 {
+				u.Used = st.Limit - st.Remaining
+			}
+			u.Percent = float64(u.Used) * 100 / float64(k.RateLimit)
+		}
+		list = append(list, u)
+	}
+	return list, nil
+}
+
+// Operator dashboard (admin-only): rate-limit consumption per API key,
+// error rates per route and notification delivery failures
+func adminMetricsHandler(w http.ResponseWriter, r *http.Request) {
+	if !adminAuthorized(r) {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+	window := 15 * time.Minute
+	if r.URL.Query().Get("window") == "60" {
+		window = time.Hour
+	}
+
+	usage, err := apiKeyUsage(r.Context())
+	if err != nil {
+		serverError(w, r, err)
+		return
+	}
+	routes, deliveries := metrics.snapshot(window)
+
+	tmpl := parseTemplates("templates/metrics.html")
+	data := map[string]interface{}{
+		"Window":     int(window.Minutes()),
+		"KeyUsage":   usage,
+		"Routes":     routes,
+		"Deliveries": deliveries,
+		"DB":         currentDBStats(),
+		"Realtime":   events.stats(),
+	}
+	if err := tmpl.Execute(w, data); err != nil {
+		serverError(w, r, err)
+	}
+}
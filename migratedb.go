@@ -0,0 +1,370 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// Moving a board to another database server. The board has only ever run
+// on Postgres, so this copies from the server in DATABASE_URL to a new,
+// empty one, e.g. when moving off a shared instance. The source is read
+// inside one repeatable-read transaction, so the copy is a consistent
+// snapshot while the board keeps running; votes cast after the copy
+// starts are not in it, so switch DATABASE_URL over right after (or turn
+// on maintenance mode for the run).
+
+const (
+	migrateDBBatchSize = 2000
+	migrateDBRetries   = 5
+)
+
+// `macurate migrate-db -to postgres://...`
+func runMigrateDB(args []string) error {
+	fs := flag.NewFlagSet("migrate-db", flag.ContinueOnError)
+	to := fs.String("to", "", "database URL to copy the board to (must be empty)")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *to == "" {
+		return errors.New("usage: macurate migrate-db -to DATABASE_URL")
+	}
+
+	target, err := sql.Open("postgres", *to)
+	if err != nil {
+		return err
+	}
+	defer target.Close()
+	if err := target.Ping(); err != nil {
+		return fmt.Errorf("target: %w", err)
+	}
+	var existing bool
+	if err := target.QueryRow("SELECT to_regclass('people') IS NOT NULL").Scan(&existing); err != nil {
+		return err
+	}
+	if existing {
+		return errors.New("the target already has a board schema; migrate-db only copies into an empty database")
+	}
+
+	// The schema comes from the same code that maintains it here, so the
+	// target ends up exactly where a fresh server would put it
+	fmt.Fprintln(os.Stderr, "creating schema on the target")
+	source := db
+	db = postgresStore{target}
+	createTables()
+	err = runMigrations()
+	db = source
+	if err != nil {
+		return fmt.Errorf("target migrations: %w", err)
+	}
+
+	tables, err := migrateDBTables(target)
+	if err != nil {
+		return err
+	}
+	// Rows created by createTables (default settings and the like) would
+	// clash with the copied ones
+	quoted := make([]string, len(tables))
+	for i, t := range tables {
+		quoted[i] = pq.QuoteIdentifier(t)
+	}
+	if _, err := target.Exec("TRUNCATE " + strings.Join(quoted, ", ") + " RESTART IDENTITY CASCADE"); err != nil {
+		return err
+	}
+
+	tx, err := source.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	if _, err := tx.Exec("SET TRANSACTION ISOLATION LEVEL REPEATABLE READ READ ONLY"); err != nil {
+		return err
+	}
+
+	counts := make(map[string]int64, len(tables))
+	for _, table := range tables {
+		n, err := copyTable(tx, target, table)
+		if err != nil {
+			return fmt.Errorf("%s: %w", table, err)
+		}
+		counts[table] = n
+	}
+
+	if err := resetSequences(target); err != nil {
+		return err
+	}
+
+	// Verify against the target as committed
+	fmt.Fprintln(os.Stderr, "verifying")
+	var mismatched []string
+	for _, table := range tables {
+		var n int64
+		if err := target.QueryRow("SELECT COUNT(*) FROM " + pq.QuoteIdentifier(table)).Scan(&n); err != nil {
+			return err
+		}
+		status := "ok"
+		if n != counts[table] {
+			status = "MISMATCH"
+			mismatched = append(mismatched, table)
+		}
+		fmt.Fprintf(os.Stderr, "  %-32s %10d %10d  %s\n", table, counts[table], n, status)
+	}
+	if len(mismatched) > 0 {
+		return fmt.Errorf("row counts differ for %s", strings.Join(mismatched, ", "))
+	}
+	fmt.Fprintln(os.Stderr, "done; point DATABASE_URL at the new database and restart")
+	return nil
+}
+
+// The tables to copy, parents before the tables referencing them.
+// schema_migrations is left out: the target's was filled in by
+// runMigrations.
+func migrateDBTables(target *sql.DB) ([]string, error) {
+	rows, err := target.Query(`
+        SELECT table_name FROM information_schema.tables
+        WHERE table_schema = current_schema() AND table_type = 'BASE TABLE'
+          AND table_name <> 'schema_migrations'
+        ORDER BY table_name`)
+	if err != nil {
+		return nil, err
+	}
+	var names []string
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		names = append(names, name)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	rows, err = target.Query(`
+        SELECT c.relname, p.relname
+        FROM pg_constraint k
+        JOIN pg_class c ON c.oid = k.conrelid
+        JOIN pg_class p ON p.oid = k.confrelid
+        WHERE k.contype = 'f' AND k.connamespace = current_schema()::regnamespace`)
+	if err != nil {
+		return nil, err
+	}
+	parents := make(map[string][]string)
+	for rows.Next() {
+		var child, parent string
+		if err := rows.Scan(&child, &parent); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		if child != parent {
+			parents[child] = append(parents[child], parent)
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	var order []string
+	state := make(map[string]int) // 1 visiting, 2 done
+	var visit func(string) error
+	visit = func(name string) error {
+		switch state[name] {
+		case 1:
+			return fmt.Errorf("foreign keys form a cycle through %s", name)
+		case 2:
+			return nil
+		}
+		state[name] = 1
+		for _, p := range parents[name] {
+			if slices.Contains(names, p) {
+				if err := visit(p); err != nil {
+					return err
+				}
+			}
+		}
+		state[name] = 2
+		order = append(order, name)
+		return nil
+	}
+	for _, name := range names {
+		if err := visit(name); err != nil {
+			return nil, err
+		}
+	}
+	return order, nil
+}
+
+// Copy one table in batches. Every column is read as its text form and
+// written with COPY, which parses it back, so arrays, JSONB and BYTEA need
+// no special cases. Each batch is its own transaction on the target and
+// is retried with backoff, so a dropped connection costs one batch.
+func copyTable(src *sql.Tx, target *sql.DB, table string) (int64, error) {
+	var total int64
+	if err := src.QueryRow("SELECT COUNT(*) FROM " + pq.QuoteIdentifier(table)).Scan(&total); err != nil {
+		return 0, err
+	}
+
+	crows, err := target.Query(`
+        SELECT column_name FROM information_schema.columns
+        WHERE table_schema = current_schema() AND table_name = $1
+        ORDER BY ordinal_position`, table)
+	if err != nil {
+		return 0, err
+	}
+	var cols, selects []string
+	for crows.Next() {
+		var c string
+		if err := crows.Scan(&c); err != nil {
+			crows.Close()
+			return 0, err
+		}
+		cols = append(cols, c)
+		selects = append(selects, pq.QuoteIdentifier(c)+"::text")
+	}
+	crows.Close()
+	if err := crows.Err(); err != nil {
+		return 0, err
+	}
+
+	rows, err := src.Query("SELECT " + strings.Join(selects, ", ") + " FROM " + pq.QuoteIdentifier(table))
+	if err != nil {
+		return 0, err
+	}
+	defer rows.Close()
+
+	var copied int64
+	batch := make([][]interface{}, 0, migrateDBBatchSize)
+	flush := func() error {
+		if len(batch) == 0 {
+			return nil
+		}
+		if err := withRetries(func() error { return copyBatch(target, table, cols, batch) }); err != nil {
+			return err
+		}
+		copied += int64(len(batch))
+		batch = batch[:0]
+		fmt.Fprintf(os.Stderr, "  %s: %d/%d\n", table, copied, total)
+		return nil
+	}
+
+	for rows.Next() {
+		vals := make([]sql.NullString, len(cols))
+		ptrs := make([]interface{}, len(cols))
+		for i := range vals {
+			ptrs[i] = &vals[i]
+		}
+		if err := rows.Scan(ptrs...); err != nil {
+			return copied, err
+		}
+		row := make([]interface{}, len(cols))
+		for i, v := range vals {
+			if v.Valid {
+				row[i] = v.String
+			}
+		}
+		batch = append(batch, row)
+		if len(batch) == migrateDBBatchSize {
+			if err := flush(); err != nil {
+				return copied, err
+			}
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return copied, err
+	}
+	if err := flush(); err != nil {
+		return copied, err
+	}
+	if total == 0 {
+		fmt.Fprintf(os.Stderr, "  %s: empty\n", table)
+	}
+	return copied, nil
+}
+
+func copyBatch(target *sql.DB, table string, cols []string, batch [][]interface{}) error {
+	tx, err := target.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	stmt, err := tx.Prepare(pq.CopyIn(table, cols...))
+	if err != nil {
+		return err
+	}
+	for _, row := range batch {
+		if _, err := stmt.Exec(row...); err != nil {
+			stmt.Close()
+			return err
+		}
+	}
+	if _, err := stmt.Exec(); err != nil {
+		stmt.Close()
+		return err
+	}
+	if err := stmt.Close(); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// Run fn until it succeeds, waiting 1s, 2s, 4s... between migrateDBRetries
+// attempts
+func withRetries(fn func() error) error {
+	var err error
+	wait := time.Second
+	for attempt := 1; attempt <= migrateDBRetries; attempt++ {
+		if err = fn(); err == nil {
+			return nil
+		}
+		if attempt < migrateDBRetries {
+			fmt.Fprintf(os.Stderr, "  retrying in %s: %v\n", wait, err)
+			time.Sleep(wait)
+			wait *= 2
+		}
+	}
+	return err
+}
+
+// Copied ids bypass the sequences, so move each one past its column's
+// highest value or the next insert on the new server would collide
+func resetSequences(target *sql.DB) error {
+	rows, err := target.Query(`
+        SELECT table_name, column_name FROM information_schema.columns
+        WHERE table_schema = current_schema() AND column_default LIKE 'nextval(%'`)
+	if err != nil {
+		return err
+	}
+	type serial struct{ table, column string }
+	var list []serial
+	for rows.Next() {
+		var s serial
+		if err := rows.Scan(&s.table, &s.column); err != nil {
+			rows.Close()
+			return err
+		}
+		list = append(list, s)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	for _, s := range list {
+		col := pq.QuoteIdentifier(s.column)
+		if _, err := target.Exec(fmt.Sprintf(
+			"SELECT setval(pg_get_serial_sequence($1, $2), COALESCE(MAX(%s), 1), MAX(%s) IS NOT NULL) FROM %s",
+			col, col, pq.QuoteIdentifier(s.table)), s.table, s.column); err != nil {
+			return fmt.Errorf("%s.%s sequence: %w", s.table, s.column, err)
+		}
+	}
+	return nil
+}
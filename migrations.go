@@ -0,0 +1,166 @@
+package main
+
+import (
+	"embed"
+	"flag"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Versioned schema migrations. createTables still lays down the baseline
+// with CREATE ... IF NOT EXISTS; anything that changes existing tables goes
+// into migrations/NNNN_description.sql instead. Each file runs once, in
+// version order, inside its own transaction, and is recorded in
+// schema_migrations. Instances starting together serialize on an advisory
+// lock so a migration never runs twice.
+
+//go:embed migrations/*.sql
+var migrationFiles embed.FS
+
+type migration struct {
+	Version int
+	Name    string
+	SQL     string
+}
+
+func loadMigrations() ([]migration, error) {
+	entries, err := fs.ReadDir(migrationFiles, "migrations")
+	if err != nil {
+		return nil, err
+	}
+	seen := map[int]string{}
+	var list []migration
+	for _, e := range entries {
+		name := e.Name()
+		prefix, _, ok := strings.Cut(name, "_")
+		version, err := strconv.Atoi(prefix)
+		if !ok || err != nil || version <= 0 {
+			return nil, fmt.Errorf("migration %s: name must look like 0001_description.sql", name)
+		}
+		if other, dup := seen[version]; dup {
+			return nil, fmt.Errorf("migrations %s and %s share version %d", other, name, version)
+		}
+		seen[version] = name
+		body, err := migrationFiles.ReadFile("migrations/" + name)
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, migration{Version: version, Name: strings.TrimSuffix(name, ".sql"), SQL: string(body)})
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Version < list[j].Version })
+	return list, nil
+}
+
+func createMigrationTables() error {
+	_, err := db.Exec(`
+    CREATE TABLE IF NOT EXISTS schema_migrations (
+        version INTEGER PRIMARY KEY,
+        name TEXT NOT NULL,
+        applied_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+    );
+    `)
+	return err
+}
+
+func appliedMigrations() (map[int]time.Time, error) {
+	rows, err := db.Query("SELECT version, applied_at FROM schema_migrations")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	applied := map[int]time.Time{}
+	for rows.Next() {
+		var v int
+		var at time.Time
+		if err := rows.Scan(&v, &at); err != nil {
+			return nil, err
+		}
+		applied[v] = at
+	}
+	return applied, rows.Err()
+}
+
+// Apply every pending migration in order; stops at the first failure.
+func runMigrations() error {
+	if err := createMigrationTables(); err != nil {
+		return err
+	}
+	list, err := loadMigrations()
+	if err != nil {
+		return err
+	}
+	for _, m := range list {
+		if err := applyMigration(m); err != nil {
+			return fmt.Errorf("migration %s: %w", m.Name, err)
+		}
+	}
+	return nil
+}
+
+func applyMigration(m migration) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	// Held until commit; another instance waits here, then sees the row
+	if _, err := tx.Exec("SELECT pg_advisory_xact_lock(hashtext('schema_migrations'))"); err != nil {
+		return err
+	}
+	var done bool
+	if err := tx.QueryRow("SELECT EXISTS (SELECT 1 FROM schema_migrations WHERE version = $1)", m.Version).Scan(&done); err != nil {
+		return err
+	}
+	if done {
+		return nil
+	}
+	if _, err := tx.Exec(m.SQL); err != nil {
+		return err
+	}
+	if _, err := tx.Exec("INSERT INTO schema_migrations (version, name) VALUES ($1, $2)", m.Version, m.Name); err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	slog.Info("migrate: applied", "migration", m.Name)
+	return nil
+}
+
+// macurate migrate [-status]: apply pending migrations, or just list them.
+func runMigrate(args []string) error {
+	fs := flag.NewFlagSet("migrate", flag.ContinueOnError)
+	status := fs.Bool("status", false, "list migrations and whether they have been applied")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if !*status {
+		return runMigrations()
+	}
+
+	if err := createMigrationTables(); err != nil {
+		return err
+	}
+	list, err := loadMigrations()
+	if err != nil {
+		return err
+	}
+	applied, err := appliedMigrations()
+	if err != nil {
+		return err
+	}
+	for _, m := range list {
+		if at, ok := applied[m.Version]; ok {
+			fmt.Printf("%s\tapplied %s\n", m.Name, at.Format(time.RFC3339))
+		} else {
+			fmt.Printf("%s\tpending\n", m.Name)
+		}
+	}
+	return nil
+}
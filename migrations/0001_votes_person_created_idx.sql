@@ -0,0 +1,2 @@
+-- Leaderboard aggregates and per-person comment lists scan votes by person
+CREATE INDEX IF NOT EXISTS votes_person_created_idx ON votes (person_id, created_at DESC);
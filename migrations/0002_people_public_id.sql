@@ -0,0 +1,3 @@
+-- Opaque ids for URLs and API payloads; filled in by assignPublicIDs
+ALTER TABLE people ADD COLUMN IF NOT EXISTS public_id TEXT;
+CREATE UNIQUE INDEX IF NOT EXISTS people_public_id_idx ON people (public_id);
@@ -0,0 +1,12 @@
+-- Score history for the votes cast before it was recorded (undone votes
+-- are no longer known)
+INSERT INTO score_history (person_id, vote_id, delta, new_score, created_at)
+SELECT person_id, id, delta,
+       SUM(delta) OVER (PARTITION BY person_id ORDER BY created_at, id),
+       created_at
+FROM (
+    SELECT person_id, id, created_at, CASE WHEN upvote THEN 1 ELSE -1 END AS delta
+    FROM votes
+    WHERE upvote IS NOT NULL AND person_id IS NOT NULL
+) v
+WHERE NOT EXISTS (SELECT 1 FROM score_history);
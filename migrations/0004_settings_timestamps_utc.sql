@@ -0,0 +1,5 @@
+-- The voting deadline as RFC 3339 UTC, whichever format it was saved in
+UPDATE settings
+SET value = to_char(value::timestamptz AT TIME ZONE 'UTC', 'YYYY-MM-DD"T"HH24:MI:SS"Z"')
+WHERE key = 'voting_closes_at' AND value <> ''
+  AND value !~ '^\d{4}-\d{2}-\d{2}T\d{2}:\d{2}:\d{2}Z$';
@@ -0,0 +1,212 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"macurate/validation"
+)
+
+// Milestones worth a confetti toast: a person crossing a score threshold, a
+// new #1, and every 1000th vote on the board. Each is recorded once in the
+// milestones table and published on the event bus. Score milestones are
+// skipped while scores are hidden so they can't leak the standings.
+
+var scoreMilestones = []int{100, 250, 500, 1000}
+
+const voteMilestoneEvery = 1000
+
+// Milestone is one recorded event.
+type Milestone struct {
+	ID        int       `json:"id"`
+	Kind      string    `json:"kind"` // "score", "new_leader" or "votes"
+	PersonID  *int      `json:"-"`
+	PublicID  string    `json:"public_id,omitempty"` // the person, for score and new_leader
+	Value     int       `json:"value"`
+	Message   string    `json:"message"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+func createMilestoneTables() error {
+	_, err := db.Exec(`
+    CREATE TABLE IF NOT EXISTS milestones (
+        id SERIAL PRIMARY KEY,
+        kind TEXT NOT NULL,
+        person_id INTEGER REFERENCES people(id) ON DELETE CASCADE,
+        value INTEGER NOT NULL,
+        message TEXT NOT NULL,
+        created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+    );
+    CREATE UNIQUE INDEX IF NOT EXISTS milestones_once_idx
+        ON milestones (kind, COALESCE(person_id, 0), value) WHERE kind <> 'new_leader';
+    `)
+	return err
+}
+
+// Insert unless already reached; publishes only the first time.
+func recordMilestone(kind string, personID *int, value int, message string) error {
+	var m Milestone
+	err := db.QueryRow(`
+        INSERT INTO milestones (kind, person_id, value, message) VALUES ($1, $2, $3, $4)
+        ON CONFLICT DO NOTHING
+        RETURNING id, kind, person_id, COALESCE((SELECT public_id FROM people WHERE id = person_id), ''), value, message, created_at`,
+		kind, personID, value, message,
+	).Scan(&m.ID, &m.Kind, &m.PersonID, &m.PublicID, &m.Value, &m.Message, &m.CreatedAt)
+	if err == sql.ErrNoRows {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	events.publish("milestone", m)
+	if personID != nil {
+		notifyFollowers(*personID, "milestone", "🎉 Milestone", message)
+	}
+	return nil
+}
+
+// Look for milestones after a vote on personID. Failures are only logged;
+// the vote itself already went through.
+func checkMilestones(personID int) {
+	if err := checkVoteMilestone(); err != nil {
+		slog.Error("milestones", "err", err)
+	}
+	if !publicDisplayOptions().ShowScores {
+		return
+	}
+	if err := checkScoreMilestones(personID); err != nil {
+		slog.Error("milestones", "err", err)
+	}
+	if err := checkLeaderMilestone(); err != nil {
+		slog.Error("milestones", "err", err)
+	}
+}
+
+func checkVoteMilestone() error {
+	var total int
+	if err := db.QueryRow("SELECT COUNT(*) FROM votes WHERE upvote IS NOT NULL").Scan(&total); err != nil {
+		return err
+	}
+	if total < voteMilestoneEvery {
+		return nil
+	}
+	n := total / voteMilestoneEvery * voteMilestoneEvery
+	return recordMilestone("votes", nil, n, fmt.Sprintf("Vote number %d just came in!", n))
+}
+
+func checkScoreMilestones(personID int) error {
+	p, err := queryPerson(context.Background(), personID)
+	if err == sql.ErrNoRows {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	for _, t := range scoreMilestones {
+		if p.Score < t {
+			break
+		}
+		if err := recordMilestone("score", &p.ID, t, fmt.Sprintf("%s just crossed %d points!", p.Name, t)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// A new sole #1 with a positive score. The current leader is kept in the
+// settings table so restarts don't re-announce them.
+func checkLeaderMilestone() error {
+	rows, err := db.Query(`
+        SELECT p.id, p.name,
+               COALESCE(SUM(CASE WHEN v.upvote IS TRUE THEN 1 WHEN v.upvote IS FALSE THEN -1 ELSE 0 END), 0) AS score
+        FROM people p
+        LEFT JOIN votes v ON v.person_id = p.id
+        GROUP BY p.id
+        ORDER BY score DESC
+        LIMIT 2`)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	type entry struct {
+		id    int
+		name  string
+		score int
+	}
+	var top []entry
+	for rows.Next() {
+		var e entry
+		if err := rows.Scan(&e.id, &e.name, &e.score); err != nil {
+			return err
+		}
+		top = append(top, e)
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	if len(top) == 0 || top[0].score <= 0 || (len(top) == 2 && top[1].score == top[0].score) {
+		return nil
+	}
+	leader := top[0]
+
+	// Returns the previous leader only when the value actually changed
+	var prev sql.NullString
+	err = db.QueryRow(`
+        WITH prev AS (SELECT value FROM settings WHERE key = 'milestone_leader')
+        INSERT INTO settings (key, value) VALUES ('milestone_leader', $1)
+        ON CONFLICT (key) DO UPDATE SET value = EXCLUDED.value WHERE settings.value <> EXCLUDED.value
+        RETURNING (SELECT value FROM prev)`, fmt.Sprint(leader.id)).Scan(&prev)
+	if err == sql.ErrNoRows {
+		return nil // unchanged
+	} else if err != nil {
+		return err
+	}
+	if !prev.Valid {
+		return nil // the first leader ever isn't overtaking anyone
+	}
+	return recordMilestone("new_leader", &leader.id, leader.score, fmt.Sprintf("%s takes the #1 spot!", leader.name))
+}
+
+// Recent milestones, newest first (?limit=, default 20)
+func apiMilestonesHandler(w http.ResponseWriter, r *http.Request) {
+	var req milestonesRequest
+	if errs := validation.Bind(r.URL.Query(), &req); errs != nil {
+		writeValidationError(w, errs)
+		return
+	}
+	if req.Limit == 0 {
+		req.Limit = 20
+	}
+
+	// Score milestones reveal standings, so only vote counts while hidden
+	hidden := scoresHiddenFor(r)
+	rows, err := db.QueryContext(r.Context(), `
+        SELECT m.id, m.kind, m.person_id, COALESCE(p.public_id, ''), m.value, m.message, m.created_at
+        FROM milestones m LEFT JOIN people p ON p.id = m.person_id
+        WHERE NOT $2 OR m.kind = 'votes'
+        ORDER BY m.id DESC
+        LIMIT $1`, req.Limit, hidden)
+	if err != nil {
+		serverError(w, r, err)
+		return
+	}
+	defer rows.Close()
+
+	list := []Milestone{}
+	for rows.Next() {
+		var m Milestone
+		if err := rows.Scan(&m.ID, &m.Kind, &m.PersonID, &m.PublicID, &m.Value, &m.Message, &m.CreatedAt); err != nil {
+			serverError(w, r, err)
+			return
+		}
+		list = append(list, m)
+	}
+	if err := rows.Err(); err != nil {
+		serverError(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{"milestones": list})
+}
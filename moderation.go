@@ -0,0 +1,151 @@
+package main
+
+import (
+	"database/sql"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// Comment moderation states; only approved comments are shown publicly.
+// Votes count towards scores regardless of their comment's status.
+const (
+	commentPending  = "pending"
+	commentApproved = "approved"
+	commentRejected = "rejected"
+)
+
+// PendingComment is a comment waiting in the moderation queue.
+type PendingComment struct {
+	ID         int
+	PersonName string
+	IsUpvote   bool
+	Text       string
+	Author     string
+	CreatedAt  time.Time
+	Toxicity   *float64 // from the moderation assist; nil when not scored
+	Flagged    bool     // at or over the moderation assist's threshold
+}
+
+func createModerationTables() error {
+	_, err := db.Exec(`
+    ALTER TABLE votes ADD COLUMN IF NOT EXISTS status TEXT NOT NULL DEFAULT 'approved';
+    CREATE INDEX IF NOT EXISTS votes_pending_idx ON votes (id) WHERE status = 'pending';
+    `)
+	return err
+}
+
+func moderationEnabled() bool {
+	return getBoolSetting("moderation_enabled", false)
+}
+
+// Status for a newly written comment: held for review while moderation is on
+func newCommentStatus(comment string) string {
+	if comment != "" && moderationEnabled() {
+		return commentPending
+	}
+	return commentApproved
+}
+
+func listPendingComments() ([]PendingComment, error) {
+	rows, err := db.Query(`
+        SELECT v.id, p.name, v.upvote, v.comment, COALESCE(v.voter_name, ''), v.created_at,
+               t.score, COALESCE(t.flagged, FALSE)
+        FROM votes v JOIN people p ON p.id = v.person_id
+        LEFT JOIN comment_toxicity t ON t.vote_id = v.id
+        WHERE v.status = 'pending'
+        ORDER BY t.flagged IS NOT TRUE, v.id`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var list []PendingComment
+	for rows.Next() {
+		var c PendingComment
+		if err := rows.Scan(&c.ID, &c.PersonName, &c.IsUpvote, &c.Text, &c.Author, &c.CreatedAt, &c.Toxicity, &c.Flagged); err != nil {
+			return nil, err
+		}
+		list = append(list, c)
+	}
+	return list, rows.Err()
+}
+
+// Moderation queue (admin-only): GET lists pending comments, POST approves
+// or rejects one, or switches moderation on and off.
+func adminModerationHandler(w http.ResponseWriter, r *http.Request) {
+	if !adminAuthorized(r) {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	if r.Method == http.MethodPost {
+		var err error
+		switch action := r.FormValue("action"); action {
+		case "approve", "reject":
+			id, convErr := strconv.Atoi(r.FormValue("id"))
+			if convErr != nil || id <= 0 {
+				http.Error(w, "Invalid id", http.StatusBadRequest)
+				return
+			}
+			status := commentApproved
+			if action == "reject" {
+				status = commentRejected
+			}
+			c := webhookComment{VoteID: id}
+			err = db.QueryRowContext(r.Context(), `
+                UPDATE votes SET status = $2 WHERE id = $1
+                RETURNING COALESCE((SELECT public_id FROM people WHERE id = person_id), ''), COALESCE(upvote, FALSE), COALESCE(comment, ''), COALESCE(voter_name, '')`, id, status).
+				Scan(&c.PublicID, &c.Upvote, &c.Text, &c.Author)
+			if err == sql.ErrNoRows {
+				err = nil
+			} else if err == nil && status == commentApproved {
+				invalidatePeopleCache()
+				events.publish("comment", map[string]interface{}{"vote_id": id, "public_id": c.PublicID})
+				queueWebhooks(webhookCommentPublished, c)
+			}
+		case "settings":
+			err = setSetting("moderation_enabled", strconv.FormatBool(r.FormValue("enabled") != ""))
+		case "toxicity":
+			threshold, convErr := strconv.ParseFloat(r.FormValue("threshold"), 64)
+			if convErr != nil || threshold <= 0 || threshold > 1 {
+				http.Error(w, "Threshold must be above 0 and at most 1", http.StatusBadRequest)
+				return
+			}
+			err = setSetting("toxicity_threshold", strconv.FormatFloat(threshold, 'f', -1, 64))
+		default:
+			http.Error(w, "Invalid action", http.StatusBadRequest)
+			return
+		}
+		if err != nil {
+			serverError(w, r, err)
+			return
+		}
+		http.Redirect(w, r, "/admin/moderation", http.StatusSeeOther)
+		return
+	}
+
+	pending, err := listPendingComments()
+	if err != nil {
+		serverError(w, r, err)
+		return
+	}
+	data := map[string]interface{}{
+		"Enabled":   moderationEnabled(),
+		"Pending":   pending,
+		"Assist":    toxicityScorer != nil,
+		"Threshold": getToxicityThreshold(),
+	}
+	if toxicityScorer != nil {
+		stats, err := toxicityStats(r.Context())
+		if err != nil {
+			serverError(w, r, err)
+			return
+		}
+		data["Stats"] = stats
+	}
+	tmpl := parseTemplates("templates/moderation.html")
+	if err := tmpl.Execute(w, data); err != nil {
+		serverError(w, r, err)
+	}
+}
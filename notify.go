@@ -0,0 +1,355 @@
+package main
+
+import (
+	"bytes"
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/smtp"
+	"os"
+	"strings"
+	"time"
+
+	"macurate/validation"
+)
+
+// Subscription delivers batched vote digests to the person being voted on.
+// Nothing is sent until the person confirms through their opt-in link.
+type Subscription struct {
+	ID           int
+	PersonID     int
+	PersonName   string
+	Email        string
+	WebhookURL   string
+	BatchMinutes int
+	Token        string
+	Confirmed    bool
+	LastSentAt   sql.NullTime
+}
+
+// digest is the payload of one batched notification.
+type digest struct {
+	PublicID  string          `json:"public_id"`
+	Name      string          `json:"name"`
+	NewVotes  int             `json:"new_votes"`
+	Upvotes   int             `json:"upvotes"`
+	Downvotes int             `json:"downvotes"`
+	Comments  []digestComment `json:"comments"`
+}
+
+type digestComment struct {
+	Upvote bool   `json:"upvote"`
+	Text   string `json:"text"`
+}
+
+const minBatchMinutes = 5
+
+var notifyClient = &http.Client{Timeout: 10 * time.Second}
+
+func createNotifyTables() error {
+	_, err := db.Exec(`
+    CREATE TABLE IF NOT EXISTS person_subscriptions (
+        id SERIAL PRIMARY KEY,
+        person_id INTEGER REFERENCES people(id) ON DELETE CASCADE,
+        email TEXT NOT NULL DEFAULT '',
+        webhook_url TEXT NOT NULL DEFAULT '',
+        batch_minutes INTEGER NOT NULL,
+        token TEXT NOT NULL UNIQUE,
+        confirmed BOOLEAN NOT NULL DEFAULT FALSE,
+        last_vote_id INTEGER NOT NULL DEFAULT 0,
+        last_sent_at TIMESTAMPTZ
+    );
+    `)
+	return err
+}
+
+func listSubscriptions() ([]Subscription, error) {
+	rows, err := db.Query(`
+        SELECT s.id, s.person_id, p.name, s.email, s.webhook_url, s.batch_minutes, s.token, s.confirmed, s.last_sent_at
+        FROM person_subscriptions s JOIN people p ON p.id = s.person_id
+        ORDER BY p.name, s.id`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var list []Subscription
+	for rows.Next() {
+		var s Subscription
+		if err := rows.Scan(&s.ID, &s.PersonID, &s.PersonName, &s.Email, &s.WebhookURL, &s.BatchMinutes, &s.Token, &s.Confirmed, &s.LastSentAt); err != nil {
+			return nil, err
+		}
+		list = append(list, s)
+	}
+	return list, rows.Err()
+}
+
+// Background loop sending digests for subscriptions whose batch window elapsed
+func startNotifier() {
+	go func() {
+		for range time.Tick(time.Minute) {
+			if err := runExclusive("notifier", sendDueDigests); err != nil {
+				slog.Error("notifier", "err", err)
+			}
+		}
+	}()
+}
+
+func sendDueDigests() error {
+	rows, err := db.Query(`
+        SELECT s.id, s.person_id, COALESCE(p.public_id, ''), p.name, s.email, s.webhook_url, s.last_vote_id
+        FROM person_subscriptions s JOIN people p ON p.id = s.person_id
+        WHERE s.confirmed
+          AND (s.last_sent_at IS NULL OR s.last_sent_at + s.batch_minutes * INTERVAL '1 minute' <= NOW())`)
+	if err != nil {
+		return err
+	}
+	type due struct {
+		id, personID, lastVoteID       int
+		publicID, name, email, webhook string
+	}
+	var list []due
+	for rows.Next() {
+		var d due
+		if err := rows.Scan(&d.id, &d.personID, &d.publicID, &d.name, &d.email, &d.webhook, &d.lastVoteID); err != nil {
+			rows.Close()
+			return err
+		}
+		list = append(list, d)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for _, d := range list {
+		dg, maxID, err := buildDigest(d.personID, d.publicID, d.name, d.lastVoteID)
+		if err != nil {
+			return err
+		}
+		if dg.NewVotes == 0 {
+			continue
+		}
+		if d.webhook != "" {
+			err := sendWebhookDigest(d.webhook, dg)
+			metrics.observeDelivery("webhook", err)
+			if err != nil {
+				slog.Error("notifier: webhook failed", "subscription", d.id, "err", err)
+				continue
+			}
+		}
+		if d.email != "" {
+			err := sendEmailDigest(d.email, dg)
+			metrics.observeDelivery("email", err)
+			if err != nil {
+				slog.Error("notifier: email failed", "subscription", d.id, "err", err)
+				continue
+			}
+		}
+		if _, err := db.Exec(
+			"UPDATE person_subscriptions SET last_vote_id = $1, last_sent_at = NOW() WHERE id = $2",
+			maxID, d.id,
+		); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Votes on personID newer than afterID, and the highest vote id seen
+func buildDigest(personID int, publicID, name string, afterID int) (digest, int, error) {
+	dg := digest{PublicID: publicID, Name: name, Comments: []digestComment{}}
+	rows, err := db.Query(
+		"SELECT id, upvote, CASE WHEN status = 'approved' THEN COALESCE(comment, '') ELSE '' END FROM votes WHERE person_id = $1 AND id > $2 AND upvote IS NOT NULL ORDER BY id",
+		personID, afterID,
+	)
+	if err != nil {
+		return dg, afterID, err
+	}
+	defer rows.Close()
+
+	maxID := afterID
+	for rows.Next() {
+		var id int
+		var c digestComment
+		if err := rows.Scan(&id, &c.Upvote, &c.Text); err != nil {
+			return dg, afterID, err
+		}
+		maxID = id
+		dg.NewVotes++
+		if c.Upvote {
+			dg.Upvotes++
+		} else {
+			dg.Downvotes++
+		}
+		if strings.TrimSpace(c.Text) != "" && len(dg.Comments) < 20 {
+			dg.Comments = append(dg.Comments, c)
+		}
+	}
+	return dg, maxID, rows.Err()
+}
+
+func sendWebhookDigest(url string, dg digest) error {
+	body, err := json.Marshal(map[string]interface{}{"event": "votes.digest", "data": dg})
+	if err != nil {
+		return err
+	}
+	resp, err := notifyClient.Post(url, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("webhook returned %s", resp.Status)
+	}
+	return nil
+}
+
+func smtpConfigured() bool {
+	return os.Getenv("SMTP_ADDR") != "" && os.Getenv("SMTP_FROM") != ""
+}
+
+// Send a plain-text mail through SMTP_ADDR (host:port) as SMTP_FROM,
+// authenticating with SMTP_USER/SMTP_PASSWORD when set
+func sendMail(to, subject, body string) error {
+	addr, from := os.Getenv("SMTP_ADDR"), os.Getenv("SMTP_FROM")
+	if !smtpConfigured() {
+		return fmt.Errorf("SMTP_ADDR and SMTP_FROM are not configured")
+	}
+	var auth smtp.Auth
+	if user := os.Getenv("SMTP_USER"); user != "" {
+		host, _, _ := strings.Cut(addr, ":")
+		auth = smtp.PlainAuth("", user, os.Getenv("SMTP_PASSWORD"), host)
+	}
+	subject = strings.NewReplacer("\r", " ", "\n", " ").Replace(subject)
+	msg := fmt.Sprintf("From: %s\r\nTo: %s\r\nSubject: %s\r\nContent-Type: text/plain; charset=utf-8\r\n\r\n%s", from, to, subject, body)
+	return smtp.SendMail(addr, auth, from, []string{to}, []byte(msg))
+}
+
+func sendEmailDigest(to string, dg digest) error {
+	var b strings.Builder
+	fmt.Fprintf(&b, "Hi %s,\r\n\r\nYou received %d new votes (%d up, %d down).\r\n", dg.Name, dg.NewVotes, dg.Upvotes, dg.Downvotes)
+	if len(dg.Comments) > 0 {
+		b.WriteString("\r\nLatest comments:\r\n")
+		for _, c := range dg.Comments {
+			sign := "-"
+			if c.Upvote {
+				sign = "+"
+			}
+			fmt.Fprintf(&b, "  %s %s\r\n", sign, strings.ReplaceAll(c.Text, "\n", " "))
+		}
+	}
+	return sendMail(to, fmt.Sprintf("%s: %d new votes", currentBoardName(), dg.NewVotes), b.String())
+}
+
+// Create or delete a subscription (admin-only). New subscriptions stay
+// inactive until the person opens their confirmation link.
+func adminSubscriptionsHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if !adminAuthorized(r) {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	var req adminSubscriptionRequest
+	if errs := bindAdminForm(r, &req); errs != nil {
+		renderAdmin(w, r, errs)
+		return
+	}
+
+	switch req.Action {
+	case "create":
+		if req.PersonID == 0 {
+			renderAdmin(w, r, validation.Errors{"sub_person_id": "is required"})
+			return
+		}
+		if req.Email == "" && req.WebhookURL == "" {
+			renderAdmin(w, r, validation.Errors{"email": "or webhook URL is required"})
+			return
+		}
+		if req.WebhookURL != "" && !strings.HasPrefix(req.WebhookURL, "https://") && !strings.HasPrefix(req.WebhookURL, "http://") {
+			renderAdmin(w, r, validation.Errors{"webhook_url": "must be an http(s) URL"})
+			return
+		}
+		if req.Email != "" && !strings.Contains(req.Email, "@") {
+			renderAdmin(w, r, validation.Errors{"email": "must be an email address"})
+			return
+		}
+		if req.BatchMinutes < minBatchMinutes {
+			req.BatchMinutes = 60
+		}
+		b := make([]byte, 16)
+		if _, err := rand.Read(b); err != nil {
+			serverError(w, r, err)
+			return
+		}
+		if _, err := db.ExecContext(r.Context(),
+			`INSERT INTO person_subscriptions (person_id, email, webhook_url, batch_minutes, token, last_vote_id)
+             VALUES ($1, $2, $3, $4, $5, (SELECT COALESCE(MAX(id), 0) FROM votes))`,
+			req.PersonID, req.Email, req.WebhookURL, req.BatchMinutes, hex.EncodeToString(b),
+		); err != nil {
+			serverError(w, r, err)
+			return
+		}
+	case "delete":
+		if _, err := db.ExecContext(r.Context(), "DELETE FROM person_subscriptions WHERE id = $1", req.ID); err != nil {
+			serverError(w, r, err)
+			return
+		}
+	}
+
+	http.Redirect(w, r, "/admin", http.StatusSeeOther)
+}
+
+// Opt-in page for the notified person: GET shows the choice, POST confirms
+// or unsubscribes. A GET never changes anything, so link previews are safe.
+func notifyConfirmHandler(w http.ResponseWriter, r *http.Request) {
+	token := r.FormValue("token")
+	var sub Subscription
+	err := db.QueryRowContext(r.Context(), `
+        SELECT s.id, p.name, s.email, s.webhook_url, s.batch_minutes, s.confirmed
+        FROM person_subscriptions s JOIN people p ON p.id = s.person_id
+        WHERE s.token = $1`, token).
+		Scan(&sub.ID, &sub.PersonName, &sub.Email, &sub.WebhookURL, &sub.BatchMinutes, &sub.Confirmed)
+	if err == sql.ErrNoRows {
+		http.Error(w, "Unknown or expired link", http.StatusNotFound)
+		return
+	} else if err != nil {
+		serverError(w, r, err)
+		return
+	}
+
+	if r.Method == http.MethodPost {
+		switch r.FormValue("action") {
+		case "confirm":
+			_, err = db.ExecContext(r.Context(), "UPDATE person_subscriptions SET confirmed = TRUE WHERE id = $1", sub.ID)
+			sub.Confirmed = true
+		case "unsubscribe":
+			_, err = db.ExecContext(r.Context(), "DELETE FROM person_subscriptions WHERE id = $1", sub.ID)
+			if err == nil {
+				w.Write([]byte("You have been unsubscribed."))
+				return
+			}
+		default:
+			http.Error(w, "Invalid action", http.StatusBadRequest)
+			return
+		}
+		if err != nil {
+			serverError(w, r, err)
+			return
+		}
+	}
+
+	sub.Token = token
+	tmpl := parseTemplates("templates/notify.html")
+	if err := tmpl.Execute(w, sub); err != nil {
+		serverError(w, r, err)
+	}
+}
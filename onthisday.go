@@ -0,0 +1,280 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"log/slog"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+)
+
+// "On this day": what happened on today's date (UTC) in earlier years, for
+// the homepage. Leaders come from the score history, as the board stood at
+// the end of that day; season winners from the snapshots taken when a
+// season closed; the best comment of the day (most tagged, newest breaking
+// ties) from the live votes and, when ARCHIVE_DATABASE_URL is set, the
+// archive. Leaders are left out while scores are hidden, closed seasons'
+// winners aren't. On a team's own domain only that team's members count,
+// and archived comments are left out, since the archive doesn't know teams.
+
+// How many years back to look
+const onThisDayYears = 10
+
+// OnThisDayEvent is one thing that happened on today's date in an earlier year.
+type OnThisDayEvent struct {
+	Kind     string `json:"kind"` // "leader", "season_winner" or "best_comment"
+	Year     int    `json:"year"`
+	YearsAgo int    `json:"years_ago"`
+	Name     string `json:"name"`                // the person
+	PublicID string `json:"public_id,omitempty"` // empty once they're gone
+	Score    *int   `json:"score,omitempty"`     // leader and season_winner
+	Season   string `json:"season,omitempty"`    // season_winner
+	// best_comment; replies aren't kept for it
+	Comment *PreviewComment `json:"comment,omitempty"`
+}
+
+// The best comment of one day, along with how many tags it got
+type dayComment struct {
+	event OnThisDayEvent
+	tags  int
+}
+
+// Archived comments only change when more votes are archived, so one look
+// a day is enough
+var onThisDayArchive struct {
+	mu       sync.Mutex
+	day      string
+	comments map[int]dayComment // by year
+}
+
+func queryOnThisDay(ctx context.Context, now time.Time, teamID int, hidden bool) ([]OnThisDayEvent, error) {
+	today := now.UTC().Truncate(24 * time.Hour)
+	events := []OnThisDayEvent{}
+
+	if !hidden {
+		var since sql.NullTime
+		if err := db.QueryRowContext(ctx, "SELECT MIN(created_at) FROM score_history").Scan(&since); err != nil {
+			return nil, err
+		}
+		for ago := 1; since.Valid && ago <= onThisDayYears; ago++ {
+			day := today.AddDate(-ago, 0, 0)
+			if day.AddDate(0, 0, 1).Before(since.Time) {
+				break // before the board's history starts
+			}
+			e, ok, err := leaderAt(ctx, day.AddDate(0, 0, 1), teamID)
+			if err != nil {
+				return nil, err
+			}
+			if ok {
+				e.Year, e.YearsAgo = day.Year(), ago
+				events = append(events, e)
+			}
+		}
+	}
+
+	winners, err := seasonWinnersOn(ctx, today, teamID)
+	if err != nil {
+		return nil, err
+	}
+	events = append(events, winners...)
+
+	comments, err := bestCommentsOn(ctx, today, teamID)
+	if err != nil {
+		return nil, err
+	}
+	if teamID == 0 {
+		for year, c := range archivedCommentsOn(ctx, today) {
+			if live, ok := comments[year]; !ok || c.tags > live.tags {
+				comments[year] = c
+			}
+		}
+	}
+	for ago := 1; ago <= onThisDayYears; ago++ {
+		if c, ok := comments[today.Year()-ago]; ok {
+			events = append(events, c.event)
+		}
+	}
+	return events, nil
+}
+
+// The person with the best score just before until, if anyone was ahead
+func leaderAt(ctx context.Context, until time.Time, teamID int) (OnThisDayEvent, bool, error) {
+	e := OnThisDayEvent{Kind: "leader"}
+	var score int
+	err := db.QueryRowContext(ctx, `
+        SELECT p.name, COALESCE(p.public_id, ''), h.new_score
+        FROM (
+            SELECT DISTINCT ON (person_id) person_id, new_score
+            FROM score_history WHERE created_at < $1
+            ORDER BY person_id, created_at DESC, id DESC
+        ) h
+        JOIN people p ON p.id = h.person_id
+        WHERE h.new_score > 0 AND ($2 = 0 OR p.team_id = $2)
+        ORDER BY h.new_score DESC, p.name
+        LIMIT 1`, until, teamID).Scan(&e.Name, &e.PublicID, &score)
+	if err == sql.ErrNoRows {
+		return e, false, nil
+	} else if err != nil {
+		return e, false, err
+	}
+	e.Score = &score
+	return e, true, nil
+}
+
+// The winners of seasons that closed on today's date in earlier years
+func seasonWinnersOn(ctx context.Context, today time.Time, teamID int) ([]OnThisDayEvent, error) {
+	rows, err := db.QueryContext(ctx, `
+        SELECT s.name, s.ended_at, r.name, r.public_id, r.score
+        FROM seasons s
+        JOIN season_results r ON r.season_id = s.id AND r.rank = 1
+        WHERE EXTRACT(MONTH FROM s.ended_at AT TIME ZONE 'UTC') = $1
+          AND EXTRACT(DAY FROM s.ended_at AT TIME ZONE 'UTC') = $2
+          AND s.ended_at < $3 AND s.ended_at >= $4
+          AND ($5 = 0 OR r.team_id = $5)
+        ORDER BY s.ended_at DESC, r.name`,
+		int(today.Month()), today.Day(), today, today.AddDate(-onThisDayYears, 0, 0), teamID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var events []OnThisDayEvent
+	for rows.Next() {
+		e := OnThisDayEvent{Kind: "season_winner"}
+		var endedAt time.Time
+		var score int
+		if err := rows.Scan(&e.Season, &endedAt, &e.Name, &e.PublicID, &score); err != nil {
+			return nil, err
+		}
+		e.Score = &score
+		e.Year = endedAt.UTC().Year()
+		e.YearsAgo = today.Year() - e.Year
+		events = append(events, e)
+	}
+	return events, rows.Err()
+}
+
+// The best approved comment of today's date in each earlier year, by year
+func bestCommentsOn(ctx context.Context, today time.Time, teamID int) (map[int]dayComment, error) {
+	rows, err := db.QueryContext(ctx, `
+        SELECT DISTINCT ON (EXTRACT(YEAR FROM v.created_at AT TIME ZONE 'UTC'))
+               p.name, COALESCE(p.public_id, ''),
+               v.id, v.upvote, v.comment, COALESCE(v.voter_name, ''), v.created_at,
+               v.edited_at IS NOT NULL, COUNT(vt.tag_id)
+        FROM votes v
+        JOIN people p ON p.id = v.person_id
+        LEFT JOIN vote_tags vt ON vt.vote_id = v.id
+        WHERE COALESCE(TRIM(v.comment), '') <> '' AND v.status = 'approved'
+          AND EXTRACT(MONTH FROM v.created_at AT TIME ZONE 'UTC') = $1
+          AND EXTRACT(DAY FROM v.created_at AT TIME ZONE 'UTC') = $2
+          AND v.created_at < $3 AND v.created_at >= $4
+          AND ($5 = 0 OR p.team_id = $5)
+        GROUP BY v.id, p.id
+        ORDER BY EXTRACT(YEAR FROM v.created_at AT TIME ZONE 'UTC'), COUNT(vt.tag_id) DESC, v.id DESC`,
+		int(today.Month()), today.Day(), today, today.AddDate(-onThisDayYears, 0, 0), teamID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	comments := map[int]dayComment{}
+	for rows.Next() {
+		var e OnThisDayEvent
+		var c PreviewComment
+		var tags int
+		if err := rows.Scan(&e.Name, &e.PublicID, &c.ID, &c.Upvote, &c.Text, &c.Author, &c.CreatedAt, &c.Edited, &tags); err != nil {
+			return nil, err
+		}
+		addDayComment(comments, today, e, c, tags)
+	}
+	return comments, rows.Err()
+}
+
+// The archive's best comment of today's date in each earlier year, by
+// year; none when there's no archive or it can't be reached
+func archivedCommentsOn(ctx context.Context, today time.Time) map[int]dayComment {
+	if os.Getenv("ARCHIVE_DATABASE_URL") == "" {
+		return nil
+	}
+	day := today.Format(time.DateOnly)
+	onThisDayArchive.mu.Lock()
+	defer onThisDayArchive.mu.Unlock()
+	if onThisDayArchive.day == day {
+		return onThisDayArchive.comments
+	}
+
+	comments, err := queryArchivedCommentsOn(ctx, today)
+	if err != nil {
+		// Tried again tomorrow; the widget does fine without
+		slog.Warn("on this day: archive", "err", err)
+	}
+	onThisDayArchive.day, onThisDayArchive.comments = day, comments
+	return comments
+}
+
+func queryArchivedCommentsOn(ctx context.Context, today time.Time) (map[int]dayComment, error) {
+	adb, err := openArchiveDB()
+	if err != nil {
+		return nil, err
+	}
+	defer adb.Close()
+
+	rows, err := adb.QueryContext(ctx, `
+        SELECT DISTINCT ON (EXTRACT(YEAR FROM created_at AT TIME ZONE 'UTC'))
+               person_name, id, COALESCE(upvote, FALSE), comment, COALESCE(voter_name, ''), created_at,
+               cardinality(tags)
+        FROM archived_votes
+        WHERE COALESCE(TRIM(comment), '') <> '' AND status = 'approved'
+          AND EXTRACT(MONTH FROM created_at AT TIME ZONE 'UTC') = $1
+          AND EXTRACT(DAY FROM created_at AT TIME ZONE 'UTC') = $2
+          AND created_at >= $3
+        ORDER BY EXTRACT(YEAR FROM created_at AT TIME ZONE 'UTC'), cardinality(tags) DESC, id DESC`,
+		int(today.Month()), today.Day(), today.AddDate(-onThisDayYears, 0, 0))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	comments := map[int]dayComment{}
+	for rows.Next() {
+		var e OnThisDayEvent
+		var c PreviewComment
+		var tags int
+		if err := rows.Scan(&e.Name, &c.ID, &c.Upvote, &c.Text, &c.Author, &c.CreatedAt, &tags); err != nil {
+			return nil, err
+		}
+		addDayComment(comments, today, e, c, tags)
+	}
+	return comments, rows.Err()
+}
+
+func addDayComment(comments map[int]dayComment, today time.Time, e OnThisDayEvent, c PreviewComment, tags int) {
+	if getNamePolicy() == namePolicyAnonymous {
+		c.Author = ""
+	}
+	c.Replies = []Reply{}
+	e.Kind = "best_comment"
+	e.Year = c.CreatedAt.UTC().Year()
+	e.YearsAgo = today.Year() - e.Year
+	e.Comment = &c
+	comments[e.Year] = dayComment{event: e, tags: tags}
+}
+
+// GET /api/onthisday: notable moments from today's date in earlier years,
+// newest first within each kind. Empty on a board younger than a year.
+func apiOnThisDayHandler(w http.ResponseWriter, r *http.Request) {
+	hidden := scoresHiddenFor(r)
+	now := time.Now()
+	events, err := queryOnThisDay(r.Context(), now, hostTeamID(r), hidden)
+	if err != nil {
+		serverError(w, r, err)
+		return
+	}
+	w.Header().Set("Cache-Control", "private, max-age=300")
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"date":   now.UTC().Format(time.DateOnly),
+		"events": events,
+	})
+}
@@ -0,0 +1,32 @@
+package main
+
+import (
+	_ "embed"
+	"net/http"
+	"strconv"
+)
+
+// The OpenAPI description of the public endpoints (people, comments and
+// votes), kept by hand in openapi.json next to the handlers it describes;
+// a route or field change there belongs in the same commit. /api/docs
+// renders it with Swagger UI for people embedding the board elsewhere.
+
+//go:embed openapi.json
+var openAPISpec []byte
+
+// GET /api/v1/openapi.json
+func apiOpenAPIHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.Header().Set("API-Version", strconv.Itoa(apiVersion))
+	w.Header().Set("Cache-Control", "public, max-age=3600")
+	w.Write(openAPISpec)
+}
+
+// GET /api/docs: Swagger UI over the spec
+func apiDocsHandler(w http.ResponseWriter, r *http.Request) {
+	tmpl := parseTemplates("templates/apidocs.html")
+	if err := tmpl.Execute(w, map[string]interface{}{"BoardName": currentBoardName()}); err != nil {
+		serverError(w, r, err)
+	}
+}
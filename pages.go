@@ -0,0 +1,122 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"net/http"
+	"regexp"
+	"time"
+
+	"macurate/validation"
+)
+
+// Simple pages (board rules, FAQ, ...) that admins write in Markdown and
+// that show at /pages/{slug}, linked from the board in position order.
+
+// Page is one admin-written page.
+type Page struct {
+	Slug      string
+	Title     string
+	Body      string // Markdown
+	Position  int
+	UpdatedAt time.Time
+}
+
+var pageSlugRe = regexp.MustCompile(`^[a-z0-9]+(-[a-z0-9]+)*$`)
+
+func createPageTables() error {
+	_, err := db.Exec(`
+    CREATE TABLE IF NOT EXISTS pages (
+        slug TEXT PRIMARY KEY,
+        title TEXT NOT NULL,
+        body TEXT NOT NULL DEFAULT '',
+        position INTEGER NOT NULL DEFAULT 0,
+        updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+    );
+    `)
+	return err
+}
+
+func listPages(ctx context.Context) ([]Page, error) {
+	rows, err := db.QueryContext(ctx, "SELECT slug, title, body, position, updated_at FROM pages ORDER BY position, title")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var list []Page
+	for rows.Next() {
+		var p Page
+		if err := rows.Scan(&p.Slug, &p.Title, &p.Body, &p.Position, &p.UpdatedAt); err != nil {
+			return nil, err
+		}
+		list = append(list, p)
+	}
+	return list, rows.Err()
+}
+
+func pageHandler(w http.ResponseWriter, r *http.Request) {
+	var p Page
+	err := db.QueryRowContext(r.Context(), "SELECT title, body FROM pages WHERE slug = $1", r.PathValue("slug")).Scan(&p.Title, &p.Body)
+	if err == sql.ErrNoRows {
+		http.NotFound(w, r)
+		return
+	} else if err != nil {
+		serverError(w, r, err)
+		return
+	}
+	tmpl := parseTemplates("templates/page.html")
+	data := map[string]interface{}{
+		"BoardName": currentBoardName(),
+		"Title":     p.Title,
+		"Body":      renderMarkdown(p.Body),
+	}
+	if err := tmpl.Execute(w, data); err != nil {
+		serverError(w, r, err)
+	}
+}
+
+// Create, edit or delete a page (admin-only). Saving under an existing slug
+// replaces that page.
+func adminPagesHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if !adminAuthorized(r) {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	var req adminPageRequest
+	if errs := bindAdminForm(r, &req); errs != nil {
+		renderAdmin(w, r, errs)
+		return
+	}
+	if !pageSlugRe.MatchString(req.Slug) {
+		renderAdmin(w, r, validation.Errors{"slug": "may only contain a-z, 0-9 and single dashes"})
+		return
+	}
+
+	var err error
+	switch req.Action {
+	case "save":
+		if req.Title == "" {
+			renderAdmin(w, r, validation.Errors{"title": "is required"})
+			return
+		}
+		_, err = db.ExecContext(r.Context(), `
+            INSERT INTO pages (slug, title, body, position) VALUES ($1, $2, $3, $4)
+            ON CONFLICT (slug) DO UPDATE SET
+                title = EXCLUDED.title, body = EXCLUDED.body,
+                position = EXCLUDED.position, updated_at = NOW()`,
+			req.Slug, req.Title, req.Body, req.Position)
+	case "delete":
+		_, err = db.ExecContext(r.Context(), "DELETE FROM pages WHERE slug = $1", req.Slug)
+	}
+	if err != nil {
+		serverError(w, r, err)
+		return
+	}
+
+	http.Redirect(w, r, "/admin", http.StatusSeeOther)
+}
@@ -0,0 +1,173 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"io"
+	"net/http"
+	"strconv"
+
+	"macurate/validation"
+)
+
+// Admin JSON API for people. Bodies are form-encoded or multipart (for the
+// image field), like the HTML admin forms.
+
+func adminPersonID(w http.ResponseWriter, r *http.Request) (int, bool) {
+	if !adminAuthorized(r) {
+		writeError(w, http.StatusUnauthorized, "unauthorized", "Unauthorized")
+		return 0, false
+	}
+	id, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil || id <= 0 {
+		writeError(w, http.StatusBadRequest, "invalid_id", "Invalid id")
+		return 0, false
+	}
+	return id, true
+}
+
+// Rename a person, move them to another team or replace their photo. PUT
+// replaces name and team (team_id omitted clears it); PATCH changes only the
+// fields present. The photo is only replaced when an image file is sent,
+// and voting_frozen only changes when given.
+func adminAPIUpdatePersonHandler(w http.ResponseWriter, r *http.Request) {
+	id, ok := adminPersonID(w, r)
+	if !ok {
+		return
+	}
+	values, err := formValues(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid_request", "Invalid form")
+		return
+	}
+	var req adminPersonUpdateRequest
+	if errs := validation.Bind(values, &req); errs != nil {
+		writeValidationError(w, errs)
+		return
+	}
+
+	partial := r.Method == http.MethodPatch
+	_, hasName := values["name"]
+	_, hasTeam := values["team_id"]
+	_, hasFrozen := values["voting_frozen"]
+	if (!partial || hasName) && req.Name == "" {
+		writeValidationError(w, validation.Errors{"name": "is required"})
+		return
+	}
+
+	var image []byte
+	if file, _, err := r.FormFile("image"); err == nil {
+		defer file.Close()
+		raw, err := io.ReadAll(file)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "invalid_request", "Failed to read image")
+			return
+		}
+		if image, err = normalizeImage(raw); err != nil {
+			writeError(w, http.StatusBadRequest, "invalid_request", "Failed to process image: "+err.Error())
+			return
+		}
+	} else if err != http.ErrMissingFile && err != http.ErrNotMultipart {
+		writeError(w, http.StatusBadRequest, "invalid_request", "Invalid image upload")
+		return
+	}
+
+	res, err := db.ExecContext(r.Context(), `
+        UPDATE people SET
+            name = CASE WHEN $2 THEN $3 ELSE name END,
+            team_id = CASE WHEN $4 THEN NULLIF($5, 0) ELSE team_id END,
+            image = COALESCE($6, image),
+            voting_frozen = CASE WHEN $7 THEN $8 ELSE voting_frozen END
+        WHERE id = $1`,
+		id, !partial || hasName, req.Name, !partial || hasTeam, req.TeamID, image, hasFrozen, req.VotingFrozen)
+	if err != nil {
+		serverError(w, r, err)
+		return
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		writeError(w, http.StatusNotFound, "not_found", "Person not found")
+		return
+	}
+
+	invalidatePeopleCache()
+	events.publish("person_updated", map[string]interface{}{"public_id": publicIDOf(r.Context(), id)})
+
+	p, err := queryPerson(r.Context(), id)
+	if err != nil {
+		serverError(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, newAPIPerson(p, false))
+}
+
+// Remove a person together with their votes, comments and everything hanging
+// off them, in one transaction. ?dry_run=true reports the same counts
+// without deleting anything.
+func adminAPIDeletePersonHandler(w http.ResponseWriter, r *http.Request) {
+	id, ok := adminPersonID(w, r)
+	if !ok {
+		return
+	}
+
+	d, err := deletePerson(r.Context(), id, dryRunRequested(r))
+	if err == sql.ErrNoRows {
+		writeError(w, http.StatusNotFound, "not_found", "Person not found")
+		return
+	} else if err != nil {
+		serverError(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, d)
+}
+
+// What deleting a person took with them
+type personDeletion struct {
+	ID            int    `json:"-"`
+	PublicID      string `json:"deleted"`
+	Name          string `json:"name"`
+	Votes         int    `json:"deleted_votes"`
+	Comments      int    `json:"deleted_comments"`
+	Replies       int    `json:"deleted_replies"`
+	Tags          int    `json:"deleted_tags"`
+	Follows       int    `json:"deleted_follows"`
+	Subscriptions int    `json:"deleted_subscriptions"`
+	DryRun        bool   `json:"dry_run"`
+}
+
+// Delete a person and their votes; sql.ErrNoRows when there is no such person.
+// With dryRun everything is rolled back after counting.
+func deletePerson(ctx context.Context, id int, dryRun bool) (personDeletion, error) {
+	d := personDeletion{ID: id, DryRun: dryRun}
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return d, err
+	}
+	defer tx.Rollback()
+
+	// Counted first; these cascade once the votes and the person go
+	if err := tx.QueryRowContext(ctx, `
+        SELECT (SELECT COUNT(*) FROM comment_replies cr JOIN votes v ON v.id = cr.vote_id WHERE v.person_id = $1),
+               (SELECT COUNT(*) FROM vote_tags vt JOIN votes v ON v.id = vt.vote_id WHERE v.person_id = $1),
+               (SELECT COUNT(*) FROM follows WHERE person_id = $1),
+               (SELECT COUNT(*) FROM person_subscriptions WHERE person_id = $1)`, id).
+		Scan(&d.Replies, &d.Tags, &d.Follows, &d.Subscriptions); err != nil {
+		return d, err
+	}
+	// Votes go first so tags, replies and translations cascade off them
+	if err := tx.QueryRowContext(ctx, `
+        WITH deleted AS (DELETE FROM votes WHERE person_id = $1 RETURNING comment)
+        SELECT COUNT(*), COUNT(*) FILTER (WHERE COALESCE(TRIM(comment), '') <> '') FROM deleted`, id).Scan(&d.Votes, &d.Comments); err != nil {
+		return d, err
+	}
+	if err := tx.QueryRowContext(ctx, "DELETE FROM people WHERE id = $1 RETURNING name, COALESCE(public_id, '')", id).Scan(&d.Name, &d.PublicID); err != nil {
+		return d, err
+	}
+	if err := finishTx(tx, dryRun); err != nil {
+		return d, err
+	}
+	if !dryRun {
+		invalidatePeopleCache()
+		events.publish("person_removed", map[string]interface{}{"public_id": d.PublicID})
+	}
+	return d, nil
+}
@@ -0,0 +1,126 @@
+package main
+
+import (
+	"context"
+	"os"
+	"sync"
+	"time"
+)
+
+// The ordered people list behind the board and the APIs, kept in memory so
+// a burst of page views doesn't run the aggregate query each time. Anything
+// that changes scores or the roster calls invalidatePeopleCache; the
+// max age (LEADERBOARD_CACHE_TTL, a Go duration, default 5s, "0" turns the
+// cache off) bounds how stale it can get through paths that don't, like
+// the archive command. Other instances drop theirs too (instancesync.go).
+
+var peopleCacheTTL = 5 * time.Second
+
+func loadPeopleCacheTTL() {
+	ttl := 5 * time.Second
+	if v := os.Getenv("LEADERBOARD_CACHE_TTL"); v != "" {
+		if d, err := time.ParseDuration(v); err == nil && d >= 0 {
+			ttl = d
+		}
+	}
+	configMu.Lock()
+	peopleCacheTTL = ttl
+	configMu.Unlock()
+	invalidatePeopleCache()
+}
+
+type peopleCacheKey struct {
+	sortOrder string
+	teamID    int
+}
+
+type peopleCacheEntry struct {
+	people []Person
+	at     time.Time
+}
+
+var peopleCache struct {
+	mu      sync.Mutex
+	gen     uint64 // bumped on every invalidation
+	entries map[peopleCacheKey]peopleCacheEntry
+	// The last full list loaded per key, whatever the TTL, kept through
+	// invalidations for serving while the database is down
+	lastGood map[peopleCacheKey]peopleCacheEntry
+}
+
+func invalidatePeopleCache() {
+	dropPeopleCache()
+	notifyInstances("people")
+}
+
+// Drop this instance's cached lists
+func dropPeopleCache() {
+	peopleCache.mu.Lock()
+	peopleCache.gen++
+	peopleCache.entries = nil
+	peopleCache.mu.Unlock()
+}
+
+// Called by loadPeoplePage with every full list it loads
+func rememberPeople(sortOrder string, teamID int, people []Person) {
+	peopleCache.mu.Lock()
+	defer peopleCache.mu.Unlock()
+	if peopleCache.lastGood == nil {
+		peopleCache.lastGood = make(map[peopleCacheKey]peopleCacheEntry)
+	}
+	peopleCache.lastGood[peopleCacheKey{sortOrder, teamID}] = peopleCacheEntry{people, time.Now()}
+}
+
+// One page of the last list loaded for the key and when it was loaded,
+// for when the database can't give a fresh one; ok is false if there is
+// none
+func stalePeoplePage(sortOrder string, teamID, limit, offset int) (people []Person, total int, at time.Time, ok bool) {
+	peopleCache.mu.Lock()
+	entry, ok := peopleCache.lastGood[peopleCacheKey{sortOrder, teamID}]
+	peopleCache.mu.Unlock()
+	if !ok {
+		return nil, 0, time.Time{}, false
+	}
+	total = len(entry.people)
+	start, end := min(offset, total), total
+	if limit > 0 {
+		end = min(start+limit, total)
+	}
+	return append([]Person(nil), entry.people[start:end]...), total, entry.at, true
+}
+
+// The full list for one sort order and team, from the cache when fresh.
+// ok is false when the cache is off; the caller then queries directly.
+func cachedPeople(ctx context.Context, sortOrder string, teamID int) (people []Person, ok bool, err error) {
+	configMu.RLock()
+	ttl := peopleCacheTTL
+	configMu.RUnlock()
+	if ttl <= 0 {
+		return nil, false, nil
+	}
+
+	key := peopleCacheKey{sortOrder, teamID}
+	peopleCache.mu.Lock()
+	entry, hit := peopleCache.entries[key]
+	gen := peopleCache.gen
+	peopleCache.mu.Unlock()
+	if hit && time.Since(entry.at) < ttl {
+		return entry.people, true, nil
+	}
+
+	people, _, err = loadPeoplePage(ctx, sortOrder, teamID, 0, 0)
+	if err != nil {
+		return nil, true, err
+	}
+	peopleCache.mu.Lock()
+	// A vote that landed while we were querying may be missing from the
+	// result, so only keep it if nothing was invalidated meanwhile
+	if peopleCache.gen == gen {
+		if peopleCache.entries == nil {
+			peopleCache.entries = make(map[peopleCacheKey]peopleCacheEntry)
+		}
+		peopleCache.entries[key] = peopleCacheEntry{people, time.Now()}
+	}
+	peopleCache.mu.Unlock()
+	return people, true, nil
+}
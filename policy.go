@@ -0,0 +1,124 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+
+	"macurate/validation"
+)
+
+// Voter name policies for votes and comments
+const (
+	namePolicyOptional  = "optional"  // voter decides whether to sign
+	namePolicyRequired  = "required"  // every vote must carry a display name
+	namePolicyAnonymous = "anonymous" // names are never stored or shown
+)
+
+// Helper to read current name policy from settings (defaults to "optional")
+func getNamePolicy() string {
+	switch p := getSetting("name_policy", namePolicyOptional); p {
+	case namePolicyRequired, namePolicyAnonymous:
+		return p
+	default:
+		return namePolicyOptional
+	}
+}
+
+// Whether a vote needs a comment. Only applies while comments are enabled.
+const (
+	commentPolicyOptional  = "optional"  // quick votes are fine
+	commentPolicyRequired  = "required"  // every vote explains itself
+	commentPolicyDownvotes = "downvotes" // optional for upvotes, required for downvotes
+)
+
+// Helper to read current comment policy from settings (defaults to "optional")
+func getCommentPolicy() string {
+	switch p := getSetting("comment_policy", commentPolicyOptional); p {
+	case commentPolicyRequired, commentPolicyDownvotes:
+		return p
+	default:
+		return commentPolicyOptional
+	}
+}
+
+// Whether a vote in this direction must come with a comment
+func commentRequired(policy string, up bool) bool {
+	if !getDisplayOptions().CommentsEnabled {
+		return false
+	}
+	return policy == commentPolicyRequired || (policy == commentPolicyDownvotes && !up)
+}
+
+// The refusal for a vote left without a comment it needed
+func commentRequiredError(policy string) APIError {
+	msg := "Add a comment to go with your vote."
+	if policy == commentPolicyDownvotes {
+		msg = "Downvotes need a comment: say what could be better."
+	}
+	return APIError{Code: "comment_required", Message: msg, Fields: validation.Errors{"comment": msg}}
+}
+
+// Apply the name policy to a submitted display name. Returns the name to store
+// (empty when none) or a client-facing error message.
+func resolveVoterName(policy, name string) (string, string) {
+	name = strings.TrimSpace(name)
+	switch policy {
+	case namePolicyAnonymous:
+		return "", ""
+	case namePolicyRequired:
+		if name == "" {
+			return "", "is required"
+		}
+	}
+	return name, ""
+}
+
+// Set the voter name policy (admin-only)
+func adminNamePolicyHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if !adminAuthorized(r) {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	var req adminNamePolicyRequest
+	if errs := bindAdminForm(r, &req); errs != nil {
+		renderAdmin(w, r, errs)
+		return
+	}
+
+	if err := setSetting("name_policy", req.Policy); err != nil {
+		serverError(w, r, err)
+		return
+	}
+
+	http.Redirect(w, r, "/admin", http.StatusSeeOther)
+}
+
+// Set whether votes need a comment (admin-only)
+func adminCommentPolicyHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if !adminAuthorized(r) {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	var req adminCommentPolicyRequest
+	if errs := bindAdminForm(r, &req); errs != nil {
+		renderAdmin(w, r, errs)
+		return
+	}
+
+	if err := setSetting("comment_policy", req.CommentPolicy); err != nil {
+		serverError(w, r, err)
+		return
+	}
+
+	http.Redirect(w, r, "/admin", http.StatusSeeOther)
+}
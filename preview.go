@@ -0,0 +1,123 @@
+package main
+
+import (
+	"context"
+	"strings"
+	"time"
+)
+
+// PreviewComment is a comment as the API exposes it: the teaser on a
+// leaderboard card or an entry in a person's recent comments.
+type PreviewComment struct {
+	ID        int       `json:"id"`
+	Upvote    bool      `json:"upvote"`
+	Text      string    `json:"text"`
+	Author    string    `json:"author,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+	Edited    bool      `json:"edited"`
+	Replies   []Reply   `json:"replies"`
+}
+
+// Each person's best comment: the most tagged, newest breaking ties
+func previewComments(ctx context.Context) (map[int]PreviewComment, error) {
+	rows, err := db.QueryContext(ctx, `
+        SELECT DISTINCT ON (v.person_id)
+               v.person_id, v.id, v.upvote, v.comment, COALESCE(v.voter_name, ''), v.created_at,
+               v.edited_at IS NOT NULL
+        FROM votes v
+        LEFT JOIN vote_tags vt ON vt.vote_id = v.id
+        WHERE COALESCE(TRIM(v.comment), '') <> '' AND v.status = 'approved'
+        GROUP BY v.id
+        ORDER BY v.person_id, COUNT(vt.tag_id) DESC, v.id DESC`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	anonymous := getNamePolicy() == namePolicyAnonymous
+	previews := map[int]PreviewComment{}
+	var ids []int
+	for rows.Next() {
+		var personID int
+		var c PreviewComment
+		if err := rows.Scan(&personID, &c.ID, &c.Upvote, &c.Text, &c.Author, &c.CreatedAt, &c.Edited); err != nil {
+			return nil, err
+		}
+		if anonymous {
+			c.Author = ""
+		}
+		previews[personID] = c
+		ids = append(ids, c.ID)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	replies, err := repliesByVote(ctx, ids)
+	if err != nil {
+		return nil, err
+	}
+	for personID, c := range previews {
+		c.Replies = replies[c.ID]
+		if c.Replies == nil {
+			c.Replies = []Reply{}
+		}
+		previews[personID] = c
+	}
+	return previews, nil
+}
+
+// A person's newest n comments, with replies
+func recentComments(ctx context.Context, personID, n int) ([]PreviewComment, error) {
+	rows, err := db.QueryContext(ctx, `
+        SELECT id, upvote, comment, COALESCE(voter_name, ''), created_at, edited_at IS NOT NULL
+        FROM votes
+        WHERE person_id = $1 AND COALESCE(TRIM(comment), '') <> '' AND status = 'approved'
+        ORDER BY id DESC
+        LIMIT $2`, personID, n)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	anonymous := getNamePolicy() == namePolicyAnonymous
+	list := []PreviewComment{}
+	var ids []int
+	for rows.Next() {
+		var c PreviewComment
+		if err := rows.Scan(&c.ID, &c.Upvote, &c.Text, &c.Author, &c.CreatedAt, &c.Edited); err != nil {
+			return nil, err
+		}
+		if anonymous {
+			c.Author = ""
+		}
+		list = append(list, c)
+		ids = append(ids, c.ID)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	replies, err := repliesByVote(ctx, ids)
+	if err != nil {
+		return nil, err
+	}
+	for i := range list {
+		list[i].Replies = replies[list[i].ID]
+		if list[i].Replies == nil {
+			list[i].Replies = []Reply{}
+		}
+	}
+	return list, nil
+}
+
+// Parse ?include=a,b into a set
+func parseInclude(raw string) map[string]bool {
+	set := map[string]bool{}
+	for _, part := range strings.Split(raw, ",") {
+		if part = strings.TrimSpace(part); part != "" {
+			set[part] = true
+		}
+	}
+	return set
+}
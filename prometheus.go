@@ -0,0 +1,172 @@
+package main
+
+import (
+	"bufio"
+	"crypto/subtle"
+	"fmt"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Prometheus text exposition at GET /metrics: request counts and latency
+// per route since start, vote and comment totals from the database, and
+// connection pool stats. METRICS_TOKEN, when set, must be sent as a bearer
+// token; scrape from inside the network otherwise.
+
+var latencyBounds = [...]float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+type requestKey struct {
+	route  string
+	status int
+}
+
+// Cumulative histogram in seconds. Callers hold metrics.mu.
+type latencyHistogram struct {
+	counts [len(latencyBounds)]uint64
+	count  uint64
+	sum    float64
+}
+
+func (h *latencyHistogram) observe(d time.Duration) {
+	s := d.Seconds()
+	for i, b := range latencyBounds {
+		if s <= b {
+			h.counts[i]++
+		}
+	}
+	h.count++
+	h.sum += s
+}
+
+func promLabel(v string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(v)
+}
+
+func promFloat(f float64) string {
+	return strconv.FormatFloat(f, 'g', -1, 64)
+}
+
+type voteTotals struct {
+	Up, Down, Comments, Pending int64
+}
+
+func queryVoteTotals(r *http.Request) (voteTotals, error) {
+	var t voteTotals
+	err := db.QueryRowContext(r.Context(), `
+        SELECT COUNT(*) FILTER (WHERE upvote IS TRUE),
+               COUNT(*) FILTER (WHERE upvote IS FALSE),
+               COUNT(*) FILTER (WHERE upvote IS NOT NULL AND COALESCE(TRIM(comment), '') <> '' AND status = 'approved'),
+               COUNT(*) FILTER (WHERE status = 'pending')
+        FROM votes`).Scan(&t.Up, &t.Down, &t.Comments, &t.Pending)
+	return t, err
+}
+
+func prometheusHandler(w http.ResponseWriter, r *http.Request) {
+	if token := os.Getenv("METRICS_TOKEN"); token != "" {
+		got := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if subtle.ConstantTimeCompare([]byte(got), []byte(token)) != 1 {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+	}
+	votes, err := queryVoteTotals(r)
+	if err != nil {
+		serverError(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	out := bufio.NewWriter(w)
+	defer out.Flush()
+
+	metrics.mu.Lock()
+	keys := make([]requestKey, 0, len(metrics.requests))
+	for k := range metrics.requests {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].route != keys[j].route {
+			return keys[i].route < keys[j].route
+		}
+		return keys[i].status < keys[j].status
+	})
+	fmt.Fprintln(out, "# HELP macurate_http_requests_total Responses by route pattern and status code.")
+	fmt.Fprintln(out, "# TYPE macurate_http_requests_total counter")
+	for _, k := range keys {
+		fmt.Fprintf(out, "macurate_http_requests_total{route=\"%s\",code=\"%d\"} %d\n", promLabel(k.route), k.status, metrics.requests[k])
+	}
+
+	routes := make([]string, 0, len(metrics.latency))
+	for route := range metrics.latency {
+		routes = append(routes, route)
+	}
+	sort.Strings(routes)
+	fmt.Fprintln(out, "# HELP macurate_http_request_duration_seconds Time to serve a request by route pattern.")
+	fmt.Fprintln(out, "# TYPE macurate_http_request_duration_seconds histogram")
+	for _, route := range routes {
+		h, label := metrics.latency[route], promLabel(route)
+		for i, b := range latencyBounds {
+			fmt.Fprintf(out, "macurate_http_request_duration_seconds_bucket{route=\"%s\",le=\"%s\"} %d\n", label, promFloat(b), h.counts[i])
+		}
+		fmt.Fprintf(out, "macurate_http_request_duration_seconds_bucket{route=\"%s\",le=\"+Inf\"} %d\n", label, h.count)
+		fmt.Fprintf(out, "macurate_http_request_duration_seconds_sum{route=\"%s\"} %s\n", label, promFloat(h.sum))
+		fmt.Fprintf(out, "macurate_http_request_duration_seconds_count{route=\"%s\"} %d\n", label, h.count)
+	}
+	metrics.mu.Unlock()
+
+	fmt.Fprintln(out, "# HELP macurate_votes Votes currently counted, by direction.")
+	fmt.Fprintln(out, "# TYPE macurate_votes gauge")
+	fmt.Fprintf(out, "macurate_votes{direction=\"up\"} %d\n", votes.Up)
+	fmt.Fprintf(out, "macurate_votes{direction=\"down\"} %d\n", votes.Down)
+	fmt.Fprintln(out, "# HELP macurate_comments Published comments.")
+	fmt.Fprintln(out, "# TYPE macurate_comments gauge")
+	fmt.Fprintf(out, "macurate_comments %d\n", votes.Comments)
+	fmt.Fprintln(out, "# HELP macurate_comments_pending Comments waiting for moderation.")
+	fmt.Fprintln(out, "# TYPE macurate_comments_pending gauge")
+	fmt.Fprintf(out, "macurate_comments_pending %d\n", votes.Pending)
+
+	st := db.Stats()
+	fmt.Fprintln(out, "# HELP macurate_db_connections Database pool connections by state.")
+	fmt.Fprintln(out, "# TYPE macurate_db_connections gauge")
+	fmt.Fprintf(out, "macurate_db_connections{state=\"in_use\"} %d\n", st.InUse)
+	fmt.Fprintf(out, "macurate_db_connections{state=\"idle\"} %d\n", st.Idle)
+	fmt.Fprintln(out, "# HELP macurate_db_connections_max Pool limit (DB_MAX_OPEN_CONNS).")
+	fmt.Fprintln(out, "# TYPE macurate_db_connections_max gauge")
+	fmt.Fprintf(out, "macurate_db_connections_max %d\n", st.MaxOpenConnections)
+	fmt.Fprintln(out, "# HELP macurate_db_wait_total Times a query had to wait for a free connection.")
+	fmt.Fprintln(out, "# TYPE macurate_db_wait_total counter")
+	fmt.Fprintf(out, "macurate_db_wait_total %d\n", st.WaitCount)
+	fmt.Fprintln(out, "# HELP macurate_db_wait_seconds_total Time spent waiting for a free connection.")
+	fmt.Fprintln(out, "# TYPE macurate_db_wait_seconds_total counter")
+	fmt.Fprintf(out, "macurate_db_wait_seconds_total %s\n", promFloat(st.WaitDuration.Seconds()))
+
+	rt := events.stats()
+	fmt.Fprintln(out, "# HELP macurate_realtime_clients Open event streams (kiosks, live pages).")
+	fmt.Fprintln(out, "# TYPE macurate_realtime_clients gauge")
+	fmt.Fprintf(out, "macurate_realtime_clients %d\n", rt.Clients)
+	fmt.Fprintln(out, "# HELP macurate_realtime_queued_events Events buffered for clients that haven't read them yet.")
+	fmt.Fprintln(out, "# TYPE macurate_realtime_queued_events gauge")
+	fmt.Fprintf(out, "macurate_realtime_queued_events %d\n", rt.Queued)
+	fmt.Fprintln(out, "# HELP macurate_realtime_dropped_events_total Events skipped because a client's queue was full.")
+	fmt.Fprintln(out, "# TYPE macurate_realtime_dropped_events_total counter")
+	fmt.Fprintf(out, "macurate_realtime_dropped_events_total %d\n", rt.Dropped)
+	fmt.Fprintln(out, "# HELP macurate_realtime_slow_disconnects_total Clients cut off for lagging too far behind.")
+	fmt.Fprintln(out, "# TYPE macurate_realtime_slow_disconnects_total counter")
+	fmt.Fprintf(out, "macurate_realtime_slow_disconnects_total %d\n", rt.SlowDisconnect)
+	fmt.Fprintln(out, "# HELP macurate_realtime_rejected_total Streams refused at the client cap.")
+	fmt.Fprintln(out, "# TYPE macurate_realtime_rejected_total counter")
+	fmt.Fprintf(out, "macurate_realtime_rejected_total %d\n", rt.Rejected)
+
+	dbStatsMu.Lock()
+	size := lastDBStats.Bytes
+	dbStatsMu.Unlock()
+	if size > 0 {
+		fmt.Fprintln(out, "# HELP macurate_db_size_bytes Database size at the last maintenance sample.")
+		fmt.Fprintln(out, "# TYPE macurate_db_size_bytes gauge")
+		fmt.Fprintf(out, "macurate_db_size_bytes %d\n", size)
+	}
+}
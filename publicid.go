@@ -0,0 +1,164 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+
+	"macurate/validation"
+)
+
+// Opaque public ids for people. Integer ids give away how many people are
+// on the board and invite walking through /images/1, /images/2, ...; URLs
+// and API payloads use people.public_id instead, a ULID by default or a
+// random UUID with PUBLIC_ID_FORMAT=uuid (only new ids follow a change).
+// The integer id stays the key inside the database and never leaves it:
+// every payload, event and webhook names a person by public_id. Every
+// place that takes a person from a URL, form or ballot still accepts the
+// integer id, so old links and clients keep working.
+
+var errUnknownPerson = errors.New("unknown person")
+
+const crockford = "0123456789ABCDEFGHJKMNPQRSTVWXYZ"
+
+func newPublicID() string {
+	if os.Getenv("PUBLIC_ID_FORMAT") == "uuid" {
+		return newUUID()
+	}
+	return newULID()
+}
+
+// 48 bits of milliseconds and 80 random bits in Crockford base32, so ids
+// sort by creation time
+func newULID() string {
+	var b [16]byte
+	ms := uint64(time.Now().UnixMilli())
+	for i := range 6 {
+		b[i] = byte(ms >> (40 - 8*i))
+	}
+	rand.Read(b[6:])
+	hi, lo := uint64(0), uint64(0)
+	for i := range 8 {
+		hi = hi<<8 | uint64(b[i])
+		lo = lo<<8 | uint64(b[8+i])
+	}
+	out := make([]byte, 26)
+	for i := 25; i >= 0; i-- {
+		out[i] = crockford[lo&31]
+		lo = lo>>5 | hi<<59
+		hi >>= 5
+	}
+	return string(out)
+}
+
+// Random (version 4) UUID
+func newUUID() string {
+	var b [16]byte
+	rand.Read(b[:])
+	b[6] = b[6]&0x0f | 0x40
+	b[8] = b[8]&0x3f | 0x80
+	h := hex.EncodeToString(b[:])
+	return h[:8] + "-" + h[8:12] + "-" + h[12:16] + "-" + h[16:20] + "-" + h[20:]
+}
+
+// Give everyone who doesn't have one yet a public id. Runs at startup,
+// after the migration that added the column, and catches people added by
+// an older instance during a rolling deploy.
+func assignPublicIDs() error {
+	rows, err := db.Query("SELECT id FROM people WHERE public_id IS NULL")
+	if err != nil {
+		return err
+	}
+	var ids []int
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return err
+		}
+		ids = append(ids, id)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	for _, id := range ids {
+		if _, err := db.Exec("UPDATE people SET public_id = $2 WHERE id = $1 AND public_id IS NULL", id, newPublicID()); err != nil {
+			return err
+		}
+	}
+	if len(ids) > 0 {
+		slog.Info("assigned public ids", "people", len(ids))
+	}
+	return nil
+}
+
+// The internal id of the person a URL or form names, by public id or by
+// the integer id older links use; errUnknownPerson if there is no such
+// public id. Integer ids aren't checked here, as before.
+func resolvePersonRef(ctx context.Context, ref string) (int, error) {
+	if id, err := strconv.Atoi(ref); err == nil {
+		if id <= 0 {
+			return 0, errUnknownPerson
+		}
+		return id, nil
+	}
+	var id int
+	err := db.QueryRowContext(ctx, "SELECT id FROM people WHERE public_id = $1", ref).Scan(&id)
+	if err == sql.ErrNoRows {
+		return 0, errUnknownPerson
+	}
+	return id, err
+}
+
+// The public id of person id, for event and webhook payloads; "" when they
+// are gone or it can't be read
+func publicIDOf(ctx context.Context, id int) string {
+	var publicID string
+	err := db.QueryRowContext(ctx, "SELECT COALESCE(public_id, '') FROM people WHERE id = $1", id).Scan(&publicID)
+	if err != nil && err != sql.ErrNoRows {
+		slog.WarnContext(ctx, "public id lookup failed", "person", id, "err", err)
+	}
+	return publicID
+}
+
+// A person named in a JSON body: a public id, or the bare integer id older
+// clients send, kept as its decimal string for resolvePersonRef
+type personRef string
+
+func (p *personRef) UnmarshalJSON(b []byte) error {
+	var s string
+	if err := json.Unmarshal(b, &s); err == nil {
+		*p = personRef(s)
+		return nil
+	}
+	var n int
+	if err := json.Unmarshal(b, &n); err != nil {
+		return errors.New("expected a public id")
+	}
+	*p = personRef(strconv.Itoa(n))
+	return nil
+}
+
+// Resolve a person_id bound from a request into *id. On failure the error
+// response has already been written and ok is false.
+func resolveRequestPerson(w http.ResponseWriter, r *http.Request, ref string, id *int) bool {
+	var err error
+	*id, err = resolvePersonRef(r.Context(), ref)
+	if err == errUnknownPerson {
+		writeValidationError(w, validation.Errors{"person_id": "is not on this board"})
+		return false
+	} else if err != nil {
+		serverError(w, r, err)
+		return false
+	}
+	return true
+}
@@ -0,0 +1,42 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestPersonRefUnmarshal(t *testing.T) {
+	tests := []struct {
+		in   string
+		want []personRef
+		ok   bool
+	}{
+		{`["01HZX3K5Q8R9T0V1W2X3Y4Z5A6"]`, []personRef{"01HZX3K5Q8R9T0V1W2X3Y4Z5A6"}, true},
+		{`[12, 7]`, []personRef{"12", "7"}, true},
+		{`["01HZX3K5Q8R9T0V1W2X3Y4Z5A6", 3]`, []personRef{"01HZX3K5Q8R9T0V1W2X3Y4Z5A6", "3"}, true},
+		{`[1.5]`, nil, false},
+		{`[true]`, nil, false},
+		{`[{"id": 1}]`, nil, false},
+	}
+	for _, tt := range tests {
+		var got []personRef
+		err := json.Unmarshal([]byte(tt.in), &got)
+		if (err == nil) != tt.ok {
+			t.Errorf("Unmarshal(%s): err = %v, want ok %v", tt.in, err, tt.ok)
+			continue
+		}
+		if !tt.ok {
+			continue
+		}
+		if len(got) != len(tt.want) {
+			t.Errorf("Unmarshal(%s) = %q, want %q", tt.in, got, tt.want)
+			continue
+		}
+		for i := range got {
+			if got[i] != tt.want[i] {
+				t.Errorf("Unmarshal(%s) = %q, want %q", tt.in, got, tt.want)
+				break
+			}
+		}
+	}
+}
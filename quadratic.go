@@ -0,0 +1,170 @@
+package main
+
+import (
+	"database/sql"
+	"net/http"
+	"strconv"
+)
+
+// Voting modes
+const (
+	votingModeUpDown    = "updown"
+	votingModeQuadratic = "quadratic"
+)
+
+const defaultQuadraticBudget = 100
+
+// Helper to read current voting mode from settings (defaults to "updown")
+func getVotingMode() string {
+	if getSetting("voting_mode", votingModeUpDown) == votingModeQuadratic {
+		return votingModeQuadratic
+	}
+	return votingModeUpDown
+}
+
+// Credit budget each voter gets in quadratic mode
+func getQuadraticBudget() int {
+	n, err := strconv.Atoi(getSetting("qv_budget", strconv.Itoa(defaultQuadraticBudget)))
+	if err != nil || n <= 0 {
+		return defaultQuadraticBudget
+	}
+	return n
+}
+
+// Casting n votes on the same person costs n² credits in total, so the
+// n-th vote costs n² - (n-1)² = 2n-1.
+func quadraticCost(n int) int {
+	return n * n
+}
+
+// CreditUsage is a voter's spend on one person.
+type CreditUsage struct {
+	PersonID int    `json:"-"`
+	PublicID string `json:"public_id"`
+	Votes    int    `json:"votes"`
+	Cost     int    `json:"cost"`
+	NextCost int    `json:"next_cost"`
+}
+
+type querier interface {
+	Query(query string, args ...interface{}) (*sql.Rows, error)
+}
+
+// Credits spent by a voter, broken down per person
+func voterCreditUsage(q querier, voterID string) ([]CreditUsage, int, error) {
+	rows, err := q.Query(
+		`SELECT v.person_id, COALESCE(p.public_id, ''), COUNT(*)
+         FROM votes v JOIN people p ON p.id = v.person_id
+         WHERE v.voter_id = $1 AND v.upvote IS NOT NULL
+         GROUP BY v.person_id, p.public_id ORDER BY v.person_id`,
+		voterID,
+	)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	usage := []CreditUsage{}
+	spent := 0
+	for rows.Next() {
+		var u CreditUsage
+		if err := rows.Scan(&u.PersonID, &u.PublicID, &u.Votes); err != nil {
+			return nil, 0, err
+		}
+		u.Cost = quadraticCost(u.Votes)
+		u.NextCost = quadraticCost(u.Votes+1) - u.Cost
+		spent += u.Cost
+		usage = append(usage, u)
+	}
+	return usage, spent, rows.Err()
+}
+
+// Charge the next vote on personID against the voter's budget inside tx.
+// Returns false when the voter can't afford it.
+func chargeQuadraticVote(tx *sql.Tx, voterID string, personID int) (bool, error) {
+	// Serialize concurrent votes from the same voter
+	if _, err := tx.Exec("SELECT pg_advisory_xact_lock(hashtext($1))", voterID); err != nil {
+		return false, err
+	}
+	usage, spent, err := voterCreditUsage(tx, voterID)
+	if err != nil {
+		return false, err
+	}
+	next := quadraticCost(1)
+	for _, u := range usage {
+		if u.PersonID == personID {
+			next = u.NextCost
+		}
+	}
+	return spent+next <= getQuadraticBudget(), nil
+}
+
+// Remaining quadratic voting credits for the current voter
+func apiCreditsHandler(w http.ResponseWriter, r *http.Request) {
+	budget := getQuadraticBudget()
+	resp := map[string]interface{}{
+		"mode":       getVotingMode(),
+		"budget":     budget,
+		"spent":      0,
+		"remaining":  budget,
+		"per_person": []CreditUsage{},
+	}
+	if voterID := currentVoterID(r); voterID != "" {
+		usage, spent, err := voterCreditUsage(db, voterID)
+		if err != nil {
+			serverError(w, r, err)
+			return
+		}
+		resp["spent"] = spent
+		resp["remaining"] = budget - spent
+		resp["per_person"] = usage
+	}
+	w.Header().Set("Cache-Control", "no-store")
+	writeJSON(w, http.StatusOK, resp)
+}
+
+// Set the voting mode and quadratic budget (admin-only)
+func adminVotingModeHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if !adminAuthorized(r) {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	var req adminVotingModeRequest
+	if errs := bindAdminForm(r, &req); errs != nil {
+		renderAdmin(w, r, errs)
+		return
+	}
+	if req.Budget == 0 {
+		req.Budget = defaultQuadraticBudget
+	}
+
+	if err := setSetting("voting_mode", req.Mode); err != nil {
+		serverError(w, r, err)
+		return
+	}
+	if req.VoteType == "" {
+		req.VoteType = voteTypeUpDown
+	}
+	if err := setSetting("vote_type", req.VoteType); err != nil {
+		serverError(w, r, err)
+		return
+	}
+	if err := setSetting("qv_budget", strconv.Itoa(req.Budget)); err != nil {
+		serverError(w, r, err)
+		return
+	}
+	if req.Dedup == "" {
+		req.Dedup = dedupOff
+	}
+	if err := setSetting("vote_dedup", req.Dedup); err != nil {
+		serverError(w, r, err)
+		return
+	}
+
+	http.Redirect(w, r, "/admin", http.StatusSeeOther)
+}
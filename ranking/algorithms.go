@@ -0,0 +1,139 @@
+package ranking
+
+import (
+	"math"
+	"strings"
+	"time"
+)
+
+func init() {
+	Register("net", netScore{})
+	Register("approval", approval{})
+	Register("wilson", wilson{})
+	Register("elo", elo{})
+	Register("hot", hot{})
+}
+
+type netScore struct{}
+
+func (netScore) New(id int, name string) Entry { return Entry{ID: id, Name: name} }
+func (netScore) ApplyVote(e *Entry, v Vote)    { Count(e, v) }
+
+func (netScore) Rank(e Entry, _ time.Time) float64 { return float64(e.Upvotes - e.Downvotes) }
+
+// Same order as the board's score sort: score, then name
+func (n netScore) Compare(a, b Entry, now time.Time) int {
+	if d := n.Rank(b, now) - n.Rank(a, now); d != 0 {
+		return int(math.Copysign(1, d))
+	}
+	return strings.Compare(a.Name, b.Name)
+}
+
+type approval struct{}
+
+func (approval) New(id int, name string) Entry { return Entry{ID: id, Name: name} }
+func (approval) ApplyVote(e *Entry, v Vote)    { Count(e, v) }
+
+func (approval) Rank(e Entry, _ time.Time) float64 {
+	n := e.Upvotes + e.Downvotes
+	if n == 0 {
+		return 0
+	}
+	return float64(e.Upvotes) / float64(n)
+}
+
+func (p approval) Compare(a, b Entry, now time.Time) int { return ByRank(p, a, b, now) }
+
+// z for a 95% interval
+const wilsonZ = 1.96
+
+type wilson struct{}
+
+func (wilson) New(id int, name string) Entry { return Entry{ID: id, Name: name} }
+func (wilson) ApplyVote(e *Entry, v Vote)    { Count(e, v) }
+
+// Few votes give a wide interval and so a low bound: one upvote doesn't
+// beat ninety out of a hundred
+func (wilson) Rank(e Entry, _ time.Time) float64 {
+	n := float64(e.Upvotes + e.Downvotes)
+	if n == 0 {
+		return 0
+	}
+	p := float64(e.Upvotes) / n
+	z2 := wilsonZ * wilsonZ
+	return (p + z2/(2*n) - wilsonZ*math.Sqrt((p*(1-p)+z2/(4*n))/n)) / (1 + z2/n)
+}
+
+func (w wilson) Compare(a, b Entry, now time.Time) int { return ByRank(w, a, b, now) }
+
+// EloStart is the Elo rating of someone who hasn't played yet.
+const EloStart = 1500
+
+const eloK = 32
+
+type elo struct{}
+
+func (elo) New(id int, name string) Entry { return Entry{ID: id, Name: name, Value: EloStart} }
+
+// An upvote is a win and a downvote a loss against a player rated
+// EloStart, so ratings move less the further they are from the middle
+func (elo) ApplyVote(e *Entry, v Vote) {
+	Count(e, v)
+	result := 0.0
+	if v.Up {
+		result = 1
+	}
+	e.Value += eloK * (result - eloExpected(e.Value, EloStart))
+}
+
+// EloDuel returns the ratings after the player rated winner beat the one
+// rated loser; what one gains the other loses.
+func EloDuel(winner, loser float64) (float64, float64) {
+	gain := eloK * (1 - eloExpected(winner, loser))
+	return winner + gain, loser - gain
+}
+
+// Chance a player rated a beats one rated b
+func eloExpected(a, b float64) float64 {
+	return 1 / (1 + math.Pow(10, (b-a)/400))
+}
+
+func (elo) Rank(e Entry, _ time.Time) float64 { return e.Value }
+
+func (x elo) Compare(a, b Entry, now time.Time) int { return ByRank(x, a, b, now) }
+
+// HotHalfLife is how long a vote takes to count half as much in "hot".
+const HotHalfLife = 24 * time.Hour
+
+type hot struct{}
+
+func (hot) New(id int, name string) Entry { return Entry{ID: id, Name: name} }
+
+// Value is the decayed net vote as of LastVote
+func (hot) ApplyVote(e *Entry, v Vote) {
+	if !e.LastVote.IsZero() {
+		e.Value *= hotDecay(v.At.Sub(e.LastVote))
+	}
+	Count(e, v)
+	if v.Up {
+		e.Value++
+	} else {
+		e.Value--
+	}
+}
+
+func (hot) Rank(e Entry, now time.Time) float64 {
+	if e.LastVote.IsZero() {
+		return 0
+	}
+	return e.Value * hotDecay(now.Sub(e.LastVote))
+}
+
+func (h hot) Compare(a, b Entry, now time.Time) int { return ByRank(h, a, b, now) }
+
+func hotDecay(d time.Duration) float64 {
+	if d <= 0 {
+		return 1
+	}
+	return math.Exp2(-d.Hours() / HotHalfLife.Hours())
+}
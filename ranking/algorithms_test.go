@@ -0,0 +1,169 @@
+package ranking
+
+import (
+	"math"
+	"slices"
+	"testing"
+	"time"
+)
+
+var testNow = time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+
+// An entry for alg with ups upvotes then downs downvotes, an hour apart,
+// the last one at testNow
+func entryWith(alg Algorithm, name string, ups, downs int) Entry {
+	e := alg.New(0, name)
+	at := testNow.Add(-time.Duration(ups+downs-1) * time.Hour)
+	for i := 0; i < ups+downs; i++ {
+		alg.ApplyVote(&e, Vote{Up: i < ups, At: at})
+		at = at.Add(time.Hour)
+	}
+	return e
+}
+
+func mustLookup(t *testing.T, name string) Algorithm {
+	t.Helper()
+	alg, ok := Lookup(name)
+	if !ok {
+		t.Fatalf("algorithm %q is not registered", name)
+	}
+	return alg
+}
+
+func TestRank(t *testing.T) {
+	tests := []struct {
+		alg       string
+		ups, down int
+		want      float64
+	}{
+		{"net", 0, 0, 0},
+		{"net", 5, 2, 3},
+		{"net", 1, 4, -3},
+		{"approval", 0, 0, 0},
+		{"approval", 3, 1, 0.75},
+		{"approval", 0, 2, 0},
+		{"wilson", 0, 0, 0},
+		{"wilson", 1, 0, 0.2065},
+		{"wilson", 90, 10, 0.8256},
+		{"wilson", 0, 5, 0},
+		{"hot", 0, 0, 0},
+		{"hot", 1, 0, 1},
+		{"hot", 0, 1, -1},
+	}
+	for _, tt := range tests {
+		alg := mustLookup(t, tt.alg)
+		got := alg.Rank(entryWith(alg, "a", tt.ups, tt.down), testNow)
+		if math.Abs(got-tt.want) > 1e-4 {
+			t.Errorf("%s with %d up, %d down: Rank = %.4f, want %.4f", tt.alg, tt.ups, tt.down, got, tt.want)
+		}
+	}
+}
+
+func TestHotDecay(t *testing.T) {
+	tests := []struct {
+		age  time.Duration
+		want float64
+	}{
+		{-time.Hour, 1},
+		{0, 1},
+		{HotHalfLife, 0.5},
+		{2 * HotHalfLife, 0.25},
+	}
+	for _, tt := range tests {
+		if got := hotDecay(tt.age); math.Abs(got-tt.want) > 1e-9 {
+			t.Errorf("hotDecay(%v) = %v, want %v", tt.age, got, tt.want)
+		}
+	}
+
+	// An upvote a half-life old counts half by now
+	alg := mustLookup(t, "hot")
+	e := alg.New(0, "a")
+	alg.ApplyVote(&e, Vote{Up: true, At: testNow.Add(-HotHalfLife)})
+	if got := alg.Rank(e, testNow); math.Abs(got-0.5) > 1e-9 {
+		t.Errorf("day-old upvote ranks %v, want 0.5", got)
+	}
+}
+
+func TestSort(t *testing.T) {
+	type votes struct {
+		name      string
+		ups, down int
+	}
+	board := []votes{{"dee", 0, 3}, {"cy", 1, 0}, {"bo", 1, 1}, {"ada", 8, 2}, {"eve", 2, 0}}
+	tests := []struct {
+		alg  string
+		want []string
+	}{
+		// Score, then name
+		{"net", []string{"ada", "eve", "cy", "bo", "dee"}},
+		// Equal shares go to whoever has more votes
+		{"approval", []string{"eve", "cy", "ada", "bo", "dee"}},
+		// Two or one lone upvotes don't beat 8 out of 10
+		{"wilson", []string{"ada", "eve", "cy", "bo", "dee"}},
+	}
+	for _, tt := range tests {
+		alg := mustLookup(t, tt.alg)
+		var entries []Entry
+		for _, v := range board {
+			entries = append(entries, entryWith(alg, v.name, v.ups, v.down))
+		}
+		Sort(alg, entries, testNow)
+		got := make([]string, len(entries))
+		for i, e := range entries {
+			got[i] = e.Name
+		}
+		if !slices.Equal(got, tt.want) {
+			t.Errorf("%s: order %v, want %v", tt.alg, got, tt.want)
+		}
+	}
+}
+
+func TestNames(t *testing.T) {
+	want := []string{"approval", "elo", "hot", "net", "wilson"}
+	if got := Names(); !slices.Equal(got, want) {
+		t.Errorf("Names() = %v, want %v", got, want)
+	}
+}
+
+func TestEloDuel(t *testing.T) {
+	tests := []struct {
+		winner, loser         float64
+		wantWinner, wantLoser float64
+	}{
+		// Even players split the K factor
+		{1500, 1500, 1516, 1484},
+		// Beating a much stronger player is worth nearly all of it
+		{1100, 1900, 1131.68, 1868.32},
+		// Beating a much weaker one is worth almost nothing
+		{1900, 1100, 1900.32, 1099.68},
+	}
+	for _, tt := range tests {
+		w, l := EloDuel(tt.winner, tt.loser)
+		if math.Abs(w-tt.wantWinner) > 0.01 || math.Abs(l-tt.wantLoser) > 0.01 {
+			t.Errorf("EloDuel(%v, %v) = %.2f, %.2f, want %.2f, %.2f", tt.winner, tt.loser, w, l, tt.wantWinner, tt.wantLoser)
+		}
+		if math.Abs((w+l)-(tt.winner+tt.loser)) > 1e-9 {
+			t.Errorf("EloDuel(%v, %v): ratings don't add up, %v + %v", tt.winner, tt.loser, w, l)
+		}
+	}
+}
+
+func TestEloVotes(t *testing.T) {
+	tests := []struct {
+		ups, down int
+		want      float64
+	}{
+		{0, 0, EloStart},
+		{1, 0, 1516},
+		{0, 1, 1484},
+		// A second win is worth a little less: they are already rated higher
+		{2, 0, 1531.26},
+	}
+	alg := mustLookup(t, "elo")
+	for _, tt := range tests {
+		got := alg.Rank(entryWith(alg, "a", tt.ups, tt.down), testNow)
+		if math.Abs(got-tt.want) > 0.01 {
+			t.Errorf("elo with %d up, %d down = %.2f, want %.2f", tt.ups, tt.down, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,104 @@
+// Package ranking turns votes into an order of people.
+//
+// An Algorithm folds each person's votes, oldest first, into an Entry with
+// ApplyVote, gives the value people are ranked by with Rank, and breaks
+// the order down to a pair with Compare. Implementations register under a
+// name, and the board picks one by that name, so a new algorithm only has
+// to be added here:
+//
+//	net       upvotes minus downvotes (the board's score)
+//	approval  share of votes that are upvotes
+//	wilson    lower bound of the 95% Wilson interval for the approval share
+//	elo       Elo rating, each vote a game against an average opponent
+//	hot       net votes, each losing half its weight every HotHalfLife
+package ranking
+
+import (
+	"cmp"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Vote is one vote as the algorithms see it.
+type Vote struct {
+	Up bool
+	At time.Time
+}
+
+// Entry is one person being ranked. Algorithms keep their running state
+// in Value and LastVote.
+type Entry struct {
+	ID        int
+	Name      string
+	Upvotes   int
+	Downvotes int
+	Value     float64   // algorithm state, e.g. a rating
+	LastVote  time.Time // of the latest vote applied
+}
+
+// Algorithm is a way of ranking people.
+type Algorithm interface {
+	// New returns the entry for someone without votes.
+	New(id int, name string) Entry
+	// ApplyVote adds one vote to e; votes come oldest first.
+	ApplyVote(e *Entry, v Vote)
+	// Rank is the value e is ranked by at now; higher ranks first.
+	Rank(e Entry, now time.Time) float64
+	// Compare is negative when a ranks above b at now.
+	Compare(a, b Entry, now time.Time) int
+}
+
+var registry = map[string]Algorithm{}
+
+// Register makes an algorithm available by name; it panics on a duplicate.
+func Register(name string, a Algorithm) {
+	if _, dup := registry[name]; dup {
+		panic("ranking: " + name + " registered twice")
+	}
+	registry[name] = a
+}
+
+// Lookup returns the algorithm registered under name.
+func Lookup(name string) (Algorithm, bool) {
+	a, ok := registry[name]
+	return a, ok
+}
+
+// Names lists the registered algorithms, sorted.
+func Names() []string {
+	names := make([]string, 0, len(registry))
+	for name := range registry {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Sort orders entries by a at now, best first.
+func Sort(a Algorithm, entries []Entry, now time.Time) {
+	slices.SortStableFunc(entries, func(x, y Entry) int { return a.Compare(x, y, now) })
+}
+
+// ByRank is the usual Compare: higher Rank first, then more votes, then
+// by name.
+func ByRank(a Algorithm, x, y Entry, now time.Time) int {
+	if c := cmp.Compare(a.Rank(y, now), a.Rank(x, now)); c != 0 {
+		return c
+	}
+	if c := cmp.Compare(y.Upvotes+y.Downvotes, x.Upvotes+x.Downvotes); c != 0 {
+		return c
+	}
+	return strings.Compare(x.Name, y.Name)
+}
+
+// Count adds a vote to the up/down tallies; every ApplyVote starts with it.
+func Count(e *Entry, v Vote) {
+	if v.Up {
+		e.Upvotes++
+	} else {
+		e.Downvotes++
+	}
+	e.LastVote = v.At
+}
@@ -0,0 +1,193 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"net/http"
+	"slices"
+	"time"
+
+	"macurate/ranking"
+	"macurate/validation"
+)
+
+// The algorithm behind the "By Score" sort order, from the ranking
+// package, picked on the admin page. "net" (the score) is sorted by the
+// database as before; any other is applied to the full list in memory,
+// which the people cache keeps cheap. The shown score stays the net score
+// either way.
+
+const defaultRanking = "net"
+
+func getRankingAlgorithm() string {
+	name := getSetting("ranking_algorithm", defaultRanking)
+	if _, ok := ranking.Lookup(name); !ok {
+		return defaultRanking
+	}
+	return name
+}
+
+// Put people in the order algorithm name gives them, best first
+func rankPeople(ctx context.Context, people []Person, name string) error {
+	entries, err := rankingEntries(ctx, people, name)
+	if err != nil {
+		return err
+	}
+	pos := make(map[int]int, len(entries))
+	for i, e := range entries {
+		pos[e.ID] = i
+	}
+	slices.SortFunc(people, func(a, b Person) int { return pos[a.ID] - pos[b.ID] })
+	return nil
+}
+
+// Entries for people under algorithm name, sorted, from every vote cast
+// for them in order
+func rankingEntries(ctx context.Context, people []Person, name string) ([]ranking.Entry, error) {
+	votes, err := loadVoteLog(ctx, 0)
+	if err != nil {
+		return nil, err
+	}
+	return replayVotes(name, people, votes, time.Now()), nil
+}
+
+// loggedVote is one vote of the log the algorithms replay.
+type loggedVote struct {
+	PersonID int
+	ranking.Vote
+}
+
+// The votes of a closed season, or of the current one for 0, oldest first
+func loadVoteLog(ctx context.Context, seasonID int) ([]loggedVote, error) {
+	var rows *sql.Rows
+	var err error
+	if seasonID == 0 {
+		rows, err = db.QueryContext(ctx, `
+            SELECT person_id, upvote, created_at FROM votes
+            WHERE upvote IS NOT NULL
+            ORDER BY created_at, id`)
+	} else {
+		rows, err = db.QueryContext(ctx, `
+            SELECT v.person_id, sv.upvote, v.created_at
+            FROM season_votes sv JOIN votes v ON v.id = sv.vote_id
+            WHERE sv.season_id = $1
+            ORDER BY v.created_at, v.id`, seasonID)
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var votes []loggedVote
+	for rows.Next() {
+		var v loggedVote
+		if err := rows.Scan(&v.PersonID, &v.Up, &v.At); err != nil {
+			return nil, err
+		}
+		votes = append(votes, v)
+	}
+	return votes, rows.Err()
+}
+
+// Run votes through algorithm name and rank people as of now; votes for
+// anyone not in people are skipped
+func replayVotes(name string, people []Person, votes []loggedVote, now time.Time) []ranking.Entry {
+	algo, ok := ranking.Lookup(name)
+	if !ok {
+		algo, _ = ranking.Lookup(defaultRanking)
+	}
+	byID := make(map[int]*ranking.Entry, len(people))
+	entries := make([]ranking.Entry, len(people))
+	for i, p := range people {
+		entries[i] = algo.New(p.ID, p.Name)
+		byID[p.ID] = &entries[i]
+	}
+	for _, v := range votes {
+		if e := byID[v.PersonID]; e != nil {
+			algo.ApplyVote(e, v.Vote)
+		}
+	}
+	ranking.Sort(algo, entries, now)
+	return entries
+}
+
+// GET /api/admin/rankings?limit=: the top of the board under every
+// algorithm side by side, for comparing before switching
+func apiAdminRankingsHandler(w http.ResponseWriter, r *http.Request) {
+	if !adminAuthorized(r) {
+		writeError(w, http.StatusUnauthorized, "unauthorized", "Log in as an admin first")
+		return
+	}
+	var req rankingsRequest
+	if errs := validation.Bind(r.URL.Query(), &req); errs != nil {
+		writeValidationError(w, errs)
+		return
+	}
+	if req.Limit == 0 {
+		req.Limit = 20
+	}
+	people, err := queryPeople(r.Context(), "name")
+	if err != nil {
+		serverError(w, r, err)
+		return
+	}
+
+	votes, err := loadVoteLog(r.Context(), 0)
+	if err != nil {
+		serverError(w, r, err)
+		return
+	}
+	now := time.Now()
+	type ranked struct {
+		PublicID string  `json:"public_id"`
+		Name     string  `json:"name"`
+		Value    float64 `json:"value"`
+	}
+	publicIDs := make(map[int]string, len(people))
+	for _, p := range people {
+		publicIDs[p.ID] = p.PublicID
+	}
+	result := map[string][]ranked{}
+	for _, name := range ranking.Names() {
+		entries := replayVotes(name, people, votes, now)
+		algo, _ := ranking.Lookup(name)
+		list := []ranked{}
+		for _, e := range entries[:min(req.Limit, len(entries))] {
+			list = append(list, ranked{publicIDs[e.ID], e.Name, algo.Rank(e, now)})
+		}
+		result[name] = list
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"current":    getRankingAlgorithm(),
+		"rankings":   result,
+		"algorithms": ranking.Names(),
+	})
+}
+
+// Pick the ranking algorithm (admin-only)
+func adminRankingHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if !adminAuthorized(r) {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	var req adminRankingRequest
+	if errs := bindAdminForm(r, &req); errs != nil {
+		renderAdmin(w, r, errs)
+		return
+	}
+	if _, ok := ranking.Lookup(req.Algorithm); !ok {
+		renderAdmin(w, r, validation.Errors{"algorithm": "is not a known ranking"})
+		return
+	}
+	if err := setSetting("ranking_algorithm", req.Algorithm); err != nil {
+		serverError(w, r, err)
+		return
+	}
+	invalidatePeopleCache()
+
+	http.Redirect(w, r, "/admin", http.StatusSeeOther)
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"math"
+	"net/http"
+	"os"
+	"strconv"
+	"sync"
+)
+
+// Per-IP token buckets for the vote and translation endpoints. Each IP may
+// burst up to the per-minute limit and then refills at limit/minute. The
+// buckets are kept in the Store, so every instance draws on the same ones.
+type ipRateLimiter struct {
+	name   string // bucket name prefix
+	mu     sync.Mutex
+	perMin int
+}
+
+// VOTE_RATE_LIMIT: votes per minute per IP (default 20, 0 disables)
+var voteLimiter = &ipRateLimiter{name: "vote", perMin: 20}
+
+// TRANSLATE_RATE_LIMIT: uncached translations per minute per IP for
+// requests without an API key (default 10, 0 disables). Kept apart from
+// votes so reading translations never blocks voting.
+var translateLimiter = &ipRateLimiter{name: "translate", perMin: 10}
+
+func loadRateLimits() {
+	voteLimiter.setLimit(envRateLimit("VOTE_RATE_LIMIT", 20))
+	translateLimiter.setLimit(envRateLimit("TRANSLATE_RATE_LIMIT", 10))
+}
+
+// A per-minute limit from key, def when unset or invalid
+func envRateLimit(key string, def int) int {
+	if v := os.Getenv(key); v != "" {
+		if n, err := strconv.Atoi(v); err == nil && n >= 0 {
+			return n
+		}
+	}
+	return def
+}
+
+func (l *ipRateLimiter) setLimit(perMin int) {
+	l.mu.Lock()
+	l.perMin = perMin
+	l.mu.Unlock()
+}
+
+// Where a client stands against a limit, for the X-RateLimit-* headers:
+// Reset is the seconds until it is back to the full limit, RetryAfter the
+// seconds until the refused request would go through.
+type rateLimitStatus struct {
+	Limit      int
+	Remaining  int
+	Reset      int
+	RetryAfter int
+}
+
+func (s rateLimitStatus) setHeaders(w http.ResponseWriter) {
+	w.Header().Set("X-RateLimit-Limit", strconv.Itoa(s.Limit))
+	w.Header().Set("X-RateLimit-Remaining", strconv.Itoa(s.Remaining))
+	w.Header().Set("X-RateLimit-Reset", strconv.Itoa(s.Reset))
+	if s.RetryAfter > 0 {
+		w.Header().Set("Retry-After", strconv.Itoa(s.RetryAfter))
+	}
+}
+
+// Take a token for ip, or with take false only look at the bucket. ok is
+// false when it is empty. A zero limit lets everything through and
+// reports a zero Limit.
+func (l *ipRateLimiter) allow(ctx context.Context, ip string, take bool) (bool, rateLimitStatus) {
+	l.mu.Lock()
+	perMin := l.perMin
+	l.mu.Unlock()
+	if perMin <= 0 {
+		return true, rateLimitStatus{}
+	}
+	return takeToken(ctx, l.name+":"+ip, perMin, take)
+}
+
+// Take a token from a bucket of perMin in the Store, or only look. When
+// the Store can't be asked the request goes through with a zero Limit:
+// a rate limit isn't worth failing requests over.
+func takeToken(ctx context.Context, bucket string, perMin int, take bool) (bool, rateLimitStatus) {
+	ok, tokens, err := db.TakeToken(ctx, bucket, perMin, float64(perMin)/60, take)
+	if err != nil {
+		slog.Warn("rate limit check failed", "bucket", bucket, "err", err)
+		return true, rateLimitStatus{}
+	}
+	return ok, bucketStatus(perMin, tokens, ok, take)
+}
+
+// Where a bucket of perMin stands with tokens left after a take (or look)
+func bucketStatus(perMin int, tokens float64, ok, take bool) rateLimitStatus {
+	rate := float64(perMin) / 60 // tokens per second
+	st := rateLimitStatus{
+		Limit:     perMin,
+		Remaining: int(tokens),
+		Reset:     int(math.Ceil((float64(perMin) - tokens) / rate)),
+	}
+	if !ok && take {
+		st.RetryAfter = int(math.Ceil((1 - tokens) / rate))
+	}
+	return st
+}
+
+// Reject vote submissions from an IP that is over its limit with 429.
+// Every response says how many votes are left, so the board can grey out
+// its buttons instead of letting the next click fail; other methods only
+// look.
+func withVoteRateLimit(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ok, st := voteLimiter.allow(r.Context(), clientIP(r), r.Method == http.MethodPost)
+		if st.Limit > 0 {
+			st.setHeaders(w)
+		}
+		if !ok && r.Method == http.MethodPost {
+			httpError(w, r, http.StatusTooManyRequests, "rate_limited", "Too many votes, slow down")
+			return
+		}
+		next(w, r)
+	}
+}
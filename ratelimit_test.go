@@ -0,0 +1,97 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestBucketStatus(t *testing.T) {
+	tests := []struct {
+		name     string
+		perMin   int
+		tokens   float64
+		ok, take bool
+		want     rateLimitStatus
+	}{
+		{"full, looking", 20, 20, true, false, rateLimitStatus{Limit: 20, Remaining: 20, Reset: 0}},
+		{"one taken", 20, 19, true, true, rateLimitStatus{Limit: 20, Remaining: 19, Reset: 3}},
+		{"half refilled", 60, 30.5, true, true, rateLimitStatus{Limit: 60, Remaining: 30, Reset: 30}},
+		{"last token taken", 20, 0, true, true, rateLimitStatus{Limit: 20, Remaining: 0, Reset: 60}},
+		{"refused", 20, 0.25, false, true, rateLimitStatus{Limit: 20, Remaining: 0, Reset: 60, RetryAfter: 3}},
+		{"empty, looking", 20, 0.25, false, false, rateLimitStatus{Limit: 20, Remaining: 0, Reset: 60}},
+		{"slow refill", 1, 0, false, true, rateLimitStatus{Limit: 1, Remaining: 0, Reset: 60, RetryAfter: 60}},
+	}
+	for _, tt := range tests {
+		if got := bucketStatus(tt.perMin, tt.tokens, tt.ok, tt.take); got != tt.want {
+			t.Errorf("%s: bucketStatus(%d, %v, %v, %v) = %+v, want %+v", tt.name, tt.perMin, tt.tokens, tt.ok, tt.take, got, tt.want)
+		}
+	}
+}
+
+// A Store whose buckets are answered by take; nothing else is called
+type bucketStore struct {
+	Store
+	take func(bucket string, capacity int, rate float64, take bool) (bool, float64, error)
+}
+
+func (s bucketStore) TakeToken(_ context.Context, bucket string, capacity int, rate float64, take bool) (bool, float64, error) {
+	return s.take(bucket, capacity, rate, take)
+}
+
+func TestIPRateLimiterAllow(t *testing.T) {
+	saved := db
+	defer func() { db = saved }()
+
+	var asked string
+	tests := []struct {
+		name   string
+		perMin int
+		store  func(string, int, float64, bool) (bool, float64, error)
+		ok     bool
+		want   rateLimitStatus
+		bucket string
+	}{
+		{
+			"off", 0,
+			func(string, int, float64, bool) (bool, float64, error) { panic("store asked with the limit off") },
+			true, rateLimitStatus{}, "",
+		},
+		{
+			"allowed", 20,
+			func(b string, capacity int, rate float64, take bool) (bool, float64, error) {
+				asked = b
+				if capacity != 20 || rate != 20.0/60 || !take {
+					t.Errorf("TakeToken(%q, %d, %v, %v)", b, capacity, rate, take)
+				}
+				return true, 5, nil
+			},
+			true, rateLimitStatus{Limit: 20, Remaining: 5, Reset: 45}, "vote:192.0.2.1",
+		},
+		{
+			"refused", 20,
+			func(b string, _ int, _ float64, _ bool) (bool, float64, error) { asked = b; return false, 0.5, nil },
+			false, rateLimitStatus{Limit: 20, Remaining: 0, Reset: 59, RetryAfter: 2}, "vote:192.0.2.1",
+		},
+		{
+			"store down lets it through", 20,
+			func(b string, _ int, _ float64, _ bool) (bool, float64, error) {
+				asked = b
+				return false, 0, errors.New("connection refused")
+			},
+			true, rateLimitStatus{}, "vote:192.0.2.1",
+		},
+	}
+	for _, tt := range tests {
+		asked = ""
+		db = bucketStore{take: tt.store}
+		l := &ipRateLimiter{name: "vote", perMin: tt.perMin}
+		ok, st := l.allow(context.Background(), "192.0.2.1", true)
+		if ok != tt.ok || st != tt.want {
+			t.Errorf("%s: allow = %v, %+v, want %v, %+v", tt.name, ok, st, tt.ok, tt.want)
+		}
+		if asked != tt.bucket {
+			t.Errorf("%s: asked for bucket %q, want %q", tt.name, asked, tt.bucket)
+		}
+	}
+}
@@ -0,0 +1,214 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// Runtime config reload. CONFIG_FILE names an env-style file (KEY=VALUE
+// lines, # comments, no sections) whose values apply on top of the process
+// environment; real env vars always win. Only the keys in configKeys may
+// appear in it, so a typo fails loudly instead of being ignored. SIGHUP or POST /admin/reload re-reads it and
+// re-applies the tunables below without restarting, so open connections
+// stay up. Settings kept in the database (voting windows, moderation, ...)
+// are read per request and need no reload. These are only read at startup
+// and need a restart: PORT, DATABASE_URL, ADMIN_PASSWORD, the connection
+// pool (DB_MAX_*, DB_CONN_MAX_LIFETIME, DB_LOCK_TIMEOUT, DB_QUERY_TIMEOUT),
+// COOKIE_* and TRUST_PROXY, LOG_FORMAT, AUTOCERT_*, SENTRY_*, TOXICITY_*,
+// TRANSLATE_*, PDF_RENDERER_URL and VAPID_*.
+
+// Guards every value a reload can change
+var configMu sync.RWMutex
+
+// Every setting the app reads from the environment, and so may be set in
+// CONFIG_FILE
+var configKeys = map[string]bool{
+	"ADMIN_PASSWORD": true, "ALERT_WEBHOOK_URL": true,
+	"ARCHIVE_DATABASE_URL": true, "AUTOCERT_DIR": true,
+	"AUTOCERT_EMAIL": true, "AUTOCERT_HOSTS": true, "BOARD_NAME": true,
+	"COMMENT_EDIT_MINUTES": true, "COOKIE_DOMAIN": true,
+	"COOKIE_HOST_PREFIX": true, "COOKIE_PATH": true, "COOKIE_SAMESITE": true,
+	"COOKIE_SECURE": true, "CORS_ORIGIN": true, "DATABASE_URL": true,
+	"DB_CONN_MAX_LIFETIME": true, "DB_DEAD_ROWS_ALERT_PCT": true,
+	"DB_LOCK_TIMEOUT": true, "DB_MAINTENANCE_INTERVAL": true,
+	"DB_MAX_IDLE_CONNS": true, "DB_MAX_OPEN_CONNS": true,
+	"DB_QUERY_TIMEOUT": true, "DB_SIZE_ALERT_MB": true,
+	"DEFAULT_COMMENTS_ENABLED": true, "DEFAULT_SHOW_SCORES": true,
+	"DEFAULT_SHOW_VOTE_COUNTS": true, "DEFAULT_SORT_ORDER": true,
+	"EVENT_LOG_DAYS": true, "GZIP_MIN_BYTES": true,
+	"INBOUND_EMAIL_DOMAINS": true, "INBOUND_EMAIL_SECRET": true,
+	"LEADERBOARD_CACHE_TTL": true, "LOG_FORMAT": true, "LOG_LEVEL": true,
+	"METRICS_TOKEN": true, "PDF_RENDERER_URL": true, "PORT": true,
+	"PUBLIC_ID_FORMAT": true, "PUSH_EVENTS": true,
+	"REALTIME_MAX_CLIENTS": true, "REALTIME_MAX_LAG": true,
+	"REALTIME_QUEUE": true, "REQUEST_TIMEOUT": true, "ROUTE_TIMEOUTS": true,
+	"SENTRY_DSN": true, "SENTRY_ENVIRONMENT": true, "SETUP_TOKEN": true,
+	"SHUTDOWN_TIMEOUT": true, "SMTP_ADDR": true, "SMTP_FROM": true,
+	"SMTP_PASSWORD": true, "SMTP_USER": true, "TOXICITY_API_KEY": true,
+	"TOXICITY_PROVIDER": true, "TOXICITY_URL": true,
+	"TRANSLATE_API_KEY": true, "TRANSLATE_PROVIDER": true, "TRANSLATE_RATE_LIMIT": true,
+	"TRANSLATE_URL": true, "TRUST_PROXY": true, "VAPID_PRIVATE_KEY": true,
+	"VAPID_PUBLIC_KEY": true, "VAPID_SUBJECT": true, "VOTE_RATE_LIMIT": true,
+}
+
+var (
+	baseEnv     = map[string]bool{} // keys set before the config file was read
+	fileKeys    = map[string]bool{} // keys the config file currently provides
+	reloadMu    sync.Mutex
+	lastReload  time.Time
+	reloadError string
+)
+
+// Read CONFIG_FILE into the environment. Keys the file no longer lists are
+// unset again so removing a line restores the default.
+func loadConfigFile() error {
+	path := os.Getenv("CONFIG_FILE")
+	if path == "" {
+		return nil
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("CONFIG_FILE: %w", err)
+	}
+	defer f.Close()
+
+	values := map[string]string{}
+	scanner := bufio.NewScanner(f)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		key, value, ok := strings.Cut(strings.TrimPrefix(line, "export "), "=")
+		key = strings.TrimSpace(key)
+		if !ok || key == "" {
+			return fmt.Errorf("%s:%d: expected KEY=VALUE", path, n)
+		}
+		if !configKeys[key] {
+			return fmt.Errorf("%s:%d: unknown setting %q", path, n, key)
+		}
+		value = strings.TrimSpace(value)
+		if len(value) >= 2 && (value[0] == '"' || value[0] == '\'') && value[len(value)-1] == value[0] {
+			value = value[1 : len(value)-1]
+		}
+		values[key] = value
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+
+	for key := range fileKeys {
+		if _, ok := values[key]; !ok {
+			os.Unsetenv(key)
+		}
+	}
+	fileKeys = map[string]bool{}
+	for key, value := range values {
+		if baseEnv[key] {
+			continue
+		}
+		os.Setenv(key, value)
+		fileKeys[key] = true
+	}
+	return nil
+}
+
+// Remember which keys came from the real environment before the first read.
+func snapshotBaseEnv() {
+	for _, kv := range os.Environ() {
+		key, _, _ := strings.Cut(kv, "=")
+		baseEnv[key] = true
+	}
+}
+
+// Re-read the config file and apply everything that can change at runtime.
+// The first bad value stops the reload: its setting and the ones checked
+// after it keep their previous values, the ones before it are applied.
+func reloadConfig() error {
+	reloadMu.Lock()
+	defer reloadMu.Unlock()
+
+	err := loadConfigFile()
+	if err == nil {
+		err = loadLogLevel()
+	}
+	if err == nil {
+		err = loadRouteTimeouts()
+	}
+	if err == nil {
+		err = loadMaintenanceConfig()
+	}
+	if err == nil {
+		err = loadRealtimeConfig()
+	}
+	if err == nil {
+		err = loadCompressionConfig()
+	}
+	if err == nil {
+		err = loadCORSConfig()
+	}
+	if err == nil {
+		loadRateLimits()
+		loadCommentEditWindow()
+		loadPeopleCacheTTL()
+		loadBoardName()
+	}
+
+	lastReload, reloadError = time.Now(), ""
+	if err != nil {
+		reloadError = err.Error()
+	}
+	return err
+}
+
+// ReloadStatus is shown on the admin page.
+type ReloadStatus struct {
+	ConfigFile string
+	At         time.Time
+	Error      string
+}
+
+func lastReloadStatus() ReloadStatus {
+	reloadMu.Lock()
+	defer reloadMu.Unlock()
+	return ReloadStatus{ConfigFile: os.Getenv("CONFIG_FILE"), At: lastReload, Error: reloadError}
+}
+
+// Reload on SIGHUP for the rest of the process lifetime.
+func watchReloadSignal() {
+	ch := make(chan os.Signal, 1)
+	signal.Notify(ch, syscall.SIGHUP)
+	go func() {
+		for range ch {
+			if err := reloadConfig(); err != nil {
+				slog.Error("config reload failed", "err", err)
+				continue
+			}
+			slog.Info("config reloaded")
+		}
+	}()
+}
+
+// Reload the config from the admin page
+func adminReloadHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if !adminAuthorized(r) {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+	if err := reloadConfig(); err != nil {
+		slog.Error("config reload failed", "err", err)
+	}
+	http.Redirect(w, r, "/admin", http.StatusSeeOther)
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// Reply is an official response attached to a comment. Role marks who
+// wrote it; only admins can reply for now.
+type Reply struct {
+	ID        int       `json:"id"`
+	Role      string    `json:"role"`
+	Text      string    `json:"text"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+const replyRoleAdmin = "admin"
+
+func createReplyTables() error {
+	_, err := db.Exec(`
+    CREATE TABLE IF NOT EXISTS comment_replies (
+        id SERIAL PRIMARY KEY,
+        vote_id INTEGER NOT NULL REFERENCES votes(id) ON DELETE CASCADE,
+        role TEXT NOT NULL DEFAULT 'admin',
+        body TEXT NOT NULL,
+        created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+    );
+    CREATE INDEX IF NOT EXISTS comment_replies_vote_id_idx ON comment_replies (vote_id);
+    `)
+	return err
+}
+
+// Replies for the given comments keyed by vote id, oldest first
+func repliesByVote(ctx context.Context, voteIDs []int) (map[int][]Reply, error) {
+	replies := map[int][]Reply{}
+	if len(voteIDs) == 0 {
+		return replies, nil
+	}
+	rows, err := db.QueryContext(ctx, `
+        SELECT id, vote_id, role, body, created_at FROM comment_replies
+        WHERE vote_id = ANY($1) ORDER BY id`, pq.Array(voteIDs))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var voteID int
+		var rp Reply
+		if err := rows.Scan(&rp.ID, &voteID, &rp.Role, &rp.Text, &rp.CreatedAt); err != nil {
+			return nil, err
+		}
+		replies[voteID] = append(replies[voteID], rp)
+	}
+	return replies, rows.Err()
+}
+
+// Post or delete an admin reply (admin-only). The form lives in the comments
+// fragment, so success goes back to the board.
+func adminRepliesHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if !adminAuthorized(r) {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	var req adminReplyRequest
+	if errs := bindAdminForm(r, &req); errs != nil {
+		writeValidationError(w, errs)
+		return
+	}
+
+	switch req.Action {
+	case "create":
+		if req.Text == "" {
+			http.Error(w, "Reply text is required", http.StatusBadRequest)
+			return
+		}
+		res, err := db.ExecContext(r.Context(), `
+            INSERT INTO comment_replies (vote_id, role, body)
+            SELECT id, $2, $3 FROM votes WHERE id = $1 AND COALESCE(TRIM(comment), '') <> ''`,
+			req.VoteID, replyRoleAdmin, req.Text)
+		if err != nil {
+			serverError(w, r, err)
+			return
+		}
+		if n, _ := res.RowsAffected(); n == 0 {
+			http.Error(w, "Comment not found", http.StatusNotFound)
+			return
+		}
+	case "delete":
+		if _, err := db.ExecContext(r.Context(), "DELETE FROM comment_replies WHERE id = $1", req.ID); err != nil {
+			serverError(w, r, err)
+			return
+		}
+	}
+
+	http.Redirect(w, r, "/", http.StatusSeeOther)
+}
@@ -0,0 +1,236 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+)
+
+// PDFRenderer converts a rendered HTML document into a PDF.
+type PDFRenderer interface {
+	RenderPDF(ctx context.Context, html []byte) ([]byte, error)
+}
+
+// Configured PDF renderer; nil when PDF export is disabled
+var pdfRenderer PDFRenderer
+
+// Build the PDF renderer from PDF_RENDERER_URL, an external service that
+// accepts a POSTed HTML body and answers with application/pdf.
+func newPDFRendererFromEnv() PDFRenderer {
+	if u := os.Getenv("PDF_RENDERER_URL"); u != "" {
+		return &httpPDFRenderer{endpoint: u, client: &http.Client{Timeout: 30 * time.Second}}
+	}
+	return nil
+}
+
+type httpPDFRenderer struct {
+	endpoint string
+	client   *http.Client
+}
+
+func (p *httpPDFRenderer) RenderPDF(ctx context.Context, html []byte) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, p.endpoint, bytes.NewReader(html))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "text/html; charset=utf-8")
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("pdf renderer returned %s", resp.Status)
+	}
+	return io.ReadAll(resp.Body)
+}
+
+// ReportComment is a highlighted comment in the results report.
+type ReportComment struct {
+	PersonName string
+	IsUpvote   bool
+	Text       string
+	Tags       int
+}
+
+// ReportRow is one line of the final standings.
+type ReportRow struct {
+	Rank int
+	Person
+}
+
+// ReportStats are board-wide totals shown in the results report.
+type ReportStats struct {
+	People    int
+	Votes     int
+	Upvotes   int
+	Downvotes int
+	Comments  int
+}
+
+var errUnknownSeason = errors.New("unknown season")
+
+// Load the report data for the requested season: the running one ("" or
+// "current") or a closed one by id, from the standings and vote directions
+// saved when it closed.
+func loadReport(ctx context.Context, season string) (map[string]interface{}, error) {
+	seasonID, label := 0, "current"
+	if season != "" && season != "current" {
+		id, err := strconv.Atoi(season)
+		if err != nil || id <= 0 {
+			return nil, errUnknownSeason
+		}
+		err = db.QueryRowContext(ctx, "SELECT name FROM seasons WHERE id = $1", id).Scan(&label)
+		if err == sql.ErrNoRows {
+			return nil, errUnknownSeason
+		} else if err != nil {
+			return nil, err
+		}
+		seasonID = id
+	}
+
+	var standings []ReportRow
+	if seasonID == 0 {
+		people, err := queryPeople(ctx, "score_desc")
+		if err != nil {
+			return nil, err
+		}
+		standings = make([]ReportRow, len(people))
+		for i, p := range people {
+			standings[i] = ReportRow{Rank: i + 1, Person: p}
+		}
+	} else {
+		var err error
+		if standings, err = seasonStandings(ctx, seasonID); err != nil {
+			return nil, err
+		}
+	}
+
+	// A closed season's votes are the ones in season_votes, which keeps
+	// their direction; the running season's are all the others
+	const seasonVotes = `
+        FROM votes v
+        LEFT JOIN season_votes sv ON sv.vote_id = v.id
+        WHERE ($1 = 0 AND sv.vote_id IS NULL) OR sv.season_id = $1`
+
+	var stats ReportStats
+	stats.People = len(standings)
+	err := db.QueryRowContext(ctx, `
+        SELECT COUNT(*),
+               COUNT(*) FILTER (WHERE COALESCE(sv.upvote, v.upvote) IS TRUE),
+               COUNT(*) FILTER (WHERE COALESCE(sv.upvote, v.upvote) IS FALSE),
+               COUNT(*) FILTER (WHERE COALESCE(TRIM(v.comment), '') <> '' AND v.status = 'approved')`+
+		seasonVotes, seasonID).Scan(&stats.Votes, &stats.Upvotes, &stats.Downvotes, &stats.Comments)
+	if err != nil {
+		return nil, err
+	}
+
+	// Best comments: most tagged first, newest breaking ties
+	rows, err := db.QueryContext(ctx, `
+        SELECT p.name, COALESCE(sv.upvote, v.upvote, FALSE), v.comment, COUNT(vt.tag_id) AS n
+        FROM votes v
+        LEFT JOIN season_votes sv ON sv.vote_id = v.id
+        JOIN people p ON p.id = v.person_id
+        LEFT JOIN vote_tags vt ON vt.vote_id = v.id
+        WHERE COALESCE(TRIM(v.comment), '') <> '' AND v.status = 'approved'
+          AND (($1 = 0 AND sv.vote_id IS NULL) OR sv.season_id = $1)
+        GROUP BY v.id, p.name, sv.upvote
+        ORDER BY n DESC, v.id DESC
+        LIMIT 10`, seasonID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var best []ReportComment
+	for rows.Next() {
+		var c ReportComment
+		if err := rows.Scan(&c.PersonName, &c.IsUpvote, &c.Text, &c.Tags); err != nil {
+			return nil, err
+		}
+		best = append(best, c)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return map[string]interface{}{
+		"Season":       label,
+		"GeneratedAt":  time.Now().UTC().Format("2006-01-02 15:04 MST"),
+		"Standings":    standings,
+		"BestComments": best,
+		"Stats":        stats,
+	}, nil
+}
+
+// Final standings of a closed season, people who were removed since included
+func seasonStandings(ctx context.Context, seasonID int) ([]ReportRow, error) {
+	rows, err := db.QueryContext(ctx, `
+        SELECT rank, name, team, score, upvotes, downvotes
+        FROM season_results WHERE season_id = $1
+        ORDER BY rank, name`, seasonID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var standings []ReportRow
+	for rows.Next() {
+		var row ReportRow
+		if err := rows.Scan(&row.Rank, &row.Name, &row.Team, &row.Score, &row.Upvotes, &row.Downvotes); err != nil {
+			return nil, err
+		}
+		standings = append(standings, row)
+	}
+	return standings, rows.Err()
+}
+
+// Printable results report (admin-only; ?season= is "current" or a closed
+// season's id); format=pdf goes through the PDF renderer
+func adminReportHandler(w http.ResponseWriter, r *http.Request) {
+	if !adminAuthorized(r) {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	data, err := loadReport(r.Context(), r.URL.Query().Get("season"))
+	if err == errUnknownSeason {
+		http.Error(w, "Season not found", http.StatusNotFound)
+		return
+	} else if err != nil {
+		serverError(w, r, err)
+		return
+	}
+
+	tmpl := parseTemplates("templates/report.html")
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, data); err != nil {
+		serverError(w, r, err)
+		return
+	}
+
+	if r.URL.Query().Get("format") != "pdf" {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.Write(buf.Bytes())
+		return
+	}
+	if pdfRenderer == nil {
+		http.Error(w, "PDF export not configured", http.StatusNotImplemented)
+		return
+	}
+	pdf, err := pdfRenderer.RenderPDF(r.Context(), buf.Bytes())
+	if err != nil {
+		http.Error(w, "PDF rendering failed: "+err.Error(), http.StatusBadGateway)
+		return
+	}
+	w.Header().Set("Content-Type", "application/pdf")
+	w.Header().Set("Content-Disposition", `attachment; filename="macurate-report.pdf"`)
+	w.Write(pdf)
+}
@@ -0,0 +1,355 @@
+package main
+
+import (
+	"net/http"
+	"net/url"
+
+	"macurate/validation"
+)
+
+// Request payloads. Field names follow the HTML form inputs.
+
+type voteRequest struct {
+	Person   string `form:"person_id" validate:"required,max=40"` // public id, or the integer id of older clients
+	PersonID int    // resolved from Person
+	Vote     string `form:"vote" validate:"oneof=up down"` // required unless the board takes star ratings
+	Comment  string `form:"comment" validate:"max=2000"`
+	Name     string `form:"name" validate:"max=64"`
+	Tags     []int  `form:"tag" validate:"max=20"`
+	// Rating dimension the vote is about; 0 for none
+	Dimension int `form:"dimension_id" validate:"min=0"`
+	// Star rating, 1–5, where the vote type allows it; 0 for none
+	Rating int `form:"rating" validate:"min=1,max=5"`
+}
+
+type voteUndoRequest struct {
+	Person   string `form:"person_id" validate:"required,max=40"` // public id, or the integer id of older clients
+	PersonID int    // resolved from Person
+}
+
+type commentEditRequest struct {
+	VoteID  int    `form:"vote_id" validate:"required,min=1"`
+	Comment string `form:"comment" validate:"required,max=2000"`
+}
+
+type feedRequest struct {
+	Person string `form:"person_id" validate:"max=40"`
+}
+
+type commentsRequest struct {
+	Person   string `form:"person_id" validate:"required,max=40"` // public id, or the integer id of older clients
+	PersonID int    // resolved from Person
+}
+
+// Query of GET /api/people; limit 0 means everything
+type pageRequest struct {
+	Limit    int    `form:"limit" validate:"min=1,max=200"`
+	Offset   int    `form:"offset" validate:"min=0"`
+	Category string `form:"category" validate:"max=64"` // slug; empty means everyone
+}
+
+// Query of GET /api/admin/analytics; 0 days means the default 30
+type analyticsRequest struct {
+	Days int `form:"days" validate:"min=1,max=365"`
+}
+
+// Query of GET /api/people/{id}/history; 0 days means all of it
+type scoreHistoryRequest struct {
+	Interval string `form:"interval" validate:"oneof=hour day week month"`
+	Days     int    `form:"days" validate:"min=1,max=3650"`
+}
+
+// Query of GET /api/leaderboard; an empty period is "week", 0 the default limit
+type leaderboardRequest struct {
+	Period string `form:"period" validate:"oneof=week month all"`
+	Limit  int    `form:"limit" validate:"min=1,max=200"`
+}
+
+// Query of GET /api/trending; 0 means the default
+type trendingRequest struct {
+	Hours int `form:"hours" validate:"min=1,max=168"`
+	Limit int `form:"limit" validate:"min=1,max=50"`
+}
+
+type personDetailRequest struct {
+	Comments int `form:"comments" validate:"min=1,max=50"`
+}
+
+type pushSubscribeRequest struct {
+	Endpoint string `form:"endpoint" validate:"required,max=1000"`
+	P256dh   string `form:"p256dh" validate:"required,max=200"`
+	Auth     string `form:"auth" validate:"required,max=100"`
+}
+
+type pushUnsubscribeRequest struct {
+	Endpoint string `form:"endpoint" validate:"required,max=1000"`
+}
+
+type eventReplayRequest struct {
+	FromSeq int64 `form:"from_seq" validate:"min=0"`
+	Limit   int   `form:"limit" validate:"min=1,max=500"`
+}
+
+type milestonesRequest struct {
+	Limit int `form:"limit" validate:"min=1,max=100"`
+}
+
+type kioskRequest struct {
+	Rotate   int    `form:"rotate" validate:"min=5,max=600"` // seconds per section
+	Sections string `form:"sections" validate:"max=100"`
+}
+
+type exportRequest struct {
+	Format   string `form:"format" validate:"oneof=ndjson json"`
+	PersonID int    `form:"person_id" validate:"min=1"`
+}
+
+// Query of GET /api/admin/rankings; 0 means the default 20
+type rankingsRequest struct {
+	Limit int `form:"limit" validate:"min=1,max=200"`
+}
+
+// Query of GET /admin/simulate; an unknown algorithm means the live one
+type adminSimulateRequest struct {
+	Algorithm string `form:"algorithm" validate:"max=40"`
+	Season    int    `form:"season" validate:"min=0"`
+	Limit     int    `form:"limit" validate:"min=1,max=500"`
+}
+
+type adminRankingRequest struct {
+	Algorithm string `form:"algorithm" validate:"required,max=40"`
+}
+
+// Query of GET /api/seasons/{id}/results; 0 means everyone
+type seasonResultsRequest struct {
+	Limit int `form:"limit" validate:"min=1,max=1000"`
+}
+
+type adminSeasonRequest struct {
+	Name string `form:"season_name" validate:"required,max=100"`
+}
+
+type adminSortRequest struct {
+	Order string `form:"order" validate:"required,oneof=name score_desc upvotes_desc"`
+}
+
+type adminNamePolicyRequest struct {
+	Policy string `form:"policy" validate:"required,oneof=optional required anonymous"`
+}
+
+type adminCommentPolicyRequest struct {
+	CommentPolicy string `form:"comment_policy" validate:"required,oneof=optional required downvotes"`
+}
+
+type adminCommentRulesRequest struct {
+	MinLength   int  `form:"min_length" validate:"min=0,max=500"`
+	NoShouting  bool `form:"no_shouting"`
+	NoRepeats   bool `form:"no_repeats"`
+	NoEmojiOnly bool `form:"no_emoji_only"`
+}
+
+type adminDisplayRequest struct {
+	ShowScores      bool `form:"show_scores"`
+	ShowVoteCounts  bool `form:"show_vote_counts"`
+	CommentsEnabled bool `form:"comments_enabled"`
+}
+
+// The public "remove me" form
+type exclusionRequest struct {
+	Person   string `form:"person_id" validate:"required,max=40"` // public id, or the integer id of older clients
+	PersonID int    // resolved from Person
+	Name     string `form:"name" validate:"required,max=100"`
+	Contact  string `form:"contact" validate:"max=200"`
+	Reason   string `form:"reason" validate:"max=1000"`
+}
+
+type adminExclusionRequest struct {
+	Action    string `form:"action" validate:"required,oneof=approve reject"`
+	ID        int    `form:"id" validate:"required,min=1"`
+	Anonymize bool   `form:"anonymize"`
+}
+
+type consentRequest struct {
+	Accept bool `form:"accept"`
+}
+
+type adminLegalRequest struct {
+	Privacy         string `form:"privacy" validate:"max=20000"`
+	Imprint         string `form:"imprint" validate:"max=20000"`
+	ConsentRequired bool   `form:"consent_required"`
+}
+
+type adminPageRequest struct {
+	Action   string `form:"action" validate:"required,oneof=save delete"`
+	Slug     string `form:"slug" validate:"required,max=64"`
+	Title    string `form:"title" validate:"max=200"`
+	Body     string `form:"body" validate:"max=20000"`
+	Position int    `form:"position" validate:"min=0"`
+}
+
+type adminSearchRequest struct {
+	Q     string `form:"q" validate:"max=200"`
+	Voter string `form:"voter" validate:"max=100"`
+}
+
+type adminImportRequest struct {
+	OnConflict string `form:"on_conflict" validate:"required,oneof=skip merge duplicate"`
+}
+
+type adminImportBatchRequest struct {
+	Action  string `form:"action" validate:"oneof=commit discard"` // empty to preview
+	BatchID int    `form:"batch" validate:"required,min=1"`
+}
+
+type adminFreezeRequest struct {
+	PersonID int  `form:"person_id" validate:"required,min=1"`
+	Frozen   bool `form:"frozen"`
+}
+
+type adminBlindRequest struct {
+	BlindVoting bool   `form:"blind_voting"`
+	ClosesAt    string `form:"closes_at"`
+}
+
+type adminVotingModeRequest struct {
+	Mode     string `form:"mode" validate:"required,oneof=updown quadratic"`
+	VoteType string `form:"vote_type" validate:"oneof=updown stars both"`
+	Budget   int    `form:"budget" validate:"min=1,max=100000"`
+	Dedup    string `form:"dedup" validate:"oneof=off once daily"`
+}
+
+type adminElectionRequest struct {
+	Action     string `form:"action" validate:"required,oneof=create close"`
+	Question   string `form:"question" validate:"max=200"`
+	Candidates []int  `form:"candidate" validate:"max=50"`
+	ID         int    `form:"id" validate:"min=1"`
+}
+
+// Body of POST /api/duel
+type duelRequest struct {
+	Winner   string `json:"winner_id" validate:"required,max=40"`
+	Loser    string `json:"loser_id" validate:"required,max=40"`
+	WinnerID int    `json:"-"`
+	LoserID  int    `json:"-"`
+}
+
+type ballotRequest struct {
+	Ranking []personRef `json:"ranking" validate:"required,max=50"`
+}
+
+type adminTeamRequest struct {
+	Action   string `form:"action" validate:"required,oneof=add delete assign domain"`
+	Name     string `form:"team_name" validate:"max=100"`
+	Domain   string `form:"domain" validate:"max=253"`
+	TeamID   int    `form:"team_id" validate:"min=0"`
+	PersonID int    `form:"person_id" validate:"min=1"`
+}
+
+type adminAPIKeyRequest struct {
+	Action    string `form:"action" validate:"required,oneof=create revoke"`
+	Name      string `form:"name" validate:"max=100"`
+	RateLimit int    `form:"rate_limit" validate:"min=1,max=100000"`
+	ID        int    `form:"id" validate:"min=1"`
+}
+
+type adminWebhookRequest struct {
+	Action string   `form:"action" validate:"required,oneof=create delete"`
+	URL    string   `form:"hook_url" validate:"max=1000"`
+	Events []string `form:"hook_events" validate:"max=10"`
+	ID     int      `form:"id" validate:"min=1"`
+}
+
+type adminSubscriptionRequest struct {
+	Action       string `form:"action" validate:"required,oneof=create delete"`
+	PersonID     int    `form:"sub_person_id" validate:"min=1"`
+	Email        string `form:"email" validate:"max=254"`
+	WebhookURL   string `form:"webhook_url" validate:"max=500"`
+	BatchMinutes int    `form:"batch_minutes" validate:"min=1,max=10080"`
+	ID           int    `form:"id" validate:"min=1"`
+}
+
+type adminReplyRequest struct {
+	Action string `form:"action" validate:"required,oneof=create delete"`
+	VoteID int    `form:"vote_id" validate:"min=1"`
+	Text   string `form:"text" validate:"max=1000"`
+	ID     int    `form:"id" validate:"min=1"`
+}
+
+// Body of PUT/PATCH /admin/api/people/{id}; PATCH only touches the fields sent
+type adminPersonUpdateRequest struct {
+	Name         string `form:"name" validate:"max=100"`
+	TeamID       int    `form:"team_id" validate:"min=0"`
+	VotingFrozen bool   `form:"voting_frozen"`
+}
+
+// Passwords are read raw from the form: cleaning them like other text
+// would change what the admin typed.
+type adminAccountRequest struct {
+	Action   string `form:"action" validate:"required,oneof=create delete password"`
+	Username string `form:"username" validate:"max=64"`
+	ID       int    `form:"id" validate:"min=1"`
+}
+
+type setupRequest struct {
+	BoardName  string `form:"board_name" validate:"required,max=100"`
+	VotingMode string `form:"voting_mode" validate:"required,oneof=updown quadratic"`
+	Demo       bool   `form:"demo"`
+	Username   string `form:"username" validate:"required,max=64"`
+}
+
+type adminAddRequest struct {
+	Name   string `form:"name" validate:"required,max=100"`
+	TeamID int    `form:"team_id" validate:"min=0"`
+}
+
+type adminDimensionRequest struct {
+	Action string `form:"action" validate:"required,oneof=add delete"`
+	Name   string `form:"dimension_name" validate:"max=40"`
+	ID     int    `form:"id" validate:"min=1"`
+}
+
+type adminCategoryRequest struct {
+	Action     string `form:"action" validate:"required,oneof=add delete assign unassign"`
+	Name       string `form:"category_name" validate:"max=60"`
+	Slug       string `form:"category_slug" validate:"max=64"`
+	CategoryID int    `form:"category_id" validate:"min=1"`
+	PersonID   int    `form:"person_id" validate:"min=1"`
+}
+
+type adminTagRequest struct {
+	Action string `form:"action" validate:"required,oneof=add delete"`
+	Label  string `form:"label" validate:"max=40"`
+	ID     int    `form:"id" validate:"min=1"`
+}
+
+// Parse the request form (urlencoded or multipart) and return all values
+func formValues(r *http.Request) (url.Values, error) {
+	if err := r.ParseMultipartForm(32 << 20); err != nil && err != http.ErrNotMultipart {
+		return nil, err
+	}
+	return r.Form, nil
+}
+
+// Bind the request form into dst. On failure the error response has already
+// been written and ok is false.
+func bindForm(w http.ResponseWriter, r *http.Request, dst interface{}) bool {
+	values, err := formValues(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid_request", "Invalid form")
+		return false
+	}
+	if errs := validation.Bind(values, dst); errs != nil {
+		writeValidationError(w, errs)
+		return false
+	}
+	return true
+}
+
+// Field-level validation failure as JSON
+func writeValidationError(w http.ResponseWriter, errs validation.Errors) {
+	writeAPIError(w, http.StatusBadRequest, APIError{
+		Code:    "validation_failed",
+		Message: "Some fields are invalid",
+		Fields:  errs,
+	})
+}
@@ -0,0 +1,157 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"html"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// RoastLine is one comment read out in the roast reel.
+type RoastLine struct {
+	ID       int      `json:"id"`
+	IsUpvote bool     `json:"upvote"`
+	Text     string   `json:"text"`
+	Author   string   `json:"author,omitempty"`
+	Tags     []string `json:"tags"`
+}
+
+// Export a person's top comments as a read-aloud script (admin-only).
+// format=json (default) returns script, SSML and metadata; format=text or
+// format=ssml return just that rendering.
+func adminRoastHandler(w http.ResponseWriter, r *http.Request) {
+	if !adminAuthorized(r) {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+	personID, err := resolvePersonRef(r.Context(), r.URL.Query().Get("person_id"))
+	if err == errUnknownPerson {
+		http.Error(w, "Invalid person_id", http.StatusBadRequest)
+		return
+	} else if err != nil {
+		serverError(w, r, err)
+		return
+	}
+	limit := 10
+	if v := r.URL.Query().Get("limit"); v != "" {
+		limit, err = strconv.Atoi(v)
+		if err != nil || limit <= 0 || limit > 100 {
+			http.Error(w, "Invalid limit", http.StatusBadRequest)
+			return
+		}
+	}
+
+	var name string
+	var score int
+	err = db.QueryRowContext(r.Context(), `
+        SELECT p.name,
+               COALESCE(SUM(CASE WHEN v.upvote IS TRUE THEN 1 WHEN v.upvote IS FALSE THEN -1 ELSE 0 END), 0)
+        FROM people p
+        LEFT JOIN votes v ON p.id = v.person_id
+        WHERE p.id = $1
+        GROUP BY p.id, p.name`, personID).Scan(&name, &score)
+	if err == sql.ErrNoRows {
+		http.Error(w, "Person not found", http.StatusNotFound)
+		return
+	} else if err != nil {
+		serverError(w, r, err)
+		return
+	}
+
+	// Most tagged comments first, newest breaking ties
+	rows, err := db.QueryContext(r.Context(), `
+        SELECT v.id, v.upvote, v.comment, COALESCE(v.voter_name, ''),
+               COALESCE(string_agg(t.label, ',' ORDER BY t.label), '')
+        FROM votes v
+        LEFT JOIN vote_tags vt ON vt.vote_id = v.id
+        LEFT JOIN reason_tags t ON t.id = vt.tag_id
+        WHERE v.person_id = $1 AND COALESCE(TRIM(v.comment), '') <> '' AND v.status = 'approved'
+        GROUP BY v.id
+        ORDER BY COUNT(t.id) DESC, v.id DESC
+        LIMIT $2`, personID, limit)
+	if err != nil {
+		serverError(w, r, err)
+		return
+	}
+	defer rows.Close()
+
+	anonymous := getNamePolicy() == namePolicyAnonymous
+	lines := []RoastLine{}
+	for rows.Next() {
+		var l RoastLine
+		var tags string
+		if err := rows.Scan(&l.ID, &l.IsUpvote, &l.Text, &l.Author, &tags); err != nil {
+			serverError(w, r, err)
+			return
+		}
+		if anonymous {
+			l.Author = ""
+		}
+		l.Tags = []string{}
+		if tags != "" {
+			l.Tags = strings.Split(tags, ",")
+		}
+		lines = append(lines, l)
+	}
+	if err := rows.Err(); err != nil {
+		serverError(w, r, err)
+		return
+	}
+
+	script := roastScript(name, score, lines)
+	ssml := roastSSML(name, score, lines)
+
+	switch r.URL.Query().Get("format") {
+	case "text":
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		w.Write([]byte(script))
+	case "ssml":
+		w.Header().Set("Content-Type", "application/ssml+xml; charset=utf-8")
+		w.Write([]byte(ssml))
+	case "", "json":
+		writeJSON(w, http.StatusOK, map[string]interface{}{
+			"person":       map[string]interface{}{"id": personID, "name": name, "score": score},
+			"generated_at": time.Now().UTC().Format(time.RFC3339),
+			"lines":        lines,
+			"script":       script,
+			"ssml":         ssml,
+		})
+	default:
+		http.Error(w, "Invalid format", http.StatusBadRequest)
+	}
+}
+
+func roastScript(name string, score int, lines []RoastLine) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "And now, the roast reel for %s. Final score: %d.\n\n", name, score)
+	for i, l := range lines {
+		fmt.Fprintf(&b, "%d. %s\n", i+1, l.Text)
+	}
+	if len(lines) == 0 {
+		b.WriteString("Nobody had anything to say. Ouch.\n")
+	}
+	return b.String()
+}
+
+func roastSSML(name string, score int, lines []RoastLine) string {
+	var b strings.Builder
+	b.WriteString(`<speak>`)
+	fmt.Fprintf(&b, `<p>And now, the roast reel for <emphasis level="strong">%s</emphasis>. Final score: %d.</p>`,
+		html.EscapeString(name), score)
+	for _, l := range lines {
+		b.WriteString(`<break time="800ms"/>`)
+		if l.IsUpvote {
+			fmt.Fprintf(&b, `<p><prosody pitch="+10%%">%s</prosody></p>`, html.EscapeString(l.Text))
+		} else {
+			fmt.Fprintf(&b, `<p><prosody pitch="-10%%" rate="slow">%s</prosody></p>`, html.EscapeString(l.Text))
+		}
+	}
+	if len(lines) == 0 {
+		b.WriteString(`<p>Nobody had anything to say. Ouch.</p>`)
+	}
+	b.WriteString(`</speak>`)
+	return b.String()
+}
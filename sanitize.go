@@ -0,0 +1,83 @@
+package main
+
+import (
+	"fmt"
+	"html/template"
+	"net/url"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Template helpers for the few places that need to bypass html/template's
+// contextual escaping. Anything user supplied that ends up as template.URL or
+// template.HTML must go through one of these; never convert directly.
+var templateFuncs = template.FuncMap{
+	"safeURL":  SafeURL,
+	"safeHTML": SafeHTML,
+	"timeAgo":  timeAgo,
+}
+
+// Parse template files with the shared helper functions available
+func parseTemplates(files ...string) *template.Template {
+	return template.Must(template.New(filepath.Base(files[0])).Funcs(templateFuncs).ParseFiles(files...))
+}
+
+// SafeURL allows same-origin paths and http(s)/mailto links; everything else
+// (javascript:, data:, protocol-relative //host, garbage) becomes "#".
+func SafeURL(raw string) template.URL {
+	raw = strings.TrimSpace(raw)
+	if strings.HasPrefix(raw, "/") && !strings.HasPrefix(raw, "//") && !strings.HasPrefix(raw, "/\\") {
+		return template.URL(raw)
+	}
+	u, err := url.Parse(raw)
+	if err != nil {
+		return "#"
+	}
+	switch strings.ToLower(u.Scheme) {
+	case "http", "https":
+		if u.Host == "" {
+			return "#"
+		}
+		return template.URL(u.String())
+	case "mailto":
+		return template.URL(u.String())
+	}
+	return "#"
+}
+
+// SafeHTML escapes text and keeps line breaks, the only markup a comment may carry
+func SafeHTML(text string) template.HTML {
+	escaped := template.HTMLEscapeString(text)
+	escaped = strings.ReplaceAll(escaped, "\r\n", "\n")
+	return template.HTML(strings.ReplaceAll(escaped, "\n", "<br>"))
+}
+
+// Content types the image endpoint may serve. Anything else is sent as an
+// opaque download so a crafted upload can't be rendered as HTML or SVG script.
+func safeImageContentType(ct string) string {
+	switch ct {
+	case "image/jpeg", "image/png", "image/gif", "image/webp", "image/bmp":
+		return ct
+	}
+	return "application/octet-stream"
+}
+
+// Compact relative time for display, e.g. "5m ago"
+func timeAgo(t *time.Time) string {
+	if t == nil {
+		return ""
+	}
+	d := time.Since(*t)
+	switch {
+	case d < time.Minute:
+		return "just now"
+	case d < time.Hour:
+		return fmt.Sprintf("%dm ago", int(d.Minutes()))
+	case d < 24*time.Hour:
+		return fmt.Sprintf("%dh ago", int(d.Hours()))
+	case d < 30*24*time.Hour:
+		return fmt.Sprintf("%dd ago", int(d.Hours()/24))
+	}
+	return t.Format("2 Jan 2006")
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"html/template"
+	"testing"
+)
+
+func TestSafeURL(t *testing.T) {
+	tests := []struct {
+		in   string
+		want template.URL
+	}{
+		{"/pages/about", "/pages/about"},
+		{"  /pages/about", "/pages/about"},
+		{"https://example.com/a?b=c", "https://example.com/a?b=c"},
+		{"HTTP://example.com", "http://example.com"},
+		{"mailto:someone@example.com", "mailto:someone@example.com"},
+		{"javascript:alert(1)", "#"},
+		{"JavaScript:alert(1)", "#"},
+		{"JAVASCRIPT:alert(1)", "#"},
+		{" \tjavascript:alert(1)", "#"},
+		{"\njavascript:alert(1)", "#"},
+		{"java\tscript:alert(1)", "#"},
+		{"javascript://example.com/%0aalert(1)", "#"},
+		{"data:text/html,<script>alert(1)</script>", "#"},
+		{"DATA:text/html;base64,PHNjcmlwdD4=", "#"},
+		{"vbscript:msgbox(1)", "#"},
+		{"//evil.example", "#"},
+		{"/\\evil.example", "#"},
+		{"https:evil.example", "#"},
+		{"http://", "#"},
+		{"%zz", "#"},
+		{"", "#"},
+	}
+	for _, tt := range tests {
+		if got := SafeURL(tt.in); got != tt.want {
+			t.Errorf("SafeURL(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestSafeHTML(t *testing.T) {
+	tests := []struct {
+		in   string
+		want template.HTML
+	}{
+		{"plain", "plain"},
+		{"<script>alert(1)</script>", "&lt;script&gt;alert(1)&lt;/script&gt;"},
+		{`" onmouseover="alert(1)`, "&#34; onmouseover=&#34;alert(1)"},
+		{`' onfocus='alert(1)' autofocus='`, "&#39; onfocus=&#39;alert(1)&#39; autofocus=&#39;"},
+		{"<img src=x onerror=alert(1)>", "&lt;img src=x onerror=alert(1)&gt;"},
+		{"a & b", "a &amp; b"},
+		{"line one\nline two", "line one<br>line two"},
+		{"line one\r\nline two", "line one<br>line two"},
+		{"<br>", "&lt;br&gt;"},
+		{"</textarea><script>", "&lt;/textarea&gt;&lt;script&gt;"},
+	}
+	for _, tt := range tests {
+		if got := SafeHTML(tt.in); got != tt.want {
+			t.Errorf("SafeHTML(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestSafeImageContentType(t *testing.T) {
+	tests := []struct {
+		in, want string
+	}{
+		{"image/png", "image/png"},
+		{"image/jpeg", "image/jpeg"},
+		{"image/webp", "image/webp"},
+		{"image/svg+xml", "application/octet-stream"},
+		{"image/svg", "application/octet-stream"},
+		{"text/html", "application/octet-stream"},
+		{"text/html; charset=utf-8", "application/octet-stream"},
+		{"application/xhtml+xml", "application/octet-stream"},
+		{"IMAGE/PNG", "application/octet-stream"},
+		{"image/png; charset=utf-8", "application/octet-stream"},
+		{"", "application/octet-stream"},
+	}
+	for _, tt := range tests {
+		if got := safeImageContentType(tt.in); got != tt.want {
+			t.Errorf("safeImageContentType(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"database/sql"
+	"net/http"
+	"time"
+
+	"macurate/validation"
+)
+
+// Every change to a person's score, for charting it over time. A row is
+// written in the same transaction as the vote or undo that caused it, with
+// the score as it stands afterwards; migration 0003 filled in the votes
+// cast before this existed. Imported and archived votes aren't recorded,
+// so a board that used those can show a jump the history doesn't explain.
+
+// ScorePoint is the history aggregated over one interval.
+type ScorePoint struct {
+	At    time.Time `json:"at"`    // start of the interval, UTC
+	Delta int       `json:"delta"` // net change within it
+	Score int       `json:"score"` // score at the end of it
+	Votes int       `json:"votes"` // changes within it
+}
+
+func createScoreHistoryTables() error {
+	_, err := db.Exec(`
+    CREATE TABLE IF NOT EXISTS score_history (
+        id BIGSERIAL PRIMARY KEY,
+        person_id INTEGER NOT NULL REFERENCES people(id) ON DELETE CASCADE,
+        vote_id INTEGER,
+        delta INTEGER NOT NULL,
+        new_score INTEGER NOT NULL,
+        created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+    );
+    CREATE INDEX IF NOT EXISTS score_history_person_idx ON score_history (person_id, created_at);
+    `)
+	return err
+}
+
+// Record a vote (+1/-1) or an undo of one inside tx, after the votes row
+// itself has changed. The person's row is locked first so two votes
+// committing together can't both record the same new score.
+func recordScoreChange(tx *sql.Tx, personID, voteID, delta int) error {
+	if _, err := tx.Exec("SELECT 1 FROM people WHERE id = $1 FOR NO KEY UPDATE", personID); err != nil {
+		return err
+	}
+	_, err := tx.Exec(`
+        INSERT INTO score_history (person_id, vote_id, delta, new_score)
+        SELECT $1, $2, $3, COALESCE(SUM(CASE WHEN upvote THEN 1 ELSE -1 END), 0)
+        FROM votes WHERE person_id = $1 AND upvote IS NOT NULL`, personID, voteID, delta)
+	return err
+}
+
+// +1 for an upvote, -1 for a downvote
+func voteDelta(up bool) int {
+	if up {
+		return 1
+	}
+	return -1
+}
+
+// GET /api/people/{id}/history?interval=day: the score over time, one
+// point per interval that saw a change (?days= limits how far back).
+// While scores are hidden only admins get the points.
+func apiPersonHistoryHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := resolvePersonRef(r.Context(), r.PathValue("id"))
+	if err == errUnknownPerson {
+		writeError(w, http.StatusNotFound, "not_found", "Person not found")
+		return
+	} else if err != nil {
+		serverError(w, r, err)
+		return
+	}
+	var req scoreHistoryRequest
+	if errs := validation.Bind(r.URL.Query(), &req); errs != nil {
+		writeValidationError(w, errs)
+		return
+	}
+	if req.Interval == "" {
+		req.Interval = "day"
+	}
+
+	var publicID string
+	err = db.QueryRowContext(r.Context(), "SELECT COALESCE(public_id, '') FROM people WHERE id = $1", id).Scan(&publicID)
+	if err == sql.ErrNoRows {
+		writeError(w, http.StatusNotFound, "not_found", "Person not found")
+		return
+	} else if err != nil {
+		serverError(w, r, err)
+		return
+	}
+
+	hidden := scoresHiddenFor(r)
+	points := []ScorePoint{}
+	if !hidden {
+		rows, err := db.QueryContext(r.Context(), `
+            SELECT date_trunc($2, created_at AT TIME ZONE 'UTC') AT TIME ZONE 'UTC',
+                   SUM(delta), (array_agg(new_score ORDER BY id DESC))[1], COUNT(*)
+            FROM score_history
+            WHERE person_id = $1 AND ($3 = 0 OR created_at >= NOW() - $3 * INTERVAL '1 day')
+            GROUP BY 1
+            ORDER BY 1`, id, req.Interval, req.Days)
+		if err != nil {
+			serverError(w, r, err)
+			return
+		}
+		defer rows.Close()
+		for rows.Next() {
+			var p ScorePoint
+			if err := rows.Scan(&p.At, &p.Delta, &p.Score, &p.Votes); err != nil {
+				serverError(w, r, err)
+				return
+			}
+			p.At = p.At.UTC()
+			points = append(points, p)
+		}
+		if err := rows.Err(); err != nil {
+			serverError(w, r, err)
+			return
+		}
+	}
+
+	writeJSONWithETag(w, r, map[string]interface{}{
+		"public_id": publicID,
+		"interval":  req.Interval,
+		"days":      req.Days,
+		"hidden":    hidden,
+		"points":    points,
+	})
+}
@@ -0,0 +1,174 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// One search box for the admin area: a fragment is matched (case-
+// insensitively) against people, comments, voter names and removal
+// requests, the one audit trail the board keeps. Each group is capped at
+// searchGroupLimit hits and links to where the thing can be acted on.
+
+const searchGroupLimit = 20
+
+// SearchComment is a comment hit, linked to its place in the thread.
+type SearchComment struct {
+	ID         int
+	PersonID   int
+	PersonName string
+	IsUpvote   bool
+	Text       string
+	Author     string
+	Status     string
+	CreatedAt  time.Time
+}
+
+// SearchVoter is one voter name with how much it has been used.
+type SearchVoter struct {
+	Name     string
+	Votes    int
+	LastVote time.Time
+}
+
+// SearchResults holds every group; empty groups are left out of the page.
+type SearchResults struct {
+	People     []Person
+	Comments   []SearchComment
+	Voters     []SearchVoter
+	Exclusions []ExclusionRequest
+}
+
+// Escape LIKE wildcards so the fragment is matched literally
+func likePattern(fragment string) string {
+	r := strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+	return "%" + r.Replace(fragment) + "%"
+}
+
+func adminSearch(ctx context.Context, q, voter string) (SearchResults, error) {
+	var res SearchResults
+	pattern := likePattern(q)
+
+	// A voter search lists that voter's comments only
+	if voter == "" {
+		people, err := queryPeople(ctx, "name")
+		if err != nil {
+			return res, err
+		}
+		lower := strings.ToLower(q)
+		for _, p := range people {
+			if strings.Contains(strings.ToLower(p.Name), lower) || strings.Contains(strings.ToLower(p.Team), lower) {
+				res.People = append(res.People, p)
+				if len(res.People) == searchGroupLimit {
+					break
+				}
+			}
+		}
+	}
+
+	rows, err := db.QueryContext(ctx, `
+        SELECT v.id, v.person_id, p.name, v.upvote, v.comment, COALESCE(v.voter_name, ''), v.status, v.created_at
+        FROM votes v JOIN people p ON p.id = v.person_id
+        WHERE v.comment <> '' AND v.upvote IS NOT NULL
+          AND (($2 = '' AND (v.comment ILIKE $1 OR v.voter_name ILIKE $1)) OR ($2 <> '' AND v.voter_name = $2))
+        ORDER BY v.id DESC
+        LIMIT $3`, pattern, voter, searchGroupLimit)
+	if err != nil {
+		return res, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var c SearchComment
+		if err := rows.Scan(&c.ID, &c.PersonID, &c.PersonName, &c.IsUpvote, &c.Text, &c.Author, &c.Status, &c.CreatedAt); err != nil {
+			return res, err
+		}
+		res.Comments = append(res.Comments, c)
+	}
+	if err := rows.Err(); err != nil {
+		return res, err
+	}
+	if voter != "" {
+		return res, nil
+	}
+
+	rows, err = db.QueryContext(ctx, `
+        SELECT voter_name, COUNT(*), MAX(created_at)
+        FROM votes
+        WHERE voter_name ILIKE $1
+        GROUP BY voter_name
+        ORDER BY COUNT(*) DESC, voter_name
+        LIMIT $2`, pattern, searchGroupLimit)
+	if err != nil {
+		return res, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var v SearchVoter
+		if err := rows.Scan(&v.Name, &v.Votes, &v.LastVote); err != nil {
+			return res, err
+		}
+		res.Voters = append(res.Voters, v)
+	}
+	if err := rows.Err(); err != nil {
+		return res, err
+	}
+
+	rows, err = db.QueryContext(ctx, `
+        SELECT id, person_id, person_name, requester_name, contact, reason, status,
+               outcome, decided_by, created_at, decided_at
+        FROM exclusion_requests
+        WHERE person_name ILIKE $1 OR requester_name ILIKE $1 OR contact ILIKE $1
+           OR reason ILIKE $1 OR decided_by ILIKE $1
+        ORDER BY id DESC
+        LIMIT $2`, pattern, searchGroupLimit)
+	if err != nil {
+		return res, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var e ExclusionRequest
+		if err := rows.Scan(&e.ID, &e.PersonID, &e.PersonName, &e.RequesterName, &e.Contact, &e.Reason, &e.Status,
+			&e.Outcome, &e.DecidedBy, &e.CreatedAt, &e.DecidedAt); err != nil {
+			return res, err
+		}
+		res.Exclusions = append(res.Exclusions, e)
+	}
+	return res, rows.Err()
+}
+
+// GET /admin/search?q=fragment, or ?voter=name for one voter's comments
+func adminSearchHandler(w http.ResponseWriter, r *http.Request) {
+	if !adminAuthorized(r) {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+	var req adminSearchRequest
+	if errs := bindAdminForm(r, &req); errs != nil {
+		http.Error(w, "Invalid search", http.StatusBadRequest)
+		return
+	}
+	q := strings.TrimSpace(req.Q)
+
+	data := map[string]interface{}{
+		"Q":     q,
+		"Voter": req.Voter,
+	}
+	if len([]rune(q)) >= 2 || req.Voter != "" {
+		res, err := adminSearch(r.Context(), q, req.Voter)
+		if err != nil {
+			serverError(w, r, err)
+			return
+		}
+		data["Results"] = res
+		data["Empty"] = len(res.People)+len(res.Comments)+len(res.Voters)+len(res.Exclusions) == 0
+	} else if q != "" {
+		data["TooShort"] = true
+	}
+
+	tmpl := parseTemplates("templates/search.html")
+	if err := tmpl.Execute(w, data); err != nil {
+		serverError(w, r, err)
+	}
+}
@@ -0,0 +1,271 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"net/http"
+	"strconv"
+	"time"
+
+	"macurate/validation"
+)
+
+// Seasons split the board into rounds. Closing one (admin page) records
+// everyone's final standing in season_results and starts every score
+// again from zero: the season's votes are set aside like undone ones,
+// with their direction kept in season_votes, so voters can vote for the
+// same people again and the old comments leave the board with them.
+// The current season is simply everything since the last one closed.
+
+// Season is one closed season.
+type Season struct {
+	ID        int       `json:"id"`
+	Name      string    `json:"name"`
+	StartedAt time.Time `json:"started_at"`
+	EndedAt   time.Time `json:"ended_at"`
+	People    int       `json:"people"` // with a result
+}
+
+// SeasonResult is one person's final standing in a season.
+type SeasonResult struct {
+	Rank      int    `json:"rank"` // 1 for the top; ties share a rank
+	PublicID  string `json:"public_id"`
+	Removed   bool   `json:"removed,omitempty"` // no longer on the board
+	Name      string `json:"name"`
+	Team      string `json:"team,omitempty"`
+	Score     int    `json:"score"`
+	Upvotes   int    `json:"upvotes"`
+	Downvotes int    `json:"downvotes"`
+}
+
+func createSeasonTables() error {
+	_, err := db.Exec(`
+    CREATE TABLE IF NOT EXISTS seasons (
+        id SERIAL PRIMARY KEY,
+        name TEXT NOT NULL,
+        started_at TIMESTAMPTZ NOT NULL,
+        ended_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+    );
+    CREATE TABLE IF NOT EXISTS season_results (
+        id SERIAL PRIMARY KEY,
+        season_id INTEGER NOT NULL REFERENCES seasons(id) ON DELETE CASCADE,
+        rank INTEGER NOT NULL,
+        person_id INTEGER REFERENCES people(id) ON DELETE SET NULL,
+        public_id TEXT NOT NULL DEFAULT '',
+        name TEXT NOT NULL,
+        team_id INTEGER,
+        team TEXT NOT NULL DEFAULT '',
+        score INTEGER NOT NULL,
+        upvotes INTEGER NOT NULL,
+        downvotes INTEGER NOT NULL
+    );
+    CREATE INDEX IF NOT EXISTS season_results_season_idx ON season_results (season_id, rank);
+    CREATE TABLE IF NOT EXISTS season_votes (
+        vote_id INTEGER PRIMARY KEY REFERENCES votes(id) ON DELETE CASCADE,
+        season_id INTEGER NOT NULL REFERENCES seasons(id) ON DELETE CASCADE,
+        upvote BOOLEAN NOT NULL
+    );
+    `)
+	return err
+}
+
+// Close the current season under name and reset every score. Votes are
+// blocked for the duration, so none lands between the snapshot and the
+// reset.
+func closeSeason(ctx context.Context, name string) (int, error) {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, "LOCK TABLE votes IN SHARE ROW EXCLUSIVE MODE"); err != nil {
+		return 0, err
+	}
+	var seasonID int
+	err = tx.QueryRowContext(ctx, `
+        INSERT INTO seasons (name, started_at)
+        VALUES ($1, COALESCE((SELECT MAX(ended_at) FROM seasons), (SELECT MIN(created_at) FROM votes), NOW()))
+        RETURNING id`, name).Scan(&seasonID)
+	if err != nil {
+		return 0, err
+	}
+	// Everyone gets a result, votes or not, ranked like the leaderboard
+	if _, err := tx.ExecContext(ctx, `
+        INSERT INTO season_results (season_id, rank, person_id, public_id, name, team_id, team, score, upvotes, downvotes)
+        SELECT $1, RANK() OVER (ORDER BY s.score DESC), p.id, COALESCE(p.public_id, ''), p.name,
+               p.team_id, COALESCE(t.name, ''), s.score, s.upvotes, s.downvotes
+        FROM (
+            SELECT p.id AS person_id,
+                   COALESCE(SUM(CASE WHEN v.upvote THEN 1 ELSE -1 END) FILTER (WHERE v.upvote IS NOT NULL), 0) AS score,
+                   COUNT(*) FILTER (WHERE v.upvote) AS upvotes,
+                   COUNT(*) FILTER (WHERE NOT v.upvote) AS downvotes
+            FROM people p LEFT JOIN votes v ON v.person_id = p.id
+            GROUP BY p.id
+        ) s
+        JOIN people p ON p.id = s.person_id
+        LEFT JOIN teams t ON t.id = p.team_id`, seasonID); err != nil {
+		return 0, err
+	}
+	if _, err := tx.ExecContext(ctx, `
+        INSERT INTO season_votes (vote_id, season_id, upvote)
+        SELECT id, $1, upvote FROM votes WHERE upvote IS NOT NULL`, seasonID); err != nil {
+		return 0, err
+	}
+	if _, err := tx.ExecContext(ctx, `
+        UPDATE votes SET upvote = NULL
+        WHERE id IN (SELECT vote_id FROM season_votes WHERE season_id = $1)`, seasonID); err != nil {
+		return 0, err
+	}
+
+	// The drop to zero goes into the score history like any other change
+	rows, err := tx.QueryContext(ctx, "SELECT person_id, score FROM season_results WHERE season_id = $1 AND score <> 0", seasonID)
+	if err != nil {
+		return 0, err
+	}
+	scores := map[int]int{}
+	for rows.Next() {
+		var id, score int
+		if err := rows.Scan(&id, &score); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		scores[id] = score
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+	for id, score := range scores {
+		if _, err := tx.ExecContext(ctx, "SELECT 1 FROM people WHERE id = $1 FOR NO KEY UPDATE", id); err != nil {
+			return 0, err
+		}
+		if _, err := tx.ExecContext(ctx, "INSERT INTO score_history (person_id, delta, new_score) VALUES ($1, $2, 0)", id, -score); err != nil {
+			return 0, err
+		}
+	}
+	return seasonID, tx.Commit()
+}
+
+func querySeasons(ctx context.Context) ([]Season, error) {
+	rows, err := db.QueryContext(ctx, `
+        SELECT s.id, s.name, s.started_at, s.ended_at, COUNT(r.id)
+        FROM seasons s LEFT JOIN season_results r ON r.season_id = s.id
+        GROUP BY s.id
+        ORDER BY s.ended_at DESC, s.id DESC`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	seasons := []Season{}
+	for rows.Next() {
+		var s Season
+		if err := rows.Scan(&s.ID, &s.Name, &s.StartedAt, &s.EndedAt, &s.People); err != nil {
+			return nil, err
+		}
+		seasons = append(seasons, s)
+	}
+	return seasons, rows.Err()
+}
+
+// GET /api/seasons: closed seasons, latest first
+func apiSeasonsHandler(w http.ResponseWriter, r *http.Request) {
+	seasons, err := querySeasons(r.Context())
+	if err != nil {
+		serverError(w, r, err)
+		return
+	}
+	var current interface{}
+	if len(seasons) > 0 {
+		current = seasons[0].EndedAt
+	}
+	writeJSONWithETag(w, r, map[string]interface{}{
+		"seasons":         seasons,
+		"current_started": current, // null before the first season closes
+	})
+}
+
+// GET /api/seasons/{id}/results (?limit=, default all): the final
+// standings. A closed season's scores are public even while the current
+// ones are hidden.
+func apiSeasonResultsHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		writeError(w, http.StatusNotFound, "not_found", "Season not found")
+		return
+	}
+	var req seasonResultsRequest
+	if errs := validation.Bind(r.URL.Query(), &req); errs != nil {
+		writeValidationError(w, errs)
+		return
+	}
+
+	var s Season
+	err = db.QueryRowContext(r.Context(), `
+        SELECT id, name, started_at, ended_at, (SELECT COUNT(*) FROM season_results WHERE season_id = s.id)
+        FROM seasons s WHERE id = $1`, id).Scan(&s.ID, &s.Name, &s.StartedAt, &s.EndedAt, &s.People)
+	if err == sql.ErrNoRows {
+		writeError(w, http.StatusNotFound, "not_found", "Season not found")
+		return
+	} else if err != nil {
+		serverError(w, r, err)
+		return
+	}
+
+	rows, err := db.QueryContext(r.Context(), `
+        SELECT rank, person_id IS NULL, public_id, name, team, score, upvotes, downvotes
+        FROM season_results
+        WHERE season_id = $1 AND ($2 = 0 OR team_id = $2)
+        ORDER BY rank, name
+        LIMIT NULLIF($3, 0)`, id, hostTeamID(r), req.Limit)
+	if err != nil {
+		serverError(w, r, err)
+		return
+	}
+	defer rows.Close()
+	results := []SeasonResult{}
+	for rows.Next() {
+		var e SeasonResult
+		if err := rows.Scan(&e.Rank, &e.Removed, &e.PublicID, &e.Name, &e.Team, &e.Score, &e.Upvotes, &e.Downvotes); err != nil {
+			serverError(w, r, err)
+			return
+		}
+		results = append(results, e)
+	}
+	if err := rows.Err(); err != nil {
+		serverError(w, r, err)
+		return
+	}
+
+	writeJSONWithETag(w, r, map[string]interface{}{
+		"season":  s,
+		"results": results,
+	})
+}
+
+// Close the current season (admin-only)
+func adminSeasonsHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if !adminAuthorized(r) {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	var req adminSeasonRequest
+	if errs := bindAdminForm(r, &req); errs != nil {
+		renderAdmin(w, r, errs)
+		return
+	}
+	if _, err := closeSeason(r.Context(), req.Name); err != nil {
+		serverError(w, r, err)
+		return
+	}
+	invalidatePeopleCache()
+	events.publish("resync", nil)
+
+	http.Redirect(w, r, "/admin", http.StatusSeeOther)
+}
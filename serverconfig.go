@@ -0,0 +1,250 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Startup settings, from the environment (CONFIG_FILE included, see
+// reload.go): PORT, DATABASE_URL, ADMIN_PASSWORD, CORS_ORIGIN and the
+// connection pool (DB_MAX_OPEN_CONNS, DB_MAX_IDLE_CONNS,
+// DB_CONN_MAX_LIFETIME, DB_LOCK_TIMEOUT, DB_QUERY_TIMEOUT). They are
+// checked together before anything is opened so a bad deployment fails
+// with every problem listed instead of starting half-configured. Only
+// CORS_ORIGIN is re-read on a reload. Images live in the database, so
+// there is no upload directory to set.
+type serverConfig struct {
+	Port          string
+	DatabaseURL   string
+	AdminPassword string   // only used to seed the first admin
+	CORSOrigins   []string // origins allowed to call /api/ from a browser
+
+	// Pool limits. database/sql keeps only 2 idle connections by default,
+	// so a burst of votes kept reconnecting; and without a cap a spike
+	// could exhaust the server's max_connections.
+	DBMaxOpenConns    int
+	DBMaxIdleConns    int
+	DBConnMaxLifetime time.Duration
+	// How long a statement waits for a row lock (say, two votes on the
+	// same person in one transaction) before failing; 0 waits forever
+	DBLockTimeout time.Duration
+	// Longest any one statement may run, background jobs included; off by
+	// default since exports and VACUUM legitimately take long. Requests
+	// are bounded by their route timeout either way.
+	DBQueryTimeout time.Duration
+}
+
+var serverCfg = defaultServerConfig()
+
+func defaultServerConfig() serverConfig {
+	return serverConfig{
+		Port:              "8080",
+		DBMaxOpenConns:    25,
+		DBMaxIdleConns:    10,
+		DBConnMaxLifetime: 30 * time.Minute,
+		DBLockTimeout:     5 * time.Second,
+	}
+}
+
+// Passwords that are as good as none
+var weakAdminPasswords = map[string]bool{
+	"admin": true, "password": true, "changeme": true, "12345678": true,
+	"macurate": true, "secret": true, "letmein": true,
+}
+
+func loadServerConfig() error {
+	cfg := defaultServerConfig()
+	cfg.Port = strings.TrimSpace(os.Getenv("PORT"))
+	cfg.DatabaseURL = os.Getenv("DATABASE_URL")
+	cfg.AdminPassword = os.Getenv("ADMIN_PASSWORD")
+	var errs []error
+	if cfg.Port == "" {
+		cfg.Port = "8080"
+	} else if n, err := strconv.Atoi(cfg.Port); err != nil || n < 1 || n > 65535 {
+		errs = append(errs, fmt.Errorf("PORT must be a number between 1 and 65535, got %q", cfg.Port))
+	}
+
+	if cfg.DatabaseURL == "" {
+		errs = append(errs, errors.New("DATABASE_URL is not set"))
+	} else if err := checkStoreURL(cfg.DatabaseURL); err != nil {
+		errs = append(errs, err)
+	}
+
+	if p := cfg.AdminPassword; p != "" {
+		if len(p) < minAdminPasswordLength {
+			errs = append(errs, fmt.Errorf("ADMIN_PASSWORD must be at least %d characters", minAdminPasswordLength))
+		} else if weakAdminPasswords[strings.ToLower(p)] {
+			errs = append(errs, errors.New("ADMIN_PASSWORD is a well-known password; pick another"))
+		}
+	}
+
+	origins, corsErrs := parseCORSOrigins(os.Getenv("CORS_ORIGIN"))
+	cfg.CORSOrigins = origins
+	errs = append(errs, corsErrs...)
+
+	for _, opt := range []struct {
+		key string
+		dst *int
+	}{
+		{"DB_MAX_OPEN_CONNS", &cfg.DBMaxOpenConns},
+		{"DB_MAX_IDLE_CONNS", &cfg.DBMaxIdleConns},
+	} {
+		if v := strings.TrimSpace(os.Getenv(opt.key)); v != "" {
+			n, err := strconv.Atoi(v)
+			if err != nil || n < 1 {
+				errs = append(errs, fmt.Errorf("%s must be a positive number, got %q", opt.key, v))
+				continue
+			}
+			*opt.dst = n
+		}
+	}
+	if cfg.DBMaxIdleConns > cfg.DBMaxOpenConns {
+		cfg.DBMaxIdleConns = cfg.DBMaxOpenConns
+	}
+	for _, opt := range []struct {
+		key string
+		dst *time.Duration
+	}{
+		{"DB_CONN_MAX_LIFETIME", &cfg.DBConnMaxLifetime},
+		{"DB_LOCK_TIMEOUT", &cfg.DBLockTimeout},
+		{"DB_QUERY_TIMEOUT", &cfg.DBQueryTimeout},
+	} {
+		if v := strings.TrimSpace(os.Getenv(opt.key)); v != "" {
+			d, err := time.ParseDuration(v)
+			if err != nil || d < 0 {
+				errs = append(errs, fmt.Errorf("%s must be a duration like 30s, got %q", opt.key, v))
+				continue
+			}
+			*opt.dst = d
+		}
+	}
+
+	if len(errs) > 0 {
+		msgs := make([]string, len(errs))
+		for i, err := range errs {
+			msgs[i] = err.Error()
+		}
+		return fmt.Errorf("invalid configuration: %s", strings.Join(msgs, "; "))
+	}
+	serverCfg = cfg
+	return nil
+}
+
+// The origins in a comma-separated CORS_ORIGIN, with an error for each
+// one that isn't an origin
+func parseCORSOrigins(v string) ([]string, []error) {
+	var origins []string
+	var errs []error
+	for _, origin := range strings.Split(v, ",") {
+		origin = strings.TrimRight(strings.TrimSpace(origin), "/")
+		if origin == "" {
+			continue
+		}
+		if origin == "*" {
+			errs = append(errs, errors.New("CORS_ORIGIN must list origins, not *"))
+			continue
+		}
+		u, err := url.Parse(origin)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" || u.Path != "" {
+			errs = append(errs, fmt.Errorf("CORS_ORIGIN: %q is not an origin like https://example.com", origin))
+			continue
+		}
+		origins = append(origins, origin)
+	}
+	return origins, errs
+}
+
+// Re-read CORS_ORIGIN on a reload; the rest of serverCfg stays as it was
+// at startup.
+func loadCORSConfig() error {
+	origins, errs := parseCORSOrigins(os.Getenv("CORS_ORIGIN"))
+	if len(errs) > 0 {
+		return errs[0]
+	}
+	configMu.Lock()
+	serverCfg.CORSOrigins = origins
+	configMu.Unlock()
+	return nil
+}
+
+func corsOrigins() []string {
+	configMu.RLock()
+	defer configMu.RUnlock()
+	return serverCfg.CORSOrigins
+}
+
+// Open DATABASE_URL with the pool limits applied. The timeouts go in as
+// connection parameters, so every pooled connection gets them, unless the
+// URL already sets them.
+func openDatabase(cfg serverConfig) (*sql.DB, error) {
+	dsn := cfg.DatabaseURL
+	for _, param := range []struct {
+		name string
+		d    time.Duration
+	}{
+		{"lock_timeout", cfg.DBLockTimeout},
+		{"statement_timeout", cfg.DBQueryTimeout},
+	} {
+		if param.d <= 0 || strings.Contains(dsn, param.name) {
+			continue
+		}
+		ms := strconv.FormatInt(param.d.Milliseconds(), 10)
+		if u, err := url.Parse(dsn); err == nil && (u.Scheme == "postgres" || u.Scheme == "postgresql") {
+			q := u.Query()
+			q.Set(param.name, ms)
+			u.RawQuery = q.Encode()
+			dsn = u.String()
+		} else {
+			dsn += " " + param.name + "=" + ms // key=value form
+		}
+	}
+	conn, err := sql.Open("postgres", dsn)
+	if err != nil {
+		return nil, err
+	}
+	conn.SetMaxOpenConns(cfg.DBMaxOpenConns)
+	conn.SetMaxIdleConns(cfg.DBMaxIdleConns)
+	conn.SetConnMaxLifetime(cfg.DBConnMaxLifetime)
+	conn.SetConnMaxIdleTime(5 * time.Minute)
+	return conn, nil
+}
+
+// Let the configured origins read /api/ responses. Cookies are never
+// allowed cross-origin; API keys travel in a header.
+func withCORS(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		origin := r.Header.Get("Origin")
+		origins := corsOrigins()
+		if origin == "" || len(origins) == 0 || !strings.HasPrefix(r.URL.Path, "/api/") {
+			next.ServeHTTP(w, r)
+			return
+		}
+		w.Header().Add("Vary", "Origin")
+		allowed := false
+		for _, o := range origins {
+			if o == origin {
+				allowed = true
+				break
+			}
+		}
+		if allowed {
+			w.Header().Set("Access-Control-Allow-Origin", origin)
+			w.Header().Set("Access-Control-Expose-Headers", "X-RateLimit-Limit, X-RateLimit-Remaining, X-RateLimit-Reset, Retry-After")
+			if r.Method == http.MethodOptions && r.Header.Get("Access-Control-Request-Method") != "" {
+				w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, PATCH, DELETE")
+				w.Header().Set("Access-Control-Allow-Headers", "Authorization, Content-Type, X-API-Key")
+				w.Header().Set("Access-Control-Max-Age", "600")
+				w.WriteHeader(http.StatusNoContent)
+				return
+			}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
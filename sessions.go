@@ -0,0 +1,263 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	adminCookieName = "macurate_admin"
+	adminSessionTTL = 7 * 24 * time.Hour
+
+	// Sessions unused for this long expire before their TTL
+	adminSessionIdle = 12 * time.Hour
+)
+
+type adminSessionCtxKey struct{}
+
+// AdminSession is a logged-in admin browser.
+type AdminSession struct {
+	ID         int
+	CreatedAt  time.Time
+	LastSeenAt time.Time
+	ExpiresAt  time.Time
+	IP         string
+	UserAgent  string
+	Username   string
+	Current    bool
+}
+
+func createSessionTables() error {
+	_, err := db.Exec(`
+    CREATE TABLE IF NOT EXISTS admin_sessions (
+        id SERIAL PRIMARY KEY,
+        token_hash TEXT NOT NULL UNIQUE,
+        created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+        last_seen_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+        expires_at TIMESTAMPTZ NOT NULL,
+        ip TEXT NOT NULL DEFAULT '',
+        user_agent TEXT NOT NULL DEFAULT ''
+    );
+    `)
+	return err
+}
+
+// Start a new admin session and set its cookie
+func createAdminSession(w http.ResponseWriter, r *http.Request, adminID int) error {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return err
+	}
+	token := hex.EncodeToString(b)
+	expires := time.Now().Add(adminSessionTTL)
+	if _, err := db.ExecContext(r.Context(),
+		"DELETE FROM admin_sessions WHERE expires_at <= NOW() OR last_seen_at <= NOW() - $1 * INTERVAL '1 second'",
+		int(adminSessionIdle.Seconds()),
+	); err != nil {
+		return err
+	}
+	if _, err := db.ExecContext(r.Context(),
+		"INSERT INTO admin_sessions (token_hash, expires_at, ip, user_agent, admin_id) VALUES ($1, $2, $3, $4, $5)",
+		hashAPIKey(token), expires, clientIP(r), r.UserAgent(), adminID,
+	); err != nil {
+		return err
+	}
+	http.SetCookie(w, newCookie(r, adminCookieName, token, expires))
+	return nil
+}
+
+// The admin session behind this request's cookie, touching its last-seen time.
+// Reuses the lookup already done by withAdminSessions when there was one.
+func currentAdminSession(r *http.Request) (int, bool) {
+	if id, ok := r.Context().Value(adminSessionCtxKey{}).(int); ok {
+		return id, true
+	}
+	token, ok := readCookie(r, adminCookieName)
+	if !ok {
+		return 0, false
+	}
+	var id int
+	err := db.QueryRowContext(r.Context(), `
+        UPDATE admin_sessions SET last_seen_at = NOW(), ip = $2, user_agent = $3
+        WHERE token_hash = $1 AND expires_at > NOW() AND last_seen_at > NOW() - $4 * INTERVAL '1 second'
+        RETURNING id`, hashAPIKey(token), clientIP(r), r.UserAgent(), int(adminSessionIdle.Seconds())).Scan(&id)
+	if err != nil {
+		return 0, false
+	}
+	return id, true
+}
+
+// Every /admin/* route except login and logout needs a live session; the
+// admin password alone no longer opens admin pages. Browsers are sent to the
+// login form, the admin JSON API gets a 401.
+func withAdminSessions(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		p := r.URL.Path
+		if (p != "/admin" && !strings.HasPrefix(p, "/admin/")) || p == "/admin/login" || p == "/admin/logout" {
+			next.ServeHTTP(w, r)
+			return
+		}
+		id, ok := currentAdminSession(r)
+		if !ok {
+			switch {
+			case strings.HasPrefix(p, "/admin/api/"):
+				writeError(w, http.StatusUnauthorized, "unauthorized", "Log in as an admin first")
+			case r.Method == http.MethodGet:
+				http.Redirect(w, r, "/admin/login", http.StatusSeeOther)
+			default:
+				http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			}
+			return
+		}
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), adminSessionCtxKey{}, id)))
+	})
+}
+
+// Admin access: a live session cookie. A stale or forged cookie is delayed
+// like a failed login.
+func adminAuthorized(r *http.Request) bool {
+	start := time.Now()
+	if _, ok := currentAdminSession(r); ok {
+		return true
+	}
+	if _, hasCookie := readCookie(r, adminCookieName); hasCookie {
+		delayAuthFailure(start)
+	}
+	return false
+}
+
+// Remote address without the port. Behind a trusted proxy (TRUST_PROXY) it
+// is the last X-Forwarded-For hop, the address the proxy itself saw.
+func clientIP(r *http.Request) string {
+	if cookieCfg.TrustProxy {
+		if xff := r.Header.Get("X-Forwarded-For"); xff != "" {
+			hops := strings.Split(xff, ",")
+			if ip := strings.TrimSpace(hops[len(hops)-1]); ip != "" {
+				return ip
+			}
+		}
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+func listAdminSessions(currentID int) ([]AdminSession, error) {
+	rows, err := db.Query(`
+        SELECT s.id, s.created_at, s.last_seen_at, s.expires_at, s.ip, s.user_agent, a.username
+        FROM admin_sessions s JOIN admins a ON a.id = s.admin_id
+        WHERE expires_at > NOW() AND last_seen_at > NOW() - $1 * INTERVAL '1 second'
+        ORDER BY last_seen_at DESC`, int(adminSessionIdle.Seconds()))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var list []AdminSession
+	for rows.Next() {
+		var s AdminSession
+		if err := rows.Scan(&s.ID, &s.CreatedAt, &s.LastSeenAt, &s.ExpiresAt, &s.IP, &s.UserAgent, &s.Username); err != nil {
+			return nil, err
+		}
+		s.Current = s.ID == currentID
+		list = append(list, s)
+	}
+	return list, rows.Err()
+}
+
+// Admin login form; a correct username and password start a session
+func adminLoginHandler(w http.ResponseWriter, r *http.Request) {
+	if setupNeeded() {
+		http.Redirect(w, r, "/setup", http.StatusSeeOther)
+		return
+	}
+	data := map[string]interface{}{}
+	if r.Method == http.MethodPost {
+		ok, err := loginAdmin(w, r, r.FormValue("username"), r.FormValue("password"))
+		if err != nil {
+			serverError(w, r, err)
+			return
+		}
+		if ok {
+			http.Redirect(w, r, "/admin", http.StatusSeeOther)
+			return
+		}
+		w.WriteHeader(http.StatusUnauthorized)
+		data["Error"] = "Wrong username or password"
+	}
+	tmpl := parseTemplates("templates/login.html")
+	if err := tmpl.Execute(w, data); err != nil {
+		serverError(w, r, err)
+	}
+}
+
+// End the current admin session
+func adminLogoutHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if token, ok := readCookie(r, adminCookieName); ok {
+		if _, err := db.ExecContext(r.Context(), "DELETE FROM admin_sessions WHERE token_hash = $1", hashAPIKey(token)); err != nil {
+			serverError(w, r, err)
+			return
+		}
+	}
+	http.SetCookie(w, newCookie(r, adminCookieName, "", time.Time{}))
+	http.Redirect(w, r, "/admin/login", http.StatusSeeOther)
+}
+
+// List active admin sessions; POST revokes one (id) or all but the current one (admin-only)
+func adminSessionsHandler(w http.ResponseWriter, r *http.Request) {
+	if !adminAuthorized(r) {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+	currentID, _ := currentAdminSession(r)
+
+	if r.Method == http.MethodPost {
+		var err error
+		switch r.FormValue("action") {
+		case "revoke":
+			id, convErr := strconv.Atoi(r.FormValue("id"))
+			if convErr != nil || id <= 0 {
+				http.Error(w, "Invalid id", http.StatusBadRequest)
+				return
+			}
+			_, err = db.ExecContext(r.Context(), "DELETE FROM admin_sessions WHERE id = $1", id)
+		case "revoke_others":
+			_, err = db.ExecContext(r.Context(), "DELETE FROM admin_sessions WHERE id <> $1", currentID)
+		default:
+			http.Error(w, "Invalid action", http.StatusBadRequest)
+			return
+		}
+		if err != nil {
+			serverError(w, r, err)
+			return
+		}
+		http.Redirect(w, r, "/admin/sessions", http.StatusSeeOther)
+		return
+	}
+
+	sessions, err := listAdminSessions(currentID)
+	if err != nil && err != sql.ErrNoRows {
+		serverError(w, r, err)
+		return
+	}
+	tmpl := parseTemplates("templates/sessions.html")
+	data := map[string]interface{}{
+		"Sessions": sessions,
+	}
+	if err := tmpl.Execute(w, data); err != nil {
+		serverError(w, r, err)
+	}
+}
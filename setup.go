@@ -0,0 +1,137 @@
+package main
+
+import (
+	"crypto/subtle"
+	"fmt"
+	"net/http"
+	"os"
+
+	"macurate/validation"
+)
+
+// First-run setup: while no admin account exists, /setup names the board,
+// creates the first admin, picks the voting mode and can seed demo people.
+// Set SETUP_TOKEN to require ?token= on the form, so a public deployment
+// can't be claimed by whoever finds it first.
+
+var demoPeople = []string{"Alex", "Sam", "Robin", "Charlie", "Jordan"}
+
+func setupNeeded() bool {
+	var n int
+	if err := db.QueryRow("SELECT COUNT(*) FROM admins").Scan(&n); err != nil {
+		return false
+	}
+	return n == 0
+}
+
+func setupTokenOK(r *http.Request) bool {
+	want := os.Getenv("SETUP_TOKEN")
+	return want == "" || subtle.ConstantTimeCompare([]byte(r.FormValue("token")), []byte(want)) == 1
+}
+
+func setupHandler(w http.ResponseWriter, r *http.Request) {
+	if !setupNeeded() {
+		http.NotFound(w, r)
+		return
+	}
+	if !setupTokenOK(r) {
+		http.Error(w, "Setup token required", http.StatusForbidden)
+		return
+	}
+
+	data := map[string]interface{}{
+		"Token":     r.FormValue("token"),
+		"BoardName": currentBoardName(),
+	}
+	if r.Method == http.MethodPost {
+		errs, err := runSetup(w, r)
+		if err != nil {
+			serverError(w, r, err)
+			return
+		}
+		if errs == nil {
+			http.Redirect(w, r, "/admin", http.StatusSeeOther)
+			return
+		}
+		data["Errors"] = errs
+		w.WriteHeader(http.StatusBadRequest)
+	}
+
+	tmpl := parseTemplates("templates/setup.html")
+	if err := tmpl.Execute(w, data); err != nil {
+		serverError(w, r, err)
+	}
+}
+
+// Apply the setup form and log the new admin in. Field problems come back
+// as errors for the form; err is for everything else.
+func runSetup(w http.ResponseWriter, r *http.Request) (validation.Errors, error) {
+	var req setupRequest
+	if errs := bindAdminForm(r, &req); errs != nil {
+		return errs, nil
+	}
+	password := r.PostFormValue("password")
+	if len(password) < minAdminPasswordLength {
+		return validation.Errors{"password": fmt.Sprintf("must be at least %d characters", minAdminPasswordLength)}, nil
+	}
+	if password != r.PostFormValue("confirm") {
+		return validation.Errors{"confirm": "does not match"}, nil
+	}
+
+	tx, err := db.BeginTx(r.Context(), nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	// Only one setup may win, however many browsers submit at once
+	if _, err := tx.Exec("LOCK TABLE admins IN EXCLUSIVE MODE"); err != nil {
+		return nil, err
+	}
+	var n int
+	if err := tx.QueryRow("SELECT COUNT(*) FROM admins").Scan(&n); err != nil {
+		return nil, err
+	}
+	if n > 0 {
+		return validation.Errors{"form": "setup has already been completed"}, nil
+	}
+	hash, err := hashAdminPassword(password)
+	if err != nil {
+		return nil, err
+	}
+	var adminID int
+	if err := tx.QueryRow(
+		"INSERT INTO admins (username, password_hash) VALUES ($1, $2) RETURNING id",
+		req.Username, hash,
+	).Scan(&adminID); err != nil {
+		return nil, err
+	}
+	for key, value := range map[string]string{"board_name": req.BoardName, "voting_mode": req.VotingMode} {
+		if _, err := tx.Exec(`
+            INSERT INTO settings (key, value) VALUES ($1, $2)
+            ON CONFLICT (key) DO UPDATE SET value = EXCLUDED.value`, key, value); err != nil {
+			return nil, err
+		}
+	}
+	if req.Demo {
+		var people int
+		if err := tx.QueryRow("SELECT COUNT(*) FROM people").Scan(&people); err != nil {
+			return nil, err
+		}
+		if people == 0 {
+			for _, name := range demoPeople {
+				if _, err := tx.Exec("INSERT INTO people (name, public_id) VALUES ($1, $2)", name, newPublicID()); err != nil {
+					return nil, err
+				}
+			}
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	loadBoardName()
+	notifyInstances("board_name")
+	invalidatePeopleCache()
+	return nil, createAdminSession(w, r, adminID)
+}
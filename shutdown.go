@@ -0,0 +1,73 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+)
+
+// SHUTDOWN_TIMEOUT bounds how long in-flight requests get to finish after
+// SIGINT/SIGTERM before the server gives up on them.
+func shutdownTimeout() (time.Duration, error) {
+	v := os.Getenv("SHUTDOWN_TIMEOUT")
+	if v == "" {
+		return 15 * time.Second, nil
+	}
+	d, err := time.ParseDuration(v)
+	if err != nil || d <= 0 {
+		return 0, fmt.Errorf("SHUTDOWN_TIMEOUT: must be a positive duration")
+	}
+	return d, nil
+}
+
+// Serve until SIGINT or SIGTERM, then stop accepting connections, drain the
+// in-flight requests and close the database.
+func serveUntilSignal(srv *http.Server, tls bool) error {
+	timeout, err := shutdownTimeout()
+	if err != nil {
+		return err
+	}
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	// Requests inherit this, so handlers see cancellation once draining times out
+	base, cancelRequests := context.WithCancel(context.Background())
+	defer cancelRequests()
+	srv.BaseContext = func(net.Listener) context.Context { return base }
+
+	errc := make(chan error, 1)
+	go func() {
+		if tls {
+			errc <- srv.ListenAndServeTLS("", "")
+		} else {
+			errc <- srv.ListenAndServe()
+		}
+	}()
+
+	select {
+	case err := <-errc:
+		return err
+	case <-ctx.Done():
+	}
+	stop() // a second signal kills the process the usual way
+	slog.Info("shutting down, draining requests", "timeout", timeout)
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	err = srv.Shutdown(shutdownCtx)
+	cancelRequests()
+	if err != nil {
+		slog.Error("shutdown", "err", err)
+	}
+	if err := <-errc; err != nil && !errors.Is(err, http.ErrServerClosed) {
+		slog.Error("shutdown", "err", err)
+	}
+	return db.Close()
+}
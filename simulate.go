@@ -0,0 +1,113 @@
+package main
+
+import (
+	"database/sql"
+	"net/http"
+	"time"
+
+	"macurate/ranking"
+)
+
+// What-if for ranking algorithms: replay the vote log of the current or a
+// closed season through any registered algorithm and put the board it
+// would give next to the one the live algorithm gives, so organizers can
+// pick next season's scoring from real votes. Nothing is saved.
+
+// SimulatedRank is one person on the simulated board.
+type SimulatedRank struct {
+	Rank    int // on the simulated board, from 1
+	Was     int // on the live algorithm's board
+	Change  int // places gained; negative for lost
+	Name    string
+	Value   float64 // under the simulated algorithm
+	Upvotes int
+	Votes   int
+}
+
+// GET /admin/simulate?algorithm=wilson&season=3 (season 0, the default,
+// is the current one)
+func adminSimulateHandler(w http.ResponseWriter, r *http.Request) {
+	if !adminAuthorized(r) {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+	var req adminSimulateRequest
+	if errs := bindAdminForm(r, &req); errs != nil {
+		http.Error(w, "Invalid simulation", http.StatusBadRequest)
+		return
+	}
+	live := getRankingAlgorithm()
+	if _, ok := ranking.Lookup(req.Algorithm); !ok {
+		req.Algorithm = live
+	}
+	if req.Limit == 0 {
+		req.Limit = 50
+	}
+
+	seasons, err := querySeasons(r.Context())
+	if err != nil {
+		serverError(w, r, err)
+		return
+	}
+	// A closed season replays to the moment it closed, so decay-based
+	// algorithms see it as it ended
+	now := time.Now()
+	if req.Season != 0 {
+		err := db.QueryRowContext(r.Context(), "SELECT ended_at FROM seasons WHERE id = $1", req.Season).Scan(&now)
+		if err == sql.ErrNoRows {
+			http.Error(w, "Season not found", http.StatusNotFound)
+			return
+		} else if err != nil {
+			serverError(w, r, err)
+			return
+		}
+	}
+
+	people, err := queryPeople(r.Context(), "name")
+	if err != nil {
+		serverError(w, r, err)
+		return
+	}
+	votes, err := loadVoteLog(r.Context(), req.Season)
+	if err != nil {
+		serverError(w, r, err)
+		return
+	}
+
+	was := map[int]int{}
+	for i, e := range replayVotes(live, people, votes, now) {
+		was[e.ID] = i + 1
+	}
+	algo, _ := ranking.Lookup(req.Algorithm)
+	board := []SimulatedRank{}
+	moved := 0
+	for i, e := range replayVotes(req.Algorithm, people, votes, now) {
+		s := SimulatedRank{
+			Rank: i + 1, Was: was[e.ID], Name: e.Name,
+			Value: algo.Rank(e, now), Upvotes: e.Upvotes, Votes: e.Upvotes + e.Downvotes,
+		}
+		s.Change = s.Was - s.Rank
+		if s.Change != 0 {
+			moved++
+		}
+		if i < req.Limit {
+			board = append(board, s)
+		}
+	}
+
+	data := map[string]interface{}{
+		"Algorithm":  req.Algorithm,
+		"Live":       live,
+		"Algorithms": ranking.Names(),
+		"Season":     req.Season,
+		"Seasons":    seasons,
+		"Votes":      len(votes),
+		"People":     len(people),
+		"Moved":      moved,
+		"Board":      board,
+	}
+	tmpl := parseTemplates("templates/simulate.html")
+	if err := tmpl.Execute(w, data); err != nil {
+		serverError(w, r, err)
+	}
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+
+	"macurate/validation"
+)
+
+// Star ratings (1–5) next to, or instead of, up/down votes. A voter has
+// one rating per person and rating again replaces it; ratings don't
+// change the score, they're shown as an average of their own. Comments
+// still go with up/down votes, so a stars-only board takes no comments.
+// Rating needs the voter cookie, so behind a consent gate only visitors
+// who accepted it can rate.
+
+// Vote types the board accepts (setting vote_type)
+const (
+	voteTypeUpDown = "updown"
+	voteTypeStars  = "stars"
+	voteTypeBoth   = "both"
+)
+
+// RatingSummary is a person's star ratings.
+type RatingSummary struct {
+	Average float64 `json:"average"`
+	Count   int     `json:"count"`
+}
+
+func getVoteType() string {
+	switch v := getSetting("vote_type", voteTypeUpDown); v {
+	case voteTypeStars, voteTypeBoth:
+		return v
+	}
+	return voteTypeUpDown
+}
+
+func starsEnabled() bool {
+	return getVoteType() != voteTypeUpDown
+}
+
+func createRatingTables() error {
+	_, err := db.Exec(`
+    CREATE TABLE IF NOT EXISTS ratings (
+        id SERIAL PRIMARY KEY,
+        person_id INTEGER NOT NULL REFERENCES people(id) ON DELETE CASCADE,
+        rating SMALLINT NOT NULL CHECK (rating BETWEEN 1 AND 5),
+        voter_id TEXT NOT NULL,
+        created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+        UNIQUE (person_id, voter_id)
+    );
+    `)
+	return err
+}
+
+// What a vote request must carry under the board's vote type
+func checkVoteType(voteType string, req voteRequest) validation.Errors {
+	switch voteType {
+	case voteTypeUpDown:
+		if req.Vote == "" {
+			return validation.Errors{"vote": "is required"}
+		}
+		if req.Rating != 0 {
+			return validation.Errors{"rating": "star ratings are off"}
+		}
+	case voteTypeStars:
+		if req.Rating == 0 {
+			return validation.Errors{"rating": "is required"}
+		}
+		if req.Vote != "" {
+			return validation.Errors{"vote": "up/down votes are off"}
+		}
+	default:
+		if req.Vote == "" && req.Rating == 0 {
+			return validation.Errors{"rating": "or vote is required"}
+		}
+	}
+	return nil
+}
+
+// Save voterID's rating of personID, replacing an earlier one
+func saveRating(tx *sql.Tx, personID int, voterID string, rating int) error {
+	_, err := tx.Exec(`
+        INSERT INTO ratings (person_id, voter_id, rating) VALUES ($1, $2, $3)
+        ON CONFLICT (person_id, voter_id) DO UPDATE SET rating = EXCLUDED.rating, created_at = NOW()`,
+		personID, voterID, rating)
+	return err
+}
+
+// Rating summaries for every person rated at least once, keyed by person id
+func ratingsByPerson(ctx context.Context) (map[int]RatingSummary, error) {
+	rows, err := db.QueryContext(ctx, `
+        SELECT person_id, ROUND(AVG(rating), 2), COUNT(*)
+        FROM ratings GROUP BY person_id`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	summaries := make(map[int]RatingSummary)
+	for rows.Next() {
+		var personID int
+		var s RatingSummary
+		if err := rows.Scan(&personID, &s.Average, &s.Count); err != nil {
+			return nil, err
+		}
+		summaries[personID] = s
+	}
+	return summaries, rows.Err()
+}
@@ -0,0 +1,50 @@
+// Keep the cards current without reloading: the board listens on /ws and,
+// when someone votes, refetches that person's totals from the API (which
+// already hides scores when it should). Reconnects with backoff.
+(function() {
+  if (!('WebSocket' in window)) return;
+
+  function updateCard(person) {
+    const box = document.querySelector(`.person-box[data-id="${person.public_id}"]`);
+    if (!box || person.hidden) return;
+    const badge = box.querySelector('.score-badge');
+    if (badge) {
+      badge.textContent = person.score;
+      badge.classList.remove('positive', 'negative', 'neutral');
+      badge.classList.add(person.score < 0 ? 'negative' : person.score === 0 ? 'neutral' : 'positive');
+    }
+    const counts = box.querySelector('.vote-counts');
+    if (counts) counts.textContent = `👍 ${person.upvotes} · 👎 ${person.downvotes}`;
+  }
+
+  function refreshPerson(id) {
+    fetch(`/api/v1/people/${id}`)
+      .then(res => res.ok ? res.json() : Promise.reject())
+      .then(updateCard)
+      .catch(() => {});
+  }
+
+  // Missed events: refresh every card at once
+  function refreshAll() {
+    fetch('/api/v1/people')
+      .then(res => res.ok ? res.json() : Promise.reject())
+      .then(data => data.people.forEach(updateCard))
+      .catch(() => {});
+  }
+
+  let retry = 1000;
+  function connect() {
+    const ws = new WebSocket(`${location.protocol === 'https:' ? 'wss' : 'ws'}://${location.host}/ws`);
+    ws.onopen = () => { retry = 1000; };
+    ws.onmessage = (msg) => {
+      const ev = JSON.parse(msg.data);
+      if ((ev.kind === 'vote' || ev.kind === 'vote_undone') && ev.data) refreshPerson(ev.data.public_id);
+      if (ev.kind === 'resync') refreshAll();
+    };
+    ws.onclose = () => {
+      setTimeout(() => { connect(); refreshAll(); }, retry);
+      retry = Math.min(retry * 2, 30000);
+    };
+  }
+  connect();
+})();
@@ -0,0 +1,10 @@
+// Service worker for follow notifications (see push.js)
+self.addEventListener('push', function(event) {
+  const data = event.data ? event.data.json() : { title: 'MacuRate', body: '' };
+  event.waitUntil(self.registration.showNotification(data.title, { body: data.body, data: { url: data.url || '/' } }));
+});
+
+self.addEventListener('notificationclick', function(event) {
+  event.notification.close();
+  event.waitUntil(clients.openWindow(event.notification.data.url));
+});
@@ -0,0 +1,57 @@
+// Follow people and get a browser notification when they get comments.
+// Following asks for notification permission once and registers the push
+// subscription with the server; the bell shows who you follow.
+(function() {
+  function keyBytes(b64) {
+    const pad = '='.repeat((4 - b64.length % 4) % 4);
+    const raw = atob((b64 + pad).replace(/-/g, '+').replace(/_/g, '/'));
+    return Uint8Array.from(raw, c => c.charCodeAt(0));
+  }
+
+  function post(url, fields) {
+    return fetch(url, { method: 'POST', body: new URLSearchParams(fields), credentials: 'same-origin' });
+  }
+
+  async function ensureSubscription() {
+    if (!('serviceWorker' in navigator) || !('PushManager' in window)) {
+      throw new Error('This browser does not support push notifications.');
+    }
+    const reg = await navigator.serviceWorker.register('/static/js/push-sw.js');
+    let sub = await reg.pushManager.getSubscription();
+    if (!sub) {
+      const res = await fetch('/api/v1/push/key');
+      if (!res.ok) throw new Error('Push notifications are not available.');
+      const { public_key } = await res.json();
+      sub = await reg.pushManager.subscribe({ userVisibleOnly: true, applicationServerKey: keyBytes(public_key) });
+    }
+    const json = sub.toJSON();
+    await post('/api/v1/push/subscribe', { endpoint: json.endpoint, p256dh: json.keys.p256dh, auth: json.keys.auth });
+  }
+
+  function mark(button, on) {
+    button.dataset.following = on ? '1' : '';
+    button.textContent = on ? '🔔' : '🔕';
+    button.title = on ? 'Unfollow' : 'Follow';
+  }
+
+  window.toggleFollow = async function(button) {
+    const id = button.dataset.follow;
+    const following = !!button.dataset.following;
+    try {
+      if (!following) await ensureSubscription();
+      const res = await fetch('/api/v1/people/' + id + '/follow', { method: following ? 'DELETE' : 'POST', credentials: 'same-origin' });
+      if (!res.ok) throw new Error(await res.text());
+      mark(button, !following);
+    } catch (err) {
+      alert(err.message);
+    }
+  };
+
+  document.addEventListener('DOMContentLoaded', async function() {
+    const res = await fetch('/api/v1/follows', { credentials: 'same-origin' });
+    if (!res.ok) return;
+    const { public_ids } = await res.json();
+    const followed = new Set(public_ids);
+    document.querySelectorAll('[data-follow]').forEach(b => mark(b, followed.has(b.dataset.follow)));
+  });
+})();
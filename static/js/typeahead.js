@@ -0,0 +1,61 @@
+// Minimal typeahead over /api/v1/suggest.
+// attachTypeahead(input, onPick) calls onPick({id, name, thumbnail}) when a
+// suggestion is chosen.
+function attachTypeahead(input, onPick) {
+  const list = document.createElement('div');
+  list.className = 'typeahead-list';
+  list.style.cssText = 'position:absolute; background:#fff; border:1px solid #ccc; border-radius:4px;' +
+    'box-shadow:0 2px 5px rgba(0,0,0,0.15); z-index:500; display:none; min-width:200px;';
+  input.parentNode.style.position = input.parentNode.style.position || 'relative';
+  input.insertAdjacentElement('afterend', list);
+
+  let timer = null;
+  let seq = 0;
+
+  function hide() {
+    list.style.display = 'none';
+  }
+
+  function render(items) {
+    list.innerHTML = '';
+    items.forEach(item => {
+      const row = document.createElement('div');
+      row.style.cssText = 'display:flex; align-items:center; gap:8px; padding:4px 8px; cursor:pointer;';
+      const img = document.createElement('img');
+      img.src = item.thumbnail;
+      img.alt = '';
+      img.style.cssText = 'width:24px; height:24px; object-fit:cover; border-radius:50%;';
+      const name = document.createElement('span');
+      name.textContent = item.name;
+      row.appendChild(img);
+      row.appendChild(name);
+      row.addEventListener('mousedown', e => {
+        e.preventDefault();
+        input.value = item.name;
+        hide();
+        onPick(item);
+      });
+      list.appendChild(row);
+    });
+    list.style.display = items.length ? 'block' : 'none';
+  }
+
+  input.addEventListener('input', () => {
+    clearTimeout(timer);
+    const q = input.value.trim();
+    if (!q) {
+      hide();
+      return;
+    }
+    timer = setTimeout(() => {
+      const mine = ++seq;
+      fetch(`/api/v1/suggest?q=${encodeURIComponent(q)}`)
+        .then(res => res.ok ? res.json() : Promise.reject())
+        .then(data => {
+          if (mine === seq) render(data.suggestions);
+        })
+        .catch(hide);
+    }, 150);
+  });
+  input.addEventListener('blur', hide);
+}
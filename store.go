@@ -0,0 +1,106 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"net/url"
+	"time"
+)
+
+// Store is the database the board runs on. Everything reaches it through
+// the package-level db, so the implementation is picked once, from the
+// DATABASE_URL scheme, by openStore. Postgres is the only one: several
+// instances share a single database, which rules out a file on local disk.
+//
+// Besides plain SQL, a Store keeps the state that has to be shared between
+// instances to mean anything, such as the rate limiting token buckets.
+type Store interface {
+	Exec(query string, args ...interface{}) (sql.Result, error)
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+	Query(query string, args ...interface{}) (*sql.Rows, error)
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+	QueryRow(query string, args ...interface{}) *sql.Row
+	QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row
+	Begin() (*sql.Tx, error)
+	BeginTx(ctx context.Context, opts *sql.TxOptions) (*sql.Tx, error)
+	Conn(ctx context.Context) (*sql.Conn, error)
+	Ping() error
+	PingContext(ctx context.Context) error
+	Stats() sql.DBStats
+	Close() error
+
+	// Take a token from the named bucket, which holds up to capacity and
+	// refills at rate tokens a second, or with take false only look at it.
+	// Returns whether a token was there and how many are left.
+	TakeToken(ctx context.Context, bucket string, capacity int, rate float64, take bool) (bool, float64, error)
+}
+
+// Open the Store DATABASE_URL names (checked by loadServerConfig)
+func openStore(cfg serverConfig) (Store, error) {
+	conn, err := openDatabase(cfg)
+	if err != nil {
+		return nil, err
+	}
+	return postgresStore{conn}, nil
+}
+
+// A URL must be postgres:// or postgresql://; a key=value connection
+// string is Postgres too
+func checkStoreURL(dsn string) error {
+	u, err := url.Parse(dsn)
+	if err != nil || u.Scheme == "" || u.Scheme == "postgres" || u.Scheme == "postgresql" {
+		return nil
+	}
+	return fmt.Errorf("DATABASE_URL: unsupported database %q, only postgres:// is", u.Scheme)
+}
+
+type postgresStore struct {
+	*sql.DB
+}
+
+func createStoreTables() error {
+	_, err := db.Exec(`
+    CREATE TABLE IF NOT EXISTS rate_limit_buckets (
+        bucket TEXT PRIMARY KEY,
+        tokens DOUBLE PRECISION NOT NULL,
+        updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+    );
+    `)
+	return err
+}
+
+// One statement takes the token, so instances racing for the last one
+// can't both get it. A refused take leaves the row alone: refilling is
+// linear, so the old tokens and time still give the right level later.
+func (s postgresStore) TakeToken(ctx context.Context, bucket string, capacity int, rate float64, take bool) (bool, float64, error) {
+	level := `LEAST($2::float8, b.tokens + EXTRACT(EPOCH FROM clock_timestamp() - b.updated_at) * $3::float8)`
+	if take && capacity >= 1 {
+		var left float64
+		err := s.QueryRowContext(ctx, `
+            INSERT INTO rate_limit_buckets AS b (bucket, tokens, updated_at)
+            VALUES ($1, $2::float8 - 1, clock_timestamp())
+            ON CONFLICT (bucket) DO UPDATE SET tokens = `+level+` - 1, updated_at = clock_timestamp()
+            WHERE `+level+` >= 1
+            RETURNING tokens`, bucket, capacity, rate).Scan(&left)
+		if err != sql.ErrNoRows {
+			return err == nil, left, err
+		}
+	}
+	tokens := float64(capacity)
+	err := s.QueryRowContext(ctx, "SELECT "+level+" FROM rate_limit_buckets b WHERE bucket = $1", bucket, capacity, rate).Scan(&tokens)
+	if err != nil && err != sql.ErrNoRows {
+		return false, 0, err
+	}
+	// A take that was refused stays refused, even if the bucket has
+	// refilled by now
+	return tokens >= 1 && !take, tokens, nil
+}
+
+// Buckets untouched this long are full again for any per-minute limit
+const rateLimitBucketTTL = time.Hour
+
+func pruneRateLimitBuckets() error {
+	_, err := db.Exec("DELETE FROM rate_limit_buckets WHERE updated_at < NOW() - $1 * INTERVAL '1 second'", int(rateLimitBucketTTL.Seconds()))
+	return err
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	suggestLimit    = 10
+	suggestCacheTTL = 30 * time.Second
+)
+
+// Suggestion is a lightweight typeahead match.
+type Suggestion struct {
+	PublicID  string `json:"public_id"`
+	Name      string `json:"name"`
+	Thumbnail string `json:"thumbnail"`
+}
+
+type suggestEntry struct {
+	at      time.Time
+	results []Suggestion
+}
+
+var (
+	suggestCacheMu sync.Mutex
+	suggestCache   = map[string]suggestEntry{}
+)
+
+func createSuggestIndex() error {
+	_, err := db.Exec(`CREATE INDEX IF NOT EXISTS people_name_lower_idx ON people (lower(name) text_pattern_ops)`)
+	return err
+}
+
+// Escape LIKE wildcards in user input
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(s)
+}
+
+// Name-prefix matches first (served by the index), then substring matches
+func findSuggestions(ctx context.Context, q string) ([]Suggestion, error) {
+	pattern := escapeLike(strings.ToLower(q))
+	rows, err := db.QueryContext(ctx, `
+        (SELECT COALESCE(public_id, ''), name, 0 AS rank FROM people WHERE lower(name) LIKE $1 || '%' ORDER BY name LIMIT $2)
+        UNION ALL
+        (SELECT COALESCE(public_id, ''), name, 1 AS rank FROM people
+         WHERE lower(name) LIKE '%' || $1 || '%' AND lower(name) NOT LIKE $1 || '%'
+         ORDER BY name LIMIT $2)
+        ORDER BY rank, name
+        LIMIT $2`, pattern, suggestLimit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	list := []Suggestion{}
+	for rows.Next() {
+		var s Suggestion
+		var rank int
+		if err := rows.Scan(&s.PublicID, &s.Name, &rank); err != nil {
+			return nil, err
+		}
+		s.Thumbnail = "/images/" + s.PublicID
+		list = append(list, s)
+	}
+	return list, rows.Err()
+}
+
+// Typeahead: up to 10 people matching ?q=
+func apiSuggestHandler(w http.ResponseWriter, r *http.Request) {
+	q := strings.TrimSpace(r.URL.Query().Get("q"))
+	if q == "" {
+		writeJSON(w, http.StatusOK, map[string]interface{}{"suggestions": []Suggestion{}})
+		return
+	}
+	if len(q) > 100 {
+		writeError(w, http.StatusBadRequest, "invalid_request", "Query too long")
+		return
+	}
+	key := strings.ToLower(q)
+
+	suggestCacheMu.Lock()
+	entry, ok := suggestCache[key]
+	suggestCacheMu.Unlock()
+	if !ok || time.Since(entry.at) > suggestCacheTTL {
+		results, err := findSuggestions(r.Context(), q)
+		if err != nil {
+			serverError(w, r, err)
+			return
+		}
+		entry = suggestEntry{at: time.Now(), results: results}
+		suggestCacheMu.Lock()
+		if len(suggestCache) > 1000 {
+			suggestCache = map[string]suggestEntry{}
+		}
+		suggestCache[key] = entry
+		suggestCacheMu.Unlock()
+	}
+
+	w.Header().Set("Cache-Control", "public, max-age=30")
+	writeJSON(w, http.StatusOK, map[string]interface{}{"suggestions": entry.results})
+}
@@ -0,0 +1,139 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"net/http"
+	"strings"
+
+	"macurate/validation"
+)
+
+// ReasonTag is an admin-defined preset reason voters can attach to a vote.
+type ReasonTag struct {
+	ID    int
+	Label string
+}
+
+// TagCount is how many times a tag was picked for a given person.
+type TagCount struct {
+	Label string `json:"label"`
+	Count int    `json:"count"`
+}
+
+func createTagTables() error {
+	_, err := db.Exec(`
+    CREATE TABLE IF NOT EXISTS reason_tags (
+        id SERIAL PRIMARY KEY,
+        label TEXT NOT NULL UNIQUE
+    );
+    CREATE TABLE IF NOT EXISTS vote_tags (
+        vote_id INTEGER REFERENCES votes(id) ON DELETE CASCADE,
+        tag_id INTEGER REFERENCES reason_tags(id) ON DELETE CASCADE,
+        PRIMARY KEY (vote_id, tag_id)
+    );
+    `)
+	return err
+}
+
+// List all reason tags in label order
+func listReasonTags(ctx context.Context) ([]ReasonTag, error) {
+	rows, err := db.QueryContext(ctx, "SELECT id, label FROM reason_tags ORDER BY label")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var tags []ReasonTag
+	for rows.Next() {
+		var t ReasonTag
+		if err := rows.Scan(&t.ID, &t.Label); err != nil {
+			return nil, err
+		}
+		tags = append(tags, t)
+	}
+	return tags, rows.Err()
+}
+
+// Tag aggregates for every person, keyed by person id, most picked first
+func tagCountsByPerson(ctx context.Context) (map[int][]TagCount, error) {
+	rows, err := db.QueryContext(ctx, `
+        SELECT v.person_id, t.label, COUNT(*) AS n
+        FROM vote_tags vt
+        JOIN votes v ON v.id = vt.vote_id
+        JOIN reason_tags t ON t.id = vt.tag_id
+        GROUP BY v.person_id, t.label
+        ORDER BY v.person_id, n DESC, t.label`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	counts := make(map[int][]TagCount)
+	for rows.Next() {
+		var personID int
+		var tc TagCount
+		if err := rows.Scan(&personID, &tc.Label, &tc.Count); err != nil {
+			return nil, err
+		}
+		counts[personID] = append(counts[personID], tc)
+	}
+	return counts, rows.Err()
+}
+
+// Attach the selected tags to a freshly inserted vote. Unknown tag ids are ignored.
+func insertVoteTags(tx *sql.Tx, voteID int, tagIDs []int) error {
+	for _, tagID := range tagIDs {
+		if _, err := tx.Exec(
+			`INSERT INTO vote_tags (vote_id, tag_id)
+             SELECT $1, id FROM reason_tags WHERE id = $2
+             ON CONFLICT DO NOTHING`,
+			voteID, tagID,
+		); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Create or delete a reason tag (admin-only)
+func adminTagsHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if !adminAuthorized(r) {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	var req adminTagRequest
+	if errs := bindAdminForm(r, &req); errs != nil {
+		renderAdmin(w, r, errs)
+		return
+	}
+
+	switch req.Action {
+	case "add":
+		label := strings.TrimSpace(req.Label)
+		if label == "" {
+			renderAdmin(w, r, validation.Errors{"label": "is required"})
+			return
+		}
+		if _, err := db.ExecContext(r.Context(), "INSERT INTO reason_tags (label) VALUES ($1) ON CONFLICT (label) DO NOTHING", label); err != nil {
+			serverError(w, r, err)
+			return
+		}
+	case "delete":
+		if req.ID == 0 {
+			renderAdmin(w, r, validation.Errors{"id": "is required"})
+			return
+		}
+		if _, err := db.ExecContext(r.Context(), "DELETE FROM reason_tags WHERE id=$1", req.ID); err != nil {
+			serverError(w, r, err)
+			return
+		}
+	}
+
+	http.Redirect(w, r, "/admin", http.StatusSeeOther)
+}
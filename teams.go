@@ -0,0 +1,157 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"sort"
+	"strings"
+
+	"macurate/validation"
+)
+
+// Team aggregates the votes of its members.
+type Team struct {
+	Rank      int     `json:"rank"`
+	ID        int     `json:"id"`
+	Name      string  `json:"name"`
+	Members   int     `json:"members"`
+	Score     int     `json:"score"`
+	Upvotes   int     `json:"upvotes"`
+	Downvotes int     `json:"downvotes"`
+	AvgScore  float64 `json:"avg_score"` // score per member
+	Domain    string  `json:"domain,omitempty"`
+}
+
+func createTeamTables() error {
+	_, err := db.Exec(`
+    CREATE TABLE IF NOT EXISTS teams (
+        id SERIAL PRIMARY KEY,
+        name TEXT NOT NULL UNIQUE
+    );
+    ALTER TABLE people ADD COLUMN IF NOT EXISTS team_id INTEGER REFERENCES teams(id) ON DELETE SET NULL;
+    `)
+	return err
+}
+
+// Team leaderboard, highest score first
+func queryTeams(ctx context.Context) ([]Team, error) {
+	rows, err := db.QueryContext(ctx, `
+        SELECT t.id, t.name, COALESCE(t.domain, ''),
+               COUNT(DISTINCT p.id) AS members,
+               COALESCE(SUM(CASE WHEN v.upvote IS TRUE THEN 1 WHEN v.upvote IS FALSE THEN -1 ELSE 0 END), 0) AS score,
+               COUNT(v.id) FILTER (WHERE v.upvote IS TRUE) AS upvotes,
+               COUNT(v.id) FILTER (WHERE v.upvote IS FALSE) AS downvotes
+        FROM teams t
+        LEFT JOIN people p ON p.team_id = t.id
+        LEFT JOIN votes v ON v.person_id = p.id
+        GROUP BY t.id, t.name
+        ORDER BY score DESC, t.name`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	teams := []Team{}
+	for rows.Next() {
+		var t Team
+		if err := rows.Scan(&t.ID, &t.Name, &t.Domain, &t.Members, &t.Score, &t.Upvotes, &t.Downvotes); err != nil {
+			return nil, err
+		}
+		t.Rank = len(teams) + 1
+		if t.Members > 0 {
+			t.AvgScore = float64(t.Score) / float64(t.Members)
+		}
+		teams = append(teams, t)
+	}
+	return teams, rows.Err()
+}
+
+// Team leaderboard as JSON; scores are null while hidden
+func apiTeamsHandler(w http.ResponseWriter, r *http.Request) {
+	teams, err := queryTeams(r.Context())
+	if err != nil {
+		serverError(w, r, err)
+		return
+	}
+
+	hidden := scoresHiddenFor(r)
+	if !hidden {
+		writeJSON(w, http.StatusOK, map[string]interface{}{"teams": teams})
+		return
+	}
+
+	// Don't let the order or the aggregates leak the hidden scores
+	sort.Slice(teams, func(i, j int) bool {
+		return strings.ToLower(teams[i].Name) < strings.ToLower(teams[j].Name)
+	})
+	list := make([]map[string]interface{}, 0, len(teams))
+	for _, t := range teams {
+		list = append(list, map[string]interface{}{
+			"id": t.ID, "name": t.Name, "members": t.Members,
+			"score": nil, "upvotes": nil, "downvotes": nil, "avg_score": nil,
+			"hidden": true,
+		})
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{"teams": list})
+}
+
+// Create/delete teams and assign people to them (admin-only)
+func adminTeamsHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if !adminAuthorized(r) {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	var req adminTeamRequest
+	if errs := bindAdminForm(r, &req); errs != nil {
+		renderAdmin(w, r, errs)
+		return
+	}
+
+	switch req.Action {
+	case "add":
+		if req.Name == "" {
+			renderAdmin(w, r, validation.Errors{"team_name": "is required"})
+			return
+		}
+		if _, err := db.ExecContext(r.Context(), "INSERT INTO teams (name) VALUES ($1) ON CONFLICT (name) DO NOTHING", req.Name); err != nil {
+			serverError(w, r, err)
+			return
+		}
+	case "delete":
+		if _, err := db.ExecContext(r.Context(), "DELETE FROM teams WHERE id=$1", req.TeamID); err != nil {
+			serverError(w, r, err)
+			return
+		}
+		notifyInstances("teams")
+		if err := loadTeamDomains(); err != nil {
+			serverError(w, r, err)
+			return
+		}
+	case "domain":
+		if err := setTeamDomain(req.TeamID, req.Domain); err == errInvalidHostname || err == errDomainTaken {
+			renderAdmin(w, r, validation.Errors{"domain": err.Error()})
+			return
+		} else if err != nil {
+			serverError(w, r, err)
+			return
+		}
+	case "assign":
+		if req.PersonID == 0 {
+			renderAdmin(w, r, validation.Errors{"person_id": "is required"})
+			return
+		}
+		// team_id 0 removes the person from their team
+		if _, err := db.ExecContext(r.Context(), "UPDATE people SET team_id = NULLIF($1, 0) WHERE id = $2", req.TeamID, req.PersonID); err != nil {
+			serverError(w, r, err)
+			return
+		}
+	}
+	invalidatePeopleCache()
+
+	http.Redirect(w, r, "/admin", http.StatusSeeOther)
+}
@@ -0,0 +1,189 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"runtime/debug"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Per-route request deadlines. The longest matching path prefix wins; a
+// zero duration leaves the route unbounded.
+type routeTimeout struct {
+	prefix  string
+	timeout time.Duration
+}
+
+var builtinRouteTimeouts = []routeTimeout{
+	{"/admin/add", 60 * time.Second},
+	{"/admin/export/", 0}, // streamed, so it can't be buffered
+	{"/events", 0},        // SSE, open for as long as the client stays
+	{"/ws", 0},            // same, over a WebSocket
+	{"/admin/report", 2 * time.Minute},
+	{"/admin/roast", 2 * time.Minute},
+	// Parsing a large upload, or committing its batch, is one request
+	{"/admin/import", 5 * time.Minute},
+	{"/images/", 30 * time.Second},
+	{"/api/", 3 * time.Second}, // plain reads; a slow one means a struggling database
+	// Translations wait on the provider, which translateClient gives 10s
+	{"/api/comments/", 15 * time.Second},
+	{"/api/v1/comments/", 15 * time.Second},
+}
+
+var (
+	defaultRequestTimeout = 10 * time.Second
+	routeTimeouts         = builtinRouteTimeouts
+)
+
+// REQUEST_TIMEOUT sets the default (a Go duration like "10s");
+// ROUTE_TIMEOUTS overrides single prefixes, e.g. "/admin/report=5m,/api/=5s".
+func loadRouteTimeouts() error {
+	def := 10 * time.Second
+	if v := os.Getenv("REQUEST_TIMEOUT"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil {
+			return fmt.Errorf("REQUEST_TIMEOUT: %w", err)
+		}
+		def = d
+	}
+	routes := append([]routeTimeout(nil), builtinRouteTimeouts...)
+	for _, part := range strings.Split(os.Getenv("ROUTE_TIMEOUTS"), ",") {
+		if part = strings.TrimSpace(part); part == "" {
+			continue
+		}
+		prefix, value, ok := strings.Cut(part, "=")
+		if !ok || !strings.HasPrefix(prefix, "/") {
+			return fmt.Errorf("ROUTE_TIMEOUTS: invalid entry %q", part)
+		}
+		d, err := time.ParseDuration(value)
+		if err != nil {
+			return fmt.Errorf("ROUTE_TIMEOUTS: %w", err)
+		}
+		routes = append(routes, routeTimeout{prefix, d})
+	}
+
+	configMu.Lock()
+	defaultRequestTimeout, routeTimeouts = def, routes
+	configMu.Unlock()
+	return nil
+}
+
+func timeoutFor(path string) time.Duration {
+	configMu.RLock()
+	defer configMu.RUnlock()
+	d, best := defaultRequestTimeout, -1
+	for _, rt := range routeTimeouts {
+		// Later entries (the env overrides) win ties
+		if strings.HasPrefix(path, rt.prefix) && len(rt.prefix) >= best {
+			d, best = rt.timeout, len(rt.prefix)
+		}
+	}
+	return d
+}
+
+// Like http.TimeoutHandler, but with the deadline picked per route and an
+// error body that suits the route: JSON for the APIs, a page for the rest.
+// The handler's response is buffered and only sent if it beat the deadline.
+func withTimeouts(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		d := timeoutFor(r.URL.Path)
+		if d <= 0 {
+			next.ServeHTTP(w, r)
+			return
+		}
+		ctx, cancel := context.WithTimeout(r.Context(), d)
+		defer cancel()
+
+		tw := &timeoutWriter{header: make(http.Header)}
+		done := make(chan struct{})
+		panicked := make(chan interface{}, 1)
+		go func() {
+			defer func() {
+				if p := recover(); p != nil {
+					if p != http.ErrAbortHandler {
+						p = fmt.Errorf("%v\n\n%s", p, debug.Stack())
+					}
+					panicked <- p
+				}
+			}()
+			next.ServeHTTP(tw, r.WithContext(ctx))
+			close(done)
+		}()
+
+		select {
+		case p := <-panicked:
+			panic(p)
+		case <-done:
+			tw.mu.Lock()
+			defer tw.mu.Unlock()
+			for k, v := range tw.header {
+				w.Header()[k] = v
+			}
+			if tw.status == 0 {
+				tw.status = http.StatusOK
+			}
+			w.WriteHeader(tw.status)
+			w.Write(tw.buf.Bytes())
+		case <-ctx.Done():
+			tw.mu.Lock()
+			defer tw.mu.Unlock()
+			tw.timedOut = true
+			if ctx.Err() == context.DeadlineExceeded {
+				slog.WarnContext(r.Context(), "request timed out", "method", r.Method, "path", r.URL.Path, "after", d)
+				writeTimeoutError(w, r)
+			}
+		}
+	})
+}
+
+func writeTimeoutError(w http.ResponseWriter, r *http.Request) {
+	if isAPIPath(r.URL.Path) {
+		writeError(w, http.StatusServiceUnavailable, "timeout", "The request took too long. Please try again.")
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(http.StatusServiceUnavailable)
+	tmpl := parseTemplates("templates/timeout.html")
+	if err := tmpl.Execute(w, nil); err != nil {
+		slog.ErrorContext(r.Context(), "timeout page", "err", err)
+	}
+}
+
+// Buffers the response until the handler finishes; writes after the
+// deadline are dropped with http.ErrHandlerTimeout.
+type timeoutWriter struct {
+	mu       sync.Mutex
+	header   http.Header
+	buf      bytes.Buffer
+	status   int
+	timedOut bool
+}
+
+func (tw *timeoutWriter) Header() http.Header { return tw.header }
+
+func (tw *timeoutWriter) Write(b []byte) (int, error) {
+	tw.mu.Lock()
+	defer tw.mu.Unlock()
+	if tw.timedOut {
+		return 0, http.ErrHandlerTimeout
+	}
+	if tw.status == 0 {
+		tw.status = http.StatusOK
+	}
+	return tw.buf.Write(b)
+}
+
+func (tw *timeoutWriter) WriteHeader(status int) {
+	tw.mu.Lock()
+	defer tw.mu.Unlock()
+	if tw.timedOut || tw.status != 0 {
+		return
+	}
+	tw.status = status
+}
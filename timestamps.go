@@ -0,0 +1,56 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Timestamps that arrive as text. Columns are TIMESTAMPTZ, so what is in
+// the database sorts and compares correctly whatever it was written from,
+// but settings and import files carry text, and databases from older
+// setups wrote it as CURRENT_TIMESTAMP does ("2024-05-01 12:30:00") as
+// well as RFC 3339. Migration 0004 rewrote stored settings as RFC 3339
+// UTC; parseTimestamp reads both for files and anything written since.
+
+var timestampLayouts = []string{
+	time.RFC3339Nano,
+	"2006-01-02 15:04:05.999999999Z07:00",
+	"2006-01-02 15:04:05.999999999Z07", // Postgres text output, "+00"
+	"2006-01-02 15:04:05.999999999",    // no zone: UTC
+	"2006-01-02T15:04:05.999999999",
+}
+
+// Parse an RFC 3339 or space-separated timestamp, in UTC
+func parseTimestamp(s string) (time.Time, error) {
+	s = strings.TrimSpace(s)
+	for _, layout := range timestampLayouts {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t.UTC(), nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("%q is not a timestamp", s)
+}
+
+// Read created_at with parseTimestamp, so exports from older boards and
+// hand-made files import as well as our own
+func (c *exportComment) UnmarshalJSON(b []byte) error {
+	type plain exportComment
+	aux := struct {
+		*plain
+		CreatedAt string `json:"created_at"`
+	}{plain: (*plain)(c)}
+	if err := json.Unmarshal(b, &aux); err != nil {
+		return err
+	}
+	c.CreatedAt = time.Time{}
+	if aux.CreatedAt != "" {
+		t, err := parseTimestamp(aux.CreatedAt)
+		if err != nil {
+			return fmt.Errorf("created_at: %w", err)
+		}
+		c.CreatedAt = t
+	}
+	return nil
+}
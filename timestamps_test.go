@@ -0,0 +1,65 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+func TestParseTimestamp(t *testing.T) {
+	want := time.Date(2024, 5, 1, 12, 30, 0, 0, time.UTC)
+	tests := []struct {
+		in   string
+		want time.Time
+		ok   bool
+	}{
+		{"2024-05-01T12:30:00Z", want, true},
+		{"2024-05-01T14:30:00+02:00", want, true},
+		{"2024-05-01T12:30:00.25Z", want.Add(250 * time.Millisecond), true},
+		{"2024-05-01 12:30:00", want, true},
+		{"2024-05-01 12:30:00.123456", want.Add(123456 * time.Microsecond), true},
+		{"2024-05-01 12:30:00+00", want, true},
+		{"2024-05-01 07:30:00-05", want, true},
+		{"2024-05-01 13:30:00+01:00", want, true},
+		{"2024-05-01T12:30:00", want, true},
+		{"  2024-05-01T12:30:00Z\n", want, true},
+		{"", time.Time{}, false},
+		{"2024-05-01", time.Time{}, false},
+		{"yesterday", time.Time{}, false},
+		{"2024-13-01 12:30:00", time.Time{}, false},
+	}
+	for _, tt := range tests {
+		got, err := parseTimestamp(tt.in)
+		if (err == nil) != tt.ok {
+			t.Errorf("parseTimestamp(%q) error = %v, want ok %v", tt.in, err, tt.ok)
+			continue
+		}
+		if !got.Equal(tt.want) || got.Location() != time.UTC {
+			t.Errorf("parseTimestamp(%q) = %v, want %v in UTC", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestExportCommentCreatedAt(t *testing.T) {
+	tests := []struct {
+		in   string
+		want time.Time
+		ok   bool
+	}{
+		{`{"id": 1, "created_at": "2024-05-01 12:30:00"}`, time.Date(2024, 5, 1, 12, 30, 0, 0, time.UTC), true},
+		{`{"id": 1, "created_at": "2024-05-01T12:30:00Z"}`, time.Date(2024, 5, 1, 12, 30, 0, 0, time.UTC), true},
+		{`{"id": 1}`, time.Time{}, true},
+		{`{"id": 1, "created_at": "soon"}`, time.Time{}, false},
+	}
+	for _, tt := range tests {
+		var c exportComment
+		err := json.Unmarshal([]byte(tt.in), &c)
+		if (err == nil) != tt.ok {
+			t.Errorf("%s: error = %v, want ok %v", tt.in, err, tt.ok)
+			continue
+		}
+		if tt.ok && (!c.CreatedAt.Equal(tt.want) || c.ID != 1) {
+			t.Errorf("%s: got id %d, created_at %v, want 1, %v", tt.in, c.ID, c.CreatedAt, tt.want)
+		}
+	}
+}
@@ -0,0 +1,327 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Moderation assist: an external provider rates new comments for
+// toxicity, in any language it supports, from 0 (fine) to 1. Scoring runs
+// in the background after the vote is saved, so a slow provider never
+// holds up voting. A comment at or above the threshold goes back to the
+// moderation queue even if it was already published; every score is kept
+// for the moderation page. An edited comment is scored again. Comments a
+// provider can't rate (say, in a language it doesn't know) are recorded
+// with the error and left alone; one it fails on (timeouts, 5xx) is
+// retried with backoff on its own, up to toxicityMaxAttempts, while the
+// rest of the queue moves on.
+
+// ToxicityScorer rates a comment from 0 (harmless) to 1 (toxic).
+type ToxicityScorer interface {
+	Score(ctx context.Context, text string) (float64, error)
+}
+
+// Configured toxicity provider; nil when moderation assist is off
+var toxicityScorer ToxicityScorer
+
+var toxicityClient = &http.Client{Timeout: 10 * time.Second}
+
+const (
+	defaultToxicityThreshold = 0.8
+	toxicityBatchSize        = 20
+	toxicityMaxAttempts      = 5
+)
+
+// Build the scorer from TOXICITY_PROVIDER (perspective|http), TOXICITY_URL
+// and TOXICITY_API_KEY. Returns nil when unset. "http" posts
+// {"text": ...} to TOXICITY_URL and expects {"score": 0..1} back.
+func newToxicityScorerFromEnv() (ToxicityScorer, error) {
+	key := os.Getenv("TOXICITY_API_KEY")
+	endpoint := os.Getenv("TOXICITY_URL")
+	switch provider := os.Getenv("TOXICITY_PROVIDER"); provider {
+	case "":
+		return nil, nil
+	case "perspective":
+		if key == "" {
+			return nil, errors.New("TOXICITY_API_KEY is required for perspective")
+		}
+		if endpoint == "" {
+			endpoint = "https://commentanalyzer.googleapis.com/v1alpha1/comments:analyze"
+		}
+		return &perspectiveScorer{endpoint: endpoint, apiKey: key}, nil
+	case "http":
+		if endpoint == "" {
+			return nil, errors.New("TOXICITY_URL is required for http")
+		}
+		return &httpToxicityScorer{endpoint: endpoint, apiKey: key}, nil
+	default:
+		return nil, fmt.Errorf("unknown TOXICITY_PROVIDER %q", provider)
+	}
+}
+
+type perspectiveScorer struct {
+	endpoint string
+	apiKey   string
+}
+
+// The language is left to Perspective to detect
+func (s *perspectiveScorer) Score(ctx context.Context, text string) (float64, error) {
+	body, err := json.Marshal(map[string]interface{}{
+		"comment":             map[string]string{"text": text},
+		"requestedAttributes": map[string]interface{}{"TOXICITY": struct{}{}},
+		"doNotStore":          true,
+	})
+	if err != nil {
+		return 0, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.endpoint, strings.NewReader(string(body)))
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	// A header rather than ?key=, which would end up in logged URL errors
+	req.Header.Set("X-Goog-Api-Key", s.apiKey)
+
+	var out struct {
+		AttributeScores struct {
+			Toxicity struct {
+				SummaryScore struct {
+					Value float64 `json:"value"`
+				} `json:"summaryScore"`
+			} `json:"TOXICITY"`
+		} `json:"attributeScores"`
+	}
+	if err := doToxicityRequest(req, &out); err != nil {
+		return 0, err
+	}
+	return out.AttributeScores.Toxicity.SummaryScore.Value, nil
+}
+
+type httpToxicityScorer struct {
+	endpoint string
+	apiKey   string
+}
+
+func (s *httpToxicityScorer) Score(ctx context.Context, text string) (float64, error) {
+	body, err := json.Marshal(map[string]string{"text": text})
+	if err != nil {
+		return 0, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.endpoint, strings.NewReader(string(body)))
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if s.apiKey != "" {
+		req.Header.Set("Authorization", "Bearer "+s.apiKey)
+	}
+
+	var out struct {
+		Score *float64 `json:"score"`
+	}
+	if err := doToxicityRequest(req, &out); err != nil {
+		return 0, err
+	}
+	if out.Score == nil {
+		return 0, errors.New("toxicity provider: no score in response")
+	}
+	return *out.Score, nil
+}
+
+// errToxicityRejected is a provider refusing the comment itself (4xx),
+// as opposed to being unreachable, so retrying won't help.
+var errToxicityRejected = errors.New("toxicity provider rejected the comment")
+
+func doToxicityRequest(req *http.Request, out interface{}) error {
+	resp, err := toxicityClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 400 && resp.StatusCode < 500 && resp.StatusCode != http.StatusTooManyRequests {
+		return fmt.Errorf("%w: %s", errToxicityRejected, resp.Status)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("toxicity provider returned %s", resp.Status)
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+func createToxicityTables() error {
+	_, err := db.Exec(`
+    CREATE TABLE IF NOT EXISTS comment_toxicity (
+        vote_id INTEGER PRIMARY KEY REFERENCES votes(id) ON DELETE CASCADE,
+        score DOUBLE PRECISION,
+        error TEXT NOT NULL DEFAULT '',
+        flagged BOOLEAN NOT NULL DEFAULT FALSE,
+        scored_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+    );
+    CREATE INDEX IF NOT EXISTS comment_toxicity_scored_at_idx ON comment_toxicity (scored_at);
+    ALTER TABLE comment_toxicity ADD COLUMN IF NOT EXISTS attempts INTEGER NOT NULL DEFAULT 0;
+    ALTER TABLE comment_toxicity ADD COLUMN IF NOT EXISTS retry_at TIMESTAMPTZ;
+    `)
+	return err
+}
+
+func getToxicityThreshold() float64 {
+	v, err := strconv.ParseFloat(getSetting("toxicity_threshold", ""), 64)
+	if err != nil || v <= 0 || v > 1 {
+		return defaultToxicityThreshold
+	}
+	return v
+}
+
+// Background loop scoring new comments; does nothing without a provider
+func startToxicityWorker() {
+	if toxicityScorer == nil {
+		return
+	}
+	go func() {
+		for range time.Tick(5 * time.Second) {
+			if err := runExclusive("toxicity", scoreNewComments); err != nil {
+				slog.Error("toxicity scoring", "err", err)
+			}
+		}
+	}()
+}
+
+// Score the comments written or edited in the last day that haven't been
+// scored since, and the failed ones due a retry. Older ones are left out
+// so turning the provider on doesn't send it the whole board's history.
+func scoreNewComments() error {
+	ctx := context.Background()
+	rows, err := db.QueryContext(ctx, `
+        SELECT v.id, v.comment, NOW() FROM votes v
+        WHERE COALESCE(TRIM(v.comment), '') <> '' AND v.status IN ('approved', 'pending')
+          AND COALESCE(v.edited_at, v.created_at) > NOW() - INTERVAL '1 day'
+          AND NOT EXISTS (
+              SELECT 1 FROM comment_toxicity c
+              WHERE c.vote_id = v.id AND (v.edited_at IS NULL OR c.scored_at >= v.edited_at)
+                AND (c.retry_at IS NULL OR c.retry_at > NOW())
+          )
+        ORDER BY v.id
+        LIMIT $1`, toxicityBatchSize)
+	if err != nil {
+		return err
+	}
+	// readAt is kept as the time of scoring, so an edit made while the
+	// provider is busy with the old text still gets scored
+	type comment struct {
+		id     int
+		text   string
+		readAt time.Time
+	}
+	var batch []comment
+	for rows.Next() {
+		var c comment
+		if err := rows.Scan(&c.id, &c.text, &c.readAt); err != nil {
+			rows.Close()
+			return err
+		}
+		batch = append(batch, c)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	threshold := getToxicityThreshold()
+	for _, c := range batch {
+		sctx, cancel := context.WithTimeout(ctx, 15*time.Second)
+		score, scoreErr := toxicityScorer.Score(sctx, c.text)
+		cancel()
+		if scoreErr != nil {
+			if err := recordToxicityFailure(ctx, c.id, scoreErr, c.readAt); err != nil {
+				return err
+			}
+			continue
+		}
+		if err := recordToxicity(ctx, c.id, score, score >= threshold, c.readAt); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Record that scoring a comment failed. A rejection is final; otherwise it
+// is tried again after 1, 2, 4, ... minutes until toxicityMaxAttempts. A
+// row with no retry pending (scored, rejected or given up on) means this
+// is a new round for an edited comment, so the count starts over.
+func recordToxicityFailure(ctx context.Context, voteID int, scoreErr error, scoredAt time.Time) error {
+	final := errors.Is(scoreErr, errToxicityRejected)
+	slog.Warn("toxicity scoring failed", "vote_id", voteID, "final", final, "err", scoreErr)
+	_, err := db.ExecContext(ctx, `
+        INSERT INTO comment_toxicity AS c (vote_id, error, scored_at, attempts, retry_at)
+        VALUES ($1, $2, $3, 1, CASE WHEN $4 OR $5 <= 1 THEN NULL ELSE NOW() + INTERVAL '1 minute' END)
+        ON CONFLICT (vote_id) DO UPDATE SET
+            score = NULL, error = EXCLUDED.error, flagged = FALSE, scored_at = EXCLUDED.scored_at,
+            attempts = CASE WHEN c.retry_at IS NULL THEN 1 ELSE c.attempts + 1 END,
+            retry_at = CASE
+                WHEN $4 OR (CASE WHEN c.retry_at IS NULL THEN 1 ELSE c.attempts + 1 END) >= $5 THEN NULL
+                WHEN c.retry_at IS NULL THEN NOW() + INTERVAL '1 minute'
+                ELSE NOW() + (2 ^ c.attempts) * INTERVAL '1 minute'
+            END`,
+		voteID, truncate(scoreErr.Error(), 500), scoredAt, final, toxicityMaxAttempts)
+	return err
+}
+
+// Save a comment's score, replacing one of an earlier version, and, when
+// flagged, send it back for review
+func recordToxicity(ctx context.Context, voteID int, score float64, flag bool, scoredAt time.Time) error {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, `
+        INSERT INTO comment_toxicity (vote_id, score, flagged, scored_at) VALUES ($1, $2, $3, $4)
+        ON CONFLICT (vote_id) DO UPDATE SET score = EXCLUDED.score, error = '', flagged = EXCLUDED.flagged,
+            scored_at = EXCLUDED.scored_at, retry_at = NULL`,
+		voteID, score, flag, scoredAt); err != nil {
+		return err
+	}
+	held := false
+	if flag {
+		res, err := tx.ExecContext(ctx, "UPDATE votes SET status = $2 WHERE id = $1 AND status = $3", voteID, commentPending, commentApproved)
+		if err != nil {
+			return err
+		}
+		n, _ := res.RowsAffected()
+		held = n > 0
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	if held {
+		slog.Info("comment held for review", "vote_id", voteID, "toxicity", score)
+		invalidatePeopleCache()
+	}
+	return nil
+}
+
+// ToxicityStats sums up the last week of scoring for the moderation page.
+type ToxicityStats struct {
+	Scored  int
+	Flagged int
+	Failed  int
+	Average float64
+}
+
+func toxicityStats(ctx context.Context) (ToxicityStats, error) {
+	var s ToxicityStats
+	err := db.QueryRowContext(ctx, `
+        SELECT COUNT(score), COUNT(*) FILTER (WHERE flagged), COUNT(*) FILTER (WHERE score IS NULL),
+               COALESCE(AVG(score), 0)
+        FROM comment_toxicity WHERE scored_at > NOW() - INTERVAL '7 days'`).
+		Scan(&s.Scored, &s.Flagged, &s.Failed, &s.Average)
+	return s, err
+}
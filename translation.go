@@ -0,0 +1,235 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Translator turns comment text into the target language (ISO code, e.g. "en").
+type Translator interface {
+	Translate(ctx context.Context, text, target string) (string, error)
+}
+
+// Configured translation provider; nil when translation is disabled
+var translator Translator
+
+var translateClient = &http.Client{Timeout: 10 * time.Second}
+
+// Target languages offered, the ones both DeepL and LibreTranslate take.
+// Anything else is refused before it reaches the (paid) provider.
+var translationLanguages = map[string]bool{
+	"ar": true, "bg": true, "cs": true, "da": true, "de": true, "el": true,
+	"en": true, "es": true, "et": true, "fi": true, "fr": true, "hu": true,
+	"id": true, "it": true, "ja": true, "ko": true, "lt": true, "lv": true,
+	"nb": true, "nl": true, "pl": true, "pt": true, "ro": true, "ru": true,
+	"sk": true, "sl": true, "sv": true, "tr": true, "uk": true, "zh": true,
+}
+
+// Build the translator from TRANSLATE_PROVIDER (deepl|libretranslate),
+// TRANSLATE_URL and TRANSLATE_API_KEY. Returns nil when unset.
+func newTranslatorFromEnv() (Translator, error) {
+	key := os.Getenv("TRANSLATE_API_KEY")
+	endpoint := os.Getenv("TRANSLATE_URL")
+	switch provider := os.Getenv("TRANSLATE_PROVIDER"); provider {
+	case "":
+		return nil, nil
+	case "deepl":
+		if key == "" {
+			return nil, errors.New("TRANSLATE_API_KEY is required for deepl")
+		}
+		if endpoint == "" {
+			endpoint = "https://api-free.deepl.com/v2/translate"
+		}
+		return &deeplTranslator{endpoint: endpoint, apiKey: key}, nil
+	case "libretranslate":
+		if endpoint == "" {
+			return nil, errors.New("TRANSLATE_URL is required for libretranslate")
+		}
+		return &libreTranslator{endpoint: strings.TrimRight(endpoint, "/") + "/translate", apiKey: key}, nil
+	default:
+		return nil, fmt.Errorf("unknown TRANSLATE_PROVIDER %q", provider)
+	}
+}
+
+type deeplTranslator struct {
+	endpoint string
+	apiKey   string
+}
+
+func (t *deeplTranslator) Translate(ctx context.Context, text, target string) (string, error) {
+	form := url.Values{"text": {text}, "target_lang": {strings.ToUpper(target)}}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, t.endpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Authorization", "DeepL-Auth-Key "+t.apiKey)
+
+	var out struct {
+		Translations []struct {
+			Text string `json:"text"`
+		} `json:"translations"`
+	}
+	if err := doTranslateRequest(req, &out); err != nil {
+		return "", err
+	}
+	if len(out.Translations) == 0 {
+		return "", errors.New("deepl: empty response")
+	}
+	return out.Translations[0].Text, nil
+}
+
+type libreTranslator struct {
+	endpoint string
+	apiKey   string
+}
+
+func (t *libreTranslator) Translate(ctx context.Context, text, target string) (string, error) {
+	body, err := json.Marshal(map[string]string{
+		"q":       text,
+		"source":  "auto",
+		"target":  strings.ToLower(target),
+		"format":  "text",
+		"api_key": t.apiKey,
+	})
+	if err != nil {
+		return "", err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, t.endpoint, strings.NewReader(string(body)))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	var out struct {
+		TranslatedText string `json:"translatedText"`
+	}
+	if err := doTranslateRequest(req, &out); err != nil {
+		return "", err
+	}
+	return out.TranslatedText, nil
+}
+
+func doTranslateRequest(req *http.Request, out interface{}) error {
+	resp, err := translateClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("translation provider returned %s", resp.Status)
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+func createTranslationTables() error {
+	_, err := db.Exec(`
+    CREATE TABLE IF NOT EXISTS comment_translations (
+        vote_id INTEGER REFERENCES votes(id) ON DELETE CASCADE,
+        lang TEXT NOT NULL,
+        text TEXT NOT NULL,
+        PRIMARY KEY (vote_id, lang)
+    );
+    `)
+	return err
+}
+
+// Return a comment translated into ?to= (default "en"), cached per language.
+// A request without an API key that has to go to the provider takes a
+// token from translateLimiter; cached ones are free.
+func apiCommentTranslationHandler(w http.ResponseWriter, r *http.Request) {
+	if translator == nil {
+		writeError(w, http.StatusNotFound, "not_configured", "Translation not configured")
+		return
+	}
+	id, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil || id <= 0 {
+		writeError(w, http.StatusBadRequest, "invalid_id", "Invalid id")
+		return
+	}
+	to := r.URL.Query().Get("to")
+	if to == "" {
+		to = "en"
+	}
+	to = strings.ToLower(to)
+	if !translationLanguages[to] {
+		writeError(w, http.StatusBadRequest, "invalid_request", "Unsupported target language")
+		return
+	}
+
+	var original string
+	err = db.QueryRowContext(r.Context(), "SELECT COALESCE(comment, '') FROM votes WHERE id=$1 AND status='approved'", id).Scan(&original)
+	if err == sql.ErrNoRows {
+		writeError(w, http.StatusNotFound, "not_found", "Comment not found")
+		return
+	} else if err != nil {
+		serverError(w, r, err)
+		return
+	}
+
+	resp := map[string]interface{}{
+		"id":       id,
+		"to":       to,
+		"original": original,
+	}
+
+	var translated string
+	err = db.QueryRowContext(r.Context(), "SELECT text FROM comment_translations WHERE vote_id=$1 AND lang=$2", id, to).Scan(&translated)
+	if err != nil && err != sql.ErrNoRows {
+		serverError(w, r, err)
+		return
+	}
+	if err == nil {
+		resp["text"] = translated
+		resp["cached"] = true
+		writeJSON(w, http.StatusOK, resp)
+		return
+	}
+
+	if strings.TrimSpace(original) == "" {
+		translated = original
+	} else {
+		// Keyed requests were already counted against the key's limit
+		if requestAPIKey(r) == "" {
+			ok, st := translateLimiter.allow(r.Context(), clientIP(r), true)
+			if st.Limit > 0 {
+				st.setHeaders(w)
+			}
+			if !ok {
+				writeError(w, http.StatusTooManyRequests, "rate_limited", "Too many translations, slow down")
+				return
+			}
+		}
+		translated, err = translator.Translate(r.Context(), original, to)
+		if err != nil {
+			// The error can carry TRANSLATE_URL; it stays in the log
+			slog.ErrorContext(r.Context(), "translation failed", "vote", id, "to", to, "err", err)
+			writeError(w, http.StatusBadGateway, "upstream_error", "Translation failed")
+			return
+		}
+	}
+	// Not cached if the comment was edited meanwhile
+	if _, err := db.ExecContext(r.Context(), `
+        INSERT INTO comment_translations (vote_id, lang, text)
+        SELECT $1, $2, $3 WHERE EXISTS (SELECT 1 FROM votes WHERE id = $1 AND comment = $4)
+        ON CONFLICT DO NOTHING`,
+		id, to, translated, original,
+	); err != nil {
+		serverError(w, r, err)
+		return
+	}
+
+	resp["text"] = translated
+	resp["cached"] = false
+	writeJSON(w, http.StatusOK, resp)
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"math"
+	"net/http"
+
+	"macurate/validation"
+)
+
+// Who is "hot right now": people ranked by how many votes they got in the
+// last hours, up or down alike, with each vote counting less as it ages
+// (its weight halves every quarter of the window). Unlike the leaderboard
+// this rewards activity, not approval, so it stays up while scores are
+// hidden; only the up/down split is withheld then.
+
+// TrendingEntry is one person's recent activity.
+type TrendingEntry struct {
+	Rank      int     `json:"rank"`
+	PublicID  string  `json:"public_id"`
+	Name      string  `json:"name"`
+	Team      string  `json:"team,omitempty"`
+	Heat      float64 `json:"heat"`  // recency-weighted vote count
+	Votes     int     `json:"votes"` // in the window
+	Upvotes   *int    `json:"upvotes"`
+	Downvotes *int    `json:"downvotes"`
+}
+
+// GET /api/trending (?hours= window, default 24; ?limit=, default 10)
+func apiTrendingHandler(w http.ResponseWriter, r *http.Request) {
+	var req trendingRequest
+	if errs := validation.Bind(r.URL.Query(), &req); errs != nil {
+		writeValidationError(w, errs)
+		return
+	}
+	if req.Hours == 0 {
+		req.Hours = 24
+	}
+	if req.Limit == 0 {
+		req.Limit = 10
+	}
+	halfLife := float64(req.Hours) * 3600 / 4
+
+	rows, err := db.QueryContext(r.Context(), `
+        SELECT RANK() OVER (ORDER BY s.heat DESC), COALESCE(p.public_id, ''), p.name,
+               COALESCE(t.name, ''), s.heat, s.votes, s.upvotes, s.downvotes
+        FROM (
+            SELECT person_id,
+                   SUM(EXP(-LN(2) * EXTRACT(EPOCH FROM NOW() - created_at) / $2)) AS heat,
+                   COUNT(*) AS votes,
+                   COUNT(*) FILTER (WHERE upvote) AS upvotes,
+                   COUNT(*) FILTER (WHERE NOT upvote) AS downvotes
+            FROM votes
+            WHERE upvote IS NOT NULL AND created_at >= NOW() - $1 * INTERVAL '1 hour'
+            GROUP BY person_id
+        ) s
+        JOIN people p ON p.id = s.person_id
+        LEFT JOIN teams t ON t.id = p.team_id
+        WHERE $3 = 0 OR p.team_id = $3
+        ORDER BY s.heat DESC, p.name
+        LIMIT $4`, req.Hours, halfLife, hostTeamID(r), req.Limit)
+	if err != nil {
+		serverError(w, r, err)
+		return
+	}
+	defer rows.Close()
+
+	hidden := scoresHiddenFor(r)
+	entries := []TrendingEntry{}
+	for rows.Next() {
+		var e TrendingEntry
+		var up, down int
+		if err := rows.Scan(&e.Rank, &e.PublicID, &e.Name, &e.Team, &e.Heat, &e.Votes, &up, &down); err != nil {
+			serverError(w, r, err)
+			return
+		}
+		e.Heat = math.Round(e.Heat*100) / 100
+		if !hidden {
+			e.Upvotes, e.Downvotes = &up, &down
+		}
+		entries = append(entries, e)
+	}
+	if err := rows.Err(); err != nil {
+		serverError(w, r, err)
+		return
+	}
+
+	writeJSONWithETag(w, r, map[string]interface{}{
+		"hours":   req.Hours,
+		"hidden":  hidden,
+		"entries": entries,
+	})
+}
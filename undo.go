@@ -0,0 +1,103 @@
+package main
+
+import (
+	"database/sql"
+	"net/http"
+)
+
+// Retracted votes stay in the table for the record, but with upvote NULL
+// they count towards nothing, and their comment is no longer shown.
+const commentRetracted = "retracted"
+
+func createUndoTables() error {
+	_, err := db.Exec(`
+    ALTER TABLE votes ADD COLUMN IF NOT EXISTS retracted_at TIMESTAMPTZ;
+    `)
+	return err
+}
+
+// Take back this visitor's latest vote on a person: the score drops back and
+// any comment on it is marked retracted, in one transaction. Answers with
+// the person's updated totals.
+func apiVoteUndoHandler(w http.ResponseWriter, r *http.Request) {
+	if votingClosed() {
+		writeError(w, http.StatusForbidden, "voting_closed", "Voting is closed")
+		return
+	}
+	var req voteUndoRequest
+	if !bindForm(w, r, &req) || !resolveRequestPerson(w, r, req.Person, &req.PersonID) {
+		return
+	}
+	voterID := currentVoterID(r)
+	if voterID == "" {
+		writeError(w, http.StatusNotFound, "not_found", "No vote to undo")
+		return
+	}
+	if frozen, err := votingFrozen(r.Context(), req.PersonID); err != nil {
+		serverError(w, r, err)
+		return
+	} else if frozen {
+		writeVotingFrozen(w)
+		return
+	}
+
+	tx, err := db.BeginTx(r.Context(), nil)
+	if err != nil {
+		serverError(w, r, err)
+		return
+	}
+	defer tx.Rollback()
+
+	// Same per-voter lock as voting, so an undo can't race a new vote
+	if _, err := tx.Exec("SELECT pg_advisory_xact_lock(hashtext($1))", voterID); err != nil {
+		serverError(w, r, err)
+		return
+	}
+	var voteID int
+	var wasUp bool
+	err = tx.QueryRow(`
+        UPDATE votes v SET upvote = NULL, status = $3, retracted_at = NOW()
+        FROM (
+            SELECT id, upvote FROM votes
+            WHERE voter_id = $1 AND person_id = $2 AND upvote IS NOT NULL
+            ORDER BY id DESC LIMIT 1
+        ) old
+        WHERE v.id = old.id
+        RETURNING v.id, old.upvote`, voterID, req.PersonID, commentRetracted).Scan(&voteID, &wasUp)
+	if err == sql.ErrNoRows {
+		writeError(w, http.StatusNotFound, "not_found", "No vote to undo")
+		return
+	} else if err != nil {
+		serverError(w, r, err)
+		return
+	}
+	if err := recordScoreChange(tx, req.PersonID, voteID, -voteDelta(wasUp)); err != nil {
+		serverError(w, r, err)
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		serverError(w, r, err)
+		return
+	}
+	invalidatePeopleCache()
+	publicID := publicIDOf(r.Context(), req.PersonID)
+	events.publish("vote_undone", map[string]interface{}{"public_id": publicID})
+	queueWebhooks(webhookVoteUndone, map[string]interface{}{"vote_id": voteID, "public_id": publicID})
+
+	p, err := queryPerson(r.Context(), req.PersonID)
+	if err != nil {
+		serverError(w, r, err)
+		return
+	}
+	ap := newAPIPerson(p, scoresHiddenFor(r))
+	if myVotes, err := voterLatestVotes(r.Context(), voterID); err != nil {
+		serverError(w, r, err)
+		return
+	} else if v, ok := myVotes[p.ID]; ok {
+		ap.MyVote = &v
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"undone": voteID,
+		"person": ap,
+	})
+}
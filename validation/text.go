@@ -0,0 +1,45 @@
+package validation
+
+import (
+	"strings"
+	"unicode"
+
+	"github.com/rivo/uniseg"
+	"golang.org/x/text/unicode/norm"
+)
+
+// CleanText normalizes user supplied text to NFC, removes bidirectional
+// override/isolate marks and control characters (keeping newlines and tabs),
+// and trims surrounding whitespace. Bidi controls are dropped because they
+// can visually reorder a name on the leaderboard to impersonate someone else.
+func CleanText(s string) string {
+	s = norm.NFC.String(s)
+	s = strings.Map(func(r rune) rune {
+		if isBidiControl(r) {
+			return -1
+		}
+		if unicode.IsControl(r) && r != '\n' && r != '\t' {
+			return -1
+		}
+		return r
+	}, s)
+	return strings.TrimSpace(s)
+}
+
+// Length counts user-perceived characters (grapheme clusters), so a family
+// emoji or a flag counts as one.
+func Length(s string) int {
+	return uniseg.GraphemeClusterCount(s)
+}
+
+func isBidiControl(r rune) bool {
+	switch {
+	case r == '\u061C', r == '\u200E', r == '\u200F': // ALM, LRM, RLM
+		return true
+	case r >= '\u202A' && r <= '\u202E': // LRE, RLE, PDF, LRO, RLO
+		return true
+	case r >= '\u2066' && r <= '\u2069': // LRI, RLI, FSI, PDI
+		return true
+	}
+	return false
+}
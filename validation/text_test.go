@@ -0,0 +1,52 @@
+package validation
+
+import "testing"
+
+func TestCleanText(t *testing.T) {
+	tests := []struct {
+		name, in, want string
+	}{
+		{"plain", "Alice", "Alice"},
+		{"trims", "  Alice \n", "Alice"},
+		{"keeps newlines and tabs", "a\nb\tc", "a\nb\tc"},
+		{"composes to NFC", "Jose\u0301", "Jos\u00e9"},
+		{"right-to-left override", "Alice\u202egnp.exe", "Alicegnp.exe"},
+		{"embeddings and pop", "\u202aa\u202bb\u202cc", "abc"},
+		{"isolates", "\u2066a\u2067b\u2068c\u2069", "abc"},
+		{"marks", "\u200ea\u200fb\u061cc", "abc"},
+		{"null and escape", "a\x00b\x1b[31mc", "ab[31mc"},
+		{"carriage return", "a\r\nb", "a\nb"},
+		{"C1 control", "a\u0085b", "ab"},
+		{"only controls", " \u202e\x00\u2066 ", ""},
+		{"keeps zero-width joiner", "\U0001F468\u200d\U0001F469\u200d\U0001F467", "\U0001F468\u200d\U0001F469\u200d\U0001F467"},
+	}
+	for _, tt := range tests {
+		if got := CleanText(tt.in); got != tt.want {
+			t.Errorf("%s: CleanText(%q) = %q, want %q", tt.name, tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestLength(t *testing.T) {
+	tests := []struct {
+		name string
+		in   string
+		want int
+	}{
+		{"empty", "", 0},
+		{"ascii", "abc", 3},
+		{"accented, composed", "Jos\u00e9", 4},
+		{"accented, decomposed", "Jose\u0301", 4},
+		{"family emoji", "\U0001F468\u200d\U0001F469\u200d\U0001F467", 1},
+		{"flag", "\U0001F1E9\U0001F1EA", 1},
+		{"skin tone", "\U0001F44D\U0001F3FD", 1},
+		{"stacked combining marks", "Z\u0351\u036b\u0343\u036a", 1},
+		{"CJK", "\u65e5\u672c\u8a9e", 3},
+		{"CRLF is one", "a\r\nb", 3},
+	}
+	for _, tt := range tests {
+		if got := Length(tt.in); got != tt.want {
+			t.Errorf("%s: Length(%q) = %d, want %d", tt.name, tt.in, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,212 @@
+// Package validation binds form values into structs and checks them against
+// `validate` struct tags.
+//
+// Fields are bound by their `form` tag. Supported rules, comma separated:
+//
+//	required    value must be non-zero (non-empty string, non-zero number, non-empty slice)
+//	min=N       minimum length for strings (grapheme clusters), value for ints, length for slices
+//	max=N       maximum, same semantics as min
+//	oneof=a b   string must be one of the space separated options
+//
+// Bound strings are passed through CleanText before validation.
+//
+// Errors are keyed by the field's form name so they can be rendered next to
+// the matching input or returned as a field map from the JSON API.
+package validation
+
+import (
+	"fmt"
+	"net/url"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// Errors maps a form field name to a human readable problem.
+type Errors map[string]string
+
+// Add records msg for field unless the field already has an error.
+func (e Errors) Add(field, msg string) {
+	if _, ok := e[field]; !ok {
+		e[field] = msg
+	}
+}
+
+// Bind decodes values into the struct pointed to by dst and validates it.
+// A nil result means the payload is valid.
+func Bind(values url.Values, dst interface{}) Errors {
+	rv := reflect.ValueOf(dst)
+	if rv.Kind() != reflect.Pointer || rv.Elem().Kind() != reflect.Struct {
+		panic("validation: Bind requires a pointer to a struct")
+	}
+	errs := Errors{}
+	rv = rv.Elem()
+	rt := rv.Type()
+	for i := 0; i < rt.NumField(); i++ {
+		f := rt.Field(i)
+		name := fieldName(f)
+		if name == "" {
+			continue
+		}
+		raw, ok := values[name]
+		if !ok || len(raw) == 0 {
+			continue
+		}
+		if err := setField(rv.Field(i), raw); err != nil {
+			errs.Add(name, err.Error())
+		}
+	}
+	for k, v := range Struct(dst) {
+		errs.Add(k, v)
+	}
+	if len(errs) == 0 {
+		return nil
+	}
+	return errs
+}
+
+// Struct validates an already populated struct (or pointer to one), e.g. a
+// decoded JSON body. Errors use the form name, else the json name.
+// A nil result means the value is valid.
+func Struct(v interface{}) Errors {
+	rv := reflect.Indirect(reflect.ValueOf(v))
+	rt := rv.Type()
+	errs := Errors{}
+	for i := 0; i < rt.NumField(); i++ {
+		f := rt.Field(i)
+		tag := f.Tag.Get("validate")
+		if tag == "" {
+			continue
+		}
+		name := fieldName(f)
+		if name == "" {
+			name, _, _ = strings.Cut(f.Tag.Get("json"), ",")
+		}
+		if name == "" || name == "-" {
+			name = f.Name
+		}
+		checkField(errs, name, rv.Field(i), tag)
+	}
+	if len(errs) == 0 {
+		return nil
+	}
+	return errs
+}
+
+func fieldName(f reflect.StructField) string {
+	if f.PkgPath != "" {
+		return "" // unexported
+	}
+	name, _, _ := strings.Cut(f.Tag.Get("form"), ",")
+	if name == "-" {
+		return ""
+	}
+	return name
+}
+
+func setField(fv reflect.Value, raw []string) error {
+	switch fv.Kind() {
+	case reflect.String:
+		fv.SetString(CleanText(raw[0]))
+	case reflect.Int, reflect.Int64:
+		if raw[0] == "" {
+			return nil
+		}
+		n, err := strconv.ParseInt(strings.TrimSpace(raw[0]), 10, 64)
+		if err != nil {
+			return fmt.Errorf("must be a whole number")
+		}
+		fv.SetInt(n)
+	case reflect.Bool:
+		switch strings.ToLower(raw[0]) {
+		case "1", "true", "on", "yes":
+			fv.SetBool(true)
+		case "", "0", "false", "off", "no":
+			fv.SetBool(false)
+		default:
+			return fmt.Errorf("must be true or false")
+		}
+	case reflect.Slice:
+		out := reflect.MakeSlice(fv.Type(), 0, len(raw))
+		for _, s := range raw {
+			elem := reflect.New(fv.Type().Elem()).Elem()
+			if err := setField(elem, []string{s}); err != nil {
+				return err
+			}
+			out = reflect.Append(out, elem)
+		}
+		fv.Set(out)
+	default:
+		panic("validation: unsupported field kind " + fv.Kind().String())
+	}
+	return nil
+}
+
+func checkField(errs Errors, name string, fv reflect.Value, tag string) {
+	for _, rule := range strings.Split(tag, ",") {
+		key, arg, _ := strings.Cut(strings.TrimSpace(rule), "=")
+		switch key {
+		case "required":
+			if fv.IsZero() || (fv.Kind() == reflect.String && strings.TrimSpace(fv.String()) == "") ||
+				(fv.Kind() == reflect.Slice && fv.Len() == 0) {
+				errs.Add(name, "is required")
+				return
+			}
+		case "min", "max":
+			limit, err := strconv.Atoi(arg)
+			if err != nil {
+				panic("validation: bad " + key + " argument " + strconv.Quote(arg))
+			}
+			if msg := checkBound(fv, key, limit); msg != "" && !fv.IsZero() {
+				errs.Add(name, msg)
+				return
+			}
+		case "oneof":
+			if fv.Kind() != reflect.String || fv.String() == "" {
+				continue
+			}
+			options := strings.Fields(arg)
+			found := false
+			for _, o := range options {
+				if fv.String() == o {
+					found = true
+					break
+				}
+			}
+			if !found {
+				errs.Add(name, "must be one of: "+strings.Join(options, ", "))
+				return
+			}
+		default:
+			panic("validation: unknown rule " + strconv.Quote(key))
+		}
+	}
+}
+
+func checkBound(fv reflect.Value, key string, limit int) string {
+	var n int
+	var unit string
+	switch fv.Kind() {
+	case reflect.String:
+		n, unit = Length(fv.String()), " characters"
+	case reflect.Slice:
+		n, unit = fv.Len(), " items"
+	case reflect.Int, reflect.Int64:
+		n = int(fv.Int())
+	default:
+		return ""
+	}
+	if key == "min" && n < limit {
+		if unit == "" {
+			return fmt.Sprintf("must be at least %d", limit)
+		}
+		return fmt.Sprintf("must be at least %d%s", limit, unit)
+	}
+	if key == "max" && n > limit {
+		if unit == "" {
+			return fmt.Sprintf("must be at most %d", limit)
+		}
+		return fmt.Sprintf("must be at most %d%s", limit, unit)
+	}
+	return ""
+}
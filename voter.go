@@ -0,0 +1,76 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"net/http"
+	"regexp"
+	"time"
+)
+
+const voterCookieName = "macurate_voter"
+
+var voterIDRe = regexp.MustCompile(`^[0-9a-f]{32}$`)
+
+// Read the voter identity cookie without issuing one; "" when absent or
+// not consented to
+func currentVoterID(r *http.Request) string {
+	id, ok := readCookie(r, voterCookieName)
+	if !ok || !voterIDRe.MatchString(id) || !trackingAllowed(r) {
+		return ""
+	}
+	return id
+}
+
+// Return the voter identity for this browser, issuing a new random one if
+// needed. errConsentRequired when the visitor hasn't accepted the cookie.
+func ensureVoterID(w http.ResponseWriter, r *http.Request) (string, error) {
+	if id := currentVoterID(r); id != "" {
+		return id, nil
+	}
+	if !trackingAllowed(r) {
+		return "", errConsentRequired
+	}
+	id, err := newVoterID()
+	if err != nil {
+		return "", err
+	}
+	http.SetCookie(w, newCookie(r, voterCookieName, id, time.Now().AddDate(1, 0, 0)))
+	return id, nil
+}
+
+func newVoterID() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// The voter's most recent vote direction per person ("up" or "down")
+func voterLatestVotes(ctx context.Context, voterID string) (map[int]string, error) {
+	rows, err := db.QueryContext(ctx, `
+        SELECT DISTINCT ON (person_id) person_id, upvote
+        FROM votes WHERE voter_id = $1 AND upvote IS NOT NULL
+        ORDER BY person_id, id DESC`, voterID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	votes := map[int]string{}
+	for rows.Next() {
+		var personID int
+		var up bool
+		if err := rows.Scan(&personID, &up); err != nil {
+			return nil, err
+		}
+		if up {
+			votes[personID] = "up"
+		} else {
+			votes[personID] = "down"
+		}
+	}
+	return votes, rows.Err()
+}
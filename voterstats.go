@@ -0,0 +1,140 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"time"
+)
+
+// Participation stats for the voter behind the cookie, and the badges
+// they earn with them. Everything is worked out from what the voter did
+// (votes, star ratings, duels), so there's nothing to keep in sync; undone
+// votes don't count, votes set aside by a season close still do. Days are
+// UTC days, and a streak is still running if the voter was active today
+// or yesterday.
+
+// VoterStats is one voter's participation.
+type VoterStats struct {
+	Votes         int        `json:"votes"`
+	Comments      int        `json:"comments"`
+	Ratings       int        `json:"ratings"`
+	Duels         int        `json:"duels"`
+	DaysActive    int        `json:"days_active"`
+	CurrentStreak int        `json:"current_streak"` // days in a row, up to today or yesterday
+	LongestStreak int        `json:"longest_streak"`
+	FirstActive   *time.Time `json:"first_active"`
+	LastActive    *time.Time `json:"last_active"`
+}
+
+// VoterBadge is a participation badge and whether the voter has it.
+type VoterBadge struct {
+	ID          string `json:"id"`
+	Name        string `json:"name"`
+	Description string `json:"description"`
+	Earned      bool   `json:"earned"`
+	Progress    int    `json:"progress"` // towards Goal
+	Goal        int    `json:"goal"`
+}
+
+// Badges in the order they're listed; each counts one stat towards a goal
+var voterBadges = []struct {
+	id, name, description string
+	goal                  int
+	stat                  func(VoterStats) int
+}{
+	{"first_vote", "First vote", "Cast a vote", 1, func(s VoterStats) int { return s.Votes }},
+	{"regular", "Regular", "Take part on 5 different days", 5, func(s VoterStats) int { return s.DaysActive }},
+	{"streak_3", "On a roll", "Take part 3 days in a row", 3, func(s VoterStats) int { return s.LongestStreak }},
+	{"streak_7", "Week streak", "Take part 7 days in a row", 7, func(s VoterStats) int { return s.LongestStreak }},
+	{"commentator", "Commentator", "Write 10 comments", 10, func(s VoterStats) int { return s.Comments }},
+	{"critic", "Critic", "Give 10 star ratings", 10, func(s VoterStats) int { return s.Ratings }},
+	{"duelist", "Duelist", "Judge 25 duels", 25, func(s VoterStats) int { return s.Duels }},
+	{"century", "Century", "Cast 100 votes", 100, func(s VoterStats) int { return s.Votes }},
+}
+
+func earnedVoterBadges(s VoterStats) []VoterBadge {
+	badges := make([]VoterBadge, 0, len(voterBadges))
+	for _, b := range voterBadges {
+		n := b.stat(s)
+		badges = append(badges, VoterBadge{
+			ID: b.id, Name: b.name, Description: b.description,
+			Earned: n >= b.goal, Progress: min(n, b.goal), Goal: b.goal,
+		})
+	}
+	return badges
+}
+
+func queryVoterStats(ctx context.Context, voterID string, now time.Time) (VoterStats, error) {
+	var s VoterStats
+	err := db.QueryRowContext(ctx, `
+        SELECT COUNT(*) FILTER (WHERE status <> $2),
+               COUNT(*) FILTER (WHERE status NOT IN ($2, 'rejected') AND COALESCE(TRIM(comment), '') <> ''),
+               (SELECT COUNT(*) FROM ratings WHERE voter_id = $1),
+               (SELECT COUNT(*) FROM duels WHERE voter_id = $1)
+        FROM votes WHERE voter_id = $1`, voterID, commentRetracted).
+		Scan(&s.Votes, &s.Comments, &s.Ratings, &s.Duels)
+	if err != nil {
+		return s, err
+	}
+
+	rows, err := db.QueryContext(ctx, `
+        SELECT DISTINCT (created_at AT TIME ZONE 'UTC')::date AS day FROM (
+            SELECT created_at FROM votes WHERE voter_id = $1 AND status <> $2
+            UNION ALL SELECT created_at FROM ratings WHERE voter_id = $1
+            UNION ALL SELECT created_at FROM duels WHERE voter_id = $1
+        ) a
+        ORDER BY day`, voterID, commentRetracted)
+	if err != nil {
+		return s, err
+	}
+	defer rows.Close()
+	var days []time.Time
+	for rows.Next() {
+		var d time.Time
+		if err := rows.Scan(&d); err != nil {
+			return s, err
+		}
+		days = append(days, d)
+	}
+	if err := rows.Err(); err != nil {
+		return s, err
+	}
+	if len(days) == 0 {
+		return s, nil
+	}
+
+	s.DaysActive = len(days)
+	s.FirstActive, s.LastActive = &days[0], &days[len(days)-1]
+	run := 0
+	for i, d := range days {
+		if i > 0 && d.Sub(days[i-1]) == 24*time.Hour {
+			run++
+		} else {
+			run = 1
+		}
+		s.LongestStreak = max(s.LongestStreak, run)
+	}
+	today := now.UTC().Truncate(24 * time.Hour)
+	if last := days[len(days)-1]; !last.Before(today.AddDate(0, 0, -1)) {
+		s.CurrentStreak = run
+	}
+	return s, nil
+}
+
+// GET /api/me/stats: the calling voter's participation and badges; all
+// zeros without a voter cookie
+func apiMyStatsHandler(w http.ResponseWriter, r *http.Request) {
+	var stats VoterStats
+	if voterID := currentVoterID(r); voterID != "" {
+		var err error
+		if stats, err = queryVoterStats(r.Context(), voterID, time.Now()); err != nil {
+			serverError(w, r, err)
+			return
+		}
+	}
+	w.Header().Set("Cache-Control", "no-store")
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"stats":  stats,
+		"badges": earnedVoterBadges(stats),
+	})
+}
@@ -0,0 +1,337 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+
+	"macurate/validation"
+)
+
+// Outgoing webhooks for other systems (analytics, chat bots): each one gets
+// a signed POST for the events it picked. Unlike the per-person digests in
+// notify.go these fire per event. Deliveries are queued in the database and
+// sent by a background worker, so a slow or dead receiver never holds up a
+// vote; failures are retried with exponential backoff, webhookMaxAttempts
+// times in all.
+//
+// The body is {"id", "event", "created_at", "data"}. X-Macurate-Signature
+// is "sha256=" and the hex HMAC-SHA256, keyed with the webhook's secret, of
+// X-Macurate-Timestamp, a dot and the body. Receivers should check it and
+// reject stale timestamps; the id repeats on a retry.
+
+// Event types a webhook can subscribe to
+const (
+	webhookVoteCreated      = "vote.created"
+	webhookVoteUndone       = "vote.undone"
+	webhookCommentPublished = "comment.published"
+)
+
+var webhookEvents = []string{webhookVoteCreated, webhookVoteUndone, webhookCommentPublished}
+
+const (
+	webhookMaxAttempts = 10
+	webhookBatch       = 50
+	webhookRetention   = 7 * 24 * time.Hour // delivered or abandoned deliveries are kept this long
+)
+
+var webhookClient = &http.Client{Timeout: 10 * time.Second}
+
+// Webhook is a receiver and the events it wants, with its recent record.
+type Webhook struct {
+	ID        int
+	URL       string
+	Secret    string
+	Events    []string
+	CreatedAt time.Time
+	Pending   int
+	Failed    int
+	LastError string
+}
+
+// Vote payloads; names follow the public API
+type webhookVote struct {
+	VoteID     int    `json:"vote_id"`
+	PublicID   string `json:"public_id"` // the person voted on
+	Upvote     bool   `json:"upvote"`
+	HasComment bool   `json:"has_comment"`
+	VoterName  string `json:"voter_name,omitempty"`
+	Source     string `json:"source"` // "web" or "email"
+}
+
+type webhookComment struct {
+	VoteID   int    `json:"vote_id"`
+	PublicID string `json:"public_id"` // the person commented on
+	Upvote   bool   `json:"upvote"`
+	Text     string `json:"text"`
+	Author   string `json:"author,omitempty"`
+	Edited   bool   `json:"edited,omitempty"` // a new text for a comment published before
+}
+
+func createWebhookTables() error {
+	_, err := db.Exec(`
+    CREATE TABLE IF NOT EXISTS webhooks (
+        id SERIAL PRIMARY KEY,
+        url TEXT NOT NULL,
+        secret TEXT NOT NULL,
+        events TEXT[] NOT NULL,
+        created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+    );
+    CREATE TABLE IF NOT EXISTS webhook_deliveries (
+        id BIGSERIAL PRIMARY KEY,
+        webhook_id INTEGER NOT NULL REFERENCES webhooks(id) ON DELETE CASCADE,
+        event TEXT NOT NULL,
+        payload JSONB NOT NULL,
+        attempts INTEGER NOT NULL DEFAULT 0,
+        next_attempt_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+        delivered_at TIMESTAMPTZ,
+        abandoned_at TIMESTAMPTZ,
+        last_error TEXT NOT NULL DEFAULT '',
+        created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+    );
+    CREATE INDEX IF NOT EXISTS webhook_deliveries_due_idx
+        ON webhook_deliveries (next_attempt_at) WHERE delivered_at IS NULL AND abandoned_at IS NULL;
+    `)
+	return err
+}
+
+func listWebhooks(ctx context.Context) ([]Webhook, error) {
+	rows, err := db.QueryContext(ctx, `
+        SELECT w.id, w.url, w.secret, w.events, w.created_at,
+               COUNT(d.id) FILTER (WHERE d.delivered_at IS NULL AND d.abandoned_at IS NULL),
+               COUNT(d.id) FILTER (WHERE d.abandoned_at IS NOT NULL),
+               COALESCE((SELECT last_error FROM webhook_deliveries
+                         WHERE webhook_id = w.id AND last_error <> '' ORDER BY id DESC LIMIT 1), '')
+        FROM webhooks w LEFT JOIN webhook_deliveries d ON d.webhook_id = w.id
+        GROUP BY w.id
+        ORDER BY w.id`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var list []Webhook
+	for rows.Next() {
+		var h Webhook
+		if err := rows.Scan(&h.ID, &h.URL, &h.Secret, pq.Array(&h.Events), &h.CreatedAt, &h.Pending, &h.Failed, &h.LastError); err != nil {
+			return nil, err
+		}
+		list = append(list, h)
+	}
+	return list, rows.Err()
+}
+
+// Queue an event for every webhook that wants it. Like events.publish this
+// runs after the change is committed, and a failure is logged rather than
+// failing the request.
+func queueWebhooks(event string, data interface{}) {
+	payload, err := json.Marshal(data)
+	if err == nil {
+		ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+		defer cancel()
+		_, err = db.ExecContext(ctx, `
+            INSERT INTO webhook_deliveries (webhook_id, event, payload)
+            SELECT id, $1, $2 FROM webhooks WHERE $1 = ANY(events)`, event, payload)
+	}
+	if err != nil {
+		slog.Error("webhook queue failed", "event", event, "err", err)
+	}
+}
+
+// Background loop sending queued deliveries
+func startWebhookWorker() {
+	go func() {
+		for range time.Tick(5 * time.Second) {
+			if err := runExclusive("webhooks", deliverDueWebhooks); err != nil {
+				slog.Error("webhooks", "err", err)
+			}
+		}
+	}()
+}
+
+// Wait before the next try after n failed attempts: 30s, 1m, 2m, ... up to 6h
+func webhookBackoff(n int) time.Duration {
+	d := 30 * time.Second
+	for i := 1; i < n && d < 6*time.Hour; i++ {
+		d *= 2
+	}
+	return min(d, 6*time.Hour)
+}
+
+func deliverDueWebhooks() error {
+	if _, err := db.Exec(`
+        DELETE FROM webhook_deliveries
+        WHERE COALESCE(delivered_at, abandoned_at) < $1`, time.Now().Add(-webhookRetention)); err != nil {
+		return err
+	}
+
+	rows, err := db.Query(`
+        SELECT d.id, d.event, d.payload, d.attempts, d.created_at, w.url, w.secret
+        FROM webhook_deliveries d JOIN webhooks w ON w.id = d.webhook_id
+        WHERE d.delivered_at IS NULL AND d.abandoned_at IS NULL AND d.next_attempt_at <= NOW()
+        ORDER BY d.next_attempt_at
+        LIMIT $1`, webhookBatch)
+	if err != nil {
+		return err
+	}
+	type due struct {
+		id          int64
+		event       string
+		payload     json.RawMessage
+		attempts    int
+		createdAt   time.Time
+		url, secret string
+	}
+	var list []due
+	for rows.Next() {
+		var d due
+		if err := rows.Scan(&d.id, &d.event, &d.payload, &d.attempts, &d.createdAt, &d.url, &d.secret); err != nil {
+			rows.Close()
+			return err
+		}
+		list = append(list, d)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for _, d := range list {
+		err := sendWebhook(d.url, d.secret, d.id, d.event, d.payload, d.createdAt)
+		metrics.observeDelivery("event_webhook", err)
+		if err == nil {
+			if _, err := db.Exec("UPDATE webhook_deliveries SET delivered_at = NOW(), attempts = attempts + 1, last_error = '' WHERE id = $1", d.id); err != nil {
+				return err
+			}
+			continue
+		}
+		attempts := d.attempts + 1
+		slog.Warn("webhook delivery failed", "delivery", d.id, "event", d.event, "attempt", attempts, "err", err)
+		if _, err := db.Exec(`
+            UPDATE webhook_deliveries
+            SET attempts = $2, last_error = $3, next_attempt_at = NOW() + $4 * INTERVAL '1 second',
+                abandoned_at = CASE WHEN $2 >= $5 THEN NOW() END
+            WHERE id = $1`,
+			d.id, attempts, truncate(err.Error(), 500), int(webhookBackoff(attempts).Seconds()), webhookMaxAttempts); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func sendWebhook(url, secret string, id int64, event string, payload json.RawMessage, createdAt time.Time) error {
+	body, err := json.Marshal(map[string]interface{}{
+		"id":         id,
+		"event":      event,
+		"created_at": createdAt.UTC(),
+		"data":       payload,
+	})
+	if err != nil {
+		return err
+	}
+	ts := strconv.FormatInt(time.Now().Unix(), 10)
+	req, err := http.NewRequest(http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "macurate-webhooks")
+	req.Header.Set("X-Macurate-Event", event)
+	req.Header.Set("X-Macurate-Delivery", strconv.FormatInt(id, 10))
+	req.Header.Set("X-Macurate-Timestamp", ts)
+	req.Header.Set("X-Macurate-Signature", "sha256="+webhookSignature(secret, ts, body))
+	resp, err := webhookClient.Do(req)
+	if err != nil {
+		return err
+	}
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 4096))
+	resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("webhook returned %s", resp.Status)
+	}
+	return nil
+}
+
+func webhookSignature(secret, ts string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(ts))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func truncate(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	return s[:n]
+}
+
+// Create or delete a webhook (admin-only). The secret is generated here
+// and shown on the admin page for the receiver's configuration.
+func adminWebhooksHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if !adminAuthorized(r) {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	var req adminWebhookRequest
+	if errs := bindAdminForm(r, &req); errs != nil {
+		renderAdmin(w, r, errs)
+		return
+	}
+
+	switch req.Action {
+	case "create":
+		if !strings.HasPrefix(req.URL, "https://") && !strings.HasPrefix(req.URL, "http://") {
+			renderAdmin(w, r, validation.Errors{"hook_url": "must be an http(s) URL"})
+			return
+		}
+		if len(req.Events) == 0 {
+			renderAdmin(w, r, validation.Errors{"hook_events": "pick at least one"})
+			return
+		}
+		for _, e := range req.Events {
+			if !slices.Contains(webhookEvents, e) {
+				renderAdmin(w, r, validation.Errors{"hook_events": "must be among: " + strings.Join(webhookEvents, ", ")})
+				return
+			}
+		}
+		b := make([]byte, 24)
+		if _, err := rand.Read(b); err != nil {
+			serverError(w, r, err)
+			return
+		}
+		if _, err := db.ExecContext(r.Context(),
+			"INSERT INTO webhooks (url, secret, events) VALUES ($1, $2, $3)",
+			req.URL, "whsec_"+hex.EncodeToString(b), pq.Array(req.Events),
+		); err != nil {
+			serverError(w, r, err)
+			return
+		}
+	case "delete":
+		if _, err := db.ExecContext(r.Context(), "DELETE FROM webhooks WHERE id = $1", req.ID); err != nil {
+			serverError(w, r, err)
+			return
+		}
+	}
+
+	http.Redirect(w, r, "/admin", http.StatusSeeOther)
+}
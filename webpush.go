@@ -0,0 +1,511 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ecdh"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math/big"
+	"net"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"os"
+	"strings"
+	"syscall"
+	"time"
+	"unicode/utf8"
+
+	"macurate/validation"
+)
+
+// Web Push: voters follow people and get a browser notification when
+// something happens to them. Subscriptions and follows hang off the voter
+// cookie. Payloads are encrypted per RFC 8291 (aes128gcm) and requests are
+// signed with VAPID (RFC 8292).
+//
+// VAPID_PUBLIC_KEY / VAPID_PRIVATE_KEY (base64url, as printed by
+// `macurate vapid-keys`) enable it; VAPID_SUBJECT is a mailto: or https:
+// contact for push services. PUSH_EVENTS picks what is pushed: "comment"
+// (default), "vote" and/or "milestone", comma separated.
+
+// Subscription endpoints must be on one of the browsers' push services, so
+// anyone registering a subscription can't make the server POST to a URL of
+// their choosing. The dialer also refuses non-public addresses, in case one
+// of these names ever resolves somewhere it shouldn't. A leading dot
+// matches any subdomain.
+var pushServiceHosts = []string{
+	"fcm.googleapis.com",                // Chrome, Edge, Opera
+	"android.googleapis.com",            // older Chrome subscriptions
+	"updates.push.services.mozilla.com", // Firefox
+	".push.apple.com",                   // Safari
+	".notify.windows.com",               // legacy Edge
+}
+
+var pushClient = &http.Client{
+	Timeout: 10 * time.Second,
+	Transport: &http.Transport{
+		DialContext:         (&net.Dialer{Timeout: 5 * time.Second, Control: refuseNonPublicDial}).DialContext,
+		TLSHandshakeTimeout: 5 * time.Second,
+		MaxIdleConnsPerHost: 4,
+	},
+}
+
+// Whether endpoint is an https URL on a known push service
+func pushEndpointAllowed(endpoint string) bool {
+	u, err := url.Parse(endpoint)
+	if err != nil || u.Scheme != "https" || u.User != nil || u.Port() != "" && u.Port() != "443" {
+		return false
+	}
+	host := strings.ToLower(u.Hostname())
+	for _, h := range pushServiceHosts {
+		if host == h || strings.HasPrefix(h, ".") && strings.HasSuffix(host, h) {
+			return true
+		}
+	}
+	return false
+}
+
+// net.Dialer Control: connect only to public unicast addresses
+func refuseNonPublicDial(network, address string, _ syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	ip, err := netip.ParseAddr(host)
+	if err != nil {
+		return err
+	}
+	ip = ip.Unmap()
+	if !ip.IsGlobalUnicast() || ip.IsPrivate() || ip.IsLoopback() || ip.IsLinkLocalUnicast() {
+		return fmt.Errorf("push: refusing to connect to %s", ip)
+	}
+	return nil
+}
+
+var b64 = base64.RawURLEncoding
+
+type vapidKeys struct {
+	private *ecdsa.PrivateKey
+	public  string // base64url uncompressed point, handed to browsers
+	subject string
+}
+
+var vapid *vapidKeys
+
+func loadVAPIDKeys() error {
+	pub, priv := os.Getenv("VAPID_PUBLIC_KEY"), os.Getenv("VAPID_PRIVATE_KEY")
+	if pub == "" && priv == "" {
+		return nil
+	}
+	d, err := b64.DecodeString(priv)
+	if err != nil || len(d) != 32 {
+		return errors.New("VAPID_PRIVATE_KEY: must be a base64url 32-byte P-256 key")
+	}
+	ek, err := ecdh.P256().NewPrivateKey(d)
+	if err != nil {
+		return fmt.Errorf("VAPID_PRIVATE_KEY: %w", err)
+	}
+	if b64.EncodeToString(ek.PublicKey().Bytes()) != pub {
+		return errors.New("VAPID_PUBLIC_KEY: does not match VAPID_PRIVATE_KEY")
+	}
+	raw := ek.PublicKey().Bytes()
+	key := &ecdsa.PrivateKey{
+		PublicKey: ecdsa.PublicKey{Curve: elliptic.P256(), X: new(big.Int).SetBytes(raw[1:33]), Y: new(big.Int).SetBytes(raw[33:])},
+		D:         new(big.Int).SetBytes(d),
+	}
+	subject := os.Getenv("VAPID_SUBJECT")
+	if subject == "" {
+		subject = "mailto:admin@localhost"
+	}
+	vapid = &vapidKeys{private: key, public: pub, subject: subject}
+	return nil
+}
+
+// macurate vapid-keys: print a fresh key pair for the environment.
+func runVAPIDKeys() error {
+	k, err := ecdh.P256().GenerateKey(rand.Reader)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("VAPID_PUBLIC_KEY=%s\nVAPID_PRIVATE_KEY=%s\n", b64.EncodeToString(k.PublicKey().Bytes()), b64.EncodeToString(k.Bytes()))
+	return nil
+}
+
+func pushEventEnabled(kind string) bool {
+	list := os.Getenv("PUSH_EVENTS")
+	if list == "" {
+		list = "comment"
+	}
+	for _, k := range strings.Split(list, ",") {
+		if strings.TrimSpace(k) == kind {
+			return true
+		}
+	}
+	return false
+}
+
+func createPushTables() error {
+	_, err := db.Exec(`
+    CREATE TABLE IF NOT EXISTS push_subscriptions (
+        id SERIAL PRIMARY KEY,
+        voter_id TEXT NOT NULL,
+        endpoint TEXT NOT NULL UNIQUE,
+        p256dh TEXT NOT NULL,
+        auth TEXT NOT NULL,
+        created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+    );
+    CREATE INDEX IF NOT EXISTS push_subscriptions_voter_idx ON push_subscriptions (voter_id);
+    CREATE TABLE IF NOT EXISTS follows (
+        voter_id TEXT NOT NULL,
+        person_id INTEGER NOT NULL REFERENCES people(id) ON DELETE CASCADE,
+        created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+        PRIMARY KEY (voter_id, person_id)
+    );
+    CREATE INDEX IF NOT EXISTS follows_person_idx ON follows (person_id);
+    `)
+	return err
+}
+
+func hkdfExpand(prk, info []byte, n int) []byte {
+	mac := hmac.New(sha256.New, prk)
+	mac.Write(info)
+	mac.Write([]byte{1})
+	return mac.Sum(nil)[:n]
+}
+
+func hkdfExtract(salt, ikm []byte) []byte {
+	mac := hmac.New(sha256.New, salt)
+	mac.Write(ikm)
+	return mac.Sum(nil)
+}
+
+// RFC 8291 message encryption, one record.
+func encryptPushPayload(p256dh, authSecret string, payload []byte) ([]byte, error) {
+	uaRaw, err := b64.DecodeString(strings.TrimRight(p256dh, "="))
+	if err != nil {
+		return nil, err
+	}
+	auth, err := b64.DecodeString(strings.TrimRight(authSecret, "="))
+	if err != nil {
+		return nil, err
+	}
+	uaPub, err := ecdh.P256().NewPublicKey(uaRaw)
+	if err != nil {
+		return nil, err
+	}
+	asKey, err := ecdh.P256().GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	shared, err := asKey.ECDH(uaPub)
+	if err != nil {
+		return nil, err
+	}
+	asRaw := asKey.PublicKey().Bytes()
+
+	keyInfo := append(append([]byte("WebPush: info\x00"), uaRaw...), asRaw...)
+	ikm := hkdfExpand(hkdfExtract(auth, shared), keyInfo, 32)
+
+	salt := make([]byte, 16)
+	if _, err := rand.Read(salt); err != nil {
+		return nil, err
+	}
+	prk := hkdfExtract(salt, ikm)
+	cek := hkdfExpand(prk, []byte("Content-Encoding: aes128gcm\x00"), 16)
+	nonce := hkdfExpand(prk, []byte("Content-Encoding: nonce\x00"), 12)
+
+	block, err := aes.NewCipher(cek)
+	if err != nil {
+		return nil, err
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	// 0x02 marks the last (only) record
+	sealed := gcm.Seal(nil, nonce, append(payload, 2), nil)
+
+	var body bytes.Buffer
+	body.Write(salt)
+	binary.Write(&body, binary.BigEndian, uint32(4096))
+	body.WriteByte(byte(len(asRaw)))
+	body.Write(asRaw)
+	body.Write(sealed)
+	return body.Bytes(), nil
+}
+
+// VAPID JWT for the push service's origin, valid for 12 hours
+func vapidAuthorization(endpoint string) (string, error) {
+	u, err := url.Parse(endpoint)
+	if err != nil {
+		return "", err
+	}
+	header := b64.EncodeToString([]byte(`{"typ":"JWT","alg":"ES256"}`))
+	claims, err := json.Marshal(map[string]interface{}{
+		"aud": u.Scheme + "://" + u.Host,
+		"exp": time.Now().Add(12 * time.Hour).Unix(),
+		"sub": vapid.subject,
+	})
+	if err != nil {
+		return "", err
+	}
+	signing := header + "." + b64.EncodeToString(claims)
+	digest := sha256.Sum256([]byte(signing))
+	r, s, err := ecdsa.Sign(rand.Reader, vapid.private, digest[:])
+	if err != nil {
+		return "", err
+	}
+	sig := make([]byte, 64)
+	r.FillBytes(sig[:32])
+	s.FillBytes(sig[32:])
+	return "vapid t=" + signing + "." + b64.EncodeToString(sig) + ", k=" + vapid.public, nil
+}
+
+type pushSubscription struct {
+	ID                     int
+	Endpoint, P256dh, Auth string
+}
+
+var errPushGone = errors.New("push subscription expired")
+
+func sendPush(sub pushSubscription, payload []byte) error {
+	if !pushEndpointAllowed(sub.Endpoint) {
+		return errPushGone // stored before endpoints were checked
+	}
+	body, err := encryptPushPayload(sub.P256dh, sub.Auth, payload)
+	if err != nil {
+		return err
+	}
+	authz, err := vapidAuthorization(sub.Endpoint)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest(http.MethodPost, sub.Endpoint, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Encoding", "aes128gcm")
+	req.Header.Set("Content-Type", "application/octet-stream")
+	req.Header.Set("TTL", "86400")
+	req.Header.Set("Authorization", authz)
+	resp, err := pushClient.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	switch {
+	case resp.StatusCode == http.StatusNotFound || resp.StatusCode == http.StatusGone:
+		return errPushGone
+	case resp.StatusCode >= 300:
+		return fmt.Errorf("push service returned %s", resp.Status)
+	}
+	return nil
+}
+
+// Push to everyone following personID, if that kind of event is enabled.
+// Runs in the background after the triggering request has committed.
+func notifyFollowers(personID int, kind, title, body string) {
+	if vapid == nil || !pushEventEnabled(kind) {
+		return
+	}
+	rows, err := db.Query(`
+        SELECT s.id, s.endpoint, s.p256dh, s.auth
+        FROM follows f JOIN push_subscriptions s ON s.voter_id = f.voter_id
+        WHERE f.person_id = $1`, personID)
+	if err != nil {
+		slog.Error("webpush", "err", err)
+		return
+	}
+	var subs []pushSubscription
+	for rows.Next() {
+		var s pushSubscription
+		if err := rows.Scan(&s.ID, &s.Endpoint, &s.P256dh, &s.Auth); err != nil {
+			slog.Error("webpush", "err", err)
+			rows.Close()
+			return
+		}
+		subs = append(subs, s)
+	}
+	rows.Close()
+
+	if utf8.RuneCountInString(body) > 140 {
+		body = string([]rune(body)[:139]) + "…"
+	}
+	payload, _ := json.Marshal(map[string]string{"title": title, "body": body, "url": "/"})
+	for _, s := range subs {
+		err := sendPush(s, payload)
+		metrics.observeDelivery("webpush", err)
+		if err == errPushGone {
+			if _, err := db.Exec("DELETE FROM push_subscriptions WHERE id = $1", s.ID); err != nil {
+				slog.Error("webpush", "err", err)
+			}
+		} else if err != nil {
+			slog.Error("webpush", "err", err)
+		}
+	}
+}
+
+// Pushes for a new vote: a comment notification when there is text (and
+// it's published), otherwise a plain vote notification.
+func pushVote(personID int, up bool, comment, status string) {
+	p, err := queryPerson(context.Background(), personID)
+	if err != nil {
+		slog.Error("webpush", "err", err)
+		return
+	}
+	if comment != "" && status == commentApproved {
+		notifyFollowers(personID, "comment", p.Name+" got a new comment", comment)
+		return
+	}
+	if !publicDisplayOptions().ShowScores {
+		return // the direction would give hidden scores away
+	}
+	direction := "an upvote"
+	if !up {
+		direction = "a downvote"
+	}
+	notifyFollowers(personID, "vote", p.Name+" got "+direction, "")
+}
+
+// GET /api/push/key: the VAPID public key for PushManager.subscribe
+func apiPushKeyHandler(w http.ResponseWriter, r *http.Request) {
+	if vapid == nil {
+		writeError(w, http.StatusNotFound, "not_configured", "Push notifications are not configured")
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{"public_key": vapid.public})
+}
+
+// POST /api/push/subscribe (endpoint, p256dh, auth) stores the browser's
+// subscription for the current voter; POST /api/push/unsubscribe removes it.
+func apiPushSubscribeHandler(w http.ResponseWriter, r *http.Request) {
+	if vapid == nil {
+		writeError(w, http.StatusNotFound, "not_configured", "Push notifications are not configured")
+		return
+	}
+	var req pushSubscribeRequest
+	if !bindForm(w, r, &req) {
+		return
+	}
+	if !pushEndpointAllowed(req.Endpoint) {
+		writeValidationError(w, validation.Errors{"endpoint": "must be an https URL on a browser push service"})
+		return
+	}
+	voterID, err := ensureVoterID(w, r)
+	if err == errConsentRequired {
+		writeConsentRequired(w)
+		return
+	} else if err != nil {
+		serverError(w, r, err)
+		return
+	}
+	// A subscription stays with the voter who registered it; sending its
+	// endpoint again only refreshes the keys
+	res, err := db.ExecContext(r.Context(), `
+        INSERT INTO push_subscriptions (voter_id, endpoint, p256dh, auth) VALUES ($1, $2, $3, $4)
+        ON CONFLICT (endpoint) DO UPDATE SET p256dh = EXCLUDED.p256dh, auth = EXCLUDED.auth
+        WHERE push_subscriptions.voter_id = EXCLUDED.voter_id`,
+		voterID, req.Endpoint, req.P256dh, req.Auth)
+	if err != nil {
+		serverError(w, r, err)
+		return
+	}
+	if n, err := res.RowsAffected(); err == nil && n == 0 {
+		writeError(w, http.StatusConflict, "conflict", "This subscription belongs to another voter")
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func apiPushUnsubscribeHandler(w http.ResponseWriter, r *http.Request) {
+	var req pushUnsubscribeRequest
+	if !bindForm(w, r, &req) {
+		return
+	}
+	if _, err := db.ExecContext(r.Context(), "DELETE FROM push_subscriptions WHERE endpoint = $1 AND voter_id = $2",
+		req.Endpoint, currentVoterID(r)); err != nil {
+		serverError(w, r, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// POST/DELETE /api/people/{id}/follow
+func apiFollowHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := resolvePersonRef(r.Context(), r.PathValue("id"))
+	if err == errUnknownPerson {
+		writeError(w, http.StatusBadRequest, "invalid_id", "Invalid id")
+		return
+	} else if err != nil {
+		serverError(w, r, err)
+		return
+	}
+	voterID, err := ensureVoterID(w, r)
+	if err == errConsentRequired {
+		writeConsentRequired(w)
+		return
+	} else if err != nil {
+		serverError(w, r, err)
+		return
+	}
+	if r.Method == http.MethodDelete {
+		_, err = db.ExecContext(r.Context(), "DELETE FROM follows WHERE voter_id = $1 AND person_id = $2", voterID, id)
+	} else {
+		var exists bool
+		if err := db.QueryRowContext(r.Context(), "SELECT EXISTS (SELECT 1 FROM people WHERE id = $1)", id).Scan(&exists); err != nil {
+			serverError(w, r, err)
+			return
+		} else if !exists {
+			writeError(w, http.StatusNotFound, "not_found", "Person not found")
+			return
+		}
+		_, err = db.ExecContext(r.Context(), "INSERT INTO follows (voter_id, person_id) VALUES ($1, $2) ON CONFLICT DO NOTHING", voterID, id)
+	}
+	if err != nil {
+		serverError(w, r, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// GET /api/follows: public ids of the people the current voter follows
+func apiFollowsHandler(w http.ResponseWriter, r *http.Request) {
+	publicIDs := []string{}
+	if voterID := currentVoterID(r); voterID != "" {
+		rows, err := db.QueryContext(r.Context(), `
+            SELECT COALESCE(p.public_id, '')
+            FROM follows f JOIN people p ON p.id = f.person_id
+            WHERE f.voter_id = $1 ORDER BY f.person_id`, voterID)
+		if err != nil {
+			serverError(w, r, err)
+			return
+		}
+		defer rows.Close()
+		for rows.Next() {
+			var publicID string
+			if err := rows.Scan(&publicID); err != nil {
+				serverError(w, r, err)
+				return
+			}
+			publicIDs = append(publicIDs, publicID)
+		}
+		if err := rows.Err(); err != nil {
+			serverError(w, r, err)
+			return
+		}
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{"public_ids": publicIDs})
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"net/http"
+	"net/url"
+	"time"
+
+	"golang.org/x/net/websocket"
+)
+
+// GET /ws: the /events feed over a WebSocket, one JSON Event per message and
+// a {"kind":"ping"} every eventsHeartbeat. It shares the hub, so the client
+// cap and slow-client handling are the same as for SSE. Browsers may only
+// connect from this site or a CORS_ORIGIN.
+
+// The middleware wraps the writer; websocket.Server needs the connection
+// itself, so dig down to the writer that can hand it over.
+func hijackableWriter(w http.ResponseWriter) http.ResponseWriter {
+	for {
+		if _, ok := w.(http.Hijacker); ok {
+			return w
+		}
+		u, ok := w.(interface{ Unwrap() http.ResponseWriter })
+		if !ok {
+			return w
+		}
+		w = u.Unwrap()
+	}
+}
+
+func wsOriginAllowed(origin *url.URL, r *http.Request) bool {
+	if origin == nil {
+		return true // not a browser
+	}
+	if origin.Host == r.Host {
+		return true
+	}
+	for _, o := range corsOrigins() {
+		if o == origin.Scheme+"://"+origin.Host {
+			return true
+		}
+	}
+	return false
+}
+
+func wsHandler(w http.ResponseWriter, r *http.Request) {
+	ch, unsubscribe, err := events.subscribe()
+	if err == errTooManyClients {
+		w.Header().Set("Retry-After", "30")
+		http.Error(w, "Too many live connections, try again later", http.StatusServiceUnavailable)
+		return
+	}
+	defer unsubscribe()
+
+	srv := websocket.Server{
+		Handshake: func(cfg *websocket.Config, r *http.Request) error {
+			origin, err := websocket.Origin(cfg, r)
+			if err != nil || !wsOriginAllowed(origin, r) {
+				return websocket.ErrBadWebSocketOrigin
+			}
+			return nil
+		},
+		Handler: func(ws *websocket.Conn) { streamWebSocket(ws, ch) },
+	}
+	srv.ServeHTTP(hijackableWriter(w), r)
+}
+
+func streamWebSocket(ws *websocket.Conn, ch chan Event) {
+	defer ws.Close()
+
+	// Nothing is expected from the client; reading just notices it leave
+	gone := make(chan struct{})
+	go func() {
+		defer close(gone)
+		var discard []byte
+		for websocket.Message.Receive(ws, &discard) == nil {
+		}
+	}()
+
+	heartbeat := time.NewTicker(eventsHeartbeat)
+	defer heartbeat.Stop()
+	for {
+		var ev Event
+		select {
+		case <-gone:
+			return
+		case <-heartbeat.C:
+			ev = Event{Kind: "ping", At: time.Now().UTC()}
+		case next, ok := <-ch:
+			if !ok {
+				return
+			}
+			ev = next
+		}
+		ws.SetWriteDeadline(time.Now().Add(eventsWriteTimeout))
+		if err := websocket.JSON.Send(ws, ev); err != nil {
+			return
+		}
+	}
+}